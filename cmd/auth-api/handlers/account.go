@@ -0,0 +1,266 @@
+package handler
+
+import (
+	"archive/zip"
+	"cw1/cmd/auth-api/render"
+	"cw1/internal/audit"
+	"cw1/internal/format"
+	"cw1/internal/robot"
+	"cw1/internal/session"
+	"cw1/internal/user"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type exportProfile struct {
+	ID        int64           `json:"id"`
+	FirstName string          `json:"first_name"`
+	LastName  string          `json:"last_name"`
+	Birthday  *format.Day     `json:"birthday,omitempty"`
+	Email     string          `json:"email"`
+	Role      user.Role       `json:"role"`
+	Verified  bool            `json:"email_verified"`
+	CreatedAt format.NullTime `json:"created_at"`
+	UpdatedAt format.NullTime `json:"updated_at"`
+}
+
+// exportSession doesn't contain the token, it is still valid until it expires.
+type exportSession struct {
+	CreatedAt  time.Time `json:"created_at"`
+	ValidUntil time.Time `json:"valid_until"`
+}
+
+// exportTrades holds totals of a robot, its single deals are in deals.json.
+type exportTrades struct {
+	RobotID       int64               `json:"robot_id"`
+	Ticker        *format.NullString  `json:"ticker,omitempty"`
+	DealsCount    *format.NullInt64   `json:"deals_count,omitempty"`
+	FactYield     *format.NullFloat64 `json:"fact_yield,omitempty"`
+	ActivatedAt   *format.NullTime    `json:"activated_at,omitempty"`
+	DeactivatedAt *format.NullTime    `json:"deactivated_at,omitempty"`
+}
+
+func (h *Handler) exportUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.sessionOwner(w, r)
+	if !ok {
+		return
+	}
+
+	files, err := h.exportFiles(id)
+	if err != nil {
+		h.logger.Errorf("can't export data of user with id: %v: %v", id, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	h.record(r, &audit.Entry{
+		ActorID:    id,
+		Action:     audit.ExportUser,
+		TargetType: audit.TargetUser,
+		TargetID:   id,
+	})
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"user-%d-export.zip\"", id))
+	w.WriteHeader(http.StatusOK)
+
+	err = writeZip(w, files)
+	if err != nil {
+		h.logger.Errorf("can't write export of user with id: %v: %v", id, err)
+	}
+}
+
+type exportFile struct {
+	name string
+	data interface{}
+}
+
+func (h *Handler) exportFiles(id int64) ([]exportFile, error) {
+	u, err := h.userStorage.FindByID(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't find user in storage")
+	}
+
+	rbts, err := h.robotStorage.FindByOwnerID(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't find robots in storage")
+	}
+
+	deals, err := h.robotStorage.FindDealsByOwnerID(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't find deals in storage")
+	}
+
+	sessions, err := h.sessionStorage.FindAllByUserID(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't find sessions in storage")
+	}
+
+	files := []exportFile{
+		{"profile.json", exportProfile{
+			ID:        u.ID,
+			FirstName: u.FirstName,
+			LastName:  u.LastName,
+			Birthday:  u.Birthday,
+			Email:     u.Email,
+			Role:      u.Role,
+			Verified:  u.Verified,
+			CreatedAt: u.CreatedAt,
+			UpdatedAt: u.UpdatedAt,
+		}},
+		{"robots.json", rbts},
+		{"sessions.json", exportSessions(sessions)},
+		{"trades.json", exportRobotTrades(rbts)},
+		{"deals.json", deals},
+	}
+
+	if h.apiKeyStorage != nil {
+		keys, err := h.apiKeyStorage.FindByUserID(id)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't find api keys in storage")
+		}
+
+		files = append(files, exportFile{"api_keys.json", keys})
+	}
+
+	if h.auditStorage != nil {
+		entries, err := h.auditStorage.Find(audit.Filter{UserID: id})
+		if err != nil {
+			return nil, errors.Wrap(err, "can't find audit entries in storage")
+		}
+
+		files = append(files, exportFile{"audit.json", entries})
+	}
+
+	return files, nil
+}
+
+func exportSessions(sessions []*session.Session) []exportSession {
+	res := make([]exportSession, 0, len(sessions))
+
+	for _, s := range sessions {
+		res = append(res, exportSession{CreatedAt: s.CreatedAt, ValidUntil: s.ValidUntil})
+	}
+
+	return res
+}
+
+func exportRobotTrades(rbts []*robot.Robot) []exportTrades {
+	res := make([]exportTrades, 0, len(rbts))
+
+	for _, r := range rbts {
+		res = append(res, exportTrades{
+			RobotID:       r.RobotID,
+			Ticker:        r.Ticker,
+			DealsCount:    r.DealsCount,
+			FactYield:     r.FactYield,
+			ActivatedAt:   r.ActivatedAt,
+			DeactivatedAt: r.DeactivatedAt,
+		})
+	}
+
+	return res
+}
+
+func writeZip(w http.ResponseWriter, files []exportFile) error {
+	zw := zip.NewWriter(w)
+
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return errors.Wrapf(err, "can't create %v in zip", f.name)
+		}
+
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+
+		err = enc.Encode(f.data)
+		if err != nil {
+			return errors.Wrapf(err, "can't write %v in zip", f.name)
+		}
+	}
+
+	return errors.Wrap(zw.Close(), "can't close zip")
+}
+
+// deletionReport tells the user which data is erased with the account and
+// which is kept and why.
+type deletionReport struct {
+	Erased   []string          `json:"erased"`
+	Retained map[string]string `json:"retained"`
+}
+
+var accountDeletion = deletionReport{
+	Erased: []string{"profile", "password", "sessions", "api_keys", "two_factor", "webhooks", "tags",
+		"private_templates", "scheduled_jobs"},
+	Retained: map[string]string{
+		"robots": "robots are deactivated and deleted, their deals are kept until deleted robots are purged " +
+			"and their financial results stay in the history",
+		"global_templates": "templates shared with all users are kept",
+		"audit_log": "entries keep email changes, IP addresses and user agents of requests, " +
+			"the log is chained by hashes and can't be changed",
+	},
+}
+
+// deleteUser erases the account in one transaction: robots of the user are
+// stopped and hidden, personal data, credentials, webhooks, tags, private
+// templates and jobs are removed. The response lists the retained data,
+// robots with their financial results, global templates and the audit log.
+func (h *Handler) deleteUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.sessionOwner(w, r)
+	if !ok {
+		return
+	}
+
+	rbts, err := h.robotStorage.FindByOwnerID(id)
+	if err != nil {
+		h.logger.Errorf("can't get robots with owner id: %v from storage: %v", id, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = h.userStorage.Erase(id)
+	if err != nil {
+		h.logger.Errorf("can't erase user with id: %v: %v", id, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	h.record(r, &audit.Entry{
+		ActorID:    id,
+		Action:     audit.DeleteUser,
+		TargetType: audit.TargetUser,
+		TargetID:   id,
+	})
+
+	err = respondJSON(w, accountDeletion)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	go h.broadcastRetired(rbts)
+}
+
+// broadcastRetired sends robots stopped or hidden by the deletion of their
+// owner to the clients.
+func (h *Handler) broadcastRetired(rbts []*robot.Robot) {
+	for _, rbt := range rbts {
+		if !rbt.IsActive && rbt.DeletedAt != nil {
+			continue
+		}
+
+		retired, err := h.robotStorage.FindByID(rbt.RobotID)
+		if err != nil {
+			h.logger.Errorf("can't find robot with id: %v in storage: %v", rbt.RobotID, err)
+			continue
+		}
+
+		h.hub.Broadcast(retired)
+	}
+}
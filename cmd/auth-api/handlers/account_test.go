@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"cw1/cmd/socket"
+	"cw1/internal/robot"
+	"cw1/internal/session"
+	"cw1/internal/user"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// mockErasingUserStorage erases nothing when err is set, as the transaction
+// is rolled back.
+type mockErasingUserStorage struct {
+	mockUserStorage
+	erased int64
+	err    error
+}
+
+func (m *mockErasingUserStorage) Erase(id int64) error {
+	if m.err != nil {
+		return m.err
+	}
+
+	m.erased = id
+
+	return nil
+}
+
+func TestExportUser(t *testing.T) {
+	req, err := http.NewRequest("GET", "/api/v1/users/1/export", nil)
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	req = withURLParams(req, "id", "1")
+
+	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+
+	mockUserStorage.u = &user.User{ID: 1, Email: "user@example.com"}
+	mockSessionStorage.s = &session.Session{SessionID: token, UserID: 1}
+	mockRobotStorage.rr = []*robot.Robot{
+		{RobotID: 5, OwnerUserID: 1},
+	}
+	mockRobotStorage.deals = []*robot.Deal{
+		{ID: 3, RobotID: 5, BuyPrice: 100, SellPrice: 110, Yield: 10},
+	}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.exportUser)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("exportUser handler returned wrong status code: got %v, want %v",
+			status, http.StatusOK)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil {
+		t.Fatalf("exportUser handler returned incorrect zip: %v", err)
+	}
+
+	content := make(map[string]string)
+
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("can't open %v: %v", f.Name, err)
+		}
+
+		b, err := ioutil.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("can't read %v: %v", f.Name, err)
+		}
+
+		content[f.Name] = string(b)
+	}
+
+	for _, name := range []string{"profile.json", "robots.json", "sessions.json", "trades.json", "deals.json"} {
+		if _, ok := content[name]; !ok {
+			t.Errorf("exportUser handler didn't export %v", name)
+		}
+	}
+
+	if !strings.Contains(content["deals.json"], `"sell_price": 110`) {
+		t.Errorf("exportUser handler didn't export deals: %v", content["deals.json"])
+	}
+
+	if !strings.Contains(content["profile.json"], "user@example.com") {
+		t.Errorf("exportUser handler returned unexpected profile: %v", content["profile.json"])
+	}
+
+	if strings.Contains(content["sessions.json"], token) {
+		t.Errorf("exportUser handler exported session token")
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"erased", nil, http.StatusOK},
+		{"rolled back", errors.New("connection lost"), http.StatusInternalServerError},
+	}
+
+	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("DELETE", "/api/v1/users/1", nil)
+		if err != nil {
+			t.Fatalf("can't create request %v", err)
+		}
+
+		req = withURLParams(req, "id", "1")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		mockUserStorage := &mockErasingUserStorage{err: tt.err}
+		mockRobotStorage := new(mockRobotStorage)
+		mockSessionStorage := new(mockSessionStorage)
+		mockAuditStorage := new(mockAuditStorage)
+
+		mockUserStorage.u = &user.User{ID: 1}
+		mockSessionStorage.s = &session.Session{SessionID: token, UserID: 1}
+		mockRobotStorage.rr = []*robot.Robot{
+			{RobotID: 5, OwnerUserID: 1, IsActive: true},
+		}
+
+		h, _ := New(new(mockLogger), mockUserStorage, mockSessionStorage, mockRobotStorage, socket.NewHub(),
+			WithAuditStorage(mockAuditStorage))
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.deleteUser).ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tt.status {
+			t.Fatalf("deleteUser handler returned wrong status code for %v: got %v, want %v", tt.name, status, tt.status)
+		}
+
+		if tt.err != nil {
+			if mockUserStorage.erased != 0 || len(mockAuditStorage.entries) != 0 {
+				t.Errorf("deleteUser handler reported failed deletion as done")
+			}
+
+			continue
+		}
+
+		if mockUserStorage.erased != 1 {
+			t.Errorf("deleteUser handler didn't erase user: got %v, want %v", mockUserStorage.erased, 1)
+		}
+
+		if !respContains(rr.Body.String(), `"audit_log":`) || !respContains(rr.Body.String(), `"webhooks"`) {
+			t.Errorf("deleteUser handler didn't report retained data: %v", rr.Body.String())
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"cw1/cmd/auth-api/render"
+	"cw1/internal/apikey"
+	"cw1/internal/apperr"
+	"cw1/internal/format"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type apiKeyRequest struct {
+	Name       string           `json:"name"`
+	Scopes     []string         `json:"scopes"`
+	AllowedIPs []string         `json:"allowed_ips,omitempty"`
+	ExpiresAt  *format.NullTime `json:"expires_at,omitempty"`
+}
+
+type createdAPIKey struct {
+	*apikey.APIKey
+	Key string `json:"key"`
+}
+
+func (h *Handler) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req apiKeyRequest
+
+	err := decodeJSON(w, r, &req)
+	if err != nil {
+		h.logger.Errorf("can't unmarshal input json for creating api key: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	id, ok := h.sessionOwner(w, r)
+	if !ok {
+		return
+	}
+
+	err = validateAPIKeyRequest(&req)
+	if err != nil {
+		h.logger.Errorf("incorrect api key for user with id: %v: %v", id, err)
+		render.Error(w, r, apperr.New(apperr.KindInvalid, codeInvalidAPIKey, err.Error()))
+		return
+	}
+
+	plain, err := apikey.Generate()
+	if err != nil {
+		h.logger.Errorf("can't generate api key: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	k := &apikey.APIKey{
+		UserID:     id,
+		Name:       req.Name,
+		Hint:       apikey.HintFor(plain),
+		Hash:       apikey.Hash(plain),
+		Scopes:     req.Scopes,
+		AllowedIPs: req.AllowedIPs,
+		ExpiresAt:  req.ExpiresAt,
+	}
+
+	err = h.apiKeyStorage.Create(k)
+	if err != nil {
+		h.logger.Errorf("can't create api key for user with id: %v: %v", id, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	err = json.NewEncoder(w).Encode(createdAPIKey{APIKey: k, Key: plain})
+	if err != nil {
+		h.logger.Errorf("can't respond json with api key: %v", err)
+	}
+}
+
+func validateAPIKeyRequest(req *apiKeyRequest) error {
+	if strings.TrimSpace(req.Name) == "" {
+		return errors.New("name of api key is empty")
+	}
+
+	if len(req.Scopes) == 0 {
+		return errors.New("api key must have at least one scope")
+	}
+
+	for _, s := range req.Scopes {
+		if !apikey.IsKnownScope(s) {
+			return errors.Errorf("unknown scope: %v", s)
+		}
+	}
+
+	for _, ip := range req.AllowedIPs {
+		if _, _, err := net.ParseCIDR(ip); err != nil && net.ParseIP(ip) == nil {
+			return errors.Errorf("incorrect ip address: %v", ip)
+		}
+	}
+
+	return nil
+}
+
+func (h *Handler) getAPIKeys(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.sessionOwner(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := h.apiKeyStorage.FindByUserID(id)
+	if err != nil {
+		h.logger.Errorf("can't get api keys of user with id: %v from storage: %v", id, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = respondJSON(w, keys)
+	if err != nil {
+		h.logger.Errorf("can't respond json with api keys: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+func (h *Handler) deleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.sessionOwner(w, r)
+	if !ok {
+		return
+	}
+
+	keyID, err := idParam(r, "keyID")
+	if err != nil {
+		h.logger.Errorf("don't valid api key id: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	keys, err := h.apiKeyStorage.FindByUserID(id)
+	if err != nil {
+		h.logger.Errorf("can't get api keys of user with id: %v from storage: %v", id, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	found := false
+
+	for _, k := range keys {
+		if k.ID == keyID {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		h.logger.Errorf("user with id: %v doesn't own api key with id: %v", id, keyID)
+		render.Error(w, r, apperr.Newf(apperr.KindNotFound, codeAPIKeyNotFound, "api key with id %v don't exist", keyID))
+		return
+	}
+
+	err = h.apiKeyStorage.Delete(keyID)
+	if err != nil {
+		h.logger.Errorf("can't delete api key with id: %v: %v", keyID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"bytes"
+	"cw1/cmd/socket"
+	"cw1/internal/apikey"
+	"cw1/internal/robot"
+	"cw1/internal/session"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockAPIKeyStorage struct {
+	k *apikey.APIKey
+	apikey.Storage
+}
+
+func (m mockAPIKeyStorage) Create(k *apikey.APIKey) error {
+	k.ID = 1
+	return nil
+}
+
+func (m mockAPIKeyStorage) FindByHash(hash string) (*apikey.APIKey, error) {
+	return m.k, nil
+}
+
+func (m mockAPIKeyStorage) UpdateLastUsed(id int64, t time.Time) error {
+	return nil
+}
+
+func TestCreateAPIKeyCorrect(t *testing.T) {
+	json := []byte(`{"name": "script","scopes": ["robots:read"],"allowed_ips": ["10.0.0.0/8"]}`)
+	req, err := http.NewRequest("POST", "/api/v1/users/1/api-keys", bytes.NewBuffer(json))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	req = withURLParams(req, "id", "1")
+
+	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+	mockAPIKeyStorage := new(mockAPIKeyStorage)
+
+	mockSessionStorage.s = &session.Session{
+		SessionID: token,
+		UserID:    1,
+	}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub, WithAPIKeyStorage(mockAPIKeyStorage))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.createAPIKey)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusCreated {
+		t.Errorf("createAPIKey handler returned wrong status code: got %v, want %v",
+			status, http.StatusCreated)
+	}
+
+	expected := `"key":"` + apikey.Prefix
+	if !respContains(rr.Body.String(), expected) {
+		t.Errorf("createAPIKey handler returned unexpected body: got %v, want %v",
+			rr.Body.String(), expected)
+	}
+}
+
+func TestCreateAPIKeyUnknownScope(t *testing.T) {
+	json := []byte(`{"name": "script","scopes": ["users:write"]}`)
+	req, err := http.NewRequest("POST", "/api/v1/users/1/api-keys", bytes.NewBuffer(json))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	req = withURLParams(req, "id", "1")
+
+	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+	mockAPIKeyStorage := new(mockAPIKeyStorage)
+
+	mockSessionStorage.s = &session.Session{
+		SessionID: token,
+		UserID:    1,
+	}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub, WithAPIKeyStorage(mockAPIKeyStorage))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.createAPIKey)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("createAPIKey handler returned wrong status code: got %v, want %v",
+			status, http.StatusBadRequest)
+	}
+
+	expected := "unknown scope: users:write"
+	if !respContains(rr.Body.String(), expected) {
+		t.Errorf("createAPIKey handler returned unexpected body: got %v, want %v",
+			rr.Body.String(), expected)
+	}
+}
+
+func TestActivateWithAPIKeyWithoutScope(t *testing.T) {
+	req, err := http.NewRequest("PUT", "/api/v1/robot/5/activate", nil)
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	req = withURLParams(req, "id", "5")
+
+	req.Header.Set("Authorization", "Bearer "+apikey.Prefix+strings.Repeat("a", 64))
+	req.RemoteAddr = "10.0.0.1:1234"
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+	mockAPIKeyStorage := new(mockAPIKeyStorage)
+
+	mockAPIKeyStorage.k = &apikey.APIKey{
+		ID:         1,
+		UserID:     1,
+		Scopes:     []string{apikey.ScopeRobotsRead},
+		AllowedIPs: []string{"10.0.0.0/8"},
+	}
+
+	mockRobotStorage.rr = []*robot.Robot{
+		{RobotID: 5, OwnerUserID: 1},
+	}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub, WithAPIKeyStorage(mockAPIKeyStorage))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.activate)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusForbidden {
+		t.Errorf("activate handler returned wrong status code: got %v, want %v",
+			status, http.StatusForbidden)
+	}
+}
+
+func TestAPIKeyAllowsIP(t *testing.T) {
+	k := &apikey.APIKey{AllowedIPs: []string{"10.0.0.0/8", "192.168.1.5"}}
+
+	cases := map[string]bool{
+		"10.1.2.3":    true,
+		"192.168.1.5": true,
+		"192.168.1.6": false,
+		"not an ip":   false,
+	}
+
+	for ip, want := range cases {
+		if got := k.AllowsIP(ip); got != want {
+			t.Errorf("AllowsIP(%q) = %v, want %v", ip, got, want)
+		}
+	}
+}
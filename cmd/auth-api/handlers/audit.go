@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"cw1/cmd/auth-api/render"
+	"cw1/internal/apperr"
+	"cw1/internal/audit"
+	"cw1/internal/policy"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// record appends the entry to the audit log. The action is already done when
+// it is called, so a failure is only logged.
+func (h *Handler) record(r *http.Request, e *audit.Entry) {
+	if h.auditStorage == nil {
+		return
+	}
+
+	// the scheduler acts without a request
+	if r != nil {
+		e.IP = clientIP(r)
+		e.UserAgent = r.UserAgent()
+	}
+
+	e.CreatedAt = time.Now().UTC()
+
+	err := h.auditStorage.Append(e)
+	if err != nil {
+		h.logger.Errorf("can't append %v of %v with id: %v to audit log: %v", e.Action, e.TargetType, e.TargetID, err)
+	}
+}
+
+// recordChange appends the entry with the difference between before and after.
+func (h *Handler) recordChange(r *http.Request, e *audit.Entry, before interface{}, after interface{}) {
+	if h.auditStorage == nil {
+		return
+	}
+
+	diff, err := audit.Diff(before, after)
+	if err != nil {
+		h.logger.Errorf("can't make diff for audit log: %v", err)
+	}
+
+	e.Diff = diff
+
+	h.record(r, e)
+}
+
+type auditResponse struct {
+	Entries []*audit.Entry `json:"entries"`
+	// Intact is false when an entry was changed after it had been appended.
+	Intact bool `json:"intact"`
+}
+
+// getAudit returns entries of the caller, admins get all entries or entries
+// of the user from the user_id query param.
+func (h *Handler) getAudit(w http.ResponseWriter, r *http.Request) {
+	p, err := h.authenticate(r)
+	if err != nil {
+		h.logger.Errorf("can't authenticate user for audit log: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	if p.key != nil {
+		h.logger.Errorf("api key with id: %v can't read audit log", p.key.ID)
+		render.Error(w, r, apperr.New(apperr.KindForbidden, apperr.CodeForbidden, "audit log can't be read with an api key"))
+		return
+	}
+
+	userID := p.userID
+
+	if param := r.URL.Query().Get("user_id"); param != "" {
+		userID, err = strconv.ParseInt(param, 10, 64)
+		if err != nil || userID <= BottomLineValidID {
+			h.logger.Errorf("incorrect user id for audit log: %v", param)
+			render.Error(w, r, apperr.Newf(apperr.KindInvalid, codeInvalidQuery, "incorrect user_id: %v", param))
+			return
+		}
+	} else if h.allowed(p, policy.ReadAudit, BottomLineValidID) {
+		userID = BottomLineValidID
+	}
+
+	if !h.allowed(p, policy.ReadAudit, userID) {
+		msg := fmt.Sprintf("user with id: %v don't have permission to read audit log", p.userID)
+		h.logger.Errorf(msg)
+		render.Error(w, r, apperr.New(apperr.KindForbidden, apperr.CodeForbidden, msg))
+		return
+	}
+
+	limit := defaultAuditLimit
+
+	if param := r.URL.Query().Get("limit"); param != "" {
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit <= 0 || limit > maxAuditLimit {
+			h.logger.Errorf("incorrect limit for audit log: %v", param)
+			render.Error(w, r, apperr.Newf(apperr.KindInvalid, codeInvalidQuery, "limit must be between 1 and %v", maxAuditLimit))
+			return
+		}
+	}
+
+	entries, err := h.auditStorage.Find(audit.Filter{UserID: userID, Limit: limit})
+	if err != nil {
+		h.logger.Errorf("can't get audit log from storage: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = respondJSON(w, auditResponse{Entries: entries, Intact: intact(entries, userID == BottomLineValidID)})
+	if err != nil {
+		h.logger.Errorf("can't respond json with audit log: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+// intact verifies entries which go newest first. Links between entries are
+// checked only for the whole log, entries of a user aren't adjacent.
+func intact(entries []*audit.Entry, linked bool) bool {
+	if linked {
+		chain := make([]*audit.Entry, len(entries))
+		for i, e := range entries {
+			chain[len(entries)-1-i] = e
+		}
+
+		return audit.Verify(chain) == nil
+	}
+
+	for _, e := range entries {
+		if audit.Verify([]*audit.Entry{e}) != nil {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"bytes"
+	"cw1/cmd/socket"
+	"cw1/internal/audit"
+	"cw1/internal/robot"
+	"cw1/internal/session"
+	"cw1/internal/user"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type mockAuditStorage struct {
+	entries []*audit.Entry
+}
+
+func (m *mockAuditStorage) Append(e *audit.Entry) error {
+	if len(m.entries) > 0 {
+		e.PrevHash = m.entries[len(m.entries)-1].Hash
+	}
+
+	hash, err := e.ComputeHash()
+	if err != nil {
+		return err
+	}
+
+	e.ID = int64(len(m.entries) + 1)
+	e.Hash = hash
+	m.entries = append(m.entries, e)
+
+	return nil
+}
+
+func (m *mockAuditStorage) Find(f audit.Filter) ([]*audit.Entry, error) {
+	res := make([]*audit.Entry, 0)
+
+	for i := len(m.entries) - 1; i >= 0 && (f.Limit == 0 || len(res) < f.Limit); i-- {
+		e := m.entries[i]
+		if f.UserID == 0 || e.ActorID == f.UserID || (e.TargetType == audit.TargetUser && e.TargetID == f.UserID) {
+			res = append(res, e)
+		}
+	}
+
+	return res, nil
+}
+
+func TestUpdateRobotAudited(t *testing.T) {
+	body := []byte(`{"buy_price": 56.5,` + robotParams + `}`)
+	req, err := http.NewRequest("PUT", "/api/v1/robot/5", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	req = withURLParams(req, "id", "5")
+
+	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("If-Match", `"0"`)
+	req.Header.Set("User-Agent", "test-agent")
+	req.RemoteAddr = "10.0.0.1:1234"
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+	mockAuditStorage := new(mockAuditStorage)
+
+	mockUserStorage.u = &user.User{ID: 1}
+	mockSessionStorage.s = &session.Session{SessionID: token, UserID: 1}
+	mockRobotStorage.rr = []*robot.Robot{
+		{RobotID: 5, OwnerUserID: 1},
+	}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub, WithAuditStorage(mockAuditStorage),
+		WithTickers([]string{"AAPL"}))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.updateRobot)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("updateRobot handler returned wrong status code: got %v, want %v",
+			status, http.StatusOK)
+	}
+
+	if len(mockAuditStorage.entries) != 1 {
+		t.Fatalf("updateRobot handler appended wrong number of audit entries: got %v, want %v",
+			len(mockAuditStorage.entries), 1)
+	}
+
+	e := mockAuditStorage.entries[0]
+
+	if e.Action != audit.UpdateRobot || e.TargetID != 5 || e.ActorID != 1 ||
+		e.IP != "10.0.0.1" || e.UserAgent != "test-agent" {
+		t.Errorf("updateRobot handler appended wrong audit entry: %+v", e)
+	}
+
+	if c, ok := e.Diff["ticker"]; !ok || c.After != "AAPL" {
+		t.Errorf("updateRobot handler appended wrong diff: %+v", e.Diff)
+	}
+}
+
+func TestGetAuditOwnEntries(t *testing.T) {
+	req, err := http.NewRequest("GET", "/api/v1/audit", nil)
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockSessionStorage := new(mockSessionStorage)
+	mockAuditStorage := new(mockAuditStorage)
+
+	mockUserStorage.u = &user.User{ID: 1}
+	mockSessionStorage.s = &session.Session{SessionID: token, UserID: 1}
+
+	for _, e := range []*audit.Entry{
+		{ActorID: 1, Action: audit.SignIn, TargetType: audit.TargetUser, TargetID: 1},
+		{ActorID: 2, Action: audit.SignIn, TargetType: audit.TargetUser, TargetID: 2},
+		{ActorID: 1, Action: audit.ActivateRobot, TargetType: audit.TargetRobot, TargetID: 5},
+	} {
+		_ = mockAuditStorage.Append(e)
+	}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, new(mockRobotStorage), hub,
+		WithAuditStorage(mockAuditStorage))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.getAudit)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("getAudit handler returned wrong status code: got %v, want %v",
+			status, http.StatusOK)
+	}
+
+	var resp auditResponse
+
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("can't unmarshal response %v", err)
+	}
+
+	if len(resp.Entries) != 2 || !resp.Intact {
+		t.Errorf("getAudit handler returned wrong entries: got %v entries, intact: %v, want 2 intact entries",
+			len(resp.Entries), resp.Intact)
+	}
+}
+
+func TestGetAuditOfOtherUserForbidden(t *testing.T) {
+	req, err := http.NewRequest("GET", "/api/v1/audit?user_id=2", nil)
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockSessionStorage := new(mockSessionStorage)
+
+	mockUserStorage.u = &user.User{ID: 1, Role: user.RoleUser}
+	mockSessionStorage.s = &session.Session{SessionID: token, UserID: 1}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, new(mockRobotStorage), hub,
+		WithAuditStorage(new(mockAuditStorage)))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.getAudit)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusForbidden {
+		t.Errorf("getAudit handler returned wrong status code: got %v, want %v",
+			status, http.StatusForbidden)
+	}
+}
+
+func TestGetAuditDetectsTampering(t *testing.T) {
+	req, err := http.NewRequest("GET", "/api/v1/audit", nil)
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockSessionStorage := new(mockSessionStorage)
+	mockAuditStorage := new(mockAuditStorage)
+
+	mockUserStorage.u = &user.User{ID: 2, Role: user.RoleAdmin}
+	mockSessionStorage.s = &session.Session{SessionID: token, UserID: 2}
+
+	for _, e := range []*audit.Entry{
+		{ActorID: 1, Action: audit.SignIn, TargetType: audit.TargetUser, TargetID: 1},
+		{ActorID: 1, Action: audit.DeleteRobot, TargetType: audit.TargetRobot, TargetID: 5},
+	} {
+		_ = mockAuditStorage.Append(e)
+	}
+
+	mockAuditStorage.entries[1].TargetID = 6
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, new(mockRobotStorage), hub,
+		WithAuditStorage(mockAuditStorage))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.getAudit)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("getAudit handler returned wrong status code: got %v, want %v",
+			status, http.StatusOK)
+	}
+
+	var resp auditResponse
+
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("can't unmarshal response %v", err)
+	}
+
+	if len(resp.Entries) != 2 || resp.Intact {
+		t.Errorf("getAudit handler didn't detect changed entry: got %v entries, intact: %v",
+			len(resp.Entries), resp.Intact)
+	}
+}
@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"cw1/cmd/auth-api/render"
+	"cw1/internal/apikey"
+	"cw1/internal/apperr"
+	"cw1/internal/policy"
+	"cw1/internal/user"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	errScope           = apperr.New(apperr.KindForbidden, codeScopeMissing, "api key doesn't have required scope")
+	errReadOnly        = apperr.New(apperr.KindForbidden, codeReadOnly, "impersonated requests are read-only")
+	errForbidden       = apperr.New(apperr.KindForbidden, apperr.CodeForbidden, "user isn't allowed to do this")
+	errUnauthenticated = apperr.New(apperr.KindUnauthenticated, apperr.CodeUnauthenticated, "missing or invalid credentials")
+)
+
+// ImpersonateHeader lets an admin act as another user in read-only mode.
+const ImpersonateHeader = "X-Impersonate-User"
+
+// principal is the authenticated caller of a request. Session tokens act
+// with every scope, API keys only with the scopes granted on creation.
+type principal struct {
+	userID         int64
+	key            *apikey.APIKey
+	impersonatorID int64
+}
+
+func (p *principal) can(scope string) bool {
+	return p.key == nil || p.key.HasScope(scope)
+}
+
+func (h *Handler) authenticate(r *http.Request) (*principal, error) {
+	token, err := tokenFromReq(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if apikey.IsKey(token) && h.apiKeyStorage != nil {
+		return h.authenticateKey(r, token)
+	}
+
+	s, err := h.sessionStorage.FindByToken(token)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't find owner by token in storage")
+	}
+
+	if s.UserID == BottomLineValidID {
+		return nil, errors.Wrap(errUnauthenticated, "can't find owner by token")
+	}
+
+	p := &principal{userID: s.UserID}
+
+	if r.Header.Get(ImpersonateHeader) != "" {
+		return h.impersonate(p, r.Header.Get(ImpersonateHeader))
+	}
+
+	return p, nil
+}
+
+func (h *Handler) impersonate(admin *principal, target string) (*principal, error) {
+	id, err := strconv.ParseInt(target, 10, 64)
+	if err != nil || id <= BottomLineValidID {
+		return nil, apperr.Newf(apperr.KindInvalid, codeInvalidID, "incorrect id of impersonated user: %v", target)
+	}
+
+	role, err := h.roleOf(admin.userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if role != user.RoleAdmin {
+		return nil, errors.Wrapf(errForbidden, "user with id: %v can't impersonate", admin.userID)
+	}
+
+	return &principal{userID: id, impersonatorID: admin.userID}, nil
+}
+
+func (h *Handler) authenticateKey(r *http.Request, token string) (*principal, error) {
+	k, err := h.apiKeyStorage.FindByHash(apikey.Hash(token))
+	if err != nil {
+		return nil, errors.Wrap(err, "can't find api key in storage")
+	}
+
+	if k.ID == BottomLineValidID {
+		return nil, errors.Wrap(errUnauthenticated, "can't find api key")
+	}
+
+	now := time.Now()
+
+	if k.IsExpired(now) {
+		return nil, errors.Wrapf(errUnauthenticated, "api key with id: %v is expired", k.ID)
+	}
+
+	if !k.AllowsIP(clientIP(r)) {
+		return nil, errors.Wrapf(errUnauthenticated, "api key with id: %v isn't allowed from %v", k.ID, clientIP(r))
+	}
+
+	err = h.apiKeyStorage.UpdateLastUsed(k.ID, now)
+	if err != nil {
+		h.logger.Errorf("can't update last used time for api key with id: %v: %v", k.ID, err)
+	}
+
+	return &principal{userID: k.UserID, key: k}, nil
+}
+
+func (h *Handler) authorize(r *http.Request, scope string) (*principal, error) {
+	p, err := h.authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.can(scope) {
+		return nil, errors.Wrapf(errScope, "scope %q", scope)
+	}
+
+	if p.impersonatorID != BottomLineValidID && scope != apikey.ScopeRobotsRead {
+		return nil, errors.Wrapf(errReadOnly, "admin with id: %v", p.impersonatorID)
+	}
+
+	return p, nil
+}
+
+// allowed checks the action against the policy. Owners are let through without
+// loading their role, others are checked with the role from the user storage.
+func (h *Handler) allowed(p *principal, a policy.Action, ownerID int64) bool {
+	s := policy.Subject{
+		UserID:   p.userID,
+		Role:     user.RoleUser,
+		ReadOnly: p.impersonatorID != BottomLineValidID,
+	}
+
+	if policy.Can(s, a, ownerID) {
+		return true
+	}
+
+	if s.ReadOnly {
+		return false
+	}
+
+	role, err := h.roleOf(p.userID)
+	if err != nil {
+		h.logger.Errorf("can't get role of user with id: %v: %v", p.userID, err)
+		return false
+	}
+
+	s.Role = role
+
+	return policy.Can(s, a, ownerID)
+}
+
+func (h *Handler) roleOf(userID int64) (user.Role, error) {
+	u, err := h.userStorage.FindByID(userID)
+	if err != nil {
+		return "", errors.Wrapf(err, "can't find user with id: %v in storage", userID)
+	}
+
+	if u == nil || u.ID == BottomLineValidID {
+		return "", errors.Errorf("user with id: %v doesn't exist", userID)
+	}
+
+	if u.Role == "" {
+		return user.RoleUser, nil
+	}
+
+	return u.Role, nil
+}
+
+// sessionOwner checks that the user from URL params is the caller with a session
+// token, an API key can't be used to manage keys or account security.
+func (h *Handler) sessionOwner(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := idParam(r, "id")
+	if err != nil {
+		h.logger.Errorf("can't get ID from URL params: %v", err)
+		render.Error(w, r, err)
+		return -1, false
+	}
+
+	p, err := h.authenticate(r)
+	if err != nil || p.key != nil || p.impersonatorID != BottomLineValidID || p.userID != id {
+		h.logger.Errorf("can't manage account of user with id: %v: %v", id, err)
+		render.Error(w, r, errUserNotFound(id))
+		return -1, false
+	}
+
+	return id, true
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,326 @@
+package handler
+
+import (
+	"cw1/cmd/auth-api/render"
+	"cw1/internal/apikey"
+	"cw1/internal/apperr"
+	"cw1/internal/audit"
+	"cw1/internal/policy"
+	"cw1/internal/robot"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+const maxBulkRobots = 100
+
+const (
+	bulkActivate   = "activate"
+	bulkDeactivate = "deactivate"
+	bulkDelete     = "delete"
+	bulkSet        = "set"
+)
+
+// bulkFields are the fields which can be set to many robots at once.
+var bulkFields = map[string]bool{
+	"ticker":     true,
+	"buy_price":  true,
+	"sell_price": true,
+	"plan_start": true,
+	"plan_end":   true,
+	"plan_yield": true,
+	"visibility": true,
+}
+
+// bulkRequest applies the action to robots given by ids or by the query params
+// of the robots list.
+type bulkRequest struct {
+	Action string            `json:"action"`
+	IDs    []int64           `json:"ids,omitempty"`
+	Filter map[string]string `json:"filter,omitempty"`
+	Fields json.RawMessage   `json:"fields,omitempty"`
+}
+
+type bulkResult struct {
+	RobotID int64           `json:"robot_id"`
+	OK      bool            `json:"ok"`
+	Robot   *robot.Robot    `json:"robot,omitempty"`
+	Error   *render.Problem `json:"error,omitempty"`
+}
+
+type bulkResponse struct {
+	Action    string       `json:"action"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Results   []bulkResult `json:"results"`
+}
+
+// bulkRobots applies the action to every robot separately with the same checks
+// as the handlers of a single robot, failure of one robot doesn't stop others.
+func (h *Handler) bulkRobots(w http.ResponseWriter, r *http.Request) {
+	var req bulkRequest
+
+	err := decodeJSON(w, r, &req)
+	if err != nil {
+		h.logger.Errorf("can't unmarshal input json for bulk robots: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	set, err := validateBulk(&req)
+	if err != nil {
+		h.logger.Errorf("incorrect bulk request: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	scope := apikey.ScopeRobotsWrite
+	if req.Action == bulkActivate || req.Action == bulkDeactivate {
+		scope = apikey.ScopeRobotsActivate
+	}
+
+	p, err := h.authorize(r, scope)
+	if err != nil {
+		h.logger.Errorf("can't authorize user: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	resp := bulkResponse{Action: req.Action, Results: make([]bulkResult, 0)}
+
+	robots, err := h.bulkTargets(r, &req, p, &resp)
+	if err != nil {
+		h.logger.Errorf("can't get robots for bulk %v: %v", req.Action, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	changed := make([]*robot.Robot, 0, len(robots))
+	factor := newActivationFactor(r)
+
+	for _, rbt := range robots {
+		err = h.applyBulk(r, factor, p, &req, set, rbt)
+		if err != nil {
+			h.logger.Errorf("can't %v robot with id: %v: %v", req.Action, rbt.RobotID, err)
+			resp.add(r, rbt.RobotID, err)
+
+			continue
+		}
+
+		resp.Results = append(resp.Results, bulkResult{RobotID: rbt.RobotID, OK: true, Robot: rbt})
+		resp.Succeeded++
+
+		changed = append(changed, rbt)
+	}
+
+	err = respondJSON(w, resp)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	go func() {
+		for _, rbt := range changed {
+			h.hub.Broadcast(rbt)
+		}
+	}()
+}
+
+func (resp *bulkResponse) add(r *http.Request, rbtID int64, err error) {
+	problem := render.NewProblem(r, err)
+	problem.Instance = fmt.Sprintf("/api/v1/robot/%d", rbtID)
+
+	resp.Results = append(resp.Results, bulkResult{RobotID: rbtID, Error: &problem})
+	resp.Failed++
+}
+
+// validateBulk checks the request and returns the fields the set action assigns.
+func validateBulk(req *bulkRequest) (map[string]json.RawMessage, error) {
+	fields := make(map[string]string)
+
+	switch req.Action {
+	case bulkActivate, bulkDeactivate, bulkDelete:
+		if len(req.Fields) != 0 {
+			fields["fields"] = "is allowed only for the set action"
+		}
+	case bulkSet:
+	default:
+		fields["action"] = "must be activate, deactivate, delete or set"
+	}
+
+	switch {
+	case len(req.IDs) == 0 && req.Filter == nil:
+		fields["ids"] = "ids or filter is required"
+	case len(req.IDs) != 0 && req.Filter != nil:
+		fields["ids"] = "can't be used with filter"
+	case len(req.IDs) > maxBulkRobots:
+		fields["ids"] = fmt.Sprintf("must contain at most %v robots", maxBulkRobots)
+	}
+
+	var set map[string]json.RawMessage
+
+	if req.Action == bulkSet {
+		if len(req.Fields) == 0 {
+			fields["fields"] = "is required"
+		} else if err := json.Unmarshal(req.Fields, &set); err != nil {
+			fields["fields"] = "must be an object"
+		}
+
+		for name := range set {
+			if !bulkFields[name] {
+				fields["fields."+name] = "can't be set"
+			}
+		}
+	}
+
+	if len(fields) > 0 {
+		return nil, apperr.Validation(fields)
+	}
+
+	return set, nil
+}
+
+// bulkTargets finds robots of the request, ids which can't be found are
+// reported as failed results.
+func (h *Handler) bulkTargets(r *http.Request, req *bulkRequest, p *principal,
+	resp *bulkResponse) ([]*robot.Robot, error) {
+	if req.Filter == nil {
+		robots := make([]*robot.Robot, 0, len(req.IDs))
+		seen := make(map[int64]bool, len(req.IDs))
+
+		for _, id := range req.IDs {
+			if seen[id] {
+				continue
+			}
+
+			seen[id] = true
+
+			rbt, err := findRobot(h.robotStorage, id)
+			if err != nil {
+				resp.add(r, id, err)
+				continue
+			}
+
+			robots = append(robots, rbt)
+		}
+
+		return robots, nil
+	}
+
+	q := make(url.Values, len(req.Filter))
+	for k, v := range req.Filter {
+		q.Set(k, v)
+	}
+
+	f, err := robotFilter(q)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.OwnerID == 0 {
+		f.OwnerID = p.userID
+	}
+
+	f.TagsOf = p.userID
+	f.Limit = maxBulkRobots + 1
+
+	robots, err := h.robotStorage.List(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't get robots from storage (filter: %+v)", f)
+	}
+
+	if len(robots) > maxBulkRobots {
+		return nil, apperr.Validation(map[string]string{
+			"filter": fmt.Sprintf("must match at most %v robots", maxBulkRobots),
+		})
+	}
+
+	return robots, nil
+}
+
+// applyBulk changes one robot of the request, the second factor f is shared by
+// all robots the request activates.
+func (h *Handler) applyBulk(r *http.Request, f *activationFactor, p *principal, req *bulkRequest,
+	set map[string]json.RawMessage, rbt *robot.Robot) error {
+	if req.Action == bulkDelete {
+		return h.removeRobot(r, p, rbt)
+	}
+
+	if rbt.DeletedAt != nil {
+		return errRobotNotFound(rbt.RobotID)
+	}
+
+	switch req.Action {
+	case bulkActivate:
+		return h.activateRobot(r, f, p, rbt)
+	case bulkDeactivate:
+		return h.deactivateRobot(r, p, rbt)
+	default:
+		return h.setFields(r, p, rbt, set)
+	}
+}
+
+// setFields assigns the fields to the robot as updateRobot does.
+func (h *Handler) setFields(r *http.Request, p *principal, rbt *robot.Robot, set map[string]json.RawMessage) error {
+	if !h.allowed(p, policy.UpdateRobot, rbt.OwnerUserID) {
+		return errRobotForbidden("user with id: %v don't have permission to update robot with id: %v",
+			p.userID, rbt.RobotID)
+	}
+
+	updated := *rbt
+
+	for name, v := range set {
+		var err error
+
+		switch name {
+		case "ticker":
+			updated.Ticker = nil
+			err = json.Unmarshal(v, &updated.Ticker)
+		case "buy_price":
+			updated.BuyPrice = nil
+			err = json.Unmarshal(v, &updated.BuyPrice)
+		case "sell_price":
+			updated.SellPrice = nil
+			err = json.Unmarshal(v, &updated.SellPrice)
+		case "plan_start":
+			updated.PlanStart = nil
+			err = json.Unmarshal(v, &updated.PlanStart)
+		case "plan_end":
+			updated.PlanEnd = nil
+			err = json.Unmarshal(v, &updated.PlanEnd)
+		case "plan_yield":
+			updated.PlanYield = nil
+			err = json.Unmarshal(v, &updated.PlanYield)
+		case "visibility":
+			err = json.Unmarshal(v, &updated.Visibility)
+			if err == nil && !robot.IsVisibility(updated.Visibility) {
+				return apperr.Validation(map[string]string{"visibility": msgVisibility})
+			}
+		}
+
+		if err != nil {
+			return decodeError(err)
+		}
+	}
+
+	if fields := h.validateParams(&updated); len(fields) > 0 {
+		return apperr.Validation(fields)
+	}
+
+	err := h.robotStorage.Update(&updated)
+	if err != nil {
+		return errRobotModified(errors.Wrap(err, "can't update robot in storage"), rbt.RobotID)
+	}
+
+	h.recordChange(r, robotEntry(p.userID, audit.UpdateRobot, rbt.RobotID), rbt, &updated)
+	h.recordRevision(p.userID, rbt, &updated)
+	h.syncFollowers(r, p.userID, rbt, &updated)
+
+	*rbt = updated
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"cw1/internal/format"
+	"cw1/internal/robot"
+	"cw1/internal/totp"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func planned(id int64, owner int64, from time.Duration, to time.Duration) *robot.Robot {
+	now := time.Now()
+
+	start, end := &format.NullTime{}, &format.NullTime{}
+	start.V.Time, start.V.Valid = now.Add(from), true
+	end.V.Time, end.V.Valid = now.Add(to), true
+
+	ticker := &format.NullString{}
+	ticker.V.String, ticker.V.Valid = "AAPL", true
+
+	return &robot.Robot{RobotID: id, OwnerUserID: owner, Ticker: ticker, BuyPrice: price(100), SellPrice: price(110),
+		PlanStart: start, PlanEnd: end, Visibility: robot.VisibilityPrivate}
+}
+
+func TestBulkRobotsActivate(t *testing.T) {
+	rs := &mockRobotStorage{rr: []*robot.Robot{
+		planned(5, 1, -time.Hour, time.Hour),
+		planned(6, 1, time.Hour, 2*time.Hour),
+		planned(7, 2, -time.Hour, time.Hour),
+	}}
+	h := newTestHandler(1, rs)
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.bulkRobots).ServeHTTP(rr, requestFor(t, "POST", "/api/v1/robots/bulk",
+		`{"action":"activate","ids":[5,6,7,5]}`))
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("bulkRobots handler returned wrong status code: got %v, want %v", status, http.StatusOK)
+	}
+
+	var resp bulkResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("can't unmarshal response %v", err)
+	}
+
+	if resp.Succeeded != 1 || resp.Failed != 2 || len(resp.Results) != 3 {
+		t.Fatalf("bulkRobots handler returned wrong results: %v", rr.Body.String())
+	}
+
+	want := map[int64]int{5: 0, 6: http.StatusConflict, 7: http.StatusForbidden}
+
+	for _, res := range resp.Results {
+		status := 0
+		if res.Error != nil {
+			status = res.Error.Status
+		}
+
+		if status != want[res.RobotID] || res.OK != (status == 0) {
+			t.Errorf("bulkRobots handler returned wrong result for robot with id %v: %+v", res.RobotID, res)
+		}
+	}
+
+	if !rs.rr[0].IsActive {
+		t.Errorf("bulkRobots handler didn't activate robot")
+	}
+}
+
+// onceTOTPStorage lets every time step be used once like the real storage.
+type onceTOTPStorage struct {
+	mockTOTPStorage
+	used map[int64]bool
+}
+
+func (m *onceTOTPStorage) UseStep(userID int64, step int64) (bool, error) {
+	if m.used[step] {
+		return false, nil
+	}
+
+	m.used[step] = true
+
+	return true, nil
+}
+
+func TestBulkRobotsActivateWithTwoFactor(t *testing.T) {
+	rs := &mockRobotStorage{rr: []*robot.Robot{
+		planned(5, 1, -time.Hour, time.Hour),
+		planned(6, 1, -time.Hour, time.Hour),
+	}}
+	h := newTestHandler(1, rs)
+	h.totpStorage = &onceTOTPStorage{
+		mockTOTPStorage: mockTOTPStorage{e: &totp.Enrollment{UserID: 1, Secret: rfcSecret, Enabled: true}},
+		used:            make(map[int64]bool),
+	}
+	h.totpBuyPrice = 50
+
+	code, err := totp.Code(rfcSecret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatalf("can't generate code %v", err)
+	}
+
+	req := requestFor(t, "POST", "/api/v1/robots/bulk", `{"action":"activate","ids":[5,6]}`)
+	req.Header.Set(TOTPHeader, code)
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.bulkRobots).ServeHTTP(rr, req)
+
+	var resp bulkResponse
+	if err = json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("can't unmarshal response %v", err)
+	}
+
+	if resp.Succeeded != 2 || !rs.rr[0].IsActive || !rs.rr[1].IsActive {
+		t.Errorf("bulkRobots handler didn't activate robots with one code: %v", rr.Body.String())
+	}
+}
+
+func TestBulkRobotsSetByFilter(t *testing.T) {
+	rs := &filterRecorder{mockRobotStorage: mockRobotStorage{rr: []*robot.Robot{
+		planned(5, 1, -time.Hour, time.Hour),
+		planned(6, 1, time.Hour, 2*time.Hour),
+	}}}
+	h := newTestHandler(1, rs)
+
+	body := `{"action":"set","filter":{"ticker":"AAPL"},"fields":{"visibility":"public","plan_yield":7}}`
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.bulkRobots).ServeHTTP(rr, requestFor(t, "POST", "/api/v1/robots/bulk", body))
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("bulkRobots handler returned wrong status code: got %v, want %v", status, http.StatusOK)
+	}
+
+	if rs.f.OwnerID != 1 || rs.f.Ticker != "AAPL" {
+		t.Errorf("bulkRobots handler listed robots with wrong filter: %+v", rs.f)
+	}
+
+	for _, rbt := range rs.rr {
+		if rbt.Visibility != robot.VisibilityPublic || rbt.PlanYield == nil || rbt.PlanYield.V.Float64 != 7 {
+			t.Errorf("bulkRobots handler didn't set fields of robot with id %v: %+v", rbt.RobotID, rbt)
+		}
+	}
+}
+
+func TestBulkRobotsIncorrect(t *testing.T) {
+	h := newTestHandler(1, &mockRobotStorage{rr: []*robot.Robot{planned(5, 1, -time.Hour, time.Hour)}})
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"action":"restart","ids":[5]}`, http.StatusUnprocessableEntity},
+		{`{"action":"delete"}`, http.StatusUnprocessableEntity},
+		{`{"action":"delete","ids":[5],"filter":{"active":"true"}}`, http.StatusUnprocessableEntity},
+		{`{"action":"set","ids":[5],"fields":{"is_active":true}}`, http.StatusUnprocessableEntity},
+		{`{"action":"set","ids":[5]}`, http.StatusUnprocessableEntity},
+		{`{"action":"delete","filter":{"active":"maybe"}}`, http.StatusBadRequest},
+		{`{"action":"delete","ids":[5],"force":true}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.bulkRobots).ServeHTTP(rr, requestFor(t, "POST", "/api/v1/robots/bulk", tt.body))
+
+		if status := rr.Code; status != tt.status {
+			t.Errorf("bulkRobots handler returned wrong status code for %v: got %v, want %v", tt.body, status, tt.status)
+		}
+	}
+}
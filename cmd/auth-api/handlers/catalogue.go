@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"cw1/cmd/auth-api/render"
+	"cw1/internal/apikey"
+	"cw1/internal/apperr"
+	"cw1/internal/audit"
+	"cw1/internal/format"
+	"cw1/internal/robot"
+	"fmt"
+	"net/http"
+)
+
+// catalogueRobot shows how a public robot performs without its trading parameters.
+type catalogueRobot struct {
+	RobotID      int64              `json:"robot_id"`
+	OwnerUserID  int64              `json:"owner_user_id"`
+	Ticker       *format.NullString `json:"ticker,omitempty"`
+	IsActive     bool               `json:"is_active"`
+	FactYield    float64            `json:"fact_yield"`
+	DealsCount   int64              `json:"deals_count"`
+	AvgDealYield float64            `json:"avg_deal_yield"`
+	CreatedAt    *format.NullTime   `json:"created_at,omitempty"`
+}
+
+func newCatalogueRobot(r *robot.Robot) catalogueRobot {
+	c := catalogueRobot{
+		RobotID:     r.RobotID,
+		OwnerUserID: r.OwnerUserID,
+		Ticker:      r.Ticker,
+		IsActive:    r.IsActive,
+		CreatedAt:   r.CreatedAt,
+	}
+
+	if r.FactYield != nil {
+		c.FactYield = r.FactYield.V.Float64
+	}
+
+	if r.DealsCount != nil {
+		c.DealsCount = r.DealsCount.V.Int64
+	}
+
+	if c.DealsCount > 0 {
+		c.AvgDealYield = c.FactYield / float64(c.DealsCount)
+	}
+
+	return c
+}
+
+// getCatalogue lists public robots, it accepts the query params of the robots list.
+func (h *Handler) getCatalogue(w http.ResponseWriter, r *http.Request) {
+	f, err := robotFilter(r.URL.Query())
+	if err != nil {
+		h.logger.Errorf("incorrect query params for catalogue: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	_, err = h.authorize(r, apikey.ScopeRobotsRead)
+	if err != nil {
+		h.logger.Errorf("can't authorize user: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	f.IncludeDeleted, f.Deleted = false, false
+	// tags are private to owners of robots
+	f.Tags = nil
+	f.Visibility = robot.VisibilityPublic
+
+	limit := f.Limit
+	f.Limit++
+
+	robots, err := h.robotStorage.List(f)
+	if err != nil {
+		h.logger.Errorf("can't get public robots from storage (filter: %+v): %v", f, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	if len(robots) > limit {
+		robots = robots[:limit]
+		w.Header().Set("Link", nextPageLink(r, robot.CursorAfter(robots[limit-1], f)))
+	}
+
+	catalogue := make([]catalogueRobot, 0, len(robots))
+	for _, rbt := range robots {
+		catalogue = append(catalogue, newCatalogueRobot(rbt))
+	}
+
+	err = respondJSON(w, catalogue)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+// forkRobot makes a private copy of a public robot for the user.
+func (h *Handler) forkRobot(w http.ResponseWriter, r *http.Request) {
+	rbtID, p, err := h.getRobotAndPrincipal(r, apikey.ScopeRobotsWrite)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	rbtFromDB, err := findRobot(h.robotStorage, rbtID)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	if rbtFromDB.DeletedAt != nil {
+		h.logger.Errorf("can't find robot with id: %v in storage", rbtID)
+		render.Error(w, r, errRobotNotFound(rbtID))
+		return
+	}
+
+	if rbtFromDB.Visibility != robot.VisibilityPublic {
+		err = apperr.Newf(apperr.KindForbidden, codeRobotNotPublic, "robot with id: %v isn't public", rbtID)
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	fork := copyForFavourite(rbtFromDB, p.userID)
+	fork.IsFavourite = false
+
+	err = h.robotStorage.Create(fork)
+	if err != nil {
+		h.logger.Errorf("can't create fork of robot with id: %v: %v", rbtID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	h.recordChange(r, robotEntry(p.userID, audit.ForkRobot, fork.RobotID), nil, fork)
+	h.recordRevision(p.userID, nil, fork)
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/robot/%d", fork.RobotID))
+
+	err = respondJSONStatus(w, http.StatusCreated, fork)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	go h.hub.Broadcast(fork)
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"cw1/internal/follow"
+	"cw1/internal/format"
+	"cw1/internal/robot"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// filterRecorder keeps the filter robots were listed with.
+type filterRecorder struct {
+	mockRobotStorage
+	f robot.Filter
+}
+
+func (m *filterRecorder) List(f robot.Filter) ([]*robot.Robot, error) {
+	m.f = f
+	return m.mockRobotStorage.List(f)
+}
+
+func TestGetRobotsHidesPrivateRobots(t *testing.T) {
+	rs := &filterRecorder{}
+	h := newTestHandler(3, rs)
+
+	req := requestFor(t, "GET", "/api/v1/robots?user=1", "")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.getRobots).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("getRobots handler returned wrong status code: got %v, want %v", status, http.StatusOK)
+	}
+
+	if rs.f.VisibleTo != 3 {
+		t.Errorf("getRobots handler listed robots of other users without visibility: %+v", rs.f)
+	}
+}
+
+func TestGetRobotsTrash(t *testing.T) {
+	rs := &filterRecorder{}
+	h := newTestHandler(3, rs)
+
+	req := requestFor(t, "GET", "/api/v1/robots?deleted=true", "")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.getRobots).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("getRobots handler returned wrong status code: got %v, want %v", status, http.StatusOK)
+	}
+
+	if !rs.f.Deleted || rs.f.OwnerID != 3 {
+		t.Errorf("getRobots handler listed wrong trash: %+v", rs.f)
+	}
+}
+
+func TestGetRobotShared(t *testing.T) {
+	for _, v := range []string{robot.VisibilityPrivate, robot.VisibilityUnlisted} {
+		rs := &mockRobotStorage{rr: []*robot.Robot{{RobotID: 5, OwnerUserID: 1, Visibility: v}}}
+		h := newTestHandler(2, rs)
+
+		req := requestFor(t, "GET", "/api/v1/robot/5", "", "id", "5")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.getRobot).ServeHTTP(rr, req)
+
+		expected := http.StatusOK
+		if v == robot.VisibilityPrivate {
+			expected = http.StatusForbidden
+		}
+
+		if status := rr.Code; status != expected {
+			t.Errorf("getRobot handler returned wrong status code for %v robot: got %v, want %v", v, status, expected)
+		}
+	}
+}
+
+// TestGetRobotHidesParams shows parameters of shared robots to their followers
+// only, other users get the catalogue view.
+func TestGetRobotHidesParams(t *testing.T) {
+	tests := []struct {
+		userID int64
+		params bool
+	}{
+		{1, true},
+		{2, true},
+		{3, false},
+	}
+
+	for _, tt := range tests {
+		rs := &mockRobotStorage{rr: []*robot.Robot{planned(5, 1, -time.Hour, time.Hour)}}
+		rs.rr[0].Visibility = robot.VisibilityPublic
+
+		ff := map[int64]*follow.Follow{7: {RobotID: 7, ParentRobotID: 5, UserID: 2, Mode: follow.ModeAuto}}
+		h := newTestHandler(tt.userID, rs, WithFollowStorage(&mockFollowStorage{ff: ff}))
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.getRobot).ServeHTTP(rr, requestFor(t, "GET", "/api/v1/robot/5", "", "id", "5"))
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("getRobot handler returned wrong status code: got %v, want %v", status, http.StatusOK)
+		}
+
+		if strings.Contains(rr.Body.String(), `"buy_price"`) != tt.params {
+			t.Errorf("getRobot handler returned wrong view for user %v: %v", tt.userID, rr.Body.String())
+		}
+	}
+}
+
+func TestGetCatalogue(t *testing.T) {
+	price := &format.NullFloat64{}
+	price.V.Float64, price.V.Valid = 100, true
+
+	yield := &format.NullFloat64{}
+	yield.V.Float64, yield.V.Valid = 30, true
+
+	rs := &filterRecorder{mockRobotStorage: mockRobotStorage{rr: []*robot.Robot{
+		{RobotID: 5, OwnerUserID: 1, BuyPrice: price, FactYield: yield, DealsCount: format.NewNullInt64(3),
+			Visibility: robot.VisibilityPublic},
+	}}}
+	h := newTestHandler(2, rs)
+
+	req := requestFor(t, "GET", "/api/v1/catalogue?sort=-fact_yield", "")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.getCatalogue).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("getCatalogue handler returned wrong status code: got %v, want %v", status, http.StatusOK)
+	}
+
+	if rs.f.Visibility != robot.VisibilityPublic || rs.f.Sort != robot.SortFactYield || !rs.f.Desc {
+		t.Errorf("getCatalogue handler listed robots with wrong filter: %+v", rs.f)
+	}
+
+	expected := `[{"robot_id":5,"owner_user_id":1,"is_active":false,"fact_yield":30,"deals_count":3,"avg_deal_yield":10}]`
+	if body := strings.TrimSpace(rr.Body.String()); body != expected {
+		t.Errorf("getCatalogue handler returned unexpected body: got %v, want %v", body, expected)
+	}
+}
+
+func TestForkRobot(t *testing.T) {
+	tests := []struct {
+		visibility string
+		status     int
+	}{
+		{robot.VisibilityPublic, http.StatusCreated},
+		{robot.VisibilityUnlisted, http.StatusForbidden},
+		{robot.VisibilityPrivate, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		rs := &mockRobotStorage{rr: []*robot.Robot{{RobotID: 5, OwnerUserID: 1, Visibility: tt.visibility}}}
+		h := newTestHandler(2, rs)
+
+		req := requestFor(t, "POST", "/api/v1/robot/5/fork", "", "id", "5")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.forkRobot).ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tt.status {
+			t.Errorf("forkRobot handler returned wrong status code for %v robot: got %v, want %v",
+				tt.visibility, status, tt.status)
+		}
+
+		if tt.status != http.StatusCreated {
+			continue
+		}
+
+		expected := `"owner_user_id":2,"parent_robot_id":5,"is_favourite":false,"is_active":false,"visibility":"private"`
+		if !respContains(rr.Body.String(), expected) {
+			t.Errorf("forkRobot handler returned unexpected body: got %v, want %v", rr.Body.String(), expected)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"cw1/internal/apperr"
+	"cw1/internal/robot"
+
+	"github.com/pkg/errors"
+)
+
+// Codes of errors returned by handlers, clients rely on them so they must not change.
+const (
+	codeInvalidID          = "invalid_id"
+	codeInvalidQuery       = "invalid_query_param"
+	codeUserNotFound       = "user_not_found"
+	codeEmailTaken         = "email_taken"
+	codeInvalidEmail       = "invalid_email"
+	codeWeakPassword       = "weak_password"
+	codeBadCredentials     = "invalid_credentials"
+	codeEmailNotVerified   = "email_not_verified"
+	codeAccountLocked      = "account_locked"
+	codeInvalidToken       = "invalid_token"
+	codeRobotNotFound      = "robot_not_found"
+	codeRobotForbidden     = "robot_forbidden"
+	codeRobotState         = "robot_state_conflict"
+	codeAPIKeyNotFound     = "api_key_not_found"
+	codeInvalidAPIKey      = "invalid_api_key"
+	codeScopeMissing       = "scope_missing"
+	codeReadOnly           = "impersonation_read_only"
+	codeTwoFactorRequired  = "two_factor_required"
+	codeInvalidTwoFactor   = "invalid_two_factor_code"
+	codeTwoFactorEnrolled  = "two_factor_already_enabled"
+	codeTwoFactorNotEnroll = "two_factor_not_enrolled"
+	codeVerifyThrottled    = "verification_throttled"
+	codeInvalidAuthHeader  = "invalid_authorization_header"
+	codeRobotModified      = "robot_modified"
+	codeNotACopy           = "robot_not_a_copy"
+	codeFollowNotFound     = "follow_not_found"
+	codeNothingPending     = "no_pending_changes"
+	codeRobotNotPublic     = "robot_not_public"
+	codeRevisionNotFound   = "revision_not_found"
+	codeTagNotFound        = "tag_not_found"
+	codeTagExists          = "tag_exists"
+	codeTemplateNotFound   = "template_not_found"
+	codeNoMarketPrice      = "no_market_price"
+	codeJobNotFound        = "job_not_found"
+	codeWebhookNotFound    = "webhook_not_found"
+	codeWebhookDisabled    = "webhook_disabled"
+	codeDeliveryNotFound   = "delivery_not_found"
+	codeDeliveryPending    = "delivery_pending"
+)
+
+var errMalformed = apperr.New(apperr.KindInvalid, apperr.CodeMalformedRequest, "request body is malformed")
+
+func errInvalidID(id interface{}) error {
+	return apperr.Newf(apperr.KindInvalid, codeInvalidID, "incorrect id: %v", id)
+}
+
+func errUserNotFound(id int64) error {
+	return apperr.Newf(apperr.KindNotFound, codeUserNotFound, "user %d don't find", id)
+}
+
+func errRobotNotFound(id int64) error {
+	return apperr.Newf(apperr.KindNotFound, codeRobotNotFound, "robot with id %v don't exist", id)
+}
+
+func errRobotForbidden(format string, args ...interface{}) error {
+	return apperr.Newf(apperr.KindForbidden, codeRobotForbidden, format, args...)
+}
+
+// errRobotModified asks the client to retry when the robot was changed
+// between reading and updating, other errors are returned as is.
+func errRobotModified(err error, id int64) error {
+	if errors.Cause(err) != robot.ErrConflict {
+		return err
+	}
+
+	return apperr.Newf(apperr.KindConflict, codeRobotModified, "robot with id %v was modified concurrently, try again", id)
+}
+
+const msgVisibility = "must be " + robot.VisibilityPrivate + ", " + robot.VisibilityUnlisted + " or " + robot.VisibilityPublic
+
+func errNothingPending(id int64) error {
+	return apperr.Newf(apperr.KindConflict, codeNothingPending, "robot with id %v has no changes of its parent to approve", id)
+}
+
+var errEmailNotVerified = apperr.New(apperr.KindForbidden, codeEmailNotVerified, "email is not verified")
+
+func errEmailTaken(email string) error {
+	return apperr.Newf(apperr.KindConflict, codeEmailTaken, "user %s is already registered", email)
+}
+
+// errWeakPassword shows the reason of the password policy to the client.
+func errWeakPassword(err error) error {
+	return apperr.New(apperr.KindInvalid, codeWeakPassword, err.Error())
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"cw1/cmd/auth-api/render"
+	"cw1/cmd/socket"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorResponseIsProblem(t *testing.T) {
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub)
+
+	req, err := http.NewRequest("GET", "/api/v1/users/abc/robots", nil)
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	h.Routes().ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v, want %v",
+			status, http.StatusBadRequest)
+	}
+
+	if ct := rr.Header().Get(render.ContentTypeHeader); ct != render.ProblemContentType {
+		t.Errorf("handler returned wrong content type: got %v, want %v", ct, render.ProblemContentType)
+	}
+
+	var p render.Problem
+
+	if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil {
+		t.Fatalf("can't unmarshal response %v", err)
+	}
+
+	if p.Code != codeInvalidID || p.Status != http.StatusBadRequest {
+		t.Errorf("handler returned unexpected problem: %+v", p)
+	}
+
+	if p.RequestID == "" || p.RequestID != rr.Header().Get(render.RequestIDHeader) {
+		t.Errorf("handler returned request id %q, header has %q",
+			p.RequestID, rr.Header().Get(render.RequestIDHeader))
+	}
+}
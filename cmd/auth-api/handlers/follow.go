@@ -0,0 +1,417 @@
+package handler
+
+import (
+	"cw1/cmd/auth-api/render"
+	"cw1/internal/apikey"
+	"cw1/internal/apperr"
+	"cw1/internal/audit"
+	"cw1/internal/follow"
+	"cw1/internal/policy"
+	"cw1/internal/robot"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+type followSettings struct {
+	Mode           string `json:"mode"`
+	SyncActivation bool   `json:"sync_activation"`
+}
+
+// followRobot makes the copy of a robot follow its parent or changes the settings of following.
+func (h *Handler) followRobot(w http.ResponseWriter, r *http.Request) {
+	var settings followSettings
+
+	err := decodeJSON(w, r, &settings)
+	if err != nil {
+		h.logger.Errorf("can't unmarshal input json for follow robot: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	if !follow.IsMode(settings.Mode) {
+		render.Error(w, r, apperr.Validation(map[string]string{
+			"mode": "must be " + follow.ModeAuto + " or " + follow.ModeApprove,
+		}))
+		return
+	}
+
+	rbt, p, err := h.findOwnRobot(r)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	if rbt.ParentRobotID == nil || !rbt.ParentRobotID.V.Valid {
+		err = apperr.Newf(apperr.KindConflict, codeNotACopy, "robot with id: %v isn't a copy of another robot", rbt.RobotID)
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	parent, err := findRobot(h.robotStorage, rbt.ParentRobotID.V.Int64)
+	if err == nil && parent.DeletedAt != nil {
+		err = errRobotNotFound(parent.RobotID)
+	}
+
+	if err != nil {
+		h.logger.Errorf("can't find parent of robot with id: %v: %v", rbt.RobotID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	if !h.canRead(p, parent) {
+		err = errRobotForbidden("user with id: %v don't have permission to follow robot with id: %v", p.userID, parent.RobotID)
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	f, err := h.followStorage.FindByRobotID(rbt.RobotID)
+	if err != nil {
+		h.logger.Errorf("can't find follow of robot with id: %v: %v", rbt.RobotID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	before := *f
+
+	f.RobotID = rbt.RobotID
+	f.ParentRobotID = parent.RobotID
+	f.UserID = rbt.OwnerUserID
+	f.Mode = settings.Mode
+	f.SyncActivation = settings.SyncActivation
+
+	err = h.followStorage.Create(f)
+	if err != nil {
+		h.logger.Errorf("can't save follow of robot with id: %v: %v", rbt.RobotID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	h.recordChange(r, robotEntry(p.userID, audit.FollowRobot, rbt.RobotID), &before, f)
+
+	// the copy catches up with the parent it was made from
+	h.offerParams(r, p.userID, f, follow.ParamsOf(parent))
+
+	err = respondJSON(w, f)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+func (h *Handler) unfollowRobot(w http.ResponseWriter, r *http.Request) {
+	f, p, err := h.findOwnFollow(r)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	err = h.followStorage.Delete(f.RobotID)
+	if err != nil {
+		h.logger.Errorf("can't delete follow of robot with id: %v: %v", f.RobotID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	h.recordChange(r, robotEntry(p.userID, audit.UnfollowRobot, f.RobotID), f, nil)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// approveFollow applies the changes of the parent waiting for approval to the copy.
+func (h *Handler) approveFollow(w http.ResponseWriter, r *http.Request) {
+	f, p, err := h.findOwnFollow(r)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	if f.Pending == nil {
+		err = errNothingPending(f.RobotID)
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	rbt, err := h.updateFollower(r, p.userID, f.RobotID, f.Pending.Apply)
+	if err != nil {
+		h.logger.Errorf("can't apply pending changes to robot with id: %v: %v", f.RobotID, err)
+		render.Error(w, r, errRobotModified(err, f.RobotID))
+		return
+	}
+
+	f.Pending = nil
+
+	err = h.followStorage.Update(f)
+	if err != nil {
+		h.logger.Errorf("can't clear pending changes of robot with id: %v: %v", f.RobotID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = respondJSON(w, rbt)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+func (h *Handler) rejectFollow(w http.ResponseWriter, r *http.Request) {
+	f, _, err := h.findOwnFollow(r)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	if f.Pending == nil {
+		err = errNothingPending(f.RobotID)
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	f.Pending = nil
+
+	err = h.followStorage.Update(f)
+	if err != nil {
+		h.logger.Errorf("can't clear pending changes of robot with id: %v: %v", f.RobotID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = respondJSON(w, f)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+func (h *Handler) getFollowers(w http.ResponseWriter, r *http.Request) {
+	rbtID, p, err := h.getRobotAndPrincipal(r, apikey.ScopeRobotsRead)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	rbt, err := findRobot(h.robotStorage, rbtID)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	if !h.allowed(p, policy.ReadRobot, rbt.OwnerUserID) {
+		err = errRobotForbidden("user with id: %v don't have permission to get followers of robot with id: %v", p.userID, rbtID)
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	follows, err := h.followStorage.FindByParentID(rbtID)
+	if err != nil {
+		h.logger.Errorf("can't find followers of robot with id: %v: %v", rbtID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = respondJSON(w, follows)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+// findOwnRobot returns the robot from the URL which the principal may update.
+func (h *Handler) findOwnRobot(r *http.Request) (*robot.Robot, *principal, error) {
+	rbtID, p, err := h.getRobotAndPrincipal(r, apikey.ScopeRobotsWrite)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rbt, err := findRobot(h.robotStorage, rbtID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if rbt.DeletedAt != nil {
+		return nil, nil, errRobotNotFound(rbtID)
+	}
+
+	if !h.allowed(p, policy.UpdateRobot, rbt.OwnerUserID) {
+		return nil, nil, errRobotForbidden("user with id: %v don't have permission to update robot with id: %v", p.userID, rbtID)
+	}
+
+	return rbt, p, nil
+}
+
+func (h *Handler) findOwnFollow(r *http.Request) (*follow.Follow, *principal, error) {
+	rbt, p, err := h.findOwnRobot(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := h.followStorage.FindByRobotID(rbt.RobotID)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "can't find follow of robot with id: %v", rbt.RobotID)
+	}
+
+	if f.RobotID == BottomLineValidID {
+		return nil, nil, apperr.Newf(apperr.KindNotFound, codeFollowNotFound, "robot with id: %v doesn't follow its parent", rbt.RobotID)
+	}
+
+	return f, p, nil
+}
+
+// syncFollowers passes the changes of the parent to the robots following it.
+// The parent is already saved, so failures are only logged.
+func (h *Handler) syncFollowers(r *http.Request, actorID int64, before *robot.Robot, parent *robot.Robot) {
+	if h.followStorage == nil {
+		return
+	}
+
+	params := follow.ParamsOf(parent)
+	paramsChanged := !params.Equal(follow.ParamsOf(before))
+	activationChanged := parent.IsActive != before.IsActive
+
+	if !paramsChanged && !activationChanged {
+		return
+	}
+
+	follows, err := h.followStorage.FindByParentID(parent.RobotID)
+	if err != nil {
+		h.logger.Errorf("can't find followers of robot with id: %v: %v", parent.RobotID, err)
+		return
+	}
+
+	for _, f := range follows {
+		// followers of a robot made private keep their copies as they are
+		if !parent.IsShared() && f.UserID != parent.OwnerUserID {
+			continue
+		}
+
+		if paramsChanged {
+			h.offerParams(r, actorID, f, params)
+		}
+
+		if activationChanged && f.SyncActivation {
+			err = h.syncActivation(f, parent.IsActive)
+			if err != nil {
+				h.logger.Errorf("can't sync activation of robot with id: %v: %v", f.RobotID, err)
+			}
+		}
+	}
+}
+
+// syncActivation activates or deactivates the follower on behalf of its owner,
+// so the follower passes the same checks as if the owner did it. The owner
+// isn't there to enter the second factor, so followers which need it are left
+// as they are.
+func (h *Handler) syncActivation(f *follow.Follow, active bool) error {
+	rbt, err := findRobot(h.robotStorage, f.RobotID)
+	if err != nil {
+		return err
+	}
+
+	if rbt.DeletedAt != nil || rbt.IsActive == active {
+		return nil
+	}
+
+	p := &principal{userID: rbt.OwnerUserID}
+
+	if active {
+		err = h.activateRobot(nil, newActivationFactor(nil), p, rbt)
+	} else {
+		err = h.deactivateRobot(nil, p, rbt)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	go h.hub.Broadcast(rbt)
+
+	return nil
+}
+
+// offerParams applies parameters of the parent to the follower at once or
+// leaves them for approval depending on the mode.
+func (h *Handler) offerParams(r *http.Request, actorID int64, f *follow.Follow, params *follow.Params) {
+	rbt, err := findRobot(h.robotStorage, f.RobotID)
+	if err != nil {
+		h.logger.Errorf("can't find follower: %v", err)
+		return
+	}
+
+	pending := params
+
+	switch {
+	case params.Equal(follow.ParamsOf(rbt)):
+		pending = nil
+	case f.Mode == follow.ModeAuto:
+		_, err = h.updateFollower(r, actorID, f.RobotID, params.Apply)
+		if err != nil {
+			h.logger.Errorf("can't apply changes of parent to robot with id: %v: %v", f.RobotID, err)
+			return
+		}
+
+		pending = nil
+	}
+
+	if f.Pending == nil && pending == nil {
+		return
+	}
+
+	f.Pending = pending
+
+	err = h.followStorage.Update(f)
+	if err != nil {
+		h.logger.Errorf("can't offer changes of parent to robot with id: %v: %v", f.RobotID, err)
+	}
+}
+
+// updateFollower changes the follower, it's read again when it was updated meanwhile.
+// Deleted followers are left as they are.
+func (h *Handler) updateFollower(r *http.Request, actorID int64, rbtID int64,
+	change func(rbt *robot.Robot)) (*robot.Robot, error) {
+	const maxAttempts = 3
+
+	for attempt := 1; ; attempt++ {
+		rbt, err := findRobot(h.robotStorage, rbtID)
+		if err != nil {
+			return nil, err
+		}
+
+		if rbt.DeletedAt != nil {
+			return rbt, nil
+		}
+
+		before := *rbt
+
+		change(rbt)
+
+		err = h.robotStorage.Update(rbt)
+		if err == nil {
+			h.recordChange(r, robotEntry(actorID, audit.UpdateRobot, rbtID), &before, rbt)
+			h.recordRevision(actorID, &before, rbt)
+
+			go h.hub.Broadcast(rbt)
+
+			return rbt, nil
+		}
+
+		if errors.Cause(err) != robot.ErrConflict || attempt == maxAttempts {
+			return nil, errors.Wrap(err, "can't update robot")
+		}
+	}
+}
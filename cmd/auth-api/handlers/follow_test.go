@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"cw1/internal/audit"
+	"cw1/internal/follow"
+	"cw1/internal/format"
+	"cw1/internal/robot"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type mockFollowStorage struct {
+	ff map[int64]*follow.Follow
+}
+
+func (m *mockFollowStorage) Create(f *follow.Follow) error {
+	m.ff[f.RobotID] = f
+	return nil
+}
+
+func (m *mockFollowStorage) FindByRobotID(robotID int64) (*follow.Follow, error) {
+	if f, ok := m.ff[robotID]; ok {
+		return f, nil
+	}
+
+	return &follow.Follow{}, nil
+}
+
+func (m *mockFollowStorage) FindByParentID(parentID int64) ([]*follow.Follow, error) {
+	res := make([]*follow.Follow, 0)
+
+	for _, f := range m.ff {
+		if f.ParentRobotID == parentID {
+			res = append(res, f)
+		}
+	}
+
+	return res, nil
+}
+
+func (m *mockFollowStorage) Update(f *follow.Follow) error {
+	m.ff[f.RobotID] = f
+	return nil
+}
+
+func (m *mockFollowStorage) Delete(robotID int64) error {
+	delete(m.ff, robotID)
+	return nil
+}
+
+func newFollowHandler(userID int64, rbts []*robot.Robot, ff map[int64]*follow.Follow) *Handler {
+	return newTestHandler(userID, &mockRobotStorage{rr: rbts}, WithFollowStorage(&mockFollowStorage{ff: ff}))
+}
+
+func TestFollowRobot(t *testing.T) {
+	rbts := []*robot.Robot{
+		{RobotID: 7, OwnerUserID: 1, ParentRobotID: format.NewNullInt64(5)},
+		{RobotID: 5, OwnerUserID: 2, BuyPrice: &format.NullFloat64{}, Visibility: robot.VisibilityPublic},
+	}
+	rbts[1].BuyPrice.V.Float64, rbts[1].BuyPrice.V.Valid = 10, true
+
+	ff := make(map[int64]*follow.Follow)
+	h := newFollowHandler(1, rbts, ff)
+
+	req := requestFor(t, "PUT", "/api/v1/robot/7/follow", `{"mode": "auto", "sync_activation": true}`, "id", "7")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.followRobot).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("followRobot handler returned wrong status code: got %v, want %v: %v",
+			status, http.StatusOK, rr.Body.String())
+	}
+
+	f, ok := ff[7]
+	if !ok || f.ParentRobotID != 5 || f.Mode != follow.ModeAuto || !f.SyncActivation {
+		t.Errorf("followRobot handler saved wrong follow: %+v", f)
+	}
+
+	if rbts[0].BuyPrice == nil || rbts[0].BuyPrice.V.Float64 != 10 {
+		t.Errorf("followRobot handler didn't copy parameters of the parent: %+v", rbts[0].BuyPrice)
+	}
+}
+
+func TestFollowRobotErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+	}{
+		{"no parent", `{"mode": "auto"}`, http.StatusConflict, codeNotACopy},
+		{"bad mode", `{"mode": "sometimes"}`, http.StatusUnprocessableEntity, "validation_failed"},
+	}
+
+	for _, tt := range tests {
+		rbts := []*robot.Robot{
+			{RobotID: 7, OwnerUserID: 1},
+		}
+
+		h := newFollowHandler(1, rbts, make(map[int64]*follow.Follow))
+
+		req := requestFor(t, "PUT", "/api/v1/robot/7/follow", tt.body, "id", "7")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.followRobot).ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tt.status {
+			t.Errorf("followRobot handler returned wrong status code for %v: got %v, want %v",
+				tt.name, status, tt.status)
+		}
+
+		expected := `"code":"` + tt.code + `"`
+		if !respContains(rr.Body.String(), expected) {
+			t.Errorf("followRobot handler returned unexpected body for %v: got %v, want %v",
+				tt.name, rr.Body.String(), expected)
+		}
+	}
+}
+
+func TestUpdateRobotSyncsFollowers(t *testing.T) {
+	rbts := []*robot.Robot{
+		{RobotID: 5, OwnerUserID: 1, Visibility: robot.VisibilityUnlisted},
+		{RobotID: 7, OwnerUserID: 2, ParentRobotID: format.NewNullInt64(5)},
+		{RobotID: 8, OwnerUserID: 3, ParentRobotID: format.NewNullInt64(5)},
+	}
+
+	ff := map[int64]*follow.Follow{
+		7: {RobotID: 7, ParentRobotID: 5, UserID: 2, Mode: follow.ModeAuto},
+		8: {RobotID: 8, ParentRobotID: 5, UserID: 3, Mode: follow.ModeApprove},
+	}
+
+	h := newFollowHandler(1, rbts, ff)
+
+	req := requestFor(t, "PUT", "/api/v1/robot/5", `{"buy_price": 56.5,`+robotParams+`}`, "id", "5")
+	req.Header.Set("If-Match", `"0"`)
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.updateRobot).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("updateRobot handler returned wrong status code: got %v, want %v",
+			status, http.StatusOK)
+	}
+
+	if rbts[1].BuyPrice == nil || rbts[1].BuyPrice.V.Float64 != 56.5 {
+		t.Errorf("updateRobot handler didn't apply changes to the auto follower: %+v", rbts[1].BuyPrice)
+	}
+
+	if rbts[2].BuyPrice != nil {
+		t.Errorf("updateRobot handler applied changes to the approving follower: %+v", rbts[2].BuyPrice)
+	}
+
+	if p := ff[8].Pending; p == nil || p.BuyPrice == nil || p.BuyPrice.V.Float64 != 56.5 {
+		t.Errorf("updateRobot handler didn't offer changes to the approving follower: %+v", p)
+	}
+}
+
+// TestActivateRobotSyncsFollowers activates followers on behalf of their
+// owners, a follower out of its plan stays inactive.
+func TestActivateRobotSyncsFollowers(t *testing.T) {
+	parent := planned(5, 1, -time.Hour, time.Hour)
+	parent.Visibility = robot.VisibilityUnlisted
+
+	rbts := []*robot.Robot{parent, planned(7, 2, -time.Hour, time.Hour), planned(8, 3, time.Hour, 2*time.Hour)}
+
+	ff := map[int64]*follow.Follow{
+		7: {RobotID: 7, ParentRobotID: 5, UserID: 2, Mode: follow.ModeAuto, SyncActivation: true},
+		8: {RobotID: 8, ParentRobotID: 5, UserID: 3, Mode: follow.ModeAuto, SyncActivation: true},
+	}
+
+	as := new(mockAuditStorage)
+
+	h := newFollowHandler(1, rbts, ff)
+	h.auditStorage = as
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.activate).ServeHTTP(rr, requestFor(t, "PUT", "/api/v1/robot/5/activate", "", "id", "5"))
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("activate handler returned wrong status code: got %v, want %v", status, http.StatusOK)
+	}
+
+	if !rbts[1].IsActive || rbts[2].IsActive {
+		t.Errorf("activate handler synced followers wrong: %v, %v", rbts[1].IsActive, rbts[2].IsActive)
+	}
+
+	var synced bool
+
+	for _, e := range as.entries {
+		if e.TargetID == 7 {
+			synced = e.Action == audit.ActivateRobot && e.ActorID == 2
+		}
+	}
+
+	if !synced {
+		t.Errorf("activate handler didn't record activation of follower by its owner: %+v", as.entries)
+	}
+}
+
+func TestApproveFollow(t *testing.T) {
+	rbts := []*robot.Robot{
+		{RobotID: 8, OwnerUserID: 1, ParentRobotID: format.NewNullInt64(5)},
+	}
+
+	price := &format.NullFloat64{}
+	price.V.Float64, price.V.Valid = 42, true
+
+	ff := map[int64]*follow.Follow{
+		8: {RobotID: 8, ParentRobotID: 5, UserID: 1, Mode: follow.ModeApprove, Pending: &follow.Params{BuyPrice: price}},
+	}
+
+	h := newFollowHandler(1, rbts, ff)
+
+	req := requestFor(t, "POST", "/api/v1/robot/8/follow/approve", "", "id", "8")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.approveFollow).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("approveFollow handler returned wrong status code: got %v, want %v",
+			status, http.StatusOK)
+	}
+
+	if rbts[0].BuyPrice == nil || rbts[0].BuyPrice.V.Float64 != 42 {
+		t.Errorf("approveFollow handler didn't apply pending changes: %+v", rbts[0].BuyPrice)
+	}
+
+	if ff[8].Pending != nil {
+		t.Errorf("approveFollow handler didn't clear pending changes: %+v", ff[8].Pending)
+	}
+
+	req = requestFor(t, "POST", "/api/v1/robot/8/follow/approve", "", "id", "8")
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(h.approveFollow).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusConflict {
+		t.Errorf("approveFollow handler returned wrong status code without pending changes: got %v, want %v",
+			status, http.StatusConflict)
+	}
+}
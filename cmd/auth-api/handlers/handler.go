@@ -1,18 +1,37 @@
 package handler
 
 import (
+	"cw1/cmd/auth-api/render"
 	"cw1/cmd/socket"
+	"cw1/internal/apikey"
+	"cw1/internal/audit"
+	"cw1/internal/follow"
 	"cw1/internal/format"
+	"cw1/internal/leaderboard"
+	"cw1/internal/limiter"
+	"cw1/internal/mail"
+	"cw1/internal/password"
+	"cw1/internal/quote"
+	"cw1/internal/reset"
+	"cw1/internal/revision"
 	"cw1/internal/robot"
+	"cw1/internal/robottemplate"
+	"cw1/internal/schedule"
 	"cw1/internal/session"
+	"cw1/internal/tag"
+	"cw1/internal/totp"
 	"cw1/internal/user"
+	"cw1/internal/verification"
+	"cw1/internal/webhook"
 	"cw1/pkg/log/logger"
 	"fmt"
 	"html/template"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
 	"github.com/pkg/errors"
 )
 
@@ -21,25 +40,199 @@ type Handler struct {
 	userStorage    user.Storage
 	sessionStorage session.Storage
 	robotStorage   robot.Storage
+	apiKeyStorage  apikey.Storage
+	resetStorage   reset.Storage
+	mailSender     mail.Sender
+	verifyStorage  verification.Storage
+	totpStorage    totp.Storage
+	baseURL        string
+	totpBuyPrice   float64
+	tickers        map[string]bool
+	limiter        *limiter.Limiter
+	hasher         *password.Hasher
+	passwordPolicy password.Policy
+	auditStorage   audit.Storage
+	followStorage  follow.Storage
+	leaderboard    *leaderboard.Cache
+	revStorage     revision.Storage
+	tagStorage     tag.Storage
+	tmplStorage    robottemplate.Storage
+	quotes         *quote.Book
+	quoteMaxAge    time.Duration
+	schedStorage   schedule.Storage
+	hookStorage    webhook.Storage
+	webhooks       *webhook.Dispatcher
 	hub            *socket.Hub
 	tmplts         map[string]*template.Template
 }
 
+// Option sets an optional dependency of the Handler.
+type Option func(h *Handler)
+
+func WithAPIKeyStorage(s apikey.Storage) Option {
+	return func(h *Handler) {
+		h.apiKeyStorage = s
+	}
+}
+
+func WithResetStorage(s reset.Storage) Option {
+	return func(h *Handler) {
+		h.resetStorage = s
+	}
+}
+
+func WithMailSender(s mail.Sender) Option {
+	return func(h *Handler) {
+		h.mailSender = s
+	}
+}
+
+func WithVerificationStorage(s verification.Storage) Option {
+	return func(h *Handler) {
+		h.verifyStorage = s
+	}
+}
+
+// WithBaseURL sets the public address of the API used in links sent by mail.
+func WithBaseURL(u string) Option {
+	return func(h *Handler) {
+		h.baseURL = u
+	}
+}
+
+func WithTOTPStorage(s totp.Storage) Option {
+	return func(h *Handler) {
+		h.totpStorage = s
+	}
+}
+
+// WithActivationBuyPrice requires a fresh TOTP code to activate robots with
+// buy price above v, zero disables the check.
+func WithActivationBuyPrice(v float64) Option {
+	return func(h *Handler) {
+		h.totpBuyPrice = v
+	}
+}
+
+// WithLimiter enables rate limiting and lockout of sign in and sign up.
+func WithLimiter(l *limiter.Limiter) Option {
+	return func(h *Handler) {
+		h.limiter = l
+	}
+}
+
+// WithPasswordHasher sets the hasher of new passwords, argon2id is used by default.
+func WithPasswordHasher(hs *password.Hasher) Option {
+	return func(h *Handler) {
+		h.hasher = hs
+	}
+}
+
+func WithPasswordPolicy(p password.Policy) Option {
+	return func(h *Handler) {
+		h.passwordPolicy = p
+	}
+}
+
+// WithTickers sets the instruments robots can be created for.
+func WithTickers(t []string) Option {
+	return func(h *Handler) {
+		h.tickers = robot.TickerSet(t)
+	}
+}
+
+func WithAuditStorage(s audit.Storage) Option {
+	return func(h *Handler) {
+		h.auditStorage = s
+	}
+}
+
+// WithFollowStorage lets copies of robots follow changes of their parents.
+func WithFollowStorage(s follow.Storage) Option {
+	return func(h *Handler) {
+		h.followStorage = s
+	}
+}
+
+func WithLeaderboard(c *leaderboard.Cache) Option {
+	return func(h *Handler) {
+		h.leaderboard = c
+	}
+}
+
+func WithRevisionStorage(s revision.Storage) Option {
+	return func(h *Handler) {
+		h.revStorage = s
+	}
+}
+
+// WithTagStorage lets users organize robots with tags.
+func WithTagStorage(s tag.Storage) Option {
+	return func(h *Handler) {
+		h.tagStorage = s
+	}
+}
+
+func WithTemplateStorage(s robottemplate.Storage) Option {
+	return func(h *Handler) {
+		h.tmplStorage = s
+	}
+}
+
+// WithQuotes sets the latest prices robots are created from templates with,
+// quotes older than maxAge aren't used, zero maxAge doesn't limit their age.
+func WithQuotes(b *quote.Book, maxAge time.Duration) Option {
+	return func(h *Handler) {
+		h.quotes = b
+		h.quoteMaxAge = maxAge
+	}
+}
+
+// WithScheduleStorage enables scheduled activation and deactivation of robots.
+func WithScheduleStorage(s schedule.Storage) Option {
+	return func(h *Handler) {
+		h.schedStorage = s
+	}
+}
+
+// WithWebhooks sends events of robots to hooks registered by their owners.
+func WithWebhooks(s webhook.Storage, d *webhook.Dispatcher) Option {
+	return func(h *Handler) {
+		h.hookStorage = s
+		h.webhooks = d
+	}
+}
+
 func New(logger logger.Logger, ut user.Storage, st session.Storage,
-	rt robot.Storage, hb *socket.Hub) (*Handler, error) {
+	rt robot.Storage, hb *socket.Hub, opts ...Option) (*Handler, error) {
 	t, err := parseTemplates()
 	if err != nil {
 		return nil, errors.Wrap(err, "can't parse templates for handler")
 	}
 
-	return &Handler{
+	hs, err := password.New(password.DefaultConfig())
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create password hasher")
+	}
+
+	h := &Handler{
 		logger:         logger,
 		userStorage:    ut,
 		sessionStorage: st,
 		robotStorage:   rt,
 		tmplts:         t,
 		hub:            hb,
-	}, nil
+		baseURL:        "http://localhost:5000",
+		hasher:         hs,
+		passwordPolicy: password.DefaultPolicy(),
+		tickers:        robot.TickerSet(robot.DefaultTickers),
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h, nil
 }
 
 func parseTemplates() (map[string]*template.Template, error) {
@@ -68,26 +261,85 @@ func parseTemplates() (map[string]*template.Template, error) {
 		return nil, errors.Wrapf(err, "can't parse index html template")
 	}
 
+	tmplts["leaderboard"], err = template.New("leaderboard").Funcs(funcMap).
+		ParseFiles(fmt.Sprintf("%s/base.html", pwd), fmt.Sprintf("%s/leaderboard.html", pwd))
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't parse leaderboard html template")
+	}
+
 	return tmplts, nil
 }
 
 func (h *Handler) Routes() chi.Router {
 	r := chi.NewRouter()
+	r.Use(middleware.RequestID, render.RequestID)
 	r.Route("/api/v1", func(r chi.Router) {
-		r.Post("/signup", h.signUp)
-		r.Post("/signin", h.signIn)
+		r.With(h.limitByIP).Post("/signup", h.signUp)
+		r.With(h.limitByIP).Post("/signin", h.signIn)
+		r.With(h.limitByIP).Post("/signin/2fa", h.signInTwoFactor)
+		r.With(h.limitByIP).Post("/password/forgot", h.forgotPassword)
+		r.With(h.limitByIP).Post("/password/reset", h.resetPassword)
+		r.Get("/verify", h.verifyEmail)
+		r.Post("/verify/resend", h.resendVerification)
+		r.Get("/users", h.getUsers)
+		r.Get("/audit", h.getAudit)
 		r.Put("/users/{id}", h.updateUser)
+		r.Patch("/users/{id}", h.patchUser)
+		r.Post("/users/{id}/password", h.changePassword)
 		r.Get("/users/{id}", h.getUser)
+		r.Delete("/users/{id}", h.deleteUser)
+		r.Get("/users/{id}/export", h.exportUser)
 		r.Get("/users/{id}/robots", h.getUserRobots)
+		r.Get("/users/{id}/api-keys", h.getAPIKeys)
+		r.Post("/users/{id}/api-keys", h.createAPIKey)
+		r.Delete("/users/{id}/api-keys/{keyID}", h.deleteAPIKey)
+		r.Get("/users/{id}/2fa", h.getTwoFactor)
+		r.Post("/users/{id}/2fa", h.enrollTwoFactor)
+		r.Post("/users/{id}/2fa/confirm", h.confirmTwoFactor)
+		r.Delete("/users/{id}/2fa", h.disableTwoFactor)
 
 		r.Post("/robot", h.createRobot)
 		r.Delete("/robot/{id}", h.deleteRobot)
+		r.Post("/robot/{id}/restore", h.restoreRobot)
 		r.Get("/robots", h.getRobots)
+		r.Post("/robots/bulk", h.bulkRobots)
+		r.Get("/templates", h.getTemplates)
+		r.Post("/templates", h.createTemplate)
+		r.Get("/templates/{id}", h.getTemplate)
+		r.Put("/templates/{id}", h.updateTemplate)
+		r.Delete("/templates/{id}", h.deleteTemplate)
+		r.Get("/webhooks", h.getWebhooks)
+		r.Post("/webhooks", h.createWebhook)
+		r.Get("/webhooks/{id}", h.getWebhook)
+		r.Put("/webhooks/{id}", h.updateWebhook)
+		r.Delete("/webhooks/{id}", h.deleteWebhook)
+		r.Post("/webhooks/{id}/ping", h.pingWebhook)
+		r.Get("/webhooks/{id}/deliveries", h.getDeliveries)
+		r.Post("/webhooks/{id}/deliveries/{deliveryID}/replay", h.replayDelivery)
+		r.Get("/tags", h.getTags)
+		r.Post("/tags", h.createTag)
+		r.Put("/tags/{id}", h.renameTag)
+		r.Delete("/tags/{id}", h.deleteTag)
+		r.Get("/catalogue", h.getCatalogue)
+		r.Get("/leaderboard", h.getLeaderboard)
+		r.Post("/robot/{id}/fork", h.forkRobot)
 		r.Put("/robot/{id}/favourite", h.makeFavourite) //nolint: misspell
 		r.Put("/robot/{id}/activate", h.activate)
 		r.Put("/robot/{id}/deactivate", h.deactivate)
 		r.Get("/robot/{id}", h.getRobot)
 		r.Put("/robot/{id}", h.updateRobot)
+		r.Put("/robot/{id}/tags", h.setRobotTags)
+		r.Get("/robot/{id}/schedule", h.getSchedule)
+		r.Post("/robot/{id}/schedule", h.createSchedule)
+		r.Delete("/robot/{id}/schedule/{jobID}", h.cancelSchedule)
+		r.Get("/robot/{id}/followers", h.getFollowers)
+		r.Put("/robot/{id}/follow", h.followRobot)
+		r.Delete("/robot/{id}/follow", h.unfollowRobot)
+		r.Post("/robot/{id}/follow/approve", h.approveFollow)
+		r.Post("/robot/{id}/follow/reject", h.rejectFollow)
+		r.Get("/robot/{id}/revisions", h.getRevisions)
+		r.Get("/robot/{id}/revisions/diff", h.diffRevisions)
+		r.Post("/robot/{id}/revisions/{rev}/restore", h.restoreRevision)
 	})
 
 	r.HandleFunc("/ws", func(w http.ResponseWriter, rr *http.Request) {
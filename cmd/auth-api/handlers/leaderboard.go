@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"cw1/cmd/auth-api/render"
+	"cw1/internal/apikey"
+	"cw1/internal/leaderboard"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLeaderboardLimit = 50
+	maxLeaderboardLimit     = 200
+)
+
+type leaderboardPage struct {
+	Period    string              `json:"period"`
+	Rank      string              `json:"rank"`
+	UpdatedAt time.Time           `json:"updated_at"`
+	Periods   []string            `json:"-"`
+	Robots    []leaderboard.Entry `json:"robots"`
+}
+
+// getLeaderboard ranks public robots from the cache, the page is rendered
+// for browsers and JSON is returned otherwise.
+func (h *Handler) getLeaderboard(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	page := leaderboardPage{
+		Period:  leaderboard.PeriodAll,
+		Rank:    leaderboard.RankYield,
+		Periods: leaderboard.Periods,
+	}
+
+	if v := q.Get("period"); v != "" {
+		if !leaderboard.IsPeriod(v) {
+			render.Error(w, r, errInvalidQuery("period", v))
+			return
+		}
+
+		page.Period = v
+	}
+
+	if v := q.Get("rank"); v != "" {
+		if !leaderboard.IsRank(v) {
+			render.Error(w, r, errInvalidQuery("rank", v))
+			return
+		}
+
+		page.Rank = v
+	}
+
+	limit := defaultLeaderboardLimit
+
+	if v := q.Get("limit"); v != "" {
+		var err error
+
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxLeaderboardLimit {
+			render.Error(w, r, errInvalidQuery("limit", v))
+			return
+		}
+	}
+
+	_, err := h.authorize(r, apikey.ScopeRobotsRead)
+	if err != nil {
+		h.logger.Errorf("can't authorize user: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	page.Robots, page.UpdatedAt = h.leaderboard.Board(page.Period, page.Rank, limit)
+
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		err = renderTemplate(w, "leaderboard", "base", h.tmplts, page)
+	} else {
+		err = respondJSON(w, page)
+	}
+
+	if err != nil {
+		h.logger.Errorf("can't respond with leaderboard: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
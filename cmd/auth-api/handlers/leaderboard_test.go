@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"cw1/internal/leaderboard"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type mockLeaderboardStorage struct {
+	entries []leaderboard.Entry
+	since   []time.Time
+}
+
+func (m *mockLeaderboardStorage) Compute(since time.Time) ([]leaderboard.Entry, error) {
+	m.since = append(m.since, since)
+	return m.entries, nil
+}
+
+func newLeaderboardHandler(t *testing.T) *Handler {
+	ratio := 0.5
+
+	s := &mockLeaderboardStorage{entries: []leaderboard.Entry{
+		{RobotID: 5, OwnerUserID: 1, Ticker: "AAPL", Yield: 10, Deals: 4, WinRate: 0.25},
+		{RobotID: 6, OwnerUserID: 2, Ticker: "SBER", Yield: 5, PlanRatio: &ratio, Deals: 2, WinRate: 1},
+	}}
+
+	c := leaderboard.NewCache(s, new(mockLogger))
+	if err := c.Refresh(); err != nil {
+		t.Fatalf("can't refresh leaderboard: %v", err)
+	}
+
+	if len(s.since) != len(leaderboard.Periods) {
+		t.Fatalf("leaderboard computed wrong number of periods: got %v, want %v", len(s.since), len(leaderboard.Periods))
+	}
+
+	h := newTestHandler(3, new(mockRobotStorage))
+	h.leaderboard = c
+
+	return h
+}
+
+func TestGetLeaderboard(t *testing.T) {
+	h := newLeaderboardHandler(t)
+
+	tests := []struct {
+		query string
+		first int64
+	}{
+		{"", 5},
+		{"?period=week&rank=win_rate", 6},
+		{"?rank=plan_ratio", 6},
+		{"?rank=deals&limit=1", 5},
+	}
+
+	for _, tt := range tests {
+		req := requestFor(t, "GET", "/api/v1/leaderboard"+tt.query, "")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.getLeaderboard).ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("getLeaderboard handler returned wrong status code for %q: got %v, want %v",
+				tt.query, status, http.StatusOK)
+		}
+
+		expected := fmt.Sprintf(`"robots":[{"rank":1,"robot_id":%d,`, tt.first)
+		if !respContains(rr.Body.String(), expected) {
+			t.Errorf("getLeaderboard handler returned unexpected body for %q: got %v, want %v",
+				tt.query, rr.Body.String(), expected)
+		}
+	}
+}
+
+func TestGetLeaderboardPage(t *testing.T) {
+	h := newLeaderboardHandler(t)
+
+	req := requestFor(t, "GET", "/api/v1/leaderboard?period=day", "")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.getLeaderboard).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("getLeaderboard handler returned wrong status code: got %v, want %v", status, http.StatusOK)
+	}
+
+	if !respContains(rr.Body.String(), `<table id="leaderboardTable"`) || !respContains(rr.Body.String(), "<td>SBER</td>") {
+		t.Errorf("getLeaderboard handler returned unexpected page: %v", rr.Body.String())
+	}
+}
+
+func TestGetLeaderboardInvalidQuery(t *testing.T) {
+	h := newLeaderboardHandler(t)
+
+	for _, q := range []string{"?period=year", "?rank=losses", "?limit=0"} {
+		req := requestFor(t, "GET", "/api/v1/leaderboard"+q, "")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.getLeaderboard).ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("getLeaderboard handler returned wrong status code for %q: got %v, want %v",
+				q, status, http.StatusBadRequest)
+		}
+	}
+}
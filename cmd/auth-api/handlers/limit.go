@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"cw1/cmd/auth-api/render"
+	"cw1/internal/apperr"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ipLimitPrefix      = "ip:"
+	accountLimitPrefix = "account:"
+)
+
+var (
+	errTooManyAttempts = apperr.New(apperr.KindRateLimited, apperr.CodeRateLimited, "too many attempts, try again later")
+	errAccountLocked   = apperr.New(apperr.KindRateLimited, codeAccountLocked,
+		"account is temporarily locked because of too many failed attempts")
+)
+
+// limitByIP rejects requests from addresses which exceeded the attempts limit.
+func (h *Handler) limitByIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.limiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ip := clientIP(r)
+
+		wait, err := h.limiter.Allow(ipLimitPrefix + r.URL.Path + ":" + ip)
+		if err != nil {
+			h.logger.Errorf("can't check attempts limit for %v: %v", ip, err)
+			render.Error(w, r, err)
+			return
+		}
+
+		if wait > 0 {
+			h.logger.Errorf("too many attempts from %v", ip)
+			tooManyRequests(w, r, wait, errTooManyAttempts)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func accountLimitKey(r *http.Request, email string) string {
+	return accountLimitPrefix + r.URL.Path + ":" + strings.ToLower(email)
+}
+
+// limitAccount checks the attempts limit and the lock of the account, it responds
+// with an error and returns false when the request must be rejected.
+func (h *Handler) limitAccount(w http.ResponseWriter, r *http.Request, key string) bool {
+	if h.limiter == nil {
+		return true
+	}
+
+	wait, err := h.limiter.Locked(key)
+	if err != nil {
+		h.logger.Errorf("can't check lock of %v: %v", key, err)
+		render.Error(w, r, err)
+		return false
+	}
+
+	if wait > 0 {
+		h.logger.Errorf("%v is locked for %v", key, wait)
+		tooManyRequests(w, r, wait, errAccountLocked)
+		return false
+	}
+
+	wait, err = h.limiter.Allow(key)
+	if err != nil {
+		h.logger.Errorf("can't check attempts limit for %v: %v", key, err)
+		render.Error(w, r, err)
+		return false
+	}
+
+	if wait > 0 {
+		h.logger.Errorf("too many attempts for %v", key)
+		tooManyRequests(w, r, wait, errTooManyAttempts)
+		return false
+	}
+
+	return true
+}
+
+func (h *Handler) accountFailed(key string) {
+	if h.limiter == nil {
+		return
+	}
+
+	wait, err := h.limiter.Failed(key)
+	if err != nil {
+		h.logger.Errorf("can't count failed attempt for %v: %v", key, err)
+		return
+	}
+
+	if wait > 0 {
+		h.logger.Errorf("%v is locked for %v", key, wait)
+	}
+}
+
+func (h *Handler) accountSucceeded(key string) {
+	if h.limiter == nil {
+		return
+	}
+
+	err := h.limiter.Succeeded(key)
+	if err != nil {
+		h.logger.Errorf("can't reset failed attempts for %v: %v", key, err)
+	}
+}
+
+func tooManyRequests(w http.ResponseWriter, r *http.Request, wait time.Duration, err error) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	render.Error(w, r, err)
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"bytes"
+	"cw1/cmd/socket"
+	"cw1/internal/limiter"
+	"cw1/internal/user"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignInLockedAfterFailures(t *testing.T) {
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+
+	hash, err := generateHash("123456")
+	if err != nil {
+		t.Fatalf("can't generate hash %v", err)
+	}
+
+	mockUserStorage.u = &user.User{
+		ID:       1,
+		Email:    "email",
+		Password: hash,
+		Verified: true,
+	}
+
+	c := limiter.DefaultConfig()
+	lim := limiter.New(limiter.NewMemoryStore(), c)
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub, WithLimiter(lim))
+
+	signIn := func(pwd string) *httptest.ResponseRecorder {
+		json := []byte(`{"email": "email","password":"` + pwd + `"}`)
+		req, err := http.NewRequest("POST", "/api/v1/signin", bytes.NewBuffer(json))
+		if err != nil {
+			t.Fatalf("can't create request %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.signIn).ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	for i := 0; i < c.Failures; i++ {
+		if status := signIn("wrong").Code; status != http.StatusUnauthorized {
+			t.Fatalf("signIn handler returned wrong status code: got %v, want %v",
+				status, http.StatusUnauthorized)
+		}
+	}
+
+	rr := signIn("123456")
+
+	if status := rr.Code; status != http.StatusTooManyRequests {
+		t.Errorf("signIn handler returned wrong status code: got %v, want %v",
+			status, http.StatusTooManyRequests)
+	}
+
+	if rr.Header().Get("Retry-After") != "60" {
+		t.Errorf("signIn handler returned wrong Retry-After: got %v, want %v",
+			rr.Header().Get("Retry-After"), "60")
+	}
+}
+
+func TestLimitByIP(t *testing.T) {
+	l := new(mockLogger)
+	hub := socket.NewHub()
+
+	c := limiter.Config{Attempts: 1, Window: time.Minute, Failures: 1, Lockout: time.Minute, MaxLockout: time.Minute}
+	lim := limiter.New(limiter.NewMemoryStore(), c)
+
+	h, _ := New(l, new(mockUserStorage), new(mockSessionStorage), new(mockRobotStorage), hub, WithLimiter(lim))
+
+	handler := h.limitByIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	codes := make([]int, 0, 2)
+
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest("POST", "/api/v1/signup", nil)
+		if err != nil {
+			t.Fatalf("can't create request %v", err)
+		}
+
+		req.RemoteAddr = "10.0.0.1:1234"
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		codes = append(codes, rr.Code)
+	}
+
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("limitByIP returned wrong status codes: got %v, want %v",
+			codes, []int{http.StatusOK, http.StatusTooManyRequests})
+	}
+}
@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"cw1/cmd/auth-api/render"
+	"cw1/internal/apperr"
+	"cw1/internal/mail"
+	"cw1/internal/reset"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type forgotRequest struct {
+	Email string `json:"email"`
+}
+
+type resetRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// forgotPassword always answers 202 so the endpoint can't be used to find out
+// which emails are registered. Requests for every email are limited, so the
+// endpoint can't flood a mailbox.
+func (h *Handler) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req forgotRequest
+
+	err := decodeJSON(w, r, &req)
+	if err == nil && req.Email == "" {
+		err = errRequired("email")
+	}
+
+	if err != nil {
+		h.logger.Errorf("can't unmarshal input json for password recovery: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	if !h.limitAccount(w, r, accountLimitKey(r, req.Email)) {
+		return
+	}
+
+	u, err := h.userStorage.FindByEmail(req.Email)
+	if err != nil {
+		h.logger.Errorf("can't find user with email: %v: %v", req.Email, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	if u.ID == BottomLineValidID {
+		h.logger.Infof("password recovery for unknown email: %v", req.Email)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	token, err := reset.Generate()
+	if err != nil {
+		h.logger.Errorf("can't generate reset token: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	t := &reset.Token{
+		UserID:    u.ID,
+		Hash:      reset.Hash(token),
+		ExpiresAt: now.Add(reset.TTL),
+		CreatedAt: now,
+	}
+
+	err = h.resetStorage.Create(t)
+	if err != nil {
+		h.logger.Errorf("can't create reset token for user with id: %v: %v", u.ID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = h.mailSender.Send(&mail.Message{
+		To:      u.Email,
+		Subject: "Password reset",
+		Body: fmt.Sprintf("Use this token to reset your password: %s\n"+
+			"It is valid for %v and can be used only once.", token, reset.TTL),
+	})
+	if err != nil {
+		h.logger.Errorf("can't send reset token to user with id: %v: %v", u.ID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var req resetRequest
+
+	err := decodeJSON(w, r, &req)
+	if err == nil && req.Token == "" {
+		err = errRequired("token")
+	} else if err == nil && req.Password == "" {
+		err = errRequired("password")
+	}
+
+	if err != nil {
+		h.logger.Errorf("can't unmarshal input json for password reset: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = h.passwordPolicy.Validate(req.Password)
+	if err != nil {
+		h.logger.Errorf("weak password for password reset: %v", err)
+		render.Error(w, r, errWeakPassword(err))
+		return
+	}
+
+	userID, err := h.resetStorage.Consume(reset.Hash(req.Token), time.Now().UTC())
+	if err != nil {
+		h.logger.Errorf("can't consume reset token: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	if userID == BottomLineValidID {
+		h.logger.Errorf("reset token is unknown, used or expired")
+		render.Error(w, r, apperr.New(apperr.KindInvalid, codeInvalidToken, "reset token is invalid or expired"))
+		return
+	}
+
+	u, err := h.userStorage.FindByID(userID)
+	if err != nil {
+		h.logger.Errorf("can't find user with id: %v: %v", userID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	u.Password = req.Password
+
+	err = h.initUser(u, userID)
+	if err != nil {
+		h.logger.Errorf("can't init user with id: %v: %v", userID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = h.userStorage.Update(u)
+	if err != nil {
+		h.logger.Errorf("can't update password of user with id: %v: %v", userID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = h.sessionStorage.DeleteByUserID(userID)
+	if err != nil {
+		h.logger.Errorf("can't revoke sessions of user with id: %v: %v", userID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// changePassword sets a new password after checking the current one. Other
+// sessions are revoked and the caller gets a new token.
+func (h *Handler) changePassword(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.sessionOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var req changePasswordRequest
+
+	err := decodeJSON(w, r, &req)
+	if err != nil {
+		h.logger.Errorf("can't unmarshal input json for password change: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	u, err := h.userStorage.FindByID(id)
+	if err != nil {
+		h.logger.Errorf("can't find user with id: %v: %v", id, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	fields := make(map[string]string)
+
+	if !h.isMatch(u.Password, req.CurrentPassword) {
+		fields["current_password"] = "is incorrect"
+	}
+
+	if err := h.passwordPolicy.Validate(req.NewPassword); err != nil {
+		fields["new_password"] = err.Error()
+	}
+
+	if len(fields) > 0 {
+		h.logger.Errorf("can't change password of user with id: %v: %v", id, fields)
+		render.Error(w, r, apperr.Validation(fields))
+		return
+	}
+
+	before := *u
+	u.Password = req.NewPassword
+
+	err = h.initUser(u, id)
+	if err != nil {
+		h.logger.Errorf("can't init user with id: %v: %v", id, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = h.userStorage.Update(u)
+	if err != nil {
+		h.logger.Errorf("can't update password of user with id: %v: %v", id, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	h.recordUserUpdate(r, &before, u, req.NewPassword)
+
+	err = h.sessionStorage.DeleteByUserID(id)
+	if err != nil {
+		h.logger.Errorf("can't revoke sessions of user with id: %v: %v", id, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = h.respondSession(w, id, u.Email+u.Password)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"bytes"
+	"cw1/cmd/socket"
+	"cw1/internal/limiter"
+	"cw1/internal/mail"
+	"cw1/internal/reset"
+	"cw1/internal/session"
+	"cw1/internal/user"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockResetStorage struct {
+	userID int64
+	reset.Storage
+}
+
+func (m mockResetStorage) Create(t *reset.Token) error {
+	return nil
+}
+
+func (m mockResetStorage) Consume(hash string, now time.Time) (int64, error) {
+	return m.userID, nil
+}
+
+type mockMailSender struct {
+	sent []*mail.Message
+}
+
+func (m *mockMailSender) Send(msg *mail.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+type mockRevokingSessionStorage struct {
+	mockSessionStorage
+	revoked int64
+}
+
+func (m *mockRevokingSessionStorage) DeleteByUserID(userID int64) error {
+	m.revoked = userID
+	return nil
+}
+
+func TestForgotPasswordSendsToken(t *testing.T) {
+	json := []byte(`{"email": "email"}`)
+	req, err := http.NewRequest("POST", "/api/v1/password/forgot", bytes.NewBuffer(json))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+	mockResetStorage := new(mockResetStorage)
+	mockMailSender := new(mockMailSender)
+
+	mockUserStorage.u = &user.User{
+		ID:    1,
+		Email: "email",
+	}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub,
+		WithResetStorage(mockResetStorage), WithMailSender(mockMailSender))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.forgotPassword)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusAccepted {
+		t.Errorf("forgotPassword handler returned wrong status code: got %v, want %v",
+			status, http.StatusAccepted)
+	}
+
+	if len(mockMailSender.sent) != 1 || mockMailSender.sent[0].To != "email" {
+		t.Fatalf("forgotPassword handler didn't send mail to user: %v", mockMailSender.sent)
+	}
+
+	if !strings.Contains(mockMailSender.sent[0].Body, "reset your password") {
+		t.Errorf("forgotPassword handler sent unexpected mail: %v", mockMailSender.sent[0].Body)
+	}
+}
+
+func TestForgotPasswordLimitedByEmail(t *testing.T) {
+	c := limiter.Config{Attempts: 1, Window: time.Minute, Failures: 1, Lockout: time.Minute, MaxLockout: time.Minute}
+	mockMailSender := new(mockMailSender)
+
+	h, _ := New(new(mockLogger), &mockUserStorage{u: &user.User{ID: 1, Email: "email"}}, new(mockSessionStorage),
+		new(mockRobotStorage), socket.NewHub(), WithResetStorage(new(mockResetStorage)),
+		WithMailSender(mockMailSender), WithLimiter(limiter.New(limiter.NewMemoryStore(), c)))
+
+	codes := make([]int, 0, 2)
+
+	for _, addr := range []string{"10.0.0.1:1234", "10.0.0.2:1234"} {
+		req, err := http.NewRequest("POST", "/api/v1/password/forgot", bytes.NewBufferString(`{"email": "email"}`))
+		if err != nil {
+			t.Fatalf("can't create request %v", err)
+		}
+
+		req.RemoteAddr = addr
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.forgotPassword).ServeHTTP(rr, req)
+
+		codes = append(codes, rr.Code)
+	}
+
+	if codes[0] != http.StatusAccepted || codes[1] != http.StatusTooManyRequests || len(mockMailSender.sent) != 1 {
+		t.Errorf("forgotPassword handler returned wrong status codes: got %v, want %v, sent %v mails",
+			codes, []int{http.StatusAccepted, http.StatusTooManyRequests}, len(mockMailSender.sent))
+	}
+}
+
+func TestForgotPasswordUnknownEmail(t *testing.T) {
+	json := []byte(`{"email": "unknown"}`)
+	req, err := http.NewRequest("POST", "/api/v1/password/forgot", bytes.NewBuffer(json))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+	mockResetStorage := new(mockResetStorage)
+	mockMailSender := new(mockMailSender)
+
+	mockUserStorage.u = &user.User{
+		ID: 0, // not find user in storage
+	}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub,
+		WithResetStorage(mockResetStorage), WithMailSender(mockMailSender))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.forgotPassword)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusAccepted {
+		t.Errorf("forgotPassword handler returned wrong status code: got %v, want %v",
+			status, http.StatusAccepted)
+	}
+
+	if len(mockMailSender.sent) != 0 {
+		t.Errorf("forgotPassword handler sent mail for unknown email: %v", mockMailSender.sent)
+	}
+}
+
+func TestResetPasswordRevokesSessions(t *testing.T) {
+	json := []byte(`{"token": "token","password": "new password"}`)
+	req, err := http.NewRequest("POST", "/api/v1/password/reset", bytes.NewBuffer(json))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockRevokingSessionStorage)
+	mockResetStorage := new(mockResetStorage)
+
+	mockUserStorage.u = &user.User{
+		ID:    1,
+		Email: "email",
+	}
+	mockSessionStorage.s = &session.Session{UserID: 1}
+	mockResetStorage.userID = 1
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub, WithResetStorage(mockResetStorage))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.resetPassword)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("resetPassword handler returned wrong status code: got %v, want %v",
+			status, http.StatusOK)
+	}
+
+	if mockSessionStorage.revoked != 1 {
+		t.Errorf("resetPassword handler didn't revoke sessions of user: got %v, want %v",
+			mockSessionStorage.revoked, 1)
+	}
+
+	if !h.isMatch(mockUserStorage.u.Password, "new password") {
+		t.Errorf("resetPassword handler didn't change password")
+	}
+}
+
+func TestResetPasswordInvalidToken(t *testing.T) {
+	json := []byte(`{"token": "token","password": "new password"}`)
+	req, err := http.NewRequest("POST", "/api/v1/password/reset", bytes.NewBuffer(json))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+	mockResetStorage := new(mockResetStorage)
+
+	mockResetStorage.userID = 0 // token is used or expired
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub, WithResetStorage(mockResetStorage))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.resetPassword)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("resetPassword handler returned wrong status code: got %v, want %v",
+			status, http.StatusBadRequest)
+	}
+
+	expected := `"detail":"reset token is invalid or expired"`
+	if !respContains(rr.Body.String(), expected) {
+		t.Errorf("resetPassword handler returned unexpected body: got %v, want %v",
+			rr.Body.String(), expected)
+	}
+}
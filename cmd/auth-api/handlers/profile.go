@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"cw1/cmd/auth-api/render"
+	"cw1/internal/apperr"
+	"cw1/internal/format"
+	"cw1/internal/user"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const maxNameLength = 100
+
+// patchUser applies a JSON Merge Patch (RFC 7396) to the profile: absent fields
+// are kept, null clears optional fields. The password has its own endpoint.
+func (h *Handler) patchUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.sessionOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var patch map[string]json.RawMessage
+
+	err := decodeJSON(w, r, &patch)
+	if err != nil {
+		h.logger.Errorf("can't unmarshal merge patch for user with id: %v: %v", id, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	current, err := h.userStorage.FindByID(id)
+	if err != nil {
+		h.logger.Errorf("can't find user with id= %v: %v", id, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	u := *current
+
+	fields := applyUserPatch(&u, patch)
+	for k, v := range validateProfile(&u) {
+		if _, ok := fields[k]; !ok {
+			fields[k] = v
+		}
+	}
+
+	emailChanged := current.Email != u.Email
+
+	if emailChanged && fields["email"] == "" {
+		err = checkEmail(h.userStorage, u.Email, id)
+		if err != nil {
+			h.logger.Errorf("can't change email of user with id: %v: %v", id, err)
+
+			if !apperr.HasCode(err, codeEmailTaken) {
+				render.Error(w, r, err)
+				return
+			}
+
+			fields["email"] = "is already registered"
+		}
+	}
+
+	if len(fields) > 0 {
+		h.logger.Errorf("incorrect merge patch for user with id: %v: %v", id, fields)
+		render.Error(w, r, apperr.Validation(fields))
+		return
+	}
+
+	t, err := format.NewNullTime()
+	if err != nil {
+		h.logger.Errorf("can't create new null time: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	u.UpdatedAt = *t
+	u.Verified = current.Verified && !emailChanged
+
+	err = h.userStorage.Update(&u)
+	if err != nil {
+		h.logger.Errorf("can't update user with id= %v: %v", id, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	h.recordUserUpdate(r, current, &u, "")
+
+	if emailChanged {
+		err = h.sendVerification(&u)
+		if err != nil {
+			h.logger.Errorf(err.Error())
+			render.Error(w, r, err)
+			return
+		}
+	}
+
+	err = respondJSON(w, &u)
+	if err != nil {
+		h.logger.Errorf("can't respond json with user info: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+// applyUserPatch sets fields of the patch to the user and returns messages for
+// fields which can't be set.
+func applyUserPatch(u *user.User, patch map[string]json.RawMessage) map[string]string {
+	fields := make(map[string]string)
+
+	for k, v := range patch {
+		null := string(v) == "null"
+
+		switch k {
+		case "first_name", "last_name":
+			var name string
+
+			if !null && json.Unmarshal(v, &name) != nil {
+				fields[k] = "must be a string"
+				continue
+			}
+
+			if k == "first_name" {
+				u.FirstName = name
+			} else {
+				u.LastName = name
+			}
+		case "birthday":
+			if null {
+				u.Birthday = nil
+				continue
+			}
+
+			var d format.Day
+
+			if json.Unmarshal(v, &d) != nil {
+				fields[k] = "must be a date in format " + format.DateLayout
+				continue
+			}
+
+			u.Birthday = &d
+		case "email":
+			if null || json.Unmarshal(v, &u.Email) != nil {
+				fields[k] = "must be a string"
+			}
+		case "password":
+			fields[k] = "can't be changed here, use the password endpoint"
+		default:
+			fields[k] = "unknown field"
+		}
+	}
+
+	return fields
+}
+
+// validateProfile returns messages for incorrect fields of the profile.
+func validateProfile(u *user.User) map[string]string {
+	fields := make(map[string]string)
+
+	if !isValidEmail(u.Email) {
+		fields["email"] = "must be a correct email address"
+	}
+
+	for k, name := range map[string]string{"first_name": u.FirstName, "last_name": u.LastName} {
+		if utf8.RuneCountInString(name) > maxNameLength {
+			fields[k] = fmt.Sprintf("must be at most %d characters long", maxNameLength)
+		} else if name != "" && strings.TrimSpace(name) == "" {
+			fields[k] = "must not be blank"
+		}
+	}
+
+	if u.Birthday != nil && u.Birthday.V.Valid && u.Birthday.V.Time.After(time.Now()) {
+		fields["birthday"] = "must not be in the future"
+	}
+
+	return fields
+}
@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"bytes"
+	"cw1/cmd/auth-api/render"
+	"cw1/cmd/socket"
+	"cw1/internal/format"
+	"cw1/internal/session"
+	"cw1/internal/user"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPatchUserKeepsAbsentFields(t *testing.T) {
+	body := []byte(`{"first_name": "changed", "last_name": null}`)
+	req, err := http.NewRequest("PATCH", "/api/v1/users/1", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	req = withURLParams(req, "id", "1")
+
+	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUpdatingUserStorage)
+	mockSessionStorage := new(mockSessionStorage)
+
+	birthday := &format.Day{V: sql.NullTime{Time: time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true}}
+
+	mockUserStorage.u = &user.User{
+		ID:        1,
+		FirstName: "name",
+		LastName:  "last_name",
+		Birthday:  birthday,
+		Email:     "user@example.com",
+		Password:  "hash",
+		Verified:  true,
+	}
+	mockSessionStorage.s = &session.Session{SessionID: token, UserID: 1}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, new(mockRobotStorage), hub)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.patchUser)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("patchUser handler returned wrong status code: got %v, want %v",
+			status, http.StatusOK)
+	}
+
+	u := mockUserStorage.updated
+
+	if u == nil || u.FirstName != "changed" || u.LastName != "" || u.Birthday != birthday ||
+		u.Password != "hash" || !u.Verified {
+		t.Errorf("patchUser handler updated user incorrectly: %+v", u)
+	}
+}
+
+func TestPatchUserNullBirthday(t *testing.T) {
+	req, err := http.NewRequest("PATCH", "/api/v1/users/1", bytes.NewBufferString(`{"birthday": null}`))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	req = withURLParams(req, "id", "1")
+
+	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	mockUserStorage := new(mockUpdatingUserStorage)
+	mockUserStorage.u = &user.User{
+		ID:       1,
+		Birthday: &format.Day{V: sql.NullTime{Time: time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true}},
+		Email:    "user@example.com",
+	}
+
+	h, _ := New(new(mockLogger), mockUserStorage, &mockSessionStorage{s: &session.Session{SessionID: token, UserID: 1}},
+		new(mockRobotStorage), socket.NewHub(), WithAuditStorage(new(mockAuditStorage)))
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.patchUser).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("patchUser handler returned wrong status code: got %v, want %v", status, http.StatusOK)
+	}
+
+	if u := mockUserStorage.updated; u == nil || u.Birthday != nil || respContains(rr.Body.String(), "birthday") {
+		t.Errorf("patchUser handler didn't clear birthday: %v", rr.Body.String())
+	}
+}
+
+func TestPatchUserValidation(t *testing.T) {
+	body := []byte(`{"email": "not an email", "birthday": "2999-01-01", "password": "secret", "role": "admin"}`)
+	req, err := http.NewRequest("PATCH", "/api/v1/users/1", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	req = withURLParams(req, "id", "1")
+
+	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUpdatingUserStorage)
+	mockSessionStorage := new(mockSessionStorage)
+
+	mockUserStorage.u = &user.User{ID: 1, Email: "user@example.com"}
+	mockSessionStorage.s = &session.Session{SessionID: token, UserID: 1}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, new(mockRobotStorage), hub)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.patchUser)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusUnprocessableEntity {
+		t.Fatalf("patchUser handler returned wrong status code: got %v, want %v",
+			status, http.StatusUnprocessableEntity)
+	}
+
+	var resp render.Problem
+
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("can't unmarshal response %v", err)
+	}
+
+	fields := make(map[string]string)
+	for _, p := range resp.InvalidParams {
+		fields[p.Name] = p.Reason
+	}
+
+	for _, f := range []string{"email", "birthday", "password", "role"} {
+		if fields[f] == "" {
+			t.Errorf("patchUser handler didn't return error for field %v: %v", f, resp.InvalidParams)
+		}
+	}
+
+	if mockUserStorage.updated != nil {
+		t.Errorf("patchUser handler updated user with incorrect fields")
+	}
+}
+
+func TestChangePasswordWrongCurrent(t *testing.T) {
+	body := []byte(`{"current_password": "wrong", "new_password": "correct horse"}`)
+	req, err := http.NewRequest("POST", "/api/v1/users/1/password", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	req = withURLParams(req, "id", "1")
+
+	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUpdatingUserStorage)
+	mockSessionStorage := new(mockSessionStorage)
+
+	hash, err := generateHash("123456")
+	if err != nil {
+		t.Fatalf("can't generate hash %v", err)
+	}
+
+	mockUserStorage.u = &user.User{ID: 1, Email: "user@example.com", Password: hash}
+	mockSessionStorage.s = &session.Session{SessionID: token, UserID: 1}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, new(mockRobotStorage), hub)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.changePassword)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("changePassword handler returned wrong status code: got %v, want %v",
+			status, http.StatusUnprocessableEntity)
+	}
+
+	if mockUserStorage.updated != nil {
+		t.Errorf("changePassword handler changed password without current one")
+	}
+}
+
+func TestChangePasswordCorrect(t *testing.T) {
+	body := []byte(`{"current_password": "123456", "new_password": "correct horse"}`)
+	req, err := http.NewRequest("POST", "/api/v1/users/1/password", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	req = withURLParams(req, "id", "1")
+
+	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUpdatingUserStorage)
+	mockSessionStorage := new(mockRevokingSessionStorage)
+
+	hash, err := generateHash("123456")
+	if err != nil {
+		t.Fatalf("can't generate hash %v", err)
+	}
+
+	mockUserStorage.u = &user.User{ID: 1, Email: "user@example.com", Password: hash}
+	mockSessionStorage.s = &session.Session{SessionID: token, UserID: 1}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, new(mockRobotStorage), hub)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.changePassword)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("changePassword handler returned wrong status code: got %v, want %v",
+			status, http.StatusOK)
+	}
+
+	if mockUserStorage.updated == nil || !h.isMatch(mockUserStorage.updated.Password, "correct horse") {
+		t.Errorf("changePassword handler didn't change password")
+	}
+
+	if mockSessionStorage.revoked != 1 {
+		t.Errorf("changePassword handler didn't revoke sessions")
+	}
+
+	if !respContains(rr.Body.String(), "bearer") {
+		t.Errorf("changePassword handler didn't return new token: %v", rr.Body.String())
+	}
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"cw1/internal/apperr"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxBodySize limits bodies of requests, the largest ones are robots.
+	maxBodySize = 1 << 20
+
+	authorizationHeader = "Authorization"
+	bearerScheme        = "Bearer"
+)
+
+var errTooLarge = apperr.Newf(apperr.KindTooLarge, apperr.CodeTooLarge,
+	"request body is larger than %v bytes", maxBodySize)
+
+// decodeJSON reads a single JSON value of the body into v. Bodies larger than
+// maxBodySize, unknown fields and trailing data are rejected.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(v)
+	if err != nil {
+		return decodeError(err)
+	}
+
+	if dec.More() {
+		return apperr.New(apperr.KindInvalid, apperr.CodeMalformedRequest, "request body must contain a single json value")
+	}
+
+	return nil
+}
+
+func decodeError(err error) error {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+
+	switch {
+	case err == io.EOF:
+		return apperr.New(apperr.KindInvalid, apperr.CodeMalformedRequest, "request body is empty")
+	case err.Error() == "http: request body too large":
+		return errors.Wrap(errTooLarge, err.Error())
+	case errors.As(err, &syntaxErr):
+		return apperr.Newf(apperr.KindInvalid, apperr.CodeMalformedRequest,
+			"request body has malformed json at position %v", syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		return apperr.Newf(apperr.KindInvalid, apperr.CodeMalformedRequest,
+			"field %q must be %v", typeErr.Field, typeErr.Type)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return apperr.Newf(apperr.KindInvalid, apperr.CodeMalformedRequest,
+			"request body has unknown field %v", strings.TrimPrefix(err.Error(), "json: unknown field "))
+	default:
+		return errors.Wrap(errMalformed, err.Error())
+	}
+}
+
+// errRequired is returned when a field needed by the handler is absent in the body.
+func errRequired(field string) error {
+	return apperr.Newf(apperr.KindInvalid, apperr.CodeMalformedRequest, "field %q is required", field)
+}
+
+// idParam returns the positive id from the route parameter with the name.
+func idParam(r *http.Request, name string) (int64, error) {
+	param := chi.URLParam(r, name)
+
+	id, err := strconv.ParseInt(param, 10, 64)
+	if err != nil || id <= BottomLineValidID {
+		return -1, errInvalidID(param)
+	}
+
+	return id, nil
+}
+
+// tokenFromReq returns the token of the bearer authorization header.
+func tokenFromReq(r *http.Request) (string, error) {
+	header := r.Header.Get(authorizationHeader)
+	if header == "" {
+		return "", errors.Wrap(errUnauthenticated, "authorization header is absent")
+	}
+
+	parts := strings.Fields(header)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], bearerScheme) {
+		return "", apperr.New(apperr.KindInvalid, codeInvalidAuthHeader, "authorization header must be \"Bearer <token>\"")
+	}
+
+	return parts[1], nil
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"bytes"
+	"cw1/cmd/socket"
+	"cw1/internal/apperr"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetUserAuthorizationHeader(t *testing.T) {
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub)
+
+	tests := []struct {
+		header string
+		status int
+		code   string
+	}{
+		{"", http.StatusUnauthorized, apperr.CodeUnauthenticated},
+		{"token", http.StatusBadRequest, codeInvalidAuthHeader},
+		{"Basic dXNlcjpwd2Q=", http.StatusBadRequest, codeInvalidAuthHeader},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", "/api/v1/users/1", nil)
+		if err != nil {
+			t.Fatalf("can't create request %v", err)
+		}
+
+		req = withURLParams(req, "id", "1")
+
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.getUser).ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tt.status {
+			t.Errorf("getUser handler returned wrong status code for %q: got %v, want %v",
+				tt.header, status, tt.status)
+		}
+
+		expected := `"code":"` + tt.code + `"`
+		if !respContains(rr.Body.String(), expected) {
+			t.Errorf("getUser handler returned unexpected body: got %v, want %v",
+				rr.Body.String(), expected)
+		}
+	}
+}
+
+func TestSignUpRejectsUnknownFields(t *testing.T) {
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub)
+
+	json := []byte(`{"email":"user@example.com","password":"correct horse","is_admin":true}`)
+
+	req, err := http.NewRequest("POST", "/api/v1/signup", bytes.NewBuffer(json))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.signUp).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("signUp handler returned wrong status code: got %v, want %v",
+			status, http.StatusBadRequest)
+	}
+
+	expected := `request body has unknown field \"is_admin\"`
+	if !respContains(rr.Body.String(), expected) {
+		t.Errorf("signUp handler returned unexpected body: got %v, want %v",
+			rr.Body.String(), expected)
+	}
+}
+
+func TestSignUpBodyTooLarge(t *testing.T) {
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub)
+
+	json := `{"email":"user@example.com","first_name":"` + strings.Repeat("a", maxBodySize) + `"}`
+
+	req, err := http.NewRequest("POST", "/api/v1/signup", strings.NewReader(json))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.signUp).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusRequestEntityTooLarge {
+		t.Errorf("signUp handler returned wrong status code: got %v, want %v",
+			status, http.StatusRequestEntityTooLarge)
+	}
+}
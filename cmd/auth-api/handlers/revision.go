@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"cw1/cmd/auth-api/render"
+	"cw1/internal/apikey"
+	"cw1/internal/apperr"
+	"cw1/internal/audit"
+	"cw1/internal/revision"
+	"cw1/internal/robot"
+	"net/http"
+	"strconv"
+)
+
+type revisionDiff struct {
+	From    int64                   `json:"from"`
+	To      int64                   `json:"to"`
+	Changes map[string]audit.Change `json:"changes"`
+}
+
+func errRevisionNotFound(rbtID int64, rev int64) error {
+	return apperr.Newf(apperr.KindNotFound, codeRevisionNotFound, "robot with id %v has no revision %v", rbtID, rev)
+}
+
+func (h *Handler) getRevisions(w http.ResponseWriter, r *http.Request) {
+	rbt, err := h.findReadableRobot(r)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	revs, err := h.revStorage.FindByRobotID(rbt.RobotID)
+	if err != nil {
+		h.logger.Errorf("can't find revisions of robot with id: %v: %v", rbt.RobotID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = respondJSON(w, revs)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+// diffRevisions shows how parameters changed from one revision to another.
+func (h *Handler) diffRevisions(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var revs [2]int64
+
+	for i, name := range []string{"from", "to"} {
+		v := q.Get(name)
+
+		rev, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || rev <= BottomLineValidID {
+			render.Error(w, r, errInvalidQuery(name, v))
+			return
+		}
+
+		revs[i] = rev
+	}
+
+	rbt, err := h.findReadableRobot(r)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	var params [2]revision.Params
+
+	for i, rev := range revs {
+		rv, err := h.findRevision(rbt.RobotID, rev)
+		if err != nil {
+			h.logger.Errorf(err.Error())
+			render.Error(w, r, err)
+			return
+		}
+
+		params[i] = rv.Params
+	}
+
+	changes, err := audit.Diff(params[0], params[1])
+	if err != nil {
+		h.logger.Errorf("can't make diff of revisions of robot with id: %v: %v", rbt.RobotID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = respondJSON(w, revisionDiff{From: revs[0], To: revs[1], Changes: changes})
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+// restoreRevision sets parameters of the revision to the robot, it makes a new revision.
+// If-Match is required as for updates, so a rollback doesn't overwrite a concurrent edit.
+func (h *Handler) restoreRevision(w http.ResponseWriter, r *http.Request) {
+	rbt, p, err := h.findOwnRobot(r)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	rev, err := idParam(r, "rev")
+	if err != nil {
+		h.logger.Errorf("can't get revision from URL params: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	if err = checkIfMatch(r, rbt); err != nil {
+		h.logger.Errorf("can't restore robot with id: %v: %v", rbt.RobotID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	rv, err := h.findRevision(rbt.RobotID, rev)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	before := *rbt
+
+	restored := *rbt
+	rv.Params.Apply(&restored)
+
+	// revisions were made before the current checks, so they aren't trusted
+	if fields := h.validateParams(&restored); len(fields) > 0 {
+		h.logger.Errorf("can't restore incorrect revision %v of robot with id: %v: %v", rev, rbt.RobotID, fields)
+		render.Error(w, r, apperr.Validation(fields))
+		return
+	}
+
+	*rbt = restored
+
+	err = h.robotStorage.Update(rbt)
+	if err != nil {
+		h.logger.Errorf("can't restore revision %v of robot with id: %v: %v", rev, rbt.RobotID, err)
+		render.Error(w, r, errRobotModified(err, rbt.RobotID))
+		return
+	}
+
+	h.recordChange(r, robotEntry(p.userID, audit.RevertRobot, rbt.RobotID), &before, rbt)
+	h.recordRevision(p.userID, &before, rbt)
+	h.syncFollowers(r, p.userID, &before, rbt)
+
+	w.Header().Set("ETag", robotETag(rbt))
+
+	err = respondJSON(w, rbt)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	go h.hub.Broadcast(rbt)
+}
+
+func (h *Handler) findReadableRobot(r *http.Request) (*robot.Robot, error) {
+	rbtID, p, err := h.getRobotAndPrincipal(r, apikey.ScopeRobotsRead)
+	if err != nil {
+		return nil, err
+	}
+
+	rbt, err := findRobot(h.robotStorage, rbtID)
+	if err != nil {
+		return nil, err
+	}
+
+	if rbt.DeletedAt != nil {
+		return nil, errRobotNotFound(rbtID)
+	}
+
+	// revisions show trading parameters, which are hidden from viewers of shared robots
+	full, err := h.canReadParams(p, rbt)
+	if err != nil {
+		return nil, err
+	}
+
+	if !full {
+		return nil, errRobotForbidden("user with id: %v don't have permission to get revisions of robot with id: %v",
+			p.userID, rbtID)
+	}
+
+	return rbt, nil
+}
+
+func (h *Handler) findRevision(rbtID int64, rev int64) (*revision.Revision, error) {
+	rv, err := h.revStorage.Find(rbtID, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	if rv.Rev == BottomLineValidID {
+		return nil, errRevisionNotFound(rbtID, rev)
+	}
+
+	return rv, nil
+}
+
+// recordRevision makes a revision when parameters of the robot are changed,
+// before is nil for new robots. The robot is already saved, so a failure is only logged.
+func (h *Handler) recordRevision(authorID int64, before *robot.Robot, after *robot.Robot) {
+	if h.revStorage == nil {
+		return
+	}
+
+	params := revision.ParamsOf(after)
+	if before != nil && params.Equal(revision.ParamsOf(before)) {
+		return
+	}
+
+	rv := &revision.Revision{RobotID: after.RobotID, Params: params, AuthorID: authorID}
+
+	err := h.revStorage.Create(rv)
+	if err != nil {
+		h.logger.Errorf("can't create revision of robot with id: %v: %v", after.RobotID, err)
+	}
+}
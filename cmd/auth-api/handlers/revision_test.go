@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"cw1/internal/format"
+	"cw1/internal/revision"
+	"cw1/internal/robot"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type mockRevisionStorage struct {
+	revs []*revision.Revision
+}
+
+func (m *mockRevisionStorage) Create(r *revision.Revision) error {
+	r.Rev = int64(len(m.revs) + 1)
+	r.CreatedAt = time.Now()
+	m.revs = append(m.revs, r)
+
+	return nil
+}
+
+func (m *mockRevisionStorage) FindByRobotID(robotID int64) ([]*revision.Revision, error) {
+	res := make([]*revision.Revision, 0)
+
+	for i := len(m.revs) - 1; i >= 0; i-- {
+		if m.revs[i].RobotID == robotID {
+			res = append(res, m.revs[i])
+		}
+	}
+
+	return res, nil
+}
+
+func (m *mockRevisionStorage) Find(robotID int64, rev int64) (*revision.Revision, error) {
+	for _, r := range m.revs {
+		if r.RobotID == robotID && r.Rev == rev {
+			return r, nil
+		}
+	}
+
+	return &revision.Revision{}, nil
+}
+
+func price(v float64) *format.NullFloat64 {
+	p := &format.NullFloat64{}
+	p.V.Float64, p.V.Valid = v, true
+
+	return p
+}
+
+func newRevisionHandler(rbts []*robot.Robot, revs *mockRevisionStorage) *Handler {
+	h := newTestHandler(1, &mockRobotStorage{rr: rbts})
+	h.revStorage = revs
+
+	return h
+}
+
+func TestUpdateRobotRecordsRevision(t *testing.T) {
+	rbts := []*robot.Robot{{RobotID: 5, OwnerUserID: 1, BuyPrice: price(10)}}
+	revs := &mockRevisionStorage{}
+	h := newRevisionHandler(rbts, revs)
+
+	bodies := []string{`{"buy_price": 20,` + robotParams + `}`, `{"buy_price": 20, "is_favourite": true,` + robotParams + `}`}
+
+	for _, body := range bodies {
+		req := requestFor(t, "PUT", "/api/v1/robot/5", body, "id", "5")
+		req.Header.Set("If-Match", "*")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.updateRobot).ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("updateRobot handler returned wrong status code: got %v, want %v", status, http.StatusOK)
+		}
+
+		// the mock storage doesn't save updates
+		rbts[0] = new(robot.Robot)
+		if err := json.Unmarshal(rr.Body.Bytes(), rbts[0]); err != nil {
+			t.Fatalf("can't unmarshal updated robot %v", err)
+		}
+	}
+
+	if len(revs.revs) != 1 {
+		t.Fatalf("updateRobot handler made wrong number of revisions: got %v, want %v", len(revs.revs), 1)
+	}
+
+	if rv := revs.revs[0]; rv.AuthorID != 1 || rv.BuyPrice == nil || rv.BuyPrice.V.Float64 != 20 {
+		t.Errorf("updateRobot handler made wrong revision: %+v", rv)
+	}
+}
+
+func TestDiffRevisions(t *testing.T) {
+	rbts := []*robot.Robot{{RobotID: 5, OwnerUserID: 1}}
+	revs := &mockRevisionStorage{revs: []*revision.Revision{
+		{RobotID: 5, Rev: 1, Params: revision.Params{BuyPrice: price(10), SellPrice: price(15)}},
+		{RobotID: 5, Rev: 2, Params: revision.Params{BuyPrice: price(12), SellPrice: price(15)}},
+	}}
+	h := newRevisionHandler(rbts, revs)
+
+	tests := []struct {
+		query  string
+		status int
+		body   string
+	}{
+		{"?from=1&to=2", http.StatusOK, `{"from":1,"to":2,"changes":{"buy_price":{"before":10,"after":12}}}`},
+		{"?from=1&to=3", http.StatusNotFound, `"code":"revision_not_found"`},
+		{"?from=1", http.StatusBadRequest, `"code":"invalid_query_param"`},
+	}
+
+	for _, tt := range tests {
+		req := requestFor(t, "GET", "/api/v1/robot/5/revisions/diff"+tt.query, "", "id", "5")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.diffRevisions).ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tt.status {
+			t.Errorf("diffRevisions handler returned wrong status code for %q: got %v, want %v",
+				tt.query, status, tt.status)
+		}
+
+		if !respContains(rr.Body.String(), tt.body) {
+			t.Errorf("diffRevisions handler returned unexpected body for %q: got %v, want %v",
+				tt.query, rr.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestRestoreRevision(t *testing.T) {
+	rbt := planned(5, 1, -time.Hour, time.Hour)
+	rbt.BuyPrice, rbt.Version = price(20), 3
+
+	valid := revision.ParamsOf(rbt)
+	valid.BuyPrice = price(10)
+
+	// sell price is lower than buy price
+	invalid := revision.ParamsOf(rbt)
+	invalid.BuyPrice = price(200)
+
+	rbts := []*robot.Robot{rbt}
+	revs := &mockRevisionStorage{revs: []*revision.Revision{
+		{RobotID: 5, Rev: 1, Params: valid},
+		{RobotID: 5, Rev: 2, Params: invalid},
+	}}
+	h := newRevisionHandler(rbts, revs)
+
+	tests := []struct {
+		rev     string
+		ifMatch string
+		status  int
+	}{
+		{"3", `"3"`, http.StatusNotFound},
+		{"1", "", http.StatusPreconditionRequired},
+		{"1", `"2"`, http.StatusPreconditionFailed},
+		{"2", `"3"`, http.StatusUnprocessableEntity},
+		{"1", `"3"`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := requestFor(t, "POST", "/api/v1/robot/5/revisions/"+tt.rev+"/restore", "", "id", "5", "rev", tt.rev)
+
+		if tt.ifMatch != "" {
+			req.Header.Set("If-Match", tt.ifMatch)
+		}
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.restoreRevision).ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tt.status {
+			t.Errorf("restoreRevision handler returned wrong status code for revision %v: got %v, want %v",
+				tt.rev, status, tt.status)
+		}
+	}
+
+	if rbts[0].BuyPrice.V.Float64 != 10 {
+		t.Errorf("restoreRevision handler didn't restore parameters: %+v", rbts[0].BuyPrice)
+	}
+
+	if len(revs.revs) != 3 || revs.revs[2].BuyPrice.V.Float64 != 10 {
+		t.Errorf("restoreRevision handler didn't make a new revision: %+v", revs.revs)
+	}
+}
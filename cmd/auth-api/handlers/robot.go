@@ -2,95 +2,212 @@ package handler
 
 import (
 	"cw1/cmd/auth-api/render"
+	"cw1/internal/apikey"
+	"cw1/internal/apperr"
+	"cw1/internal/audit"
 	"cw1/internal/format"
+	"cw1/internal/policy"
 	"cw1/internal/robot"
-	"cw1/internal/session"
-	"encoding/json"
+	"cw1/internal/webhook"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 )
 
 func (h *Handler) createRobot(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("template") != "" {
+		h.createRobotFromTemplate(w, r)
+		return
+	}
+
 	var rbt robot.Robot
 
-	err := json.NewDecoder(r.Body).Decode(&rbt)
+	err := decodeJSON(w, r, &rbt)
 	if err != nil {
 		h.logger.Errorf("can't unmarshal input json for creating robot: %v", err)
-		render.HTTPError("", http.StatusBadRequest, w)
+		render.Error(w, r, err)
 		return
 	}
 
-	token := tokenFromReq(r)
-
-	s, err := h.sessionStorage.FindByToken(token)
+	p, err := h.authorize(r, apikey.ScopeRobotsWrite)
 	if err != nil {
-		h.logger.Errorf("can't find owner by token in storage: %v", err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+		h.logger.Errorf("can't authorize owner: %v", err)
+		render.Error(w, r, err)
 		return
 	}
 
-	if s.UserID == BottomLineValidID {
-		h.logger.Errorf("can't find owner by token")
-		render.HTTPError("can't find owner", http.StatusBadRequest, w)
+	if fields := h.validateRobot(&rbt); len(fields) > 0 {
+		h.logger.Errorf("incorrect robot from user with id: %v: %v", p.userID, fields)
+		render.Error(w, r, apperr.Validation(fields))
 		return
 	}
 
-	rbt.OwnerUserID = s.UserID
-
-	err = h.robotStorage.Create(&rbt)
+	tags, err := tagNames(rbt.Tags)
 	if err != nil {
-		h.logger.Errorf("can't create robot record in storage: %v", err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+		h.logger.Errorf("incorrect tags of robot from user with id: %v: %v", p.userID, err)
+		render.Error(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
+	newRobot := robot.Robot{
+		OwnerUserID: p.userID,
+		IsFavourite: rbt.IsFavourite,
+		Ticker:      rbt.Ticker,
+		BuyPrice:    rbt.BuyPrice,
+		SellPrice:   rbt.SellPrice,
+		PlanStart:   rbt.PlanStart,
+		PlanEnd:     rbt.PlanEnd,
+		PlanYield:   rbt.PlanYield,
+		Visibility:  rbt.Visibility,
+	}
+
+	if newRobot.Visibility == "" {
+		newRobot.Visibility = robot.VisibilityPrivate
+	}
+
+	h.saveNewRobot(w, r, p, &newRobot, tags)
 }
 
-func (h *Handler) deleteRobot(w http.ResponseWriter, r *http.Request) {
-	rbtID, userID, err := getRobotAndUserID(h.sessionStorage, r)
+// saveNewRobot stores the validated robot of the principal and responds with it.
+func (h *Handler) saveNewRobot(w http.ResponseWriter, r *http.Request, p *principal, newRobot *robot.Robot,
+	tags []string) {
+	err := h.robotStorage.Create(newRobot)
 	if err != nil {
-		h.logger.Errorf(err.Error())
-		render.HTTPError("", http.StatusBadRequest, w)
+		h.logger.Errorf("can't create robot record in storage: %v", err)
+		render.Error(w, r, err)
 		return
 	}
 
-	rbtFromDB, err := findRobot(h.robotStorage, rbtID)
+	h.recordChange(r, robotEntry(p.userID, audit.CreateRobot, newRobot.RobotID), nil, newRobot)
+	h.recordRevision(p.userID, nil, newRobot)
+
+	if len(tags) > 0 && h.tagStorage != nil {
+		if err = h.tagStorage.SetRobotTags(newRobot.RobotID, p.userID, tags); err != nil {
+			h.logger.Errorf("can't set tags of robot with id: %v: %v", newRobot.RobotID, err)
+		} else {
+			newRobot.Tags = tags
+		}
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/robot/%d", newRobot.RobotID))
+
+	err = respondJSONStatus(w, http.StatusCreated, newRobot)
 	if err != nil {
-		h.logger.Errorf(err.Error())
-		render.HTTPError("", http.StatusInternalServerError, w)
+		h.logger.Errorf("can't respond json with robot: %v", err)
+		render.Error(w, r, err)
 		return
 	}
+}
 
-	if rbtFromDB.DeletedAt != nil {
-		h.logger.Errorf("can't find robot with id: %v in storage", rbtID)
-		msg := fmt.Sprintf("robot with id %v don't exist", rbtID)
-		render.HTTPError(msg, http.StatusNotFound, w)
-		return
+// validateRobot checks the definition of a new robot and returns messages for
+// incorrect fields. Fields set by the trading aren't accepted.
+func (h *Handler) validateRobot(rbt *robot.Robot) map[string]string {
+	fields := h.validateParams(rbt)
+
+	if rbt.IsActive {
+		fields["is_active"] = "robot can't be created active"
+	}
+
+	readOnly := map[string]bool{
+		"robot_id":       rbt.RobotID != BottomLineValidID,
+		"fact_yield":     rbt.FactYield != nil,
+		"deals_count":    rbt.DealsCount != nil,
+		"activated_at":   rbt.ActivatedAt != nil,
+		"deactivated_at": rbt.DeactivatedAt != nil,
+		"created_at":     rbt.CreatedAt != nil,
+		"deleted_at":     rbt.DeletedAt != nil,
+	}
+
+	for name, set := range readOnly {
+		if set {
+			fields[name] = "can't be set"
+		}
 	}
 
-	if rbtFromDB.OwnerUserID != userID {
-		msg := fmt.Sprintf("user with id %v don't own robot with id: %v", userID, rbtID)
-		h.logger.Errorf(msg)
-		render.HTTPError(msg, http.StatusBadRequest, w)
+	return fields
+}
+
+// validateParams checks the trading parameters of the robot.
+func (h *Handler) validateParams(rbt *robot.Robot) map[string]string {
+	fields := make(map[string]string)
+
+	if rbt.Ticker == nil || !rbt.Ticker.V.Valid || rbt.Ticker.V.String == "" {
+		fields["ticker"] = "is required"
+	} else if !h.tickers[rbt.Ticker.V.String] {
+		fields["ticker"] = "is unknown"
+	}
+
+	buy, buyOK := positivePrice(fields, "buy_price", rbt.BuyPrice)
+	sell, sellOK := positivePrice(fields, "sell_price", rbt.SellPrice)
+
+	if buyOK && sellOK && buy >= sell {
+		fields["sell_price"] = "must be greater than buy_price"
+	}
+
+	start, startOK := requiredTime(fields, "plan_start", rbt.PlanStart)
+	end, endOK := requiredTime(fields, "plan_end", rbt.PlanEnd)
+
+	if startOK && endOK && !start.Before(end) {
+		fields["plan_end"] = "must be after plan_start"
+	}
+
+	if rbt.PlanYield != nil && rbt.PlanYield.V.Valid && rbt.PlanYield.V.Float64 < 0 {
+		fields["plan_yield"] = "must not be negative"
+	}
+
+	if rbt.Visibility != "" && !robot.IsVisibility(rbt.Visibility) {
+		fields["visibility"] = msgVisibility
+	}
+
+	return fields
+}
+
+func positivePrice(fields map[string]string, name string, v *format.NullFloat64) (float64, bool) {
+	if v == nil || !v.V.Valid {
+		fields[name] = "is required"
+		return 0, false
+	}
+
+	if v.V.Float64 <= 0 {
+		fields[name] = "must be positive"
+		return 0, false
+	}
+
+	return v.V.Float64, true
+}
+
+func requiredTime(fields map[string]string, name string, v *format.NullTime) (time.Time, bool) {
+	if v == nil || !v.V.Valid {
+		fields[name] = "is required"
+		return time.Time{}, false
+	}
+
+	return v.V.Time, true
+}
+
+func (h *Handler) deleteRobot(w http.ResponseWriter, r *http.Request) {
+	rbtID, p, err := h.getRobotAndPrincipal(r, apikey.ScopeRobotsWrite)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
 		return
 	}
 
-	rbtFromDB.DeletedAt, err = format.NewNullTime()
+	rbtFromDB, err := findRobot(h.robotStorage, rbtID)
 	if err != nil {
-		h.logger.Errorf("can't create new null time: %v", err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
 		return
 	}
 
-	err = h.robotStorage.Update(rbtFromDB)
+	err = h.removeRobot(r, p, rbtFromDB)
 	if err != nil {
-		h.logger.Errorf("can't delete robot from storage with rbtID: %v: %v", rbtID, err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+		h.logger.Errorf("can't delete robot with id: %v: %v", rbtID, err)
+		render.Error(w, r, err)
 		return
 	}
 
@@ -99,137 +216,173 @@ func (h *Handler) deleteRobot(w http.ResponseWriter, r *http.Request) {
 	go h.hub.Broadcast(rbtFromDB)
 }
 
-func getRobotAndUserID(sessionStorage session.Storage, r *http.Request) (int64, int64, error) {
-	rbtID, err := IDFromParams(r)
-	if err != nil {
-		return -1, -1, errors.Wrap(err, "can't get ID from URL params")
+// removeRobot marks the robot of the principal as deleted.
+func (h *Handler) removeRobot(r *http.Request, p *principal, rbt *robot.Robot) error {
+	if rbt.DeletedAt != nil {
+		return errRobotNotFound(rbt.RobotID)
 	}
 
-	if rbtID <= BottomLineValidID {
-		return -1, -1, errors.Wrapf(err, "don't valid id: %v", rbtID)
+	if !h.allowed(p, policy.DeleteRobot, rbt.OwnerUserID) {
+		return errRobotForbidden("user with id %v don't own robot with id: %v", p.userID, rbt.RobotID)
 	}
 
-	token := tokenFromReq(r)
+	before := *rbt
 
-	session, err := sessionStorage.FindByToken(token)
-	if err != nil {
-		return -1, -1, errors.Wrap(err, "can't find owner by token in storage")
-	}
+	var err error
 
-	if session.UserID == BottomLineValidID {
-		return -1, -1, errors.Wrap(err, "can't find owner by token")
+	rbt.DeletedAt, err = format.NewNullTime()
+	if err != nil {
+		return errors.Wrap(err, "can't create new null time")
 	}
 
-	return rbtID, session.UserID, nil
-}
-
-func findRobot(robotStorage robot.Storage, rbtID int64) (*robot.Robot, error) {
-	rbtFromDB, err := robotStorage.FindByID(rbtID)
+	err = h.robotStorage.Update(rbt)
 	if err != nil {
-		return nil, errors.Wrapf(err, "can't find robot with id: %v in storage", rbtID)
+		return errRobotModified(errors.Wrap(err, "can't delete robot in storage"), rbt.RobotID)
 	}
 
-	if rbtFromDB.RobotID == BottomLineValidID {
-		return nil, errors.Wrapf(err, "robot with id: %v doesn't exist", rbtID)
-	}
+	h.recordChange(r, robotEntry(p.userID, audit.DeleteRobot, rbt.RobotID), &before, rbt)
+	h.notify(webhook.RobotDeleted, rbt)
 
-	return rbtFromDB, nil
+	return nil
 }
 
-func (h *Handler) getRobots(w http.ResponseWriter, r *http.Request) {
-	ownerID, ticker, err := IDAndTickerFromParams(r)
+func (h *Handler) restoreRobot(w http.ResponseWriter, r *http.Request) {
+	rbtID, p, err := h.getRobotAndPrincipal(r, apikey.ScopeRobotsWrite)
 	if err != nil {
-		h.logger.Errorf("can't get user's id and/or ticker from URL params: %v", err)
-		render.HTTPError("", http.StatusBadRequest, w)
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
 		return
 	}
 
-	if ownerID < BottomLineValidID {
-		msg := fmt.Sprintf("incorrect id: %v", ownerID)
-		h.logger.Errorf(msg)
-		render.HTTPError(msg, http.StatusBadRequest, w)
+	rbtFromDB, err := findRobot(h.robotStorage, rbtID)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
 		return
 	}
 
-	token := tokenFromReq(r)
-
-	u, err := h.sessionStorage.FindByToken(token)
-	if err != nil {
-		h.logger.Errorf("can't find owner by token in storage: %v", err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+	if !h.allowed(p, policy.DeleteRobot, rbtFromDB.OwnerUserID) {
+		err = errRobotForbidden("user with id %v don't own robot with id: %v", p.userID, rbtID)
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
 		return
 	}
 
-	if u.UserID == BottomLineValidID {
-		h.logger.Errorf("Can't find user by token")
-		msg := fmt.Sprintf("can't find user")
-		render.HTTPError(msg, http.StatusBadRequest, w)
+	if rbtFromDB.DeletedAt == nil {
+		err = apperr.Newf(apperr.KindConflict, codeRobotState, "robot with id: %v isn't deleted", rbtID)
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
 		return
 	}
 
-	robots, err := h.robotStorage.GetAll(ownerID, ticker)
+	before := *rbtFromDB
+	rbtFromDB.DeletedAt = nil
+
+	err = h.robotStorage.Update(rbtFromDB)
 	if err != nil {
-		h.logger.Errorf("Can't get robots from storage (owner's id: %v, ticker: %v): %v", ownerID, ticker, err)
-		msg := fmt.Sprintf("can't find user")
-		render.HTTPError(msg, http.StatusInternalServerError, w)
+		h.logger.Errorf("can't restore robot in storage with rbtID: %v: %v", rbtID, err)
+		render.Error(w, r, errRobotModified(err, rbtID))
 		return
 	}
 
-	err = respondWithData(w, r, h.tmplts, robots...)
+	h.recordChange(r, robotEntry(p.userID, audit.RestoreRobot, rbtID), &before, rbtFromDB)
+
+	w.Header().Set("ETag", robotETag(rbtFromDB))
+
+	err = respondJSON(w, rbtFromDB)
 	if err != nil {
-		h.logger.Errorf("can't respond with data: %v", err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+		h.logger.Errorf("can't respond json with robot data: %v", err)
+		render.Error(w, r, err)
 		return
 	}
+
+	go h.hub.Broadcast(rbtFromDB)
 }
 
-func IDAndTickerFromParams(r *http.Request) (int64, string, error) {
-	userStr := r.URL.Query().Get("user")
+func (h *Handler) getRobotAndPrincipal(r *http.Request, scope string) (int64, *principal, error) {
+	rbtID, err := idParam(r, "id")
+	if err != nil {
+		return -1, nil, errors.Wrap(err, "can't get ID from URL params")
+	}
+
+	p, err := h.authorize(r, scope)
+	if err != nil {
+		return -1, nil, err
+	}
 
-	var id int64 = BottomLineValidID
+	return rbtID, p, nil
+}
 
-	if userStr != "" {
-		var err error
+func robotEntry(actorID int64, action string, rbtID int64) *audit.Entry {
+	return &audit.Entry{
+		ActorID:    actorID,
+		Action:     action,
+		TargetType: audit.TargetRobot,
+		TargetID:   rbtID,
+	}
+}
 
-		id, err = strconv.ParseInt(userStr, 10, 64)
-		if err != nil {
-			return -1, "", errors.Wrap(err, "can't parse string to int for get user's id from params")
-		}
+func findRobot(robotStorage robot.Storage, rbtID int64) (*robot.Robot, error) {
+	rbtFromDB, err := robotStorage.FindByID(rbtID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't find robot with id: %v in storage", rbtID)
 	}
 
-	tickerStr := r.URL.Query().Get("ticker")
+	if rbtFromDB.RobotID == BottomLineValidID {
+		return nil, errRobotNotFound(rbtID)
+	}
 
-	return id, tickerStr, nil
+	return rbtFromDB, nil
 }
 
 func (h *Handler) makeFavourite(w http.ResponseWriter, rr *http.Request) {
-	rbtID, userID, err := getRobotAndUserID(h.sessionStorage, rr)
+	rbtID, p, err := h.getRobotAndPrincipal(rr, apikey.ScopeRobotsWrite)
 	if err != nil {
 		h.logger.Errorf(err.Error())
-		render.HTTPError("", http.StatusBadRequest, w)
+		render.Error(w, rr, err)
 		return
 	}
 
 	rbtFromDB, err := findRobot(h.robotStorage, rbtID)
 	if err != nil {
 		h.logger.Errorf(err.Error())
-		render.HTTPError("", http.StatusInternalServerError, w)
+		render.Error(w, rr, err)
 		return
 	}
 
-	rbt := copyForFavourite(rbtFromDB, userID)
+	if rbtFromDB.DeletedAt != nil {
+		h.logger.Errorf("can't find robot with id: %v in storage", rbtID)
+		render.Error(w, rr, errRobotNotFound(rbtID))
+		return
+	}
+
+	if !h.canRead(p, rbtFromDB) {
+		err = errRobotForbidden("user with id: %v don't have permission to copy robot with id: %v", p.userID, rbtID)
+		h.logger.Errorf(err.Error())
+		render.Error(w, rr, err)
+		return
+	}
+
+	rbt := copyForFavourite(rbtFromDB, p.userID)
 
 	err = h.robotStorage.Create(rbt)
 	if err != nil {
 		h.logger.Errorf("can't create copy for favourite robot with id: %v: %v", rbtID, err) //nolint: misspell
-		render.HTTPError("", http.StatusInternalServerError, w)
+		render.Error(w, rr, err)
 		return
 	}
 
+	h.recordChange(rr, robotEntry(p.userID, audit.FavouriteRobot, rbt.RobotID), nil, rbt)
+	h.recordRevision(p.userID, nil, rbt)
+
+	if err = h.copyTags(rbtFromDB, rbt); err != nil {
+		h.logger.Errorf("can't copy tags for favourite robot with id: %v: %v", rbt.RobotID, err) //nolint: misspell
+	}
+
 	err = respondJSON(w, rbt)
 	if err != nil {
 		h.logger.Errorf("can't respond with json: %v", err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+		render.Error(w, rr, err)
 		return
 	}
 
@@ -237,70 +390,164 @@ func (h *Handler) makeFavourite(w http.ResponseWriter, rr *http.Request) {
 }
 
 func copyForFavourite(old *robot.Robot, ownerID int64) *robot.Robot {
-	res := old
+	res := *old
 	res.OwnerUserID = ownerID
 	res.ParentRobotID = format.NewNullInt64(old.RobotID)
 	res.IsFavourite = true
 	res.IsActive = false
 	res.ActivatedAt = nil
+	res.Visibility = robot.VisibilityPrivate
+	res.Tags = nil
+
+	return &res
+}
 
-	return res
+// canRead reports whether the principal may read the robot, shared robots
+// are readable by everyone.
+func (h *Handler) canRead(p *principal, rbt *robot.Robot) bool {
+	return rbt.IsShared() || h.allowed(p, policy.ReadRobot, rbt.OwnerUserID)
+}
+
+// canReadParams reports whether the principal may see trading parameters of
+// the robot: its owner, support, admins and followers of the robot may.
+func (h *Handler) canReadParams(p *principal, rbt *robot.Robot) (bool, error) {
+	if h.allowed(p, policy.ReadRobot, rbt.OwnerUserID) {
+		return true, nil
+	}
+
+	if h.followStorage == nil {
+		return false, nil
+	}
+
+	ff, err := h.followStorage.FindByParentID(rbt.RobotID)
+	if err != nil {
+		return false, errors.Wrapf(err, "can't find followers of robot with id: %v", rbt.RobotID)
+	}
+
+	for _, f := range ff {
+		if f.UserID == p.userID {
+			return true, nil
+		}
+	}
+
+	return false, nil
 }
 
 func (h *Handler) activate(w http.ResponseWriter, rr *http.Request) {
-	rbtID, userID, err := getRobotAndUserID(h.sessionStorage, rr)
+	rbtID, p, err := h.getRobotAndPrincipal(rr, apikey.ScopeRobotsActivate)
 	if err != nil {
 		h.logger.Errorf(err.Error())
-		render.HTTPError("", http.StatusBadRequest, w)
+		render.Error(w, rr, err)
 		return
 	}
 
 	rbtFromDB, err := findRobot(h.robotStorage, rbtID)
 	if err != nil {
 		h.logger.Errorf(err.Error())
-		render.HTTPError("", http.StatusInternalServerError, w)
+		render.Error(w, rr, err)
 		return
 	}
 
-	if !canBeChangeActivation(rbtFromDB, userID) || rbtFromDB.IsActive {
-		msg := fmt.Sprintf("can't activate robot with id: %v", rbtID)
-		h.logger.Errorf(msg)
-		render.HTTPError(msg, http.StatusBadRequest, w)
+	err = h.activateRobot(rr, newActivationFactor(rr), p, rbtFromDB)
+	if err != nil {
+		h.logger.Errorf("can't activate robot with id: %v: %v", rbtID, err)
+		render.Error(w, rr, err)
 		return
 	}
 
-	rbtFromDB.IsActive = true
-
-	rbtFromDB.ActivatedAt, err = format.NewNullTime()
+	err = respondJSON(w, rbtFromDB)
 	if err != nil {
-		h.logger.Errorf("can't create new null time: %v", err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, rr, err)
 		return
 	}
 
-	err = h.robotStorage.Update(rbtFromDB)
+	go h.hub.Broadcast(rbtFromDB)
+}
+
+// activateRobot starts trading of the robot if the principal may do it and
+// the robot is inside its plan.
+func (h *Handler) activateRobot(r *http.Request, f *activationFactor, p *principal, rbt *robot.Robot) error {
+	err := h.canActivate(p, rbt)
 	if err != nil {
-		h.logger.Errorf("can't create copy for active robot with id: %v: %v", rbtID, err)
-		render.HTTPError("", http.StatusInternalServerError, w)
-		return
+		return err
 	}
 
-	err = respondJSON(w, rbtFromDB)
+	err = h.checkActivationTOTP(f, p, rbt)
 	if err != nil {
-		h.logger.Errorf("can't respond with json: %v", err)
-		render.HTTPError("", http.StatusInternalServerError, w)
-		return
+		return err
 	}
 
-	go h.hub.Broadcast(rbtFromDB)
+	return h.startRobot(r, p, rbt)
 }
 
-func canBeChangeActivation(rbt *robot.Robot, userID int64) bool {
-	if rbt.OwnerUserID != userID || !intoPlanRange(rbt.PlanStart, rbt.PlanEnd) {
-		return false
+// canActivate checks that the principal may activate the robot.
+func (h *Handler) canActivate(p *principal, rbt *robot.Robot) error {
+	if !h.allowed(p, policy.ActivateRobot, rbt.OwnerUserID) {
+		return errRobotForbidden("user with id: %v don't have permission to activate robot with id: %v",
+			p.userID, rbt.RobotID)
+	}
+
+	owner, err := h.userStorage.FindByID(p.userID)
+	if err != nil {
+		return errors.Wrapf(err, "can't find user with id: %v in storage", p.userID)
+	}
+
+	if !owner.Verified {
+		return apperr.Newf(apperr.KindForbidden, codeEmailNotVerified,
+			"user with id: %v must verify email to activate robots", p.userID)
+	}
+
+	return nil
+}
+
+// checkActivationTOTP requires the second factor of the request for robots
+// with a high buy price.
+func (h *Handler) checkActivationTOTP(f *activationFactor, p *principal, rbt *robot.Robot) error {
+	if rbt.BuyPrice == nil || !rbt.BuyPrice.V.Valid {
+		return nil
+	}
+
+	msg, err := h.requireTOTPForActivation(f, p.userID, rbt.BuyPrice.V.Float64)
+	if err != nil {
+		return errors.Wrap(err, "can't check second factor")
 	}
 
-	return true
+	if msg != "" {
+		return apperr.New(apperr.KindForbidden, codeTwoFactorRequired, msg)
+	}
+
+	return nil
+}
+
+// startRobot activates the robot without checks of the principal, r is nil
+// when the scheduler or the parent of the robot activates it.
+func (h *Handler) startRobot(r *http.Request, p *principal, rbt *robot.Robot) error {
+	if !intoPlanRange(rbt.PlanStart, rbt.PlanEnd) || rbt.IsActive {
+		return apperr.Newf(apperr.KindConflict, codeRobotState, "can't activate robot with id: %v", rbt.RobotID)
+	}
+
+	before := *rbt
+
+	var err error
+
+	rbt.IsActive = true
+
+	rbt.ActivatedAt, err = format.NewNullTime()
+	if err != nil {
+		return errors.Wrap(err, "can't create new null time")
+	}
+
+	err = h.robotStorage.Update(rbt)
+	if err != nil {
+		return errRobotModified(errors.Wrap(err, "can't activate robot in storage"), rbt.RobotID)
+	}
+
+	h.recordChange(r, robotEntry(p.userID, audit.ActivateRobot, rbt.RobotID), &before, rbt)
+	h.syncFollowers(r, p.userID, &before, rbt)
+	h.notify(webhook.RobotActivated, rbt)
+
+	return nil
 }
 
 func intoPlanRange(start *format.NullTime, end *format.NullTime) bool {
@@ -317,86 +564,132 @@ func intoPlanRange(start *format.NullTime, end *format.NullTime) bool {
 }
 
 func (h *Handler) deactivate(w http.ResponseWriter, rr *http.Request) {
-	rbtID, userID, err := getRobotAndUserID(h.sessionStorage, rr)
+	rbtID, p, err := h.getRobotAndPrincipal(rr, apikey.ScopeRobotsActivate)
 	if err != nil {
 		h.logger.Errorf(err.Error())
-		render.HTTPError("", http.StatusBadRequest, w)
+		render.Error(w, rr, err)
 		return
 	}
 
 	rbtFromDB, err := findRobot(h.robotStorage, rbtID)
 	if err != nil {
 		h.logger.Errorf(err.Error())
-		render.HTTPError("", http.StatusInternalServerError, w)
+		render.Error(w, rr, err)
 		return
 	}
 
-	if !canBeChangeActivation(rbtFromDB, userID) || !rbtFromDB.IsActive {
-		msg := fmt.Sprintf("can't deactivate robot with id: %v", rbtID)
-		h.logger.Errorf(msg)
-		render.HTTPError(msg, http.StatusBadRequest, w)
+	err = h.deactivateRobot(rr, p, rbtFromDB)
+	if err != nil {
+		h.logger.Errorf("can't deactivate robot with id: %v: %v", rbtID, err)
+		render.Error(w, rr, err)
 		return
 	}
 
-	rbtFromDB.IsActive = false
-
-	rbtFromDB.DeactivatedAt, err = format.NewNullTime()
+	err = respondJSON(w, rbtFromDB)
 	if err != nil {
-		h.logger.Errorf("can't create new null time: %v", err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, rr, err)
 		return
 	}
 
-	err = h.robotStorage.Update(rbtFromDB)
+	go h.hub.Broadcast(rbtFromDB)
+}
+
+// deactivateRobot stops trading of the robot if the principal may do it.
+func (h *Handler) deactivateRobot(r *http.Request, p *principal, rbt *robot.Robot) error {
+	if !h.allowed(p, policy.DeactivateRobot, rbt.OwnerUserID) {
+		return errRobotForbidden("user with id: %v don't have permission to deactivate robot with id: %v",
+			p.userID, rbt.RobotID)
+	}
+
+	// admins force deactivation of robots they don't own regardless of the plan
+	forced := rbt.OwnerUserID != p.userID
+
+	if (!forced && !intoPlanRange(rbt.PlanStart, rbt.PlanEnd)) || !rbt.IsActive {
+		return apperr.Newf(apperr.KindConflict, codeRobotState, "can't deactivate robot with id: %v", rbt.RobotID)
+	}
+
+	before := *rbt
+
+	var err error
+
+	rbt.IsActive = false
+
+	rbt.DeactivatedAt, err = format.NewNullTime()
 	if err != nil {
-		h.logger.Errorf("can't create copy for active robot with id: %v: %v", rbtID, err)
-		render.HTTPError("", http.StatusInternalServerError, w)
-		return
+		return errors.Wrap(err, "can't create new null time")
 	}
 
-	err = respondJSON(w, rbtFromDB)
+	err = h.robotStorage.Update(rbt)
 	if err != nil {
-		h.logger.Errorf("can't respond with json: %v", err)
-		render.HTTPError("", http.StatusInternalServerError, w)
-		return
+		return errRobotModified(errors.Wrap(err, "can't deactivate robot in storage"), rbt.RobotID)
 	}
 
-	go h.hub.Broadcast(rbtFromDB)
+	h.recordChange(r, robotEntry(p.userID, audit.DeactivateRobot, rbt.RobotID), &before, rbt)
+	h.syncFollowers(r, p.userID, &before, rbt)
+	h.notify(webhook.RobotDeactivated, rbt)
+
+	return nil
 }
 
 func (h *Handler) getRobot(w http.ResponseWriter, rr *http.Request) {
-	rbtID, userID, err := getRobotAndUserID(h.sessionStorage, rr)
+	rbtID, p, err := h.getRobotAndPrincipal(rr, apikey.ScopeRobotsRead)
 	if err != nil {
 		h.logger.Errorf(err.Error())
-		render.HTTPError("", http.StatusBadRequest, w)
+		render.Error(w, rr, err)
 		return
 	}
 
 	rbtFromDB, err := findRobot(h.robotStorage, rbtID)
 	if err != nil {
 		h.logger.Errorf(err.Error())
-		render.HTTPError("", http.StatusInternalServerError, w)
+		render.Error(w, rr, err)
 		return
 	}
 
 	if rbtFromDB.DeletedAt != nil {
 		h.logger.Errorf("can't find robot with id: %v in storage", rbtID)
-		msg := fmt.Sprintf("robot with id %v don't exist", rbtID)
-		render.HTTPError(msg, http.StatusNotFound, w)
+		render.Error(w, rr, errRobotNotFound(rbtID))
+		return
+	}
+
+	if !h.canRead(p, rbtFromDB) {
+		h.logger.Errorf("can get robot with id: %v for user with id: %v", rbtID, p.userID)
+		render.Error(w, rr, errRobotForbidden("user with id: %v don't have permission to get robot with id: %v", p.userID, rbtID))
 		return
 	}
 
-	if rbtFromDB.OwnerUserID != userID {
-		h.logger.Errorf("can get robot with id: %v for user with id: %v", rbtID, userID)
-		msg := fmt.Sprintf("user with id: %v don't have permission to get robot with id: %v", userID, rbtID)
-		render.HTTPError(msg, http.StatusBadRequest, w)
+	full, err := h.canReadParams(p, rbtFromDB)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, rr, err)
 		return
 	}
 
+	// other users see shared robots as the catalogue shows them
+	if !full {
+		err = respondJSON(w, newCatalogueRobot(rbtFromDB))
+		if err != nil {
+			h.logger.Errorf("can't respond with json: %v", err)
+			render.Error(w, rr, err)
+		}
+
+		return
+	}
+
+	err = h.fillTags(p.userID, rbtFromDB)
+	if err != nil {
+		h.logger.Errorf("can't fill tags of robot with id: %v: %v", rbtID, err)
+		render.Error(w, rr, err)
+		return
+	}
+
+	w.Header().Set("ETag", robotETag(rbtFromDB))
+
 	err = respondWithData(w, rr, h.tmplts, rbtFromDB)
 	if err != nil {
 		h.logger.Errorf("can't respond with data: %v", err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+		render.Error(w, rr, err)
 		return
 	}
 }
@@ -404,49 +697,129 @@ func (h *Handler) getRobot(w http.ResponseWriter, rr *http.Request) {
 func (h *Handler) updateRobot(w http.ResponseWriter, rr *http.Request) {
 	var rbt robot.Robot
 
-	err := json.NewDecoder(rr.Body).Decode(&rbt)
+	err := decodeJSON(w, rr, &rbt)
 	if err != nil {
 		h.logger.Errorf("can't unmarshal input json for update robot: %v", err)
-		render.HTTPError("", http.StatusBadRequest, w)
+		render.Error(w, rr, err)
 		return
 	}
 
-	rbtID, userID, err := getRobotAndUserID(h.sessionStorage, rr)
+	rbtID, p, err := h.getRobotAndPrincipal(rr, apikey.ScopeRobotsWrite)
 	if err != nil {
 		h.logger.Errorf(err.Error())
-		render.HTTPError("", http.StatusBadRequest, w)
+		render.Error(w, rr, err)
 		return
 	}
 
 	rbtFromID, err := findRobot(h.robotStorage, rbtID)
 	if err != nil {
 		h.logger.Errorf(err.Error())
-		render.HTTPError("", http.StatusInternalServerError, w)
+		render.Error(w, rr, err)
+		return
+	}
+
+	if !h.allowed(p, policy.UpdateRobot, rbtFromID.OwnerUserID) {
+		err = errRobotForbidden("user with id: %v don't have permission to update robot with id: %v", p.userID, rbtID)
+		h.logger.Errorf(err.Error())
+		render.Error(w, rr, err)
 		return
 	}
 
-	if rbtFromID.OwnerUserID != userID {
-		msg := fmt.Sprintf("user with id: %v don't have permission to update robot with id: %v", userID, rbtID)
-		h.logger.Errorf(msg)
-		render.HTTPError(msg, http.StatusBadRequest, w)
+	if rbtFromID.DeletedAt != nil {
+		h.logger.Errorf("can't find robot with id: %v in storage", rbtID)
+		render.Error(w, rr, errRobotNotFound(rbtID))
+		return
+	}
+
+	err = checkIfMatch(rr, rbtFromID)
+	if err != nil {
+		h.logger.Errorf("can't update robot with id: %v: %v", rbtID, err)
+		render.Error(w, rr, err)
+		return
+	}
+
+	// only the trading parameters are edited, the state, the owner and the
+	// results of the robot are changed by their own endpoints and by deals
+	updated := *rbtFromID
+	updated.Ticker = rbt.Ticker
+	updated.BuyPrice = rbt.BuyPrice
+	updated.SellPrice = rbt.SellPrice
+	updated.PlanStart = rbt.PlanStart
+	updated.PlanEnd = rbt.PlanEnd
+	updated.PlanYield = rbt.PlanYield
+
+	if rbt.Visibility != "" {
+		updated.Visibility = rbt.Visibility
+	}
+
+	// tags are changed by setRobotTags
+	updated.Tags = nil
+
+	if fields := h.validateParams(&updated); len(fields) > 0 {
+		h.logger.Errorf("incorrect robot with id: %v: %v", rbtID, fields)
+		render.Error(w, rr, apperr.Validation(fields))
 		return
 	}
 
-	rbt.RobotID = rbtID
+	rbt = updated
 
 	err = h.robotStorage.Update(&rbt)
 	if err != nil {
 		h.logger.Errorf("can't update  robot with id: %v in storage: %v", rbtID, err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+
+		if errors.Cause(err) == robot.ErrConflict {
+			err = errVersionMismatch(rbtID)
+		}
+
+		render.Error(w, rr, err)
 		return
 	}
 
+	h.recordChange(rr, robotEntry(p.userID, audit.UpdateRobot, rbtID), rbtFromID, &rbt)
+	h.recordRevision(p.userID, rbtFromID, &rbt)
+	h.syncFollowers(rr, p.userID, rbtFromID, &rbt)
+
+	if err = h.fillTags(p.userID, &rbt); err != nil {
+		h.logger.Errorf("can't fill tags of robot with id: %v: %v", rbtID, err)
+	}
+
+	w.Header().Set("ETag", robotETag(&rbt))
+
 	err = respondJSON(w, rbt)
 	if err != nil {
 		h.logger.Errorf("can't respond with json: %v", err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+		render.Error(w, rr, err)
 		return
 	}
 
 	go h.hub.Broadcast(&rbt)
 }
+
+func robotETag(r *robot.Robot) string {
+	return `"` + strconv.FormatInt(r.Version, 10) + `"`
+}
+
+func errVersionMismatch(id int64) error {
+	return apperr.Newf(apperr.KindPreconditionFailed, apperr.CodePrecondition,
+		"robot with id %v was modified, get it again and retry", id)
+}
+
+// checkIfMatch requires clients to prove they update the current version of the robot.
+func checkIfMatch(r *http.Request, rbt *robot.Robot) error {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return apperr.New(apperr.KindPreconditionRequired, apperr.CodeNoPrecondition,
+			"If-Match header with the ETag of the robot is required")
+	}
+
+	etag := robotETag(rbt)
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == etag {
+			return nil
+		}
+	}
+
+	return errVersionMismatch(rbt.RobotID)
+}
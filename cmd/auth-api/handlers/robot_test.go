@@ -8,6 +8,7 @@ import (
 	"cw1/internal/session"
 	"cw1/internal/user"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -16,7 +17,8 @@ import (
 )
 
 func TestCreateRobotCorrect(t *testing.T) {
-	json := []byte(`{"owner_user_id": 1,"is_favourite": true,"is_active": true}`)
+	json := []byte(`{"is_favourite": true,"ticker": "AAPL","buy_price": 100,"sell_price": 110,` +
+		`"plan_start": "2020-04-01T10:00:00Z","plan_end": "2020-04-01T18:00:00Z","plan_yield": 5}`)
 	req, err := http.NewRequest("POST", "/api/v1/robot", bytes.NewBuffer(json))
 	if err != nil {
 		t.Fatalf("can't create request %v", err)
@@ -68,11 +70,52 @@ func TestCreateRobotCorrect(t *testing.T) {
 			status, http.StatusCreated)
 	}
 
-	expected := ""
+	expected := `{"robot_id":1,"owner_user_id":1,"is_favourite":true,"is_active":false,"ticker":"AAPL",` +
+		`"buy_price":100,"sell_price":110,"plan_start":"2020-04-01T10:00:00Z","plan_end":"2020-04-01T18:00:00Z","plan_yield":5,"visibility":"private"}`
 	if rr.Body.String() != expected {
 		t.Errorf("createRobot handler returned unexpected body: got %v, want %v",
 			rr.Body.String(), expected)
 	}
+
+	if loc := rr.Header().Get("Location"); loc != "/api/v1/robot/1" {
+		t.Errorf("createRobot handler returned unexpected location: got %v, want %v",
+			loc, "/api/v1/robot/1")
+	}
+}
+
+func TestCreateRobotValidation(t *testing.T) {
+	json := []byte(`{"ticker": "UNKNOWN","buy_price": 110,"sell_price": 100,"plan_start": "2020-04-01T18:00:00Z",` +
+		`"plan_end": "2020-04-01T10:00:00Z","plan_yield": -1,"is_active": true,"deals_count": 3}`)
+	req, err := http.NewRequest("POST", "/api/v1/robot", bytes.NewBuffer(json))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := &mockUserStorage{u: &user.User{ID: 1, Email: "email"}}
+	mockRobotStorage := &mockRobotStorage{rr: []*robot.Robot{{RobotID: 1, OwnerUserID: 1}}}
+	mockSessionStorage := &mockSessionStorage{s: &session.Session{SessionID: token, UserID: 1}}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub)
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.createRobot).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusUnprocessableEntity {
+		t.Fatalf("createRobot handler returned wrong status code: got %v, want %v",
+			status, http.StatusUnprocessableEntity)
+	}
+
+	for _, f := range []string{"ticker", "sell_price", "plan_end", "plan_yield", "is_active", "deals_count"} {
+		expected := `"name":"` + f + `"`
+		if !respContains(rr.Body.String(), expected) {
+			t.Errorf("createRobot handler didn't return error for field %v: %v", f, rr.Body.String())
+		}
+	}
 }
 
 func TestDeleteRobotCorrect(t *testing.T) {
@@ -81,6 +124,8 @@ func TestDeleteRobotCorrect(t *testing.T) {
 		t.Fatalf("can't create request %v", err)
 	}
 
+	req = withURLParams(req, "id", "5")
+
 	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Accept", "application/json")
@@ -140,6 +185,8 @@ func TestDeleteRobotNotFound(t *testing.T) {
 		t.Fatalf("can't create request %v", err)
 	}
 
+	req = withURLParams(req, "id", "5")
+
 	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Accept", "application/json")
@@ -188,8 +235,8 @@ func TestDeleteRobotNotFound(t *testing.T) {
 			status, http.StatusNotFound)
 	}
 
-	expected := `{"error":"robot with id 5 don't exist"}`
-	if rr.Body.String() != expected {
+	expected := `"detail":"robot with id 5 don't exist"`
+	if !respContains(rr.Body.String(), expected) {
 		t.Errorf("deleteRobot handler returned unexpected body: got %v, want %v",
 			rr.Body.String(), expected)
 	}
@@ -269,6 +316,8 @@ func TestMakeFavouriteCorrect(t *testing.T) {
 		t.Fatalf("can't create request %v", err)
 	}
 
+	req = withURLParams(req, "id", "5")
+
 	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Accept", "application/json")
@@ -315,7 +364,7 @@ func TestMakeFavouriteCorrect(t *testing.T) {
 			status, http.StatusOK)
 	}
 
-	expected := `{"robot_id":5,"owner_user_id":1,"parent_robot_id":5,"is_favourite":true,"is_active":false}`
+	expected := `{"robot_id":5,"owner_user_id":1,"parent_robot_id":5,"is_favourite":true,"is_active":false,"visibility":"private"}`
 	if rr.Body.String() != expected {
 		t.Errorf("makeFavourite handler returned unexpected body: got %v, want %v",
 			rr.Body.String(), expected)
@@ -328,6 +377,8 @@ func TestActivateCorrect(t *testing.T) {
 		t.Fatalf("can't create request %v", err)
 	}
 
+	req = withURLParams(req, "id", "5")
+
 	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Accept", "application/json")
@@ -347,6 +398,7 @@ func TestActivateCorrect(t *testing.T) {
 		ID:       1, // not zero value
 		Email:    "email",
 		Password: hash,
+		Verified: true,
 	}
 
 	s := &session.Session{
@@ -391,6 +443,8 @@ func TestGetRobot(t *testing.T) {
 		t.Fatalf("can't create request %v", err)
 	}
 
+	req = withURLParams(req, "id", "5")
+
 	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Accept", "application/json")
@@ -442,6 +496,10 @@ func TestGetRobot(t *testing.T) {
 		t.Errorf("getRobot handler returned unexpected body: got %v, want %v",
 			rr.Body.String(), expected)
 	}
+
+	if etag := rr.Header().Get("ETag"); etag != `"0"` {
+		t.Errorf("getRobot handler returned wrong ETag: got %v, want %v", etag, `"0"`)
+	}
 }
 
 func TestGetRobotNotFound(t *testing.T) {
@@ -450,6 +508,8 @@ func TestGetRobotNotFound(t *testing.T) {
 		t.Fatalf("can't create request %v", err)
 	}
 
+	req = withURLParams(req, "id", "5")
+
 	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Accept", "application/json")
@@ -498,16 +558,20 @@ func TestGetRobotNotFound(t *testing.T) {
 			status, http.StatusNotFound)
 	}
 
-	expected := `{"error":"robot with id 5 don't exist"}`
+	expected := `"detail":"robot with id 5 don't exist"`
 	if !respContains(rr.Body.String(), expected) {
 		t.Errorf("getRobot handler returned unexpected body: got %v, want %v",
 			rr.Body.String(), expected)
 	}
 }
 
+// robotParams completes the body of the update with correct trading parameters.
+const robotParams = `"ticker": "AAPL","sell_price": 100,"plan_start": "2002-10-02T15:00:00Z",` +
+	`"plan_end": "2002-10-02T19:00:00Z"`
+
 func TestUpdateRobotCorrect(t *testing.T) {
 	json := []byte(`{"owner_user_id": 1,"is_favourite": true,"is_active": true,"parent_robot_id": 1,` +
-		`"ticker": "AAPL","buy_price": 56.5,"sell_price": 46.78,"plan_start": "2002-10-02T15:00:00.05Z","plan_end": "2002-10-02T19:00:00.05Z",` +
+		`"ticker": "AAPL","buy_price": 46.78,"sell_price": 56.5,"plan_start": "2002-10-02T15:00:00.05Z","plan_end": "2002-10-02T19:00:00.05Z",` +
 		`"plan_yield": 1000,"fact_yield": 100,"deals_count": 10,"activated_at": "2002-10-02T15:00:00.05Z",` +
 		`"deactivated_at": "2002-10-02T19:00:00.05Z","created_at": "2000-10-02T19:00:00.05Z"}`)
 	req, err := http.NewRequest("PUT", "/api/v1/robot/5", bytes.NewBuffer(json))
@@ -515,9 +579,12 @@ func TestUpdateRobotCorrect(t *testing.T) {
 		t.Fatalf("can't create request %v", err)
 	}
 
+	req = withURLParams(req, "id", "5")
+
 	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Accept", "application/json")
+	req.Header.Set("If-Match", `"0"`)
 
 	l := new(mockLogger)
 	hub := socket.NewHub()
@@ -549,7 +616,7 @@ func TestUpdateRobotCorrect(t *testing.T) {
 	mockSessionStorage.s = s
 	mockRobotStorage.rr = rbts
 
-	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub)
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub, WithTickers([]string{"AAPL"}))
 
 	rr := httptest.NewRecorder()
 	handler := http.HandlerFunc(h.updateRobot)
@@ -561,12 +628,304 @@ func TestUpdateRobotCorrect(t *testing.T) {
 			status, http.StatusOK)
 	}
 
-	expected := `{"robot_id":5,"owner_user_id":1,"parent_robot_id":1,"is_favourite":true,"is_active":true,"ticker":"AAPL",` +
-		`"buy_price":56.5,"sell_price":46.78,"plan_start":"2002-10-02T15:00:00Z","plan_end":"2002-10-02T19:00:00Z",` +
-		`"plan_yield":1000,"fact_yield":100,"deals_count":10,"activated_at":"2002-10-02T15:00:00Z",` +
-		`"deactivated_at":"2002-10-02T19:00:00Z","created_at":"2000-10-02T19:00:00Z"}`
+	expected := `{"robot_id":5,"owner_user_id":1,"is_favourite":false,"is_active":false,"ticker":"AAPL",` +
+		`"buy_price":46.78,"sell_price":56.5,"plan_start":"2002-10-02T15:00:00Z","plan_end":"2002-10-02T19:00:00Z",` +
+		`"plan_yield":1000}`
 	if !respContains(rr.Body.String(), expected) {
 		t.Errorf("updateRobot handler returned unexpected body: got %v, want %v",
 			rr.Body.String(), expected)
 	}
 }
+
+func TestGetRobotForbidden(t *testing.T) {
+	req, err := http.NewRequest("GET", "/api/v1/robot/5", nil)
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	req = withURLParams(req, "id", "5")
+
+	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+
+	mockUserStorage.u = &user.User{
+		ID:   2,
+		Role: user.RoleUser,
+	}
+
+	mockSessionStorage.s = &session.Session{
+		SessionID: token,
+		UserID:    2,
+	}
+
+	mockRobotStorage.rr = []*robot.Robot{
+		{RobotID: 5, OwnerUserID: 1},
+	}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.getRobot)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusForbidden {
+		t.Errorf("getRobot handler returned wrong status code: got %v, want %v",
+			status, http.StatusForbidden)
+	}
+}
+
+func TestDeactivateByAdmin(t *testing.T) {
+	req, err := http.NewRequest("PUT", "/api/v1/robot/5/deactivate", nil)
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	req = withURLParams(req, "id", "5")
+
+	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+
+	mockUserStorage.u = &user.User{
+		ID:   2,
+		Role: user.RoleAdmin,
+	}
+
+	mockSessionStorage.s = &session.Session{
+		SessionID: token,
+		UserID:    2,
+	}
+
+	// robot is outside of its plan, only an admin can stop it now
+	mockRobotStorage.rr = []*robot.Robot{
+		{RobotID: 5, OwnerUserID: 1, IsActive: true},
+	}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.deactivate)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("deactivate handler returned wrong status code: got %v, want %v",
+			status, http.StatusOK)
+	}
+
+	expected := `"robot_id":5,"owner_user_id":1,"is_favourite":false,"is_active":false`
+	if !respContains(rr.Body.String(), expected) {
+		t.Errorf("deactivate handler returned unexpected body: got %v, want %v",
+			rr.Body.String(), expected)
+	}
+}
+
+func TestUpdateRobotImpersonated(t *testing.T) {
+	json := []byte(`{"ticker": "AAPL"}`)
+	req, err := http.NewRequest("PUT", "/api/v1/robot/5", bytes.NewBuffer(json))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	req = withURLParams(req, "id", "5")
+
+	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set(ImpersonateHeader, "1")
+	req.Header.Set("If-Match", `"0"`)
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+
+	mockUserStorage.u = &user.User{
+		ID:   2,
+		Role: user.RoleAdmin,
+	}
+
+	mockSessionStorage.s = &session.Session{
+		SessionID: token,
+		UserID:    2,
+	}
+
+	mockRobotStorage.rr = []*robot.Robot{
+		{RobotID: 5, OwnerUserID: 1},
+	}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.updateRobot)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusForbidden {
+		t.Errorf("updateRobot handler returned wrong status code: got %v, want %v",
+			status, http.StatusForbidden)
+	}
+}
+
+func TestUpdateRobotPrecondition(t *testing.T) {
+	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+
+	mockUserStorage.u = &user.User{ID: 1}
+	mockSessionStorage.s = &session.Session{SessionID: token, UserID: 1}
+	mockRobotStorage.rr = []*robot.Robot{
+		{RobotID: 5, OwnerUserID: 1, Version: 2},
+	}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub, WithTickers([]string{"AAPL"}))
+
+	tests := []struct {
+		ifMatch string
+		status  int
+	}{
+		{"", http.StatusPreconditionRequired},
+		{`"1"`, http.StatusPreconditionFailed},
+		{`W/"2"`, http.StatusPreconditionFailed},
+		{`"1", "2"`, http.StatusOK},
+		{"*", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("PUT", "/api/v1/robot/5", bytes.NewBufferString(`{"buy_price": 50,`+robotParams+`}`))
+		if err != nil {
+			t.Fatalf("can't create request %v", err)
+		}
+
+		req = withURLParams(req, "id", "5")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		if tt.ifMatch != "" {
+			req.Header.Set("If-Match", tt.ifMatch)
+		}
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.updateRobot).ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tt.status {
+			t.Errorf("updateRobot handler returned wrong status code for If-Match %q: got %v, want %v",
+				tt.ifMatch, status, tt.status)
+		}
+	}
+}
+
+func TestUpdateRobotIgnoresProtectedFields(t *testing.T) {
+	rbt := planned(5, 1, -time.Hour, time.Hour)
+	rbt.FactYield = price(3)
+	rbt.DealsCount = format.NewNullInt64(2)
+
+	h := newTestHandler(1, &mockRobotStorage{rr: []*robot.Robot{rbt}})
+
+	body := `{"buy_price": 50,` + robotParams + `,"robot_id": 9,"owner_user_id": 2,"is_active": true,` +
+		`"fact_yield": 100,"deals_count": 10,"deleted_at": null,"parent_robot_id": 7}`
+
+	req := requestFor(t, "PUT", "/api/v1/robot/5", body, "id", "5")
+	req.Header.Set("If-Match", "*")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.updateRobot).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("updateRobot handler returned wrong status code: got %v, want %v", status, http.StatusOK)
+	}
+
+	var updated robot.Robot
+	if err := json.Unmarshal(rr.Body.Bytes(), &updated); err != nil {
+		t.Fatalf("can't unmarshal updated robot %v", err)
+	}
+
+	if updated.RobotID != 5 || updated.OwnerUserID != 1 || updated.IsActive || updated.ParentRobotID != nil ||
+		updated.FactYield.V.Float64 != 3 || updated.DealsCount.V.Int64 != 2 {
+		t.Errorf("updateRobot handler changed protected fields: %+v", updated)
+	}
+
+	if updated.BuyPrice.V.Float64 != 50 || updated.SellPrice.V.Float64 != 100 {
+		t.Errorf("updateRobot handler didn't change parameters: %+v", updated)
+	}
+}
+
+func TestUpdateRobotIncorrect(t *testing.T) {
+	deleted := planned(6, 1, -time.Hour, time.Hour)
+	deleted.DeletedAt = runAt(time.Now())
+
+	h := newTestHandler(1, &mockRobotStorage{rr: []*robot.Robot{planned(5, 1, -time.Hour, time.Hour), deleted}})
+
+	tests := []struct {
+		id     string
+		body   string
+		status int
+	}{
+		{"5", `{"buy_price": 150,` + robotParams + `}`, http.StatusUnprocessableEntity},
+		{"5", `{"buy_price": 50}`, http.StatusUnprocessableEntity},
+		{"6", `{"buy_price": 50,` + robotParams + `}`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		req := requestFor(t, "PUT", "/api/v1/robot/"+tt.id, tt.body, "id", tt.id)
+		req.Header.Set("If-Match", "*")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.updateRobot).ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tt.status {
+			t.Errorf("updateRobot handler returned wrong status code for %v: got %v, want %v", tt.body, status, tt.status)
+		}
+	}
+}
+
+func TestRestoreRobot(t *testing.T) {
+	deletedAt, err := format.NewNullTime()
+	if err != nil {
+		t.Fatalf("can't create null time %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		rbt    *robot.Robot
+		status int
+	}{
+		{"deleted", &robot.Robot{RobotID: 5, OwnerUserID: 1, DeletedAt: deletedAt}, http.StatusOK},
+		{"not deleted", &robot.Robot{RobotID: 5, OwnerUserID: 1}, http.StatusConflict},
+		{"not own", &robot.Robot{RobotID: 5, OwnerUserID: 2, DeletedAt: deletedAt}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		h := newTestHandler(1, &mockRobotStorage{rr: []*robot.Robot{tt.rbt}})
+
+		req := requestFor(t, "POST", "/api/v1/robot/5/restore", "", "id", "5")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.restoreRobot).ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tt.status {
+			t.Errorf("restoreRobot handler returned wrong status code for %v robot: got %v, want %v",
+				tt.name, status, tt.status)
+		}
+
+		if tt.status == http.StatusOK && respContains(rr.Body.String(), "deleted_at") {
+			t.Errorf("restoreRobot handler returned deleted robot: %v", rr.Body.String())
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"cw1/cmd/auth-api/render"
+	"cw1/internal/apikey"
+	"cw1/internal/apperr"
+	"cw1/internal/policy"
+	"cw1/internal/robot"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRobotsLimit = 50
+	maxRobotsLimit     = 200
+)
+
+// getRobots lists robots page by page, the link to the next page is sent in
+// the Link header. Soft-deleted robots are listed only on request of users
+// allowed to read robots of the owner.
+func (h *Handler) getRobots(w http.ResponseWriter, r *http.Request) {
+	f, err := robotFilter(r.URL.Query())
+	if err != nil {
+		h.logger.Errorf("incorrect query params for robots list: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	p, err := h.authorize(r, apikey.ScopeRobotsRead)
+	if err != nil {
+		h.logger.Errorf("can't authorize user: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	// trash shows own deleted robots unless other user is asked for
+	if f.Deleted && f.OwnerID == 0 {
+		f.OwnerID = p.userID
+	}
+
+	if (f.IncludeDeleted || f.Deleted) && !h.allowed(p, policy.ReadRobot, f.OwnerID) {
+		msg := fmt.Sprintf("user with id: %v can't list deleted robots of user with id: %v", p.userID, f.OwnerID)
+		h.logger.Errorf(msg)
+		render.Error(w, r, apperr.New(apperr.KindForbidden, apperr.CodeForbidden, msg))
+		return
+	}
+
+	if !h.allowed(p, policy.ReadRobot, f.OwnerID) {
+		f.VisibleTo = p.userID
+	}
+
+	f.TagsOf = p.userID
+
+	limit := f.Limit
+	f.Limit++
+
+	robots, err := h.robotStorage.List(f)
+	if err != nil {
+		h.logger.Errorf("can't get robots from storage (filter: %+v): %v", f, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	if len(robots) > limit {
+		robots = robots[:limit]
+		w.Header().Set("Link", nextPageLink(r, robot.CursorAfter(robots[limit-1], f)))
+	}
+
+	err = h.fillTags(p.userID, robots...)
+	if err != nil {
+		h.logger.Errorf("can't fill tags of robots: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = respondWithData(w, r, h.tmplts, robots...)
+	if err != nil {
+		h.logger.Errorf("can't respond with data: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+func nextPageLink(r *http.Request, c *robot.Cursor) string {
+	q := r.URL.Query()
+	q.Set("cursor", c.Encode())
+
+	u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+
+	return fmt.Sprintf("<%s>; rel=\"next\"", u.String())
+}
+
+func errInvalidQuery(name string, value string) error {
+	return apperr.Newf(apperr.KindInvalid, codeInvalidQuery, "incorrect %v: %v", name, value)
+}
+
+// robotFilter reads the filter of robots list from query params.
+func robotFilter(q url.Values) (robot.Filter, error) {
+	f := robot.Filter{Ticker: q.Get("ticker"), Limit: defaultRobotsLimit}
+
+	var err error
+
+	if v := q.Get("user"); v != "" {
+		f.OwnerID, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || f.OwnerID <= BottomLineValidID {
+			return f, errInvalidQuery("user", v)
+		}
+	}
+
+	if f.Active, err = boolParam(q, "active"); err != nil {
+		return f, err
+	}
+
+	if f.Favourite, err = boolParam(q, "favourite"); err != nil { //nolint: misspell
+		return f, err
+	}
+
+	if f.MinYield, err = floatParam(q, "min_yield"); err != nil {
+		return f, err
+	}
+
+	if f.MaxYield, err = floatParam(q, "max_yield"); err != nil {
+		return f, err
+	}
+
+	if f.PlanFrom, err = timeParam(q, "plan_from"); err != nil {
+		return f, err
+	}
+
+	if f.PlanTo, err = timeParam(q, "plan_to"); err != nil {
+		return f, err
+	}
+
+	deleted, err := boolParam(q, "include_deleted")
+	if err != nil {
+		return f, err
+	}
+
+	f.IncludeDeleted = deleted != nil && *deleted
+
+	trash, err := boolParam(q, "deleted")
+	if err != nil {
+		return f, err
+	}
+
+	f.Deleted = trash != nil && *trash
+
+	if v, ok := q["tag"]; ok {
+		if f.Tags, err = tagsParam(v); err != nil {
+			return f, err
+		}
+	}
+
+	f.Sort = robot.SortID
+
+	if v := q.Get("sort"); v != "" {
+		f.Desc = strings.HasPrefix(v, "-")
+		f.Sort = strings.TrimPrefix(v, "-")
+
+		if !robot.IsSortField(f.Sort) {
+			return f, errInvalidQuery("sort", v)
+		}
+	}
+
+	if v := q.Get("limit"); v != "" {
+		f.Limit, err = strconv.Atoi(v)
+		if err != nil || f.Limit <= 0 || f.Limit > maxRobotsLimit {
+			return f, apperr.Newf(apperr.KindInvalid, codeInvalidQuery, "limit must be between 1 and %v", maxRobotsLimit)
+		}
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		f.After, err = robot.DecodeCursor(v)
+		if err != nil || f.After.Sort != f.Sort || f.After.Desc != f.Desc {
+			return f, apperr.New(apperr.KindInvalid, codeInvalidQuery, "cursor is incorrect or is for another sort")
+		}
+	}
+
+	return f, nil
+}
+
+func boolParam(q url.Values, name string) (*bool, error) {
+	v := q.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, errInvalidQuery(name, v)
+	}
+
+	return &b, nil
+}
+
+func floatParam(q url.Values, name string) (*float64, error) {
+	v := q.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return nil, errInvalidQuery(name, v)
+	}
+
+	return &f, nil
+}
+
+func timeParam(q url.Values, name string) (*time.Time, error) {
+	v := q.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, errInvalidQuery(name, v)
+	}
+
+	return &t, nil
+}
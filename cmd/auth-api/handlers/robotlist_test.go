@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"cw1/cmd/socket"
+	"cw1/internal/robot"
+	"cw1/internal/session"
+	"cw1/internal/user"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGetRobotsPagination(t *testing.T) {
+	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := &mockUserStorage{u: &user.User{ID: 1, Email: "email"}}
+	mockSessionStorage := &mockSessionStorage{s: &session.Session{SessionID: token, UserID: 1}}
+	mockRobotStorage := &mockRobotStorage{rr: []*robot.Robot{
+		{RobotID: 5, OwnerUserID: 1},
+		{RobotID: 6, OwnerUserID: 1},
+		{RobotID: 7, OwnerUserID: 1},
+	}}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub)
+
+	req, err := http.NewRequest("GET", "/api/v1/robots?user=1&sort=-deals_count&limit=2", nil)
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.getRobots).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("getRobots handler returned wrong status code: got %v, want %v",
+			status, http.StatusOK)
+	}
+
+	expected := `[{"robot_id":5,"owner_user_id":1,"is_favourite":false,"is_active":false},` +
+		`{"robot_id":6,"owner_user_id":1,"is_favourite":false,"is_active":false}]`
+	if rr.Body.String() != expected {
+		t.Errorf("getRobots handler returned unexpected body: got %v, want %v",
+			rr.Body.String(), expected)
+	}
+
+	link := rr.Header().Get("Link")
+	if !strings.HasSuffix(link, `>; rel="next"`) {
+		t.Fatalf("getRobots handler returned unexpected link: %v", link)
+	}
+
+	next, err := url.Parse(strings.TrimPrefix(strings.TrimSuffix(link, `>; rel="next"`), "<"))
+	if err != nil {
+		t.Fatalf("can't parse link %v", err)
+	}
+
+	c, err := robot.DecodeCursor(next.Query().Get("cursor"))
+	if err != nil {
+		t.Fatalf("can't decode cursor %v", err)
+	}
+
+	if c.ID != 6 || c.Sort != robot.SortDealsCount || !c.Desc {
+		t.Errorf("getRobots handler returned unexpected cursor: %+v", c)
+	}
+
+	if next.Query().Get("limit") != "2" || next.Query().Get("user") != "1" {
+		t.Errorf("getRobots handler didn't keep query in link: %v", link)
+	}
+}
+
+func TestGetRobotsIncorrectQuery(t *testing.T) {
+	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := &mockUserStorage{u: &user.User{ID: 1, Email: "email"}}
+	mockSessionStorage := &mockSessionStorage{s: &session.Session{SessionID: token, UserID: 1}}
+	mockRobotStorage := new(mockRobotStorage)
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub)
+
+	tests := []struct {
+		query  string
+		status int
+	}{
+		{"sort=name", http.StatusBadRequest},
+		{"active=maybe", http.StatusBadRequest},
+		{"min_yield=high", http.StatusBadRequest},
+		{"plan_from=yesterday", http.StatusBadRequest},
+		{"limit=1000", http.StatusBadRequest},
+		{"cursor=abc", http.StatusBadRequest},
+		{"include_deleted=true&user=2", http.StatusForbidden},
+		{"include_deleted=true&user=1", http.StatusOK},
+		{"deleted=yes", http.StatusBadRequest},
+		{"deleted=true&user=2", http.StatusForbidden},
+		{"deleted=true", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", "/api/v1/robots?"+tt.query, nil)
+		if err != nil {
+			t.Fatalf("can't create request %v", err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Accept", "application/json")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.getRobots).ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tt.status {
+			t.Errorf("getRobots handler returned wrong status code for %q: got %v, want %v",
+				tt.query, status, tt.status)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package handler
+
+import (
+	"cw1/cmd/auth-api/render"
+	"cw1/internal/apikey"
+	"cw1/internal/apperr"
+	"cw1/internal/policy"
+	"cw1/internal/robottemplate"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const maxTemplateNameLen = 64
+
+// getTemplates lists templates of the user and global ones.
+func (h *Handler) getTemplates(w http.ResponseWriter, r *http.Request) {
+	p, err := h.authorize(r, apikey.ScopeRobotsRead)
+	if err != nil {
+		h.logger.Errorf("can't authorize user: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	templates, err := h.tmplStorage.FindAvailable(p.userID)
+	if err != nil {
+		h.logger.Errorf("can't get templates of user with id: %v from storage: %v", p.userID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = respondJSON(w, templates)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+func (h *Handler) getTemplate(w http.ResponseWriter, r *http.Request) {
+	id, err := idParam(r, "id")
+	if err != nil {
+		h.logger.Errorf("can't get ID from URL params: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	p, err := h.authorize(r, apikey.ScopeRobotsRead)
+	if err != nil {
+		h.logger.Errorf("can't authorize user: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	t, err := h.findTemplate(p, id)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	err = respondJSON(w, t)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+func (h *Handler) createTemplate(w http.ResponseWriter, r *http.Request) {
+	var t robottemplate.Template
+
+	err := decodeJSON(w, r, &t)
+	if err != nil {
+		h.logger.Errorf("can't unmarshal input json for creating template: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	p, err := h.authorize(r, apikey.ScopeRobotsWrite)
+	if err != nil {
+		h.logger.Errorf("can't authorize user: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	if fields := validateTemplate(&t); len(fields) > 0 {
+		h.logger.Errorf("incorrect template from user with id: %v: %v", p.userID, fields)
+		render.Error(w, r, apperr.Validation(fields))
+		return
+	}
+
+	if t.Global && !h.allowed(p, policy.ManageTemplate, templateOwner(&t)) {
+		err = apperr.Newf(apperr.KindForbidden, apperr.CodeForbidden, "user with id: %v can't share templates", p.userID)
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	t.ID = BottomLineValidID
+	t.OwnerUserID = p.userID
+
+	err = h.tmplStorage.Create(&t)
+	if err != nil {
+		h.logger.Errorf("can't create template in storage: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/templates/%d", t.ID))
+
+	err = respondJSONStatus(w, http.StatusCreated, &t)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+func (h *Handler) updateTemplate(w http.ResponseWriter, r *http.Request) {
+	var upd robottemplate.Template
+
+	err := decodeJSON(w, r, &upd)
+	if err != nil {
+		h.logger.Errorf("can't unmarshal input json for updating template: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	t, p, err := h.findManagedTemplate(r)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	if fields := validateTemplate(&upd); len(fields) > 0 {
+		h.logger.Errorf("incorrect template with id: %v: %v", t.ID, fields)
+		render.Error(w, r, apperr.Validation(fields))
+		return
+	}
+
+	upd.ID, upd.OwnerUserID, upd.CreatedAt = t.ID, t.OwnerUserID, t.CreatedAt
+
+	if upd.Global && !h.allowed(p, policy.ManageTemplate, templateOwner(&upd)) {
+		err = apperr.Newf(apperr.KindForbidden, apperr.CodeForbidden, "user with id: %v can't share templates", p.userID)
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	err = h.tmplStorage.Update(&upd)
+	if err != nil {
+		h.logger.Errorf("can't update template with id: %v in storage: %v", t.ID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = respondJSON(w, &upd)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+func (h *Handler) deleteTemplate(w http.ResponseWriter, r *http.Request) {
+	t, _, err := h.findManagedTemplate(r)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	err = h.tmplStorage.Delete(t.ID)
+	if err != nil {
+		h.logger.Errorf("can't delete template with id: %v from storage: %v", t.ID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// createRobotFromTemplate creates the robot of the template for the ticker of
+// the query, prices of the robot are relative to the latest price of the ticker.
+func (h *Handler) createRobotFromTemplate(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	id, err := strconv.ParseInt(q.Get("template"), 10, 64)
+	if err != nil || id <= BottomLineValidID {
+		err = errInvalidQuery("template", q.Get("template"))
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	p, err := h.authorize(r, apikey.ScopeRobotsWrite)
+	if err != nil {
+		h.logger.Errorf("can't authorize owner: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	t, err := h.findTemplate(p, id)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	ticker := q.Get("ticker")
+	if !h.tickers[ticker] {
+		render.Error(w, r, apperr.Validation(map[string]string{"ticker": "is unknown"}))
+		return
+	}
+
+	if h.quotes == nil {
+		err = apperr.Newf(apperr.KindConflict, codeNoMarketPrice, "no price of ticker %v was received yet", ticker)
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	price, ok := h.quotes.Last(ticker)
+	if !ok {
+		err = apperr.Newf(apperr.KindConflict, codeNoMarketPrice, "no price of ticker %v was received yet", ticker)
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	// quotes of tickers without active robots aren't streamed and get old
+	if h.quoteMaxAge > 0 && time.Since(price.Time) > h.quoteMaxAge {
+		err = apperr.Newf(apperr.KindConflict, codeNoMarketPrice, "last price of ticker %v is older than %v",
+			ticker, h.quoteMaxAge)
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	rbt := t.Robot(ticker, price, time.Now().UTC())
+	rbt.OwnerUserID = p.userID
+
+	if fields := h.validateParams(rbt); len(fields) > 0 {
+		h.logger.Errorf("incorrect robot of template with id: %v for price %+v: %v", id, price, fields)
+		render.Error(w, r, apperr.Validation(fields))
+		return
+	}
+
+	h.saveNewRobot(w, r, p, rbt, nil)
+}
+
+// findTemplate returns the template if the principal can use it, other
+// templates are hidden as missing ones.
+func (h *Handler) findTemplate(p *principal, id int64) (*robottemplate.Template, error) {
+	t, err := h.tmplStorage.FindByID(id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't find template with id: %v in storage", id)
+	}
+
+	if t.ID == BottomLineValidID || (!t.Global && !h.allowed(p, policy.ReadRobot, t.OwnerUserID)) {
+		return nil, apperr.Newf(apperr.KindNotFound, codeTemplateNotFound, "template with id %v don't exist", id)
+	}
+
+	return t, nil
+}
+
+func (h *Handler) findManagedTemplate(r *http.Request) (*robottemplate.Template, *principal, error) {
+	id, err := idParam(r, "id")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "can't get ID from URL params")
+	}
+
+	p, err := h.authorize(r, apikey.ScopeRobotsWrite)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t, err := h.findTemplate(p, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !h.allowed(p, policy.ManageTemplate, templateOwner(t)) {
+		return nil, nil, apperr.Newf(apperr.KindForbidden, apperr.CodeForbidden,
+			"user with id: %v don't have permission to change template with id: %v", p.userID, id)
+	}
+
+	return t, p, nil
+}
+
+// templateOwner is the owner of the template for policies, global templates
+// don't belong to anyone.
+func templateOwner(t *robottemplate.Template) int64 {
+	if t.Global {
+		return BottomLineValidID
+	}
+
+	return t.OwnerUserID
+}
+
+func validateTemplate(t *robottemplate.Template) map[string]string {
+	fields := make(map[string]string)
+
+	t.Name = strings.TrimSpace(t.Name)
+	if n := utf8.RuneCountInString(t.Name); n == 0 || n > maxTemplateNameLen {
+		fields["name"] = fmt.Sprintf("must be from 1 to %v characters", maxTemplateNameLen)
+	}
+
+	const minPercent = -100
+
+	if t.BuyPercent <= minPercent {
+		fields["buy_percent"] = "must be greater than -100"
+	}
+
+	if t.SellPercent <= minPercent {
+		fields["sell_percent"] = "must be greater than -100"
+	}
+
+	if t.PlanDuration <= 0 {
+		fields["plan_duration"] = "must be positive"
+	}
+
+	if t.PlanYield < 0 {
+		fields["plan_yield"] = "must not be negative"
+	}
+
+	return fields
+}
@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"cw1/internal/quote"
+	"cw1/internal/robot"
+	"cw1/internal/robottemplate"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type mockTemplateStorage struct {
+	tt map[int64]*robottemplate.Template
+}
+
+func (m *mockTemplateStorage) Create(t *robottemplate.Template) error {
+	t.ID = int64(len(m.tt) + 1)
+	m.tt[t.ID] = t
+
+	return nil
+}
+
+func (m *mockTemplateStorage) FindByID(id int64) (*robottemplate.Template, error) {
+	if t, ok := m.tt[id]; ok {
+		return t, nil
+	}
+
+	return &robottemplate.Template{}, nil
+}
+
+func (m *mockTemplateStorage) FindAvailable(userID int64) ([]*robottemplate.Template, error) {
+	res := make([]*robottemplate.Template, 0)
+
+	for _, t := range m.tt {
+		if t.Global || t.OwnerUserID == userID {
+			res = append(res, t)
+		}
+	}
+
+	return res, nil
+}
+
+func (m *mockTemplateStorage) Update(t *robottemplate.Template) error {
+	m.tt[t.ID] = t
+	return nil
+}
+
+func (m *mockTemplateStorage) Delete(id int64) error {
+	delete(m.tt, id)
+	return nil
+}
+
+func newTemplateHandler(tt ...*robottemplate.Template) *Handler {
+	h := newTestHandler(1, &mockRobotStorage{rr: []*robot.Robot{{RobotID: 9}}})
+	h.tmplStorage = &mockTemplateStorage{tt: make(map[int64]*robottemplate.Template)}
+	h.quotes, h.quoteMaxAge = quote.NewBook(), time.Minute
+
+	for _, t := range tt {
+		_ = h.tmplStorage.Create(t)
+	}
+
+	return h
+}
+
+func TestCreateTemplate(t *testing.T) {
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"name":"scalp","buy_percent":-1,"sell_percent":2,"plan_duration":"24h","plan_yield":5}`, http.StatusCreated},
+		{`{"name":"scalp","buy_percent":-1,"sell_percent":2,"plan_duration":"24h","global":true}`, http.StatusForbidden},
+		{`{"name":"","buy_percent":-100,"sell_percent":2,"plan_duration":"0s"}`, http.StatusUnprocessableEntity},
+		{`{"name":"scalp","plan_duration":"day"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		h := newTemplateHandler()
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.createTemplate).ServeHTTP(rr, requestFor(t, "POST", "/api/v1/templates", tt.body))
+
+		if status := rr.Code; status != tt.status {
+			t.Errorf("createTemplate handler returned wrong status code for %v: got %v, want %v", tt.body, status, tt.status)
+		}
+
+		if tt.status == http.StatusCreated && !respContains(rr.Body.String(), `"plan_duration":"24h0m0s"`) {
+			t.Errorf("createTemplate handler returned wrong template: %v", rr.Body.String())
+		}
+	}
+}
+
+func TestCreateRobotFromTemplate(t *testing.T) {
+	h := newTemplateHandler(&robottemplate.Template{OwnerUserID: 1, Name: "scalp", BuyPercent: -1, SellPercent: 2,
+		PlanDuration: robottemplate.Duration(24 * time.Hour), PlanYield: 5})
+	h.quotes.Set(quote.Quote{Ticker: "AAPL", BuyPrice: 100, SellPrice: 100.5, Time: time.Now()})
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.createRobot).ServeHTTP(rr, requestFor(t, "POST", "/api/v1/robot?template=1&ticker=AAPL", ""))
+
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("createRobot handler returned wrong status code: got %v, want %v: %v",
+			status, http.StatusCreated, rr.Body.String())
+	}
+
+	var rbt robot.Robot
+	if err := json.Unmarshal(rr.Body.Bytes(), &rbt); err != nil {
+		t.Fatalf("can't unmarshal response %v", err)
+	}
+
+	if rbt.BuyPrice.V.Float64 != 99 || rbt.SellPrice.V.Float64 != 102.51 || rbt.PlanYield.V.Float64 != 5 {
+		t.Errorf("createRobot handler returned robot with wrong prices: %v", rr.Body.String())
+	}
+
+	if d := rbt.PlanEnd.V.Time.Sub(rbt.PlanStart.V.Time); d != 24*time.Hour {
+		t.Errorf("createRobot handler returned robot with wrong plan: %v", d)
+	}
+
+	if rr.Header().Get("Location") != "/api/v1/robot/9" {
+		t.Errorf("createRobot handler returned wrong location: %v", rr.Header().Get("Location"))
+	}
+}
+
+func TestCreateRobotFromStaleQuote(t *testing.T) {
+	h := newTemplateHandler(&robottemplate.Template{OwnerUserID: 1, Name: "scalp", BuyPercent: -1, SellPercent: 2,
+		PlanDuration: robottemplate.Duration(24 * time.Hour), PlanYield: 5})
+	h.quotes.Set(quote.Quote{Ticker: "AAPL", BuyPrice: 100, SellPrice: 100.5, Time: time.Now().Add(-2 * time.Minute)})
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.createRobot).ServeHTTP(rr, requestFor(t, "POST", "/api/v1/robot?template=1&ticker=AAPL", ""))
+
+	if status := rr.Code; status != http.StatusConflict {
+		t.Errorf("createRobot handler returned wrong status code: got %v, want %v", status, http.StatusConflict)
+	}
+}
+
+func TestCreateRobotFromTemplateIncorrect(t *testing.T) {
+	h := newTemplateHandler(
+		&robottemplate.Template{OwnerUserID: 1, Name: "own", PlanDuration: robottemplate.Duration(time.Hour)},
+		&robottemplate.Template{OwnerUserID: 2, Name: "private", PlanDuration: robottemplate.Duration(time.Hour)},
+	)
+
+	tests := []struct {
+		query  string
+		status int
+	}{
+		{"template=1&ticker=AAPL", http.StatusConflict},
+		{"template=2&ticker=AAPL", http.StatusNotFound},
+		{"template=1&ticker=XXXX", http.StatusUnprocessableEntity},
+		{"template=abc&ticker=AAPL", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.createRobot).ServeHTTP(rr, requestFor(t, "POST", "/api/v1/robot?"+tt.query, ""))
+
+		if status := rr.Code; status != tt.status {
+			t.Errorf("createRobot handler returned wrong status code for %v: got %v, want %v", tt.query, status, tt.status)
+		}
+	}
+}
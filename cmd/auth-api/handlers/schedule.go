@@ -0,0 +1,359 @@
+package handler
+
+import (
+	"cw1/cmd/auth-api/render"
+	"cw1/internal/apikey"
+	"cw1/internal/apperr"
+	"cw1/internal/audit"
+	"cw1/internal/format"
+	"cw1/internal/policy"
+	"cw1/internal/robot"
+	"cw1/internal/schedule"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxDueJobs limits jobs run at one tick of the scheduler, the rest run at the next ones.
+const maxDueJobs = 100
+
+// scheduleRequest runs the action once at RunAt or repeatedly by Cron.
+type scheduleRequest struct {
+	Action string     `json:"action"`
+	RunAt  *time.Time `json:"run_at,omitempty"`
+	Cron   string     `json:"cron,omitempty"`
+}
+
+// getSchedule lists jobs of the robot.
+func (h *Handler) getSchedule(w http.ResponseWriter, r *http.Request) {
+	rbt, _, err := h.findScheduledRobot(r, apikey.ScopeRobotsRead, policy.ReadRobot)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	jobs, err := h.schedStorage.FindByRobotID(rbt.RobotID)
+	if err != nil {
+		h.logger.Errorf("can't get jobs of robot with id: %v from storage: %v", rbt.RobotID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = respondJSON(w, jobs)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+// createSchedule adds the job of the robot. The permission is checked now and
+// again when the job runs.
+func (h *Handler) createSchedule(w http.ResponseWriter, r *http.Request) {
+	var req scheduleRequest
+
+	err := decodeJSON(w, r, &req)
+	if err != nil {
+		h.logger.Errorf("can't unmarshal input json for scheduling robot: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	rbt, p, err := h.findScheduledRobot(r, apikey.ScopeRobotsActivate, jobPolicy(req.Action))
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	next, fields := validateSchedule(&req, time.Now().UTC())
+	if len(fields) > 0 {
+		h.logger.Errorf("incorrect schedule of robot with id: %v: %v", rbt.RobotID, fields)
+		render.Error(w, r, apperr.Validation(fields))
+		return
+	}
+
+	if req.Action == schedule.ActionActivate {
+		err = h.canScheduleActivation(p, rbt, &req)
+		if err != nil {
+			h.logger.Errorf("can't schedule activation of robot with id: %v: %v", rbt.RobotID, err)
+			render.Error(w, r, err)
+			return
+		}
+	}
+
+	j := &schedule.Job{
+		RobotID:   rbt.RobotID,
+		UserID:    p.userID,
+		Action:    req.Action,
+		Cron:      req.Cron,
+		NextRunAt: &format.NullTime{V: sql.NullTime{Time: next, Valid: true}},
+	}
+
+	err = h.schedStorage.Create(j)
+	if err != nil {
+		h.logger.Errorf("can't create job for robot with id: %v in storage: %v", rbt.RobotID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	h.record(r, robotEntry(p.userID, audit.ScheduleRobot, rbt.RobotID))
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/robot/%d/schedule/%d", rbt.RobotID, j.ID))
+
+	err = respondJSONStatus(w, http.StatusCreated, j)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+// cancelSchedule removes the job of the robot.
+func (h *Handler) cancelSchedule(w http.ResponseWriter, r *http.Request) {
+	jobID, err := idParam(r, "jobID")
+	if err != nil {
+		h.logger.Errorf("can't get job ID from URL params: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	rbt, p, err := h.findScheduledRobot(r, apikey.ScopeRobotsActivate, policy.ReadRobot)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	j, err := h.schedStorage.FindByID(jobID)
+	if err != nil {
+		h.logger.Errorf("can't find job with id: %v in storage: %v", jobID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	if j.ID == BottomLineValidID || j.RobotID != rbt.RobotID {
+		err = apperr.Newf(apperr.KindNotFound, codeJobNotFound, "job with id %v don't exist", jobID)
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	if !h.allowed(p, jobPolicy(j.Action), rbt.OwnerUserID) {
+		err = errRobotForbidden("user with id: %v don't have permission to cancel job with id: %v", p.userID, jobID)
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	err = h.schedStorage.Delete(j.ID)
+	if err != nil {
+		h.logger.Errorf("can't delete job with id: %v from storage: %v", j.ID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	h.record(r, robotEntry(p.userID, audit.UnscheduleRobot, rbt.RobotID))
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) findScheduledRobot(r *http.Request, scope string, a policy.Action) (*robot.Robot, *principal,
+	error) {
+	rbtID, p, err := h.getRobotAndPrincipal(r, scope)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rbt, err := findRobot(h.robotStorage, rbtID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if rbt.DeletedAt != nil {
+		return nil, nil, errRobotNotFound(rbtID)
+	}
+
+	if !h.allowed(p, a, rbt.OwnerUserID) {
+		return nil, nil, errRobotForbidden("user with id: %v don't have permission to schedule robot with id: %v",
+			p.userID, rbtID)
+	}
+
+	return rbt, p, nil
+}
+
+// canScheduleActivation checks activation as if it happened now, a one-off
+// activation must also fall into the plan of the robot. Jobs can't enter the
+// second factor, so robots which require it can't be activated by schedule.
+func (h *Handler) canScheduleActivation(p *principal, rbt *robot.Robot, req *scheduleRequest) error {
+	err := h.canActivate(p, rbt)
+	if err != nil {
+		return err
+	}
+
+	err = h.checkActivationTOTP(newActivationFactor(nil), p, rbt)
+	if err != nil {
+		return err
+	}
+
+	if req.RunAt != nil && (rbt.PlanStart == nil || rbt.PlanEnd == nil ||
+		req.RunAt.Before(rbt.PlanStart.V.Time) || req.RunAt.After(rbt.PlanEnd.V.Time)) {
+		return apperr.Validation(map[string]string{"run_at": "must be inside the plan of the robot"})
+	}
+
+	return nil
+}
+
+// validateSchedule checks the request and returns the time of the first run.
+func validateSchedule(req *scheduleRequest, now time.Time) (time.Time, map[string]string) {
+	fields := make(map[string]string)
+
+	if !schedule.IsAction(req.Action) {
+		fields["action"] = "must be activate or deactivate"
+	}
+
+	var next time.Time
+
+	switch {
+	case req.RunAt == nil && req.Cron == "":
+		fields["run_at"] = "run_at or cron is required"
+	case req.RunAt != nil && req.Cron != "":
+		fields["run_at"] = "can't be used with cron"
+	case req.RunAt != nil:
+		// the storage keeps seconds, the job is claimed by the exact time
+		next = req.RunAt.UTC().Truncate(time.Second)
+		if !next.After(now) {
+			fields["run_at"] = "must be in the future"
+		}
+
+		req.RunAt = &next
+	default:
+		c, err := schedule.ParseCron(req.Cron)
+		if err != nil {
+			fields["cron"] = err.Error()
+			break
+		}
+
+		next = c.Next(now)
+		if next.IsZero() {
+			fields["cron"] = "never matches"
+		}
+	}
+
+	return next, fields
+}
+
+func jobPolicy(action string) policy.Action {
+	if action == schedule.ActionActivate {
+		return policy.ActivateRobot
+	}
+
+	return policy.DeactivateRobot
+}
+
+// RunScheduler runs due jobs and reports finished plans of robots every
+// interval until quit is closed.
+func (h *Handler) RunScheduler(quit <-chan bool, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	since := time.Now().UTC().Add(-planLookback)
+
+	for {
+		now := time.Now().UTC()
+
+		if err := h.runDueJobs(now); err != nil {
+			h.logger.Errorf("can't run scheduled jobs: %v", err)
+		}
+
+		if err := h.notifyFinishedPlans(since, now); err != nil {
+			h.logger.Errorf("can't notify about finished plans: %v", err)
+		} else {
+			since = now
+		}
+
+		select {
+		case <-tick.C:
+		case <-quit:
+			return
+		}
+	}
+}
+
+func (h *Handler) runDueJobs(now time.Time) error {
+	jobs, err := h.schedStorage.Due(now, maxDueJobs)
+	if err != nil {
+		return errors.Wrap(err, "can't get due jobs from storage")
+	}
+
+	for _, j := range jobs {
+		h.runJob(j, now)
+	}
+
+	return nil
+}
+
+// runJob claims the job and acts on behalf of its user, jobs of removed
+// robots are deleted. The buy price may have been raised since the job was
+// created, so activation is checked for the second factor again.
+func (h *Handler) runJob(j *schedule.Job, now time.Time) {
+	var next *time.Time
+
+	if j.Cron != "" {
+		c, err := schedule.ParseCron(j.Cron)
+		if err != nil {
+			h.logger.Errorf("can't parse cron of job with id: %v: %v", j.ID, err)
+		} else if t := c.Next(now); !t.IsZero() {
+			next = &t
+		}
+	}
+
+	claimed, err := h.schedStorage.Claim(j, next)
+	if err != nil || !claimed {
+		if err != nil {
+			h.logger.Errorf("can't claim job with id: %v: %v", j.ID, err)
+		}
+
+		return
+	}
+
+	rbt, err := findRobot(h.robotStorage, j.RobotID)
+	if err == nil && rbt.DeletedAt != nil {
+		err = errRobotNotFound(j.RobotID)
+	}
+
+	if apperr.HasCode(err, codeRobotNotFound) {
+		if err = h.schedStorage.Delete(j.ID); err != nil {
+			h.logger.Errorf("can't delete job with id: %v of removed robot: %v", j.ID, err)
+		}
+
+		return
+	}
+
+	if err == nil {
+		p := &principal{userID: j.UserID}
+
+		if j.Action == schedule.ActionActivate {
+			err = h.activateRobot(nil, newActivationFactor(nil), p, rbt)
+		} else {
+			err = h.deactivateRobot(nil, p, rbt)
+		}
+	}
+
+	var lastError string
+
+	if err != nil {
+		h.logger.Errorf("can't %v robot with id: %v by job with id: %v: %v", j.Action, j.RobotID, j.ID, err)
+		lastError = apperr.From(err).Error()
+	} else {
+		go h.hub.Broadcast(rbt)
+	}
+
+	if err = h.schedStorage.SetResult(j.ID, lastError); err != nil {
+		h.logger.Errorf("can't set result of job with id: %v: %v", j.ID, err)
+	}
+}
@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"cw1/internal/format"
+	"cw1/internal/robot"
+	"cw1/internal/schedule"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type mockScheduleStorage struct {
+	jobs    map[int64]*schedule.Job
+	results map[int64]string
+}
+
+func newMockScheduleStorage(jobs ...*schedule.Job) *mockScheduleStorage {
+	m := &mockScheduleStorage{jobs: make(map[int64]*schedule.Job), results: make(map[int64]string)}
+	for _, j := range jobs {
+		m.jobs[j.ID] = j
+	}
+
+	return m
+}
+
+func (m *mockScheduleStorage) Create(j *schedule.Job) error {
+	j.ID = int64(len(m.jobs) + 1)
+	m.jobs[j.ID] = j
+
+	return nil
+}
+
+func (m *mockScheduleStorage) FindByID(id int64) (*schedule.Job, error) {
+	if j, ok := m.jobs[id]; ok {
+		return j, nil
+	}
+
+	return &schedule.Job{}, nil
+}
+
+func (m *mockScheduleStorage) FindByRobotID(robotID int64) ([]*schedule.Job, error) {
+	res := make([]*schedule.Job, 0)
+
+	for _, j := range m.jobs {
+		if j.RobotID == robotID {
+			res = append(res, j)
+		}
+	}
+
+	return res, nil
+}
+
+func (m *mockScheduleStorage) Delete(id int64) error {
+	delete(m.jobs, id)
+	return nil
+}
+
+func (m *mockScheduleStorage) Due(now time.Time, limit int) ([]*schedule.Job, error) {
+	res := make([]*schedule.Job, 0)
+
+	for _, j := range m.jobs {
+		if j.NextRunAt != nil && !j.NextRunAt.V.Time.After(now) && len(res) < limit {
+			res = append(res, j)
+		}
+	}
+
+	return res, nil
+}
+
+func (m *mockScheduleStorage) Claim(j *schedule.Job, next *time.Time) (bool, error) {
+	j.NextRunAt = nil
+	if next != nil {
+		j.NextRunAt = runAt(*next)
+	}
+
+	return true, nil
+}
+
+func (m *mockScheduleStorage) SetResult(id int64, lastError string) error {
+	m.results[id] = lastError
+	return nil
+}
+
+func runAt(t time.Time) *format.NullTime {
+	return &format.NullTime{V: sql.NullTime{Time: t, Valid: true}}
+}
+
+func TestCreateSchedule(t *testing.T) {
+	inPlan := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	afterPlan := time.Now().Add(3 * time.Hour).UTC().Format(time.RFC3339)
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"action":"activate","run_at":"` + inPlan + `"}`, http.StatusCreated},
+		{`{"action":"deactivate","cron":"0 18 * * 1-5"}`, http.StatusCreated},
+		{`{"action":"activate","run_at":"` + afterPlan + `"}`, http.StatusUnprocessableEntity},
+		{`{"action":"deactivate","run_at":"` + past + `"}`, http.StatusUnprocessableEntity},
+		{`{"action":"activate","run_at":"` + inPlan + `","cron":"* * * * *"}`, http.StatusUnprocessableEntity},
+		{`{"action":"activate","cron":"61 * * * *"}`, http.StatusUnprocessableEntity},
+		{`{"action":"activate","cron":"0 0 30 2 *"}`, http.StatusUnprocessableEntity},
+		{`{"action":"restart","cron":"* * * * *"}`, http.StatusUnprocessableEntity},
+	}
+
+	h := newTestHandler(1, &mockRobotStorage{rr: []*robot.Robot{planned(5, 1, -time.Hour, 2*time.Hour)}})
+	h.schedStorage = newMockScheduleStorage()
+
+	for _, tt := range tests {
+		req := requestFor(t, "POST", "/api/v1/robot/5/schedule", tt.body, "id", "5")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.createSchedule).ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tt.status {
+			t.Errorf("createSchedule handler returned wrong status code for %v: got %v, want %v",
+				tt.body, status, tt.status)
+		}
+	}
+}
+
+func TestCreateScheduleOfOtherUser(t *testing.T) {
+	h := newTestHandler(1, &mockRobotStorage{rr: []*robot.Robot{planned(5, 2, -time.Hour, 2*time.Hour)}})
+	h.schedStorage = newMockScheduleStorage()
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.createSchedule).ServeHTTP(rr, requestFor(t, "POST", "/api/v1/robot/5/schedule",
+		`{"action":"activate","cron":"0 9 * * *"}`, "id", "5"))
+
+	if status := rr.Code; status != http.StatusForbidden {
+		t.Errorf("createSchedule handler returned wrong status code: got %v, want %v", status, http.StatusForbidden)
+	}
+}
+
+func TestValidateScheduleCron(t *testing.T) {
+	// Monday
+	now := time.Date(2020, 6, 1, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		cron string
+		next time.Time
+	}{
+		{"*/15 * * * *", time.Date(2020, 6, 1, 10, 45, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2020, 6, 2, 9, 0, 0, 0, time.UTC)},
+		{"0 18 * * 6,7", time.Date(2020, 6, 6, 18, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 10 15 * 1", time.Date(2020, 6, 8, 10, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		req := scheduleRequest{Action: schedule.ActionActivate, Cron: tt.cron}
+
+		next, fields := validateSchedule(&req, now)
+		if len(fields) > 0 || !next.Equal(tt.next) {
+			t.Errorf("validateSchedule returned wrong next run for %q: got %v (%v), want %v", tt.cron, next, fields, tt.next)
+		}
+	}
+}
+
+func TestRunDueJobs(t *testing.T) {
+	deleted := planned(6, 1, -time.Hour, time.Hour)
+	deleted.DeletedAt = runAt(time.Now())
+
+	rs := &mockRobotStorage{rr: []*robot.Robot{planned(5, 1, -time.Hour, time.Hour), deleted}}
+	h := newTestHandler(1, rs)
+
+	now := time.Now().UTC()
+	ss := newMockScheduleStorage(
+		&schedule.Job{ID: 1, RobotID: 5, UserID: 1, Action: schedule.ActionActivate, Cron: "0 9 * * *",
+			NextRunAt: runAt(now.Add(-time.Minute))},
+		&schedule.Job{ID: 2, RobotID: 6, UserID: 1, Action: schedule.ActionActivate,
+			NextRunAt: runAt(now.Add(-time.Minute))},
+		&schedule.Job{ID: 3, RobotID: 5, UserID: 1, Action: schedule.ActionDeactivate,
+			NextRunAt: runAt(now.Add(time.Hour))},
+	)
+	h.schedStorage = ss
+
+	if err := h.runDueJobs(now); err != nil {
+		t.Fatalf("runDueJobs returned error: %v", err)
+	}
+
+	if !rs.rr[0].IsActive {
+		t.Errorf("runDueJobs didn't activate robot")
+	}
+
+	if j := ss.jobs[1]; j.NextRunAt == nil || !j.NextRunAt.V.Time.After(now) || ss.results[1] != "" {
+		t.Errorf("runDueJobs didn't move recurring job to the next run: %+v, error: %v", j, ss.results[1])
+	}
+
+	if _, ok := ss.jobs[2]; ok {
+		t.Errorf("runDueJobs didn't delete job of deleted robot")
+	}
+
+	if ss.jobs[3].NextRunAt == nil {
+		t.Errorf("runDueJobs ran job which isn't due")
+	}
+}
+
+// TestScheduleAboveBuyPrice can't schedule activation of robots which require
+// the second factor and fails jobs of robots whose buy price was raised later.
+func TestScheduleAboveBuyPrice(t *testing.T) {
+	rs := &mockRobotStorage{rr: []*robot.Robot{planned(5, 1, -time.Hour, 2*time.Hour)}}
+	h := newTestHandler(1, rs, WithActivationBuyPrice(1000))
+	h.schedStorage = newMockScheduleStorage()
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.createSchedule).ServeHTTP(rr, requestFor(t, "POST", "/api/v1/robot/5/schedule",
+		`{"action":"activate","cron":"0 9 * * *"}`, "id", "5"))
+
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("createSchedule handler returned wrong status code: got %v, want %v", status, http.StatusCreated)
+	}
+
+	rs.rr[0].BuyPrice = price(2000)
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(h.createSchedule).ServeHTTP(rr, requestFor(t, "POST", "/api/v1/robot/5/schedule",
+		`{"action":"activate","cron":"0 9 * * *"}`, "id", "5"))
+
+	if status := rr.Code; status != http.StatusForbidden {
+		t.Errorf("createSchedule handler returned wrong status code: got %v, want %v", status, http.StatusForbidden)
+	}
+
+	ss := h.schedStorage.(*mockScheduleStorage)
+	ss.jobs[1].NextRunAt = runAt(time.Now().Add(-time.Minute))
+
+	if err := h.runDueJobs(time.Now().UTC()); err != nil {
+		t.Fatalf("runDueJobs returned error: %v", err)
+	}
+
+	if rs.rr[0].IsActive || ss.results[1] == "" {
+		t.Errorf("runDueJobs activated robot above buy price without second factor, error: %v", ss.results[1])
+	}
+}
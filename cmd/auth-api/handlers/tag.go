@@ -0,0 +1,344 @@
+package handler
+
+import (
+	"cw1/cmd/auth-api/render"
+	"cw1/internal/apikey"
+	"cw1/internal/apperr"
+	"cw1/internal/policy"
+	"cw1/internal/robot"
+	"cw1/internal/tag"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var msgTagName = fmt.Sprintf("must be from 1 to %v characters without commas", tag.MaxNameLen)
+
+type tagRequest struct {
+	Name string `json:"name"`
+}
+
+type robotTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// getTags lists tags of the user.
+func (h *Handler) getTags(w http.ResponseWriter, r *http.Request) {
+	p, err := h.authorize(r, apikey.ScopeRobotsRead)
+	if err != nil {
+		h.logger.Errorf("can't authorize user: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	tags, err := h.tagStorage.FindByUserID(p.userID)
+	if err != nil {
+		h.logger.Errorf("can't get tags of user with id: %v from storage: %v", p.userID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = respondJSON(w, tags)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+func (h *Handler) createTag(w http.ResponseWriter, r *http.Request) {
+	var req tagRequest
+
+	err := decodeJSON(w, r, &req)
+	if err != nil {
+		h.logger.Errorf("can't unmarshal input json for creating tag: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	p, err := h.authorize(r, apikey.ScopeRobotsWrite)
+	if err != nil {
+		h.logger.Errorf("can't authorize user: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	name, ok := tag.Name(req.Name)
+	if !ok {
+		render.Error(w, r, apperr.Validation(map[string]string{"name": msgTagName}))
+		return
+	}
+
+	t := &tag.Tag{UserID: p.userID, Name: name}
+
+	err = h.tagStorage.Create(t)
+	if err != nil {
+		h.logger.Errorf("can't create tag for user with id: %v: %v", p.userID, err)
+		render.Error(w, r, errTagExists(err, name))
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/tags/%d", t.ID))
+
+	err = respondJSONStatus(w, http.StatusCreated, t)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+// renameTag changes the name of the tag for all its robots.
+func (h *Handler) renameTag(w http.ResponseWriter, r *http.Request) {
+	var req tagRequest
+
+	err := decodeJSON(w, r, &req)
+	if err != nil {
+		h.logger.Errorf("can't unmarshal input json for renaming tag: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	t, err := h.findOwnTag(r)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	name, ok := tag.Name(req.Name)
+	if !ok {
+		render.Error(w, r, apperr.Validation(map[string]string{"name": msgTagName}))
+		return
+	}
+
+	t.Name = name
+
+	err = h.tagStorage.Update(t)
+	if err != nil {
+		h.logger.Errorf("can't rename tag with id: %v: %v", t.ID, err)
+		render.Error(w, r, errTagExists(err, name))
+		return
+	}
+
+	err = respondJSON(w, t)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+// deleteTag removes the tag from the user and all its robots.
+func (h *Handler) deleteTag(w http.ResponseWriter, r *http.Request) {
+	t, err := h.findOwnTag(r)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	err = h.tagStorage.Delete(t.ID)
+	if err != nil {
+		h.logger.Errorf("can't delete tag with id: %v from storage: %v", t.ID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// setRobotTags replaces tags of the robot, tags which the owner doesn't have
+// yet are created.
+func (h *Handler) setRobotTags(w http.ResponseWriter, r *http.Request) {
+	var req robotTagsRequest
+
+	err := decodeJSON(w, r, &req)
+	if err != nil {
+		h.logger.Errorf("can't unmarshal input json for robot tags: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	rbtID, p, err := h.getRobotAndPrincipal(r, apikey.ScopeRobotsWrite)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	rbt, err := findRobot(h.robotStorage, rbtID)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	if rbt.DeletedAt != nil {
+		h.logger.Errorf("can't find robot with id: %v in storage", rbtID)
+		render.Error(w, r, errRobotNotFound(rbtID))
+		return
+	}
+
+	if !h.allowed(p, policy.UpdateRobot, rbt.OwnerUserID) {
+		err = errRobotForbidden("user with id: %v don't have permission to tag robot with id: %v", p.userID, rbtID)
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	names, err := tagNames(req.Tags)
+	if err != nil {
+		h.logger.Errorf("incorrect tags for robot with id: %v: %v", rbtID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = h.tagStorage.SetRobotTags(rbtID, rbt.OwnerUserID, names)
+	if err != nil {
+		h.logger.Errorf("can't set tags of robot with id: %v: %v", rbtID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	rbt.Tags = names
+
+	err = respondJSON(w, rbt)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	go h.hub.Broadcast(rbt)
+}
+
+func (h *Handler) findOwnTag(r *http.Request) (*tag.Tag, error) {
+	id, err := idParam(r, "id")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get ID from URL params")
+	}
+
+	p, err := h.authorize(r, apikey.ScopeRobotsWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := h.tagStorage.FindByID(id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't find tag with id: %v in storage", id)
+	}
+
+	// tags of other users are hidden as missing ones
+	if t.ID == BottomLineValidID || t.UserID != p.userID {
+		return nil, apperr.Newf(apperr.KindNotFound, codeTagNotFound, "tag with id %v don't exist", id)
+	}
+
+	return t, nil
+}
+
+// tagNames checks names of tags and removes duplicates.
+func tagNames(in []string) ([]string, error) {
+	names := make([]string, 0, len(in))
+	seen := make(map[string]bool, len(in))
+
+	for _, v := range in {
+		name, ok := tag.Name(v)
+		if !ok {
+			return nil, apperr.Validation(map[string]string{"tags": msgTagName})
+		}
+
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+// tagsParam reads tags of the robots list, a tag param may contain several
+// tags separated by commas.
+func tagsParam(values []string) ([]string, error) {
+	var in []string
+	for _, v := range values {
+		in = append(in, strings.Split(v, ",")...)
+	}
+
+	names, err := tagNames(in)
+	if err != nil {
+		return nil, errInvalidQuery("tag", strings.Join(values, ","))
+	}
+
+	return names, nil
+}
+
+// fillTags loads tags of the robots for responses. Tags are private to the
+// owner, so only robots of the user get them.
+func (h *Handler) fillTags(userID int64, rbts ...*robot.Robot) error {
+	if h.tagStorage == nil {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(rbts))
+	for _, rbt := range rbts {
+		if rbt.OwnerUserID == userID {
+			ids = append(ids, rbt.RobotID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	tags, err := h.tagStorage.FindByRobotIDs(ids)
+	if err != nil {
+		return errors.Wrap(err, "can't get tags of robots")
+	}
+
+	for _, rbt := range rbts {
+		if rbt.OwnerUserID == userID {
+			rbt.Tags = tags[rbt.RobotID]
+		}
+	}
+
+	return nil
+}
+
+// copyTags gives the copy of the robot the same tags in the set of its owner,
+// missing tags are created for the owner of the copy.
+func (h *Handler) copyTags(parent *robot.Robot, rbt *robot.Robot) error {
+	if h.tagStorage == nil {
+		return nil
+	}
+
+	parentID := parent.RobotID
+
+	tags, err := h.tagStorage.FindByRobotIDs([]int64{parentID})
+	if err != nil {
+		return errors.Wrapf(err, "can't get tags of robot with id: %v", parentID)
+	}
+
+	if len(tags[parentID]) == 0 {
+		return nil
+	}
+
+	err = h.tagStorage.SetRobotTags(rbt.RobotID, rbt.OwnerUserID, tags[parentID])
+	if err != nil {
+		return errors.Wrapf(err, "can't set tags of robot with id: %v", rbt.RobotID)
+	}
+
+	rbt.Tags = tags[parentID]
+
+	return nil
+}
+
+func errTagExists(err error, name string) error {
+	if errors.Cause(err) != tag.ErrExists {
+		return err
+	}
+
+	return apperr.Newf(apperr.KindConflict, codeTagExists, "tag %v already exists", name)
+}
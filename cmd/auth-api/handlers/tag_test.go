@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"cw1/internal/robot"
+	"cw1/internal/tag"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type mockTagStorage struct {
+	tags      map[int64]*tag.Tag
+	robotTags map[int64][]string
+	setUserID int64
+}
+
+func newMockTagStorage(tags ...*tag.Tag) *mockTagStorage {
+	m := &mockTagStorage{tags: make(map[int64]*tag.Tag), robotTags: make(map[int64][]string)}
+	for _, t := range tags {
+		m.tags[t.ID] = t
+	}
+
+	return m
+}
+
+func (m *mockTagStorage) Create(t *tag.Tag) error {
+	for _, v := range m.tags {
+		if v.UserID == t.UserID && v.Name == t.Name {
+			return tag.ErrExists
+		}
+	}
+
+	t.ID = int64(len(m.tags) + 1)
+	m.tags[t.ID] = t
+
+	return nil
+}
+
+func (m *mockTagStorage) FindByID(id int64) (*tag.Tag, error) {
+	if t, ok := m.tags[id]; ok {
+		return t, nil
+	}
+
+	return &tag.Tag{}, nil
+}
+
+func (m *mockTagStorage) FindByUserID(userID int64) ([]*tag.Tag, error) {
+	res := make([]*tag.Tag, 0)
+
+	for _, t := range m.tags {
+		if t.UserID == userID {
+			res = append(res, t)
+		}
+	}
+
+	return res, nil
+}
+
+func (m *mockTagStorage) Update(t *tag.Tag) error {
+	m.tags[t.ID] = t
+	return nil
+}
+
+func (m *mockTagStorage) Delete(id int64) error {
+	delete(m.tags, id)
+	return nil
+}
+
+func (m *mockTagStorage) SetRobotTags(robotID int64, userID int64, names []string) error {
+	m.robotTags[robotID] = names
+	m.setUserID = userID
+
+	return nil
+}
+
+func (m *mockTagStorage) FindByRobotIDs(robotIDs []int64) (map[int64][]string, error) {
+	res := make(map[int64][]string)
+
+	for _, id := range robotIDs {
+		if names, ok := m.robotTags[id]; ok {
+			res[id] = names
+		}
+	}
+
+	return res, nil
+}
+
+func TestCreateTag(t *testing.T) {
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"name":" stocks "}`, http.StatusCreated},
+		{`{"name":"stocks"}`, http.StatusConflict},
+		{`{"name":""}`, http.StatusUnprocessableEntity},
+		{`{"name":"a,b"}`, http.StatusUnprocessableEntity},
+	}
+
+	h := newTestHandler(1, &mockRobotStorage{})
+	h.tagStorage = newMockTagStorage()
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.createTag).ServeHTTP(rr, requestFor(t, "POST", "/api/v1/tags", tt.body))
+
+		if status := rr.Code; status != tt.status {
+			t.Errorf("createTag handler returned wrong status code for %v: got %v, want %v", tt.body, status, tt.status)
+		}
+
+		if tt.status == http.StatusCreated && rr.Header().Get("Location") != "/api/v1/tags/1" {
+			t.Errorf("createTag handler returned wrong location: %v", rr.Header().Get("Location"))
+		}
+	}
+}
+
+func TestRenameTagOfOtherUser(t *testing.T) {
+	h := newTestHandler(1, &mockRobotStorage{})
+	h.tagStorage = newMockTagStorage(&tag.Tag{ID: 3, UserID: 2, Name: "bonds"})
+
+	req := requestFor(t, "PUT", "/api/v1/tags/3", `{"name":"stocks"}`, "id", "3")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.renameTag).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("renameTag handler returned wrong status code: got %v, want %v", status, http.StatusNotFound)
+	}
+}
+
+func TestSetRobotTags(t *testing.T) {
+	rs := &mockRobotStorage{rr: []*robot.Robot{{RobotID: 5, OwnerUserID: 1}}}
+	h := newTestHandler(1, rs)
+	ts := newMockTagStorage()
+	h.tagStorage = ts
+
+	req := requestFor(t, "PUT", "/api/v1/robot/5/tags", `{"tags":["gold","stocks","gold"]}`, "id", "5")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.setRobotTags).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("setRobotTags handler returned wrong status code: got %v, want %v", status, http.StatusOK)
+	}
+
+	want := []string{"gold", "stocks"}
+	if !reflect.DeepEqual(ts.robotTags[5], want) || !respContains(rr.Body.String(), `"tags":["gold","stocks"]`) {
+		t.Errorf("setRobotTags handler set wrong tags: %v, body: %v", ts.robotTags[5], rr.Body.String())
+	}
+}
+
+func TestGetRobotsByTags(t *testing.T) {
+	rs := &filterRecorder{mockRobotStorage: mockRobotStorage{rr: []*robot.Robot{{RobotID: 5, OwnerUserID: 1}}}}
+	h := newTestHandler(1, rs)
+	ts := newMockTagStorage()
+	ts.robotTags[5] = []string{"gold", "stocks"}
+	h.tagStorage = ts
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.getRobots).ServeHTTP(rr, requestFor(t, "GET", "/api/v1/robots?tag=gold,stocks&tag=gold", ""))
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("getRobots handler returned wrong status code: got %v, want %v", status, http.StatusOK)
+	}
+
+	if !reflect.DeepEqual(rs.f.Tags, []string{"gold", "stocks"}) || rs.f.TagsOf != 1 {
+		t.Errorf("getRobots handler listed robots with wrong tags: %v of user %v", rs.f.Tags, rs.f.TagsOf)
+	}
+
+	var rbts []*robot.Robot
+	if err := json.Unmarshal(rr.Body.Bytes(), &rbts); err != nil {
+		t.Fatalf("can't unmarshal response %v", err)
+	}
+
+	if len(rbts) != 1 || !reflect.DeepEqual(rbts[0].Tags, []string{"gold", "stocks"}) {
+		t.Errorf("getRobots handler returned robots without tags: %v", rr.Body.String())
+	}
+}
+
+// TestMakeFavouriteCopiesTags copies tags of own robots and of robots of other
+// users, the copy gets tags of its owner.
+func TestMakeFavouriteCopiesTags(t *testing.T) {
+	for _, userID := range []int64{1, 2} {
+		rs := &mockRobotStorage{rr: []*robot.Robot{{RobotID: 5, OwnerUserID: 1, Visibility: robot.VisibilityPublic}}}
+		h := newTestHandler(userID, rs)
+		ts := newMockTagStorage()
+		ts.robotTags[5] = []string{"gold"}
+		h.tagStorage = ts
+
+		req := requestFor(t, "PUT", "/api/v1/robot/5/favourite", "", "id", "5")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.makeFavourite).ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("makeFavourite handler returned wrong status code: got %v, want %v", status, http.StatusOK)
+		}
+
+		var rbt robot.Robot
+		if err := json.Unmarshal(rr.Body.Bytes(), &rbt); err != nil {
+			t.Fatalf("can't unmarshal response %v", err)
+		}
+
+		if !reflect.DeepEqual(rbt.Tags, []string{"gold"}) || ts.setUserID != userID {
+			t.Errorf("makeFavourite handler copied wrong tags for user %v: %v", userID, rr.Body.String())
+		}
+	}
+}
+
+func TestGetRobotHidesTagsOfOtherUser(t *testing.T) {
+	rs := &mockRobotStorage{rr: []*robot.Robot{{RobotID: 5, OwnerUserID: 1, Visibility: robot.VisibilityPublic}}}
+	h := newTestHandler(2, rs)
+	ts := newMockTagStorage()
+	ts.robotTags[5] = []string{"gold"}
+	h.tagStorage = ts
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.getRobot).ServeHTTP(rr, requestFor(t, "GET", "/api/v1/robot/5", "", "id", "5"))
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("getRobot handler returned wrong status code: got %v, want %v", status, http.StatusOK)
+	}
+
+	if respContains(rr.Body.String(), `"tags"`) {
+		t.Errorf("getRobot handler returned tags of other user: %v", rr.Body.String())
+	}
+}
@@ -0,0 +1,404 @@
+package handler
+
+import (
+	"cw1/cmd/auth-api/render"
+	"cw1/internal/apperr"
+	"cw1/internal/audit"
+	"cw1/internal/secret"
+	"cw1/internal/totp"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// TOTPHeader carries a fresh code for actions which need a second factor.
+	TOTPHeader = "X-TOTP-Code"
+
+	totpIssuer   = "fintech-trader"
+	challengeTTL = 5 * time.Minute
+)
+
+var errInvalidChallenge = apperr.New(apperr.KindInvalid, codeInvalidTwoFactor, "incorrect challenge or code")
+
+type twoFactorCode struct {
+	Code string `json:"code"`
+}
+
+type twoFactorSignIn struct {
+	Challenge    string `json:"challenge"`
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+// twoFactor returns the enrollment of the user, 2FA is disabled for everyone
+// when the handler has no storage for it.
+func (h *Handler) twoFactor(userID int64) (*totp.Enrollment, error) {
+	if h.totpStorage == nil {
+		return &totp.Enrollment{}, nil
+	}
+
+	e, err := h.totpStorage.Find(userID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't find two-factor enrollment of user with id: %v", userID)
+	}
+
+	return e, nil
+}
+
+// checkTOTP validates the code and makes sure it wasn't used before.
+func (h *Handler) checkTOTP(e *totp.Enrollment, code string) (bool, error) {
+	step, ok := totp.Validate(e.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	fresh, err := h.totpStorage.UseStep(e.UserID, step)
+	if err != nil {
+		return false, errors.Wrapf(err, "can't use totp step for user with id: %v", e.UserID)
+	}
+
+	return fresh, nil
+}
+
+func (h *Handler) getTwoFactor(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.sessionOwner(w, r)
+	if !ok {
+		return
+	}
+
+	e, err := h.twoFactor(id)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	err = respondJSON(w, map[string]interface{}{
+		"enabled":                  e.Enabled,
+		"recovery_codes_remaining": len(e.RecoveryCodes),
+	})
+	if err != nil {
+		h.logger.Errorf("can't respond json with two-factor status: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+func (h *Handler) enrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.sessionOwner(w, r)
+	if !ok {
+		return
+	}
+
+	e, err := h.twoFactor(id)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	if e.Enabled {
+		h.logger.Errorf("two-factor authentication of user with id: %v is already enabled", id)
+		render.Error(w, r, apperr.New(apperr.KindConflict, codeTwoFactorEnrolled, "two-factor authentication is already enabled"))
+		return
+	}
+
+	u, err := h.userStorage.FindByID(id)
+	if err != nil {
+		h.logger.Errorf("can't find user with id: %v: %v", id, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	s, err := totp.GenerateSecret()
+	if err != nil {
+		h.logger.Errorf("can't generate totp secret: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = h.totpStorage.Save(&totp.Enrollment{UserID: id, Secret: s})
+	if err != nil {
+		h.logger.Errorf("can't save two-factor enrollment of user with id: %v: %v", id, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = respondJSON(w, map[string]string{
+		"secret":           s,
+		"provisioning_uri": totp.ProvisioningURI(totpIssuer, u.Email, s),
+	})
+	if err != nil {
+		h.logger.Errorf("can't respond json with totp secret: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+func (h *Handler) confirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorCode
+
+	err := decodeJSON(w, r, &req)
+	if err != nil {
+		h.logger.Errorf("can't unmarshal input json for two-factor confirmation: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	id, ok := h.sessionOwner(w, r)
+	if !ok {
+		return
+	}
+
+	e, err := h.twoFactor(id)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	if e.UserID == BottomLineValidID || e.Enabled {
+		h.logger.Errorf("user with id: %v has no pending two-factor enrollment", id)
+		render.Error(w, r, apperr.New(apperr.KindNotFound, codeTwoFactorNotEnroll, "two-factor enrollment isn't started"))
+		return
+	}
+
+	step, ok := totp.Validate(e.Secret, req.Code, time.Now())
+	if !ok {
+		h.logger.Errorf("incorrect totp code for confirmation from user with id: %v", id)
+		render.Error(w, r, apperr.New(apperr.KindInvalid, codeInvalidTwoFactor, "incorrect code"))
+		return
+	}
+
+	codes, err := totp.GenerateRecoveryCodes()
+	if err != nil {
+		h.logger.Errorf("can't generate recovery codes: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	e.Enabled = true
+	e.LastUsedStep = step
+	e.RecoveryCodes = make([]string, 0, len(codes))
+
+	for _, c := range codes {
+		e.RecoveryCodes = append(e.RecoveryCodes, secret.Hash(c))
+	}
+
+	err = h.totpStorage.Save(e)
+	if err != nil {
+		h.logger.Errorf("can't enable two-factor authentication of user with id: %v: %v", id, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = respondJSON(w, map[string][]string{"recovery_codes": codes})
+	if err != nil {
+		h.logger.Errorf("can't respond json with recovery codes: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+func (h *Handler) disableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorCode
+
+	err := decodeJSON(w, r, &req)
+	if err != nil {
+		h.logger.Errorf("can't unmarshal input json for disabling two-factor: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	id, ok := h.sessionOwner(w, r)
+	if !ok {
+		return
+	}
+
+	e, err := h.twoFactor(id)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	if !e.Enabled {
+		h.logger.Errorf("two-factor authentication of user with id: %v isn't enabled", id)
+		render.Error(w, r, apperr.New(apperr.KindNotFound, codeTwoFactorNotEnroll, "two-factor authentication isn't enabled"))
+		return
+	}
+
+	fresh, err := h.checkTOTP(e, req.Code)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	if !fresh {
+		h.logger.Errorf("incorrect totp code for disabling from user with id: %v", id)
+		render.Error(w, r, apperr.New(apperr.KindForbidden, codeInvalidTwoFactor, "incorrect or reused code"))
+		return
+	}
+
+	err = h.totpStorage.Delete(id)
+	if err != nil {
+		h.logger.Errorf("can't disable two-factor authentication of user with id: %v: %v", id, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// startTwoFactor answers the first step of sign in with a challenge which must
+// be exchanged for a session together with a code.
+func (h *Handler) startTwoFactor(w http.ResponseWriter, userID int64) error {
+	challenge, err := secret.Generate()
+	if err != nil {
+		return errors.Wrap(err, "can't generate challenge")
+	}
+
+	err = h.totpStorage.CreateChallenge(secret.Hash(challenge), userID, time.Now().UTC().Add(challengeTTL))
+	if err != nil {
+		return errors.Wrapf(err, "can't create challenge for user with id: %v", userID)
+	}
+
+	return respondJSON(w, map[string]interface{}{
+		"two_factor_required": true,
+		"challenge":           challenge,
+	})
+}
+
+func (h *Handler) signInTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorSignIn
+
+	err := decodeJSON(w, r, &req)
+	if err == nil && req.Challenge == "" {
+		err = errRequired("challenge")
+	}
+
+	if err != nil {
+		h.logger.Errorf("can't unmarshal input json for two-factor sign in: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	userID, err := h.totpStorage.ConsumeChallenge(secret.Hash(req.Challenge), time.Now().UTC())
+	if err != nil {
+		h.logger.Errorf("can't consume challenge: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	if userID == BottomLineValidID {
+		h.logger.Errorf("challenge is unknown, used or expired")
+		render.Error(w, r, errInvalidChallenge)
+		return
+	}
+
+	e, err := h.twoFactor(userID)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	var passed bool
+
+	if req.RecoveryCode != "" {
+		passed, err = h.totpStorage.UseRecoveryCode(userID, secret.Hash(req.RecoveryCode))
+	} else {
+		passed, err = h.checkTOTP(e, req.Code)
+	}
+
+	if err != nil {
+		h.logger.Errorf("can't check second factor of user with id: %v: %v", userID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	if !passed {
+		h.logger.Errorf("incorrect second factor of user with id: %v", userID)
+		h.record(r, &audit.Entry{
+			ActorID:    userID,
+			Action:     audit.SignInFailed,
+			TargetType: audit.TargetUser,
+			TargetID:   userID,
+		})
+		render.Error(w, r, errInvalidChallenge)
+		return
+	}
+
+	err = h.respondSession(w, userID, req.Challenge)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	h.recordSignIn(r, userID)
+}
+
+// activationFactor is the second factor of a request which activates robots.
+// A code can't be used twice, so it's checked once and the result applies to
+// every robot the request activates.
+type activationFactor struct {
+	r       *http.Request
+	checked bool
+	msg     string
+	err     error
+}
+
+// newActivationFactor takes the code from r, r is nil when robots are
+// activated on behalf of the user, who can't enter the code then.
+func newActivationFactor(r *http.Request) *activationFactor {
+	return &activationFactor{r: r}
+}
+
+// requireTOTPForActivation checks a fresh code for robots which buy a lot at a
+// higher price than the configured one. It returns a message for the user when
+// activation isn't allowed.
+func (h *Handler) requireTOTPForActivation(f *activationFactor, userID int64, buyPrice float64) (string, error) {
+	if h.totpBuyPrice <= 0 || buyPrice <= h.totpBuyPrice {
+		return "", nil
+	}
+
+	if !f.checked {
+		f.msg, f.err = h.checkActivationCode(f.r, userID)
+		f.checked = true
+	}
+
+	return f.msg, f.err
+}
+
+func (h *Handler) checkActivationCode(r *http.Request, userID int64) (string, error) {
+	e, err := h.twoFactor(userID)
+	if err != nil {
+		return "", err
+	}
+
+	if !e.Enabled {
+		return fmt.Sprintf("two-factor authentication is required to activate robots with buy price above %v",
+			h.totpBuyPrice), nil
+	}
+
+	if r == nil {
+		return fmt.Sprintf("robots with buy price above %v are activated only by requests with a code in %v header",
+			h.totpBuyPrice, TOTPHeader), nil
+	}
+
+	fresh, err := h.checkTOTP(e, r.Header.Get(TOTPHeader))
+	if err != nil {
+		return "", err
+	}
+
+	if !fresh {
+		return "incorrect or reused code in " + TOTPHeader + " header", nil
+	}
+
+	return "", nil
+}
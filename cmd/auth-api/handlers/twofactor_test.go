@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"bytes"
+	"cw1/cmd/socket"
+	"cw1/internal/format"
+	"cw1/internal/robot"
+	"cw1/internal/session"
+	"cw1/internal/totp"
+	"cw1/internal/user"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type mockTOTPStorage struct {
+	e      *totp.Enrollment
+	userID int64
+	totp.Storage
+}
+
+func (m mockTOTPStorage) Find(userID int64) (*totp.Enrollment, error) {
+	return m.e, nil
+}
+
+func (m mockTOTPStorage) UseStep(userID int64, step int64) (bool, error) {
+	return step > m.e.LastUsedStep, nil
+}
+
+func (m mockTOTPStorage) CreateChallenge(hash string, userID int64, expiresAt time.Time) error {
+	return nil
+}
+
+func (m mockTOTPStorage) ConsumeChallenge(hash string, now time.Time) (int64, error) {
+	return m.userID, nil
+}
+
+// secret from the test vectors of RFC 6238
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		2000000000: "279037",
+	}
+
+	for unix, want := range cases {
+		got, err := totp.Code(rfcSecret, totp.Step(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatalf("can't generate code: %v", err)
+		}
+
+		if got != want {
+			t.Errorf("Code at %v = %v, want %v", unix, got, want)
+		}
+	}
+}
+
+func TestSignInWithTwoFactor(t *testing.T) {
+	json := []byte(`{"email": "email","password":"123456"}`)
+	req, err := http.NewRequest("POST", "/api/v1/signin", bytes.NewBuffer(json))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+	mockTOTPStorage := new(mockTOTPStorage)
+
+	hash, err := generateHash("123456")
+	if err != nil {
+		t.Fatalf("can't generate hash %v", err)
+	}
+
+	mockUserStorage.u = &user.User{
+		ID:       1,
+		Email:    "email",
+		Password: hash,
+		Verified: true,
+	}
+	mockTOTPStorage.e = &totp.Enrollment{UserID: 1, Secret: rfcSecret, Enabled: true}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub, WithTOTPStorage(mockTOTPStorage))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.signIn)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("signIn handler returned wrong status code: got %v, want %v",
+			status, http.StatusOK)
+	}
+
+	expected := `"two_factor_required":true`
+	if !respContains(rr.Body.String(), expected) || respContains(rr.Body.String(), "bearer") {
+		t.Errorf("signIn handler returned unexpected body: got %v, want %v",
+			rr.Body.String(), expected)
+	}
+}
+
+func TestSignInTwoFactorCorrect(t *testing.T) {
+	code, err := totp.Code(rfcSecret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatalf("can't generate code: %v", err)
+	}
+
+	json := []byte(`{"challenge": "challenge","code": "` + code + `"}`)
+	req, err := http.NewRequest("POST", "/api/v1/signin/2fa", bytes.NewBuffer(json))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+	mockTOTPStorage := new(mockTOTPStorage)
+
+	mockTOTPStorage.userID = 1
+	mockTOTPStorage.e = &totp.Enrollment{UserID: 1, Secret: rfcSecret, Enabled: true}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub, WithTOTPStorage(mockTOTPStorage))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.signInTwoFactor)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("signInTwoFactor handler returned wrong status code: got %v, want %v",
+			status, http.StatusOK)
+	}
+
+	expected := "bearer"
+	if !respContains(rr.Body.String(), expected) {
+		t.Errorf("signInTwoFactor handler returned unexpected body: got %v, want %v",
+			rr.Body.String(), expected)
+	}
+}
+
+func TestSignInTwoFactorReusedCode(t *testing.T) {
+	step := totp.Step(time.Now())
+
+	code, err := totp.Code(rfcSecret, step)
+	if err != nil {
+		t.Fatalf("can't generate code: %v", err)
+	}
+
+	json := []byte(`{"challenge": "challenge","code": "` + code + `"}`)
+	req, err := http.NewRequest("POST", "/api/v1/signin/2fa", bytes.NewBuffer(json))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+	mockTOTPStorage := new(mockTOTPStorage)
+
+	mockTOTPStorage.userID = 1
+	mockTOTPStorage.e = &totp.Enrollment{UserID: 1, Secret: rfcSecret, Enabled: true, LastUsedStep: step + totp.Skew}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub, WithTOTPStorage(mockTOTPStorage))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.signInTwoFactor)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("signInTwoFactor handler returned wrong status code: got %v, want %v",
+			status, http.StatusBadRequest)
+	}
+}
+
+func TestActivateAboveBuyPriceWithoutTwoFactor(t *testing.T) {
+	req, err := http.NewRequest("PUT", "/api/v1/robot/5/activate", nil)
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	req = withURLParams(req, "id", "5")
+
+	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+	mockTOTPStorage := new(mockTOTPStorage)
+
+	mockUserStorage.u = &user.User{ID: 1, Verified: true}
+	mockSessionStorage.s = &session.Session{SessionID: token, UserID: 1}
+	mockTOTPStorage.e = &totp.Enrollment{}
+
+	now := time.Now()
+	mockRobotStorage.rr = []*robot.Robot{
+		{
+			RobotID:     5,
+			OwnerUserID: 1,
+			BuyPrice:    &format.NullFloat64{V: sql.NullFloat64{Float64: 5000, Valid: true}},
+			PlanStart:   &format.NullTime{V: sql.NullTime{Time: now.Add(-time.Hour), Valid: true}},
+			PlanEnd:     &format.NullTime{V: sql.NullTime{Time: now.Add(time.Hour), Valid: true}},
+		},
+	}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub,
+		WithTOTPStorage(mockTOTPStorage), WithActivationBuyPrice(1000))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.activate)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusForbidden {
+		t.Errorf("activate handler returned wrong status code: got %v, want %v",
+			status, http.StatusForbidden)
+	}
+
+	expected := "two-factor authentication is required"
+	if !respContains(rr.Body.String(), expected) {
+		t.Errorf("activate handler returned unexpected body: got %v, want %v",
+			rr.Body.String(), expected)
+	}
+}
@@ -3,7 +3,10 @@ package handler
 import (
 	"crypto/sha256"
 	"cw1/cmd/auth-api/render"
+	"cw1/internal/apperr"
+	"cw1/internal/audit"
 	"cw1/internal/format"
+	"cw1/internal/policy"
 	"cw1/internal/robot"
 	"cw1/internal/session"
 	"cw1/internal/user"
@@ -14,8 +17,6 @@ import (
 	"io"
 	"net/http"
 	"sort"
-	"strconv"
-	"strings"
 
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/bcrypt"
@@ -26,24 +27,43 @@ const BottomLineValidID = 0
 func (h *Handler) signUp(w http.ResponseWriter, r *http.Request) {
 	var u user.User
 
-	err := json.NewDecoder(r.Body).Decode(&u)
+	err := decodeJSON(w, r, &u)
 	if err != nil {
 		h.logger.Errorf("can't unmarshal input json for sign up: %v", err)
-		render.HTTPError("", http.StatusBadRequest, w)
+		render.Error(w, r, err)
 		return
 	}
 
-	u.Password, err = generateHash(u.Password)
+	if !h.limitAccount(w, r, accountLimitKey(r, u.Email)) {
+		return
+	}
+
+	if !isValidEmail(u.Email) {
+		h.logger.Errorf("incorrect email for sign up: %v", u.Email)
+		render.Error(w, r, apperr.Newf(apperr.KindInvalid, codeInvalidEmail, "incorrect email: %v", u.Email))
+		return
+	}
+
+	err = h.passwordPolicy.Validate(u.Password)
+	if err != nil {
+		h.logger.Errorf("weak password for sign up: %v", err)
+		render.Error(w, r, errWeakPassword(err))
+		return
+	}
+
+	u.Verified = false
+
+	u.Password, err = h.hasher.Hash(u.Password)
 	if err != nil {
 		h.logger.Errorf("can't generate hash for password: %v", err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+		render.Error(w, r, err)
 		return
 	}
 
 	fromDB, err := h.userStorage.FindByEmail(u.Email)
 	if err != nil {
 		h.logger.Errorf("can't find user with id: %v: %v", u.ID, err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+		render.Error(w, r, err)
 		return
 	}
 
@@ -51,78 +71,131 @@ func (h *Handler) signUp(w http.ResponseWriter, r *http.Request) {
 		err = h.userStorage.Create(&u)
 		if err != nil {
 			h.logger.Errorf("can't create user record in storage with id: %v: %v", u.ID, err)
-			render.HTTPError("", http.StatusInternalServerError, w)
+			render.Error(w, r, err)
+			return
+		}
+
+		err = h.sendVerification(&u)
+		if err != nil {
+			h.logger.Errorf(err.Error())
+			render.Error(w, r, err)
 			return
 		}
 
 		w.WriteHeader(http.StatusCreated)
 	} else {
 		h.logger.Errorf("user with email: %v is already exist", u.Email)
-		msg := fmt.Sprintf("user %s is already registered", u.Email)
-		render.HTTPError(msg, http.StatusConflict, w)
+		render.Error(w, r, errEmailTaken(u.Email))
 		return
 	}
 }
 
-func generateHash(pwd string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.MinCost)
-	if err != nil {
-		return "", errors.Wrap(err, "can't generate hash")
-	}
-
-	return string(hash), nil
-}
-
 func (h *Handler) signIn(w http.ResponseWriter, r *http.Request) {
 	var u user.User
 
-	err := json.NewDecoder(r.Body).Decode(&u)
+	err := decodeJSON(w, r, &u)
 	if err != nil {
 		h.logger.Errorf("can't unmarshal input json for sign in: %v", err)
-		render.HTTPError("", http.StatusBadRequest, w)
+		render.Error(w, r, err)
+		return
+	}
+
+	key := accountLimitKey(r, u.Email)
+
+	if !h.limitAccount(w, r, key) {
 		return
 	}
 
 	fromDB, err := h.userStorage.FindByEmail(u.Email)
 	if err != nil {
 		h.logger.Errorf("can't find user by id: %v: %v", u.ID, err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+		render.Error(w, r, err)
 		return
 	}
 
-	if !isMatch(fromDB.Password, u.Password) || fromDB.Email != u.Email {
+	if !h.isMatch(fromDB.Password, u.Password) || fromDB.Email != u.Email {
 		h.logger.Errorf("can't authorize because password or email: %v incorrect: %v", u.Email, err)
-		render.HTTPError("incorrect email or password", http.StatusBadRequest, w)
+		h.accountFailed(key)
+		h.record(r, &audit.Entry{
+			ActorID:    fromDB.ID,
+			Action:     audit.SignInFailed,
+			TargetType: audit.TargetUser,
+			TargetID:   fromDB.ID,
+			Diff:       map[string]audit.Change{"email": {After: u.Email}},
+		})
+		render.Error(w, r, apperr.New(apperr.KindUnauthenticated, codeBadCredentials, "incorrect email or password"))
 		return
 	}
 
-	token, err := generateToken(u.Email + u.Password)
+	h.accountSucceeded(key)
+
+	h.rehash(fromDB, u.Password)
+
+	if !fromDB.Verified {
+		h.logger.Errorf("can't authorize user with id: %v because email isn't verified", fromDB.ID)
+		render.Error(w, r, errEmailNotVerified)
+		return
+	}
+
+	tf, err := h.twoFactor(fromDB.ID)
 	if err != nil {
-		h.logger.Errorf("can't create new token: %v", err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	if tf.Enabled {
+		err = h.startTwoFactor(w, fromDB.ID)
+		if err != nil {
+			h.logger.Errorf("can't start two-factor sign in: %v", err)
+			render.Error(w, r, err)
+		}
+
 		return
 	}
 
-	s, err := session.New(token, fromDB.ID)
+	err = h.respondSession(w, fromDB.ID, u.Email+u.Password)
 	if err != nil {
-		h.logger.Errorf("can't create struct for session: %v", err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
 		return
 	}
 
+	h.recordSignIn(r, fromDB.ID)
+}
+
+func (h *Handler) recordSignIn(r *http.Request, userID int64) {
+	h.record(r, &audit.Entry{
+		ActorID:    userID,
+		Action:     audit.SignIn,
+		TargetType: audit.TargetUser,
+		TargetID:   userID,
+	})
+}
+
+// respondSession creates a new session for the user and responds with its token.
+func (h *Handler) respondSession(w http.ResponseWriter, userID int64, seed string) error {
+	token, err := generateToken(seed)
+	if err != nil {
+		return errors.Wrap(err, "can't create new token")
+	}
+
+	s, err := session.New(token, userID)
+	if err != nil {
+		return errors.Wrap(err, "can't create struct for session")
+	}
+
 	err = h.sessionStorage.Create(s)
 	if err != nil {
-		h.logger.Errorf("can't create session in storage: %v", err)
-		render.HTTPError("", http.StatusInternalServerError, w)
-		return
+		return errors.Wrap(err, "can't create session in storage")
 	}
 
 	err = respondJSON(w, map[string]string{"bearer": token})
 	if err != nil {
-		h.logger.Errorf("can't respond json with token: %v", err)
-		render.HTTPError("", http.StatusInternalServerError, w)
-		return
+		return errors.Wrap(err, "can't respond json with token")
 	}
+
+	return nil
 }
 
 func generateToken(s string) (string, error) {
@@ -141,100 +214,181 @@ func generateToken(s string) (string, error) {
 	return hex.EncodeToString(hasher.Sum(nil)), nil
 }
 
-func isMatch(hashedPwd string, plainPwd string) bool {
-	byteHash := []byte(hashedPwd)
+func (h *Handler) isMatch(hashedPwd string, plainPwd string) bool {
+	ok, err := h.hasher.Verify(hashedPwd, plainPwd)
+	if err != nil {
+		h.logger.Errorf("can't verify password: %v", err)
+		return false
+	}
+
+	return ok
+}
+
+// rehash upgrades the stored hash of the user to the configured algorithm
+// and parameters, the plain password is known only on successful sign in.
+func (h *Handler) rehash(u *user.User, plainPwd string) {
+	if !h.hasher.NeedsRehash(u.Password) {
+		return
+	}
 
-	err := bcrypt.CompareHashAndPassword(byteHash, []byte(plainPwd))
+	hash, err := h.hasher.Hash(plainPwd)
+	if err != nil {
+		h.logger.Errorf("can't rehash password of user with id: %v: %v", u.ID, err)
+		return
+	}
 
-	return err == nil
+	u.Password = hash
+
+	err = h.userStorage.Update(u)
+	if err != nil {
+		h.logger.Errorf("can't update password hash of user with id: %v: %v", u.ID, err)
+	}
 }
 
+// updateUser replaces the profile, the password has its own endpoint.
 func (h *Handler) updateUser(w http.ResponseWriter, r *http.Request) {
 	var u user.User
 
-	err := json.NewDecoder(r.Body).Decode(&u)
+	err := decodeJSON(w, r, &u)
 	if err != nil {
 		h.logger.Errorf("can't unmarshal input json for updating user: %v", err)
-		render.HTTPError("", http.StatusBadRequest, w)
+		render.Error(w, r, err)
 		return
 	}
 
-	id, err := IDFromParams(r)
+	id, err := idParam(r, "id")
 	if err != nil {
 		h.logger.Errorf("can't get ID from URL params: %v", err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+		render.Error(w, r, err)
 		return
 	}
 
-	if id <= BottomLineValidID {
-		h.logger.Errorf("don't valid id: %v", id)
-		msg := fmt.Sprintf("incorrect id: %v", id)
-		render.HTTPError(msg, http.StatusBadRequest, w)
+	token, err := tokenFromReq(r)
+	if err != nil {
+		h.logger.Errorf("can't get token from request: %v", err)
+		render.Error(w, r, err)
 		return
 	}
 
-	token := tokenFromReq(r)
-
 	s, err := h.sessionStorage.FindByID(id)
 	if err != nil {
 		h.logger.Errorf("can't find session by user ID: %v: %v", id, err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+		render.Error(w, r, err)
 		return
 	}
 
 	if token == s.SessionID {
-		msg, status, err := checkEmail(h.userStorage, u.Email, id)
+		fields := validateProfile(&u)
+		if u.Password != "" {
+			fields["password"] = "can't be changed here, use the password endpoint"
+		}
+
+		if len(fields) > 0 {
+			h.logger.Errorf("incorrect profile of user with id: %v: %v", id, fields)
+			render.Error(w, r, apperr.Validation(fields))
+			return
+		}
+
+		err = checkEmail(h.userStorage, u.Email, id)
 		if err != nil {
-			h.logger.Errorf("can't init user: %v", id, err)
-			render.HTTPError(msg, status, w)
+			h.logger.Errorf("can't change email of user with id: %v: %v", id, err)
+			render.Error(w, r, err)
 			return
 		}
 
-		err = initUser(&u, id)
+		current, err := h.userStorage.FindByID(id)
 		if err != nil {
-			h.logger.Errorf("can't init user: %v", id, err)
-			render.HTTPError("", http.StatusInternalServerError, w)
+			h.logger.Errorf("can't find user with id= %v: %v", id, err)
+			render.Error(w, r, err)
 			return
 		}
 
+		t, err := format.NewNullTime()
+		if err != nil {
+			h.logger.Errorf("can't create new null time: %v", err)
+			render.Error(w, r, err)
+			return
+		}
+
+		u.ID = id
+		u.UpdatedAt = *t
+		u.Password = current.Password
+
+		// a new email has to be verified again
+		emailChanged := current.Email != u.Email
+		u.Verified = current.Verified && !emailChanged
+
 		err = h.userStorage.Update(&u)
 		if err != nil {
 			h.logger.Errorf("can't update user with id= %v: %v", id, err)
-			render.HTTPError("", http.StatusInternalServerError, w)
+			render.Error(w, r, err)
 			return
 		}
 
+		h.recordUserUpdate(r, current, &u, "")
+
+		if emailChanged {
+			err = h.sendVerification(&u)
+			if err != nil {
+				h.logger.Errorf(err.Error())
+				render.Error(w, r, err)
+				return
+			}
+		}
+
 		err = respondJSON(w, &u)
 		if err != nil {
 			h.logger.Errorf("can't respond json with user info: %v", err)
-			render.HTTPError("", http.StatusInternalServerError, w)
+			render.Error(w, r, err)
 			return
 		}
 	} else {
 		h.logger.Errorf("can't respond json with user info: %v", err)
-		msg := fmt.Sprintf("user %d don't find", id)
-		render.HTTPError(msg, http.StatusNotFound, w)
+		render.Error(w, r, errUserNotFound(id))
+	}
+}
+
+// recordUserUpdate appends changes of the user to the audit log, only the
+// fact of a password change is written. plainPwd is empty when the password
+// wasn't set by the request.
+func (h *Handler) recordUserUpdate(r *http.Request, before *user.User, after *user.User, plainPwd string) {
+	if h.auditStorage == nil {
+		return
+	}
+
+	diff, err := audit.Diff(before, after)
+	if err != nil {
+		h.logger.Errorf("can't make diff for audit log: %v", err)
+		diff = make(map[string]audit.Change)
+	}
+
+	if plainPwd != "" && !h.isMatch(before.Password, plainPwd) {
+		diff["password"] = audit.Change{Before: audit.Redacted, After: audit.Redacted}
 	}
+
+	h.record(r, &audit.Entry{
+		ActorID:    after.ID,
+		Action:     audit.UpdateUser,
+		TargetType: audit.TargetUser,
+		TargetID:   after.ID,
+		Diff:       diff,
+	})
 }
 
-func checkEmail(userStorage user.Storage, email string, id int64) (string, int, error) {
+func checkEmail(userStorage user.Storage, email string, id int64) error {
 	fromDB, err := userStorage.FindByEmail(email)
 	if err != nil {
-		info := fmt.Sprintf("can't find user with email: %v", email)
-		return "", http.StatusInternalServerError, errors.Wrapf(err, info)
+		return errors.Wrapf(err, "can't find user with email: %v", email)
 	}
 
 	if fromDB.ID != BottomLineValidID && fromDB.ID != id {
-		info := fmt.Sprintf("new user's email: %v, is already exist", email)
-		msg := fmt.Sprintf("user %s is already registered", email)
-
-		return msg, http.StatusBadRequest, errors.New(info)
+		return errors.Wrapf(errEmailTaken(email), "new user's email: %v, is already exist", email)
 	}
 
-	return "", -1, nil
+	return nil
 }
 
-func initUser(u *user.User, id int64) error {
+func (h *Handler) initUser(u *user.User, id int64) error {
 	t, err := format.NewNullTime()
 	if err != nil {
 		return errors.Wrap(err, "can't create new null time")
@@ -243,7 +397,7 @@ func initUser(u *user.User, id int64) error {
 	u.ID = id
 	u.UpdatedAt = *t
 
-	pass, err := generateHash(u.Password)
+	pass, err := h.hasher.Hash(u.Password)
 	if err != nil {
 		return errors.Wrap(err, "can't generate hash")
 	}
@@ -253,126 +407,157 @@ func initUser(u *user.User, id int64) error {
 	return nil
 }
 
-func IDFromParams(r *http.Request) (int64, error) {
-	const IDIndex = 4 // space in first place
-
-	str := r.URL.String()
-	params := strings.Split(str, "/")
-
-	id, err := strconv.ParseInt(params[IDIndex], 10, 64)
-	if err != nil {
-		return -1, errors.Wrap(err, "can't parse string to int for get id from params")
-	}
-
-	return id, nil
-}
-
-func tokenFromReq(r *http.Request) string {
-	const TokenID = 1
-
-	token := r.Header.Get("Authorization")
-	s := strings.Split(token, " ")
-
-	return s[TokenID]
-}
-
 func (h *Handler) getUser(w http.ResponseWriter, r *http.Request) {
-	id, err := IDFromParams(r)
+	id, err := idParam(r, "id")
 	if err != nil {
 		h.logger.Errorf("can't get ID from URL params: %v", err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+		render.Error(w, r, err)
 		return
 	}
 
-	if id <= BottomLineValidID {
-		h.logger.Errorf("don't valid id: %v", id)
-		msg := fmt.Sprintf("incorrect id: %v", id)
-		render.HTTPError(msg, http.StatusBadRequest, w)
+	token, err := tokenFromReq(r)
+	if err != nil {
+		h.logger.Errorf("can't get token from request: %v", err)
+		render.Error(w, r, err)
 		return
 	}
 
-	tokenFromReq := tokenFromReq(r)
-
 	s, err := h.sessionStorage.FindByID(id)
 	if err != nil {
 		h.logger.Errorf("can't find session by user's ID: %v: %v", id, err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+		render.Error(w, r, err)
 		return
 	}
 
-	if tokenFromReq == s.SessionID {
+	if token == s.SessionID {
 		var u *user.User
 
 		u, err = h.userStorage.FindByID(id)
 		if err != nil {
 			h.logger.Errorf("can't find user in storage by ID: %v: %v", id, err)
-			render.HTTPError("", http.StatusInternalServerError, w)
+			render.Error(w, r, err)
 			return
 		}
 
 		err = respondJSON(w, u)
 		if err != nil {
 			h.logger.Errorf("can't respond json with user info: %v", err)
-			render.HTTPError("", http.StatusInternalServerError, w)
+			render.Error(w, r, err)
 			return
 		}
 	} else {
 		h.logger.Errorf("don't contains same token in storage: %v")
-		msg := fmt.Sprintf("don't find user with ID %v", id)
-		render.HTTPError(msg, http.StatusNotFound, w)
+		render.Error(w, r, apperr.Newf(apperr.KindNotFound, codeUserNotFound, "don't find user with ID %v", id))
+		return
+	}
+}
+
+// userSummary is the view of a user available to admins in listings.
+type userSummary struct {
+	ID        int64            `json:"id"`
+	FirstName string           `json:"first_name"`
+	LastName  string           `json:"last_name"`
+	Email     string           `json:"email"`
+	Role      user.Role        `json:"role"`
+	CreatedAt *format.NullTime `json:"created_at,omitempty"`
+}
+
+func (h *Handler) getUsers(w http.ResponseWriter, r *http.Request) {
+	p, err := h.authenticate(r)
+	if err != nil {
+		h.logger.Errorf("can't authenticate user: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	if !h.allowed(p, policy.ListUsers, BottomLineValidID) {
+		h.logger.Errorf("user with id: %v can't list users", p.userID)
+		render.Error(w, r, apperr.New(apperr.KindForbidden, apperr.CodeForbidden, "only admins can list users"))
+		return
+	}
+
+	users, err := h.userStorage.GetAll()
+	if err != nil {
+		h.logger.Errorf("can't get users from storage: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	res := make([]userSummary, 0, len(users))
+
+	for _, u := range users {
+		createdAt := u.CreatedAt
+
+		res = append(res, userSummary{
+			ID:        u.ID,
+			FirstName: u.FirstName,
+			LastName:  u.LastName,
+			Email:     u.Email,
+			Role:      u.Role,
+			CreatedAt: &createdAt,
+		})
+	}
+
+	err = respondJSON(w, res)
+	if err != nil {
+		h.logger.Errorf("can't respond json with users: %v", err)
+		render.Error(w, r, err)
 		return
 	}
 }
 
 func (h *Handler) getUserRobots(w http.ResponseWriter, r *http.Request) {
-	id, err := IDFromParams(r)
+	id, err := idParam(r, "id")
 	if err != nil {
 		h.logger.Errorf("can't get ID from URL params: %v", err)
-		render.HTTPError("", http.StatusBadRequest, w)
+		render.Error(w, r, err)
 		return
 	}
 
-	if id <= BottomLineValidID {
-		h.logger.Errorf("don't valid id: %v", id)
-		msg := fmt.Sprintf("incorrect id: %v", id)
-		render.HTTPError(msg, http.StatusBadRequest, w)
+	token, err := tokenFromReq(r)
+	if err != nil {
+		h.logger.Errorf("can't get token from request: %v", err)
+		render.Error(w, r, err)
 		return
 	}
 
-	token := tokenFromReq(r)
-
 	s, err := h.sessionStorage.FindByID(id)
 	if err != nil {
 		h.logger.Errorf("can't find user by id in storage: %v", err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+		render.Error(w, r, err)
 		return
 	}
 
 	if s.UserID == BottomLineValidID {
 		h.logger.Errorf("can't find user with id: %v: %v", id, err)
-		msg := fmt.Sprintf("can't find user with id: %v", id)
-		render.HTTPError(msg, http.StatusNotFound, w)
+		render.Error(w, r, apperr.Newf(apperr.KindNotFound, codeUserNotFound, "can't find user with id: %v", id))
 		return
 	}
 
 	if token != s.SessionID {
 		h.logger.Errorf("incorrect token")
-		msg := fmt.Sprintf("tokens don't match")
-		render.HTTPError(msg, http.StatusBadRequest, w)
+		render.Error(w, r, apperr.New(apperr.KindForbidden, apperr.CodeForbidden, "tokens don't match"))
 		return
 	}
 
 	robots, err := h.robotStorage.FindByOwnerID(id)
 	if err != nil {
 		h.logger.Errorf("can't get robots with owner id: %v from storage: %v", id, err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = h.fillTags(s.UserID, robots...)
+	if err != nil {
+		h.logger.Errorf("can't fill tags of robots: %v", err)
+		render.Error(w, r, err)
 		return
 	}
 
 	err = respondWithData(w, r, h.tmplts, robots...)
 	if err != nil {
 		h.logger.Errorf("can't respond with data: %v", err)
-		render.HTTPError("", http.StatusInternalServerError, w)
+		render.Error(w, r, err)
 		return
 	}
 }
@@ -411,13 +596,17 @@ func renderTemplate(w io.Writer, name string, template string, tmplts map[string
 }
 
 func respondJSON(w http.ResponseWriter, payload interface{}) error {
+	return respondJSONStatus(w, http.StatusOK, payload)
+}
+
+func respondJSONStatus(w http.ResponseWriter, status int, payload interface{}) error {
 	response, err := json.Marshal(payload)
 	if err != nil {
 		return errors.Wrapf(err, "can't marshal respond to json")
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 
 	c, err := w.Write(response)
 	if err != nil {
@@ -2,8 +2,10 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"cw1/cmd/socket"
 	"cw1/internal/format"
+	"cw1/internal/password"
 	"cw1/internal/robot"
 	"cw1/internal/session"
 	"cw1/internal/user"
@@ -15,6 +17,9 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/go-chi/chi"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type mockUserStorage struct {
@@ -39,7 +44,8 @@ func (m mockUserStorage) Update(u *user.User) error {
 }
 
 type mockRobotStorage struct {
-	rr []*robot.Robot
+	rr    []*robot.Robot
+	deals []*robot.Deal
 	robot.Storage
 }
 
@@ -51,6 +57,12 @@ func (m mockRobotStorage) Create(r *robot.Robot) error {
 }
 
 func (m mockRobotStorage) FindByID(id int64) (*robot.Robot, error) {
+	for _, r := range m.rr {
+		if r.RobotID == id {
+			return r, nil
+		}
+	}
+
 	return m.rr[First], nil
 }
 
@@ -62,7 +74,11 @@ func (m mockRobotStorage) FindByTicker(ticker string) ([]*robot.Robot, error) {
 	return nil, nil
 }
 
-func (m mockRobotStorage) GetAll(id int64, ticker string) ([]*robot.Robot, error) {
+func (m mockRobotStorage) List(f robot.Filter) ([]*robot.Robot, error) {
+	if f.Limit > 0 && len(m.rr) > f.Limit {
+		return m.rr[:f.Limit], nil
+	}
+
 	return m.rr, nil
 }
 
@@ -74,6 +90,10 @@ func (m mockRobotStorage) GetActiveRobots() ([]*robot.Robot, error) {
 	return nil, nil
 }
 
+func (m mockRobotStorage) FindDealsByOwnerID(id int64) ([]*robot.Deal, error) {
+	return m.deals, nil
+}
+
 type mockSessionStorage struct {
 	s *session.Session
 	session.Storage
@@ -91,6 +111,10 @@ func (m mockSessionStorage) FindByToken(token string) (*session.Session, error)
 	return m.s, nil
 }
 
+func (m mockSessionStorage) FindAllByUserID(id int64) ([]*session.Session, error) {
+	return []*session.Session{m.s}, nil
+}
+
 type mockLogger struct {
 	logger.Logger
 }
@@ -102,6 +126,16 @@ func (m mockLogger) Errorf(format string, args ...interface{}) {}
 func (m mockLogger) Fatalf(format string, args ...interface{}) {}
 func (m mockLogger) Panicf(format string, args ...interface{}) {}
 
+// generateHash makes cheap bcrypt hashes for fixtures, sign in upgrades them.
+func generateHash(pwd string) (string, error) {
+	hs, err := password.New(password.Config{Algorithm: password.Bcrypt, BcryptCost: bcrypt.MinCost})
+	if err != nil {
+		return "", err
+	}
+
+	return hs.Hash(pwd)
+}
+
 func respContains(in string, want string) bool {
 	if in == "" {
 		return want == ""
@@ -110,8 +144,45 @@ func respContains(in string, want string) bool {
 	return strings.Contains(in, want)
 }
 
+// testToken is the session token of the user of newTestHandler.
+const testToken = "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
+
+// newTestHandler makes a handler for the signed in verified user, which knows the AAPL ticker.
+func newTestHandler(userID int64, rs robot.Storage, opts ...Option) *Handler {
+	mockUserStorage := &mockUserStorage{u: &user.User{ID: userID, Verified: true}}
+	mockSessionStorage := &mockSessionStorage{s: &session.Session{SessionID: testToken, UserID: userID}}
+
+	h, _ := New(new(mockLogger), mockUserStorage, mockSessionStorage, rs, socket.NewHub(),
+		append([]Option{WithTickers([]string{"AAPL"})}, opts...)...)
+
+	return h
+}
+
+// requestFor makes a request of the user of newTestHandler, kv are route params of the request.
+func requestFor(t *testing.T, method string, url string, body string, kv ...string) *http.Request {
+	req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	req.Header.Set("Accept", "application/json")
+
+	return withURLParams(req, kv...)
+}
+
+// withURLParams adds route params to the request as the router does.
+func withURLParams(r *http.Request, kv ...string) *http.Request {
+	rctx := chi.NewRouteContext()
+	for i := 0; i+1 < len(kv); i += 2 {
+		rctx.URLParams.Add(kv[i], kv[i+1])
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
 func TestSignUpCorrect(t *testing.T) {
-	json := []byte(`{"first_name" : "name","last_name": "last_name","birthday": "1970-01-01","email": "email","password":"123456"}`)
+	json := []byte(`{"first_name" : "name","last_name": "last_name","birthday": "1970-01-01","email": "user@example.com","password":"correct horse"}`)
 	req, err := http.NewRequest("POST", "/api/v1/signup", bytes.NewBuffer(json))
 	if err != nil {
 		t.Fatalf("can't create request %v", err)
@@ -129,7 +200,8 @@ func TestSignUpCorrect(t *testing.T) {
 
 	mockUserStorage.u = u
 
-	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub)
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub,
+		WithVerificationStorage(new(mockVerificationStorage)), WithMailSender(new(mockMailSender)))
 
 	rr := httptest.NewRecorder()
 	handler := http.HandlerFunc(h.signUp)
@@ -149,7 +221,7 @@ func TestSignUpCorrect(t *testing.T) {
 }
 
 func TestSignUpIfUserAlreadyRegistered(t *testing.T) {
-	json := []byte(`{"first_name" : "name","last_name": "last_name","birthday": "1970-01-01","email": "email","password":"123456"}`)
+	json := []byte(`{"first_name" : "name","last_name": "last_name","birthday": "1970-01-01","email": "user@example.com","password":"correct horse"}`)
 	req, err := http.NewRequest("POST", "/api/v1/signup", bytes.NewBuffer(json))
 	if err != nil {
 		t.Fatalf("can't create request %v", err)
@@ -163,7 +235,7 @@ func TestSignUpIfUserAlreadyRegistered(t *testing.T) {
 
 	u := &user.User{
 		ID:    1, // not zero value => find user in storage
-		Email: "email",
+		Email: "user@example.com",
 	}
 
 	mockUserStorage.u = u
@@ -180,8 +252,8 @@ func TestSignUpIfUserAlreadyRegistered(t *testing.T) {
 			status, http.StatusConflict)
 	}
 
-	expected := fmt.Sprintf("{\"error\":\"user %v is already registered\"}", u.Email)
-	if rr.Body.String() != expected {
+	expected := fmt.Sprintf("\"detail\":\"user %v is already registered\"", u.Email)
+	if !respContains(rr.Body.String(), expected) {
 		t.Errorf("signUp handler returned unexpected body: got %v, want %v",
 			rr.Body.String(), expected)
 	}
@@ -220,8 +292,8 @@ func TestSignUpIncorrectJson(t *testing.T) {
 			status, http.StatusBadRequest)
 	}
 
-	expected := ""
-	if rr.Body.String() != expected {
+	expected := `"code":"malformed_request"`
+	if !respContains(rr.Body.String(), expected) {
 		t.Errorf("signUp handler returned unexpected body: got %v, want %v",
 			rr.Body.String(), expected)
 	}
@@ -249,6 +321,7 @@ func TestSignInCorrect(t *testing.T) {
 		ID:       1, // not zero value => find user in storage
 		Email:    "email",
 		Password: hash,
+		Verified: true,
 	}
 
 	mockUserStorage.u = u
@@ -305,9 +378,9 @@ func TestSignInEmailDontEqual(t *testing.T) {
 
 	handler.ServeHTTP(rr, req)
 
-	if status := rr.Code; status != http.StatusBadRequest {
+	if status := rr.Code; status != http.StatusUnauthorized {
 		t.Errorf("signIn handler returned wrong status code: got %v, want %v",
-			status, http.StatusBadRequest)
+			status, http.StatusUnauthorized)
 	}
 
 	expected := "incorrect email or password"
@@ -318,12 +391,14 @@ func TestSignInEmailDontEqual(t *testing.T) {
 }
 
 func TestUpdateUserCorrect(t *testing.T) {
-	json := []byte(`{"first_name" : "changed","last_name": "changed","birthday": "2000-01-01","email": "NEWEMAIL","password":"123"}`)
+	json := []byte(`{"first_name" : "changed","last_name": "changed","birthday": "2000-01-01","email": "new@example.com"}`)
 	req, err := http.NewRequest("PUT", "/api/v1/users/1", bytes.NewBuffer(json))
 	if err != nil {
 		t.Fatalf("can't create request %v", err)
 	}
 
+	req = withURLParams(req, "id", "1")
+
 	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
 	req.Header.Set("Authorization", "Bearer "+token)
 
@@ -352,7 +427,8 @@ func TestUpdateUserCorrect(t *testing.T) {
 	mockUserStorage.u = u
 	mockSessionStorage.s = s
 
-	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub)
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub,
+		WithVerificationStorage(new(mockVerificationStorage)), WithMailSender(new(mockMailSender)))
 
 	rr := httptest.NewRecorder()
 
@@ -365,13 +441,41 @@ func TestUpdateUserCorrect(t *testing.T) {
 			status, http.StatusOK)
 	}
 
-	expected := `{"first_name":"changed","last_name":"changed","birthday":"2000-01-01","email":"NEWEMAIL"}`
+	expected := `{"first_name":"changed","last_name":"changed","birthday":"2000-01-01","email":"new@example.com"}`
 	if !respContains(rr.Body.String(), expected) {
 		t.Errorf("updateUser handler returned unexpected body: got %v, want %v",
 			rr.Body.String(), expected)
 	}
 }
 
+func TestUpdateUserIncorrect(t *testing.T) {
+	tests := []struct {
+		body  string
+		field string
+	}{
+		{`{"first_name": "changed","email": "new@example.com","password": "correct horse"}`, "password"},
+		{`{"first_name": "changed","email": "NEWEMAIL"}`, "email"},
+		{`{"first_name": " ","email": "new@example.com"}`, "first_name"},
+		{`{"birthday": "2999-01-01","email": "new@example.com"}`, "birthday"},
+	}
+
+	for _, tt := range tests {
+		h := newTestHandler(1, new(mockRobotStorage))
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.updateUser).ServeHTTP(rr, requestFor(t, "PUT", "/api/v1/users/1", tt.body, "id", "1"))
+
+		if status := rr.Code; status != http.StatusUnprocessableEntity {
+			t.Errorf("updateUser handler returned wrong status code for %v: got %v, want %v",
+				tt.body, status, http.StatusUnprocessableEntity)
+		}
+
+		if !respContains(rr.Body.String(), `"`+tt.field+`"`) {
+			t.Errorf("updateUser handler didn't report field %v: %v", tt.field, rr.Body.String())
+		}
+	}
+}
+
 func TestUpdateUserIncorrectID(t *testing.T) {
 	json := []byte(`{}`)
 	req, err := http.NewRequest("PUT", "/api/v1/users/-1", bytes.NewBuffer(json))
@@ -379,6 +483,8 @@ func TestUpdateUserIncorrectID(t *testing.T) {
 		t.Fatalf("can't create request %v", err)
 	}
 
+	req = withURLParams(req, "id", "-1")
+
 	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
 	req.Header.Set("Authorization", "Bearer "+token)
 
@@ -428,12 +534,14 @@ func TestUpdateUserIncorrectID(t *testing.T) {
 }
 
 func TestUpdateUserNotFind(t *testing.T) {
-	json := []byte(`{"first_name" : "changed","last_name": "changed","birthday": "2000-01-01","email": "NEWEMAIL","password":"123"}`)
+	json := []byte(`{"first_name" : "changed","last_name": "changed","birthday": "2000-01-01","email": "NEWEMAIL","password":"correct horse"}`)
 	req, err := http.NewRequest("PUT", "/api/v1/users/1", bytes.NewBuffer(json))
 	if err != nil {
 		t.Fatalf("can't create request %v", err)
 	}
 
+	req = withURLParams(req, "id", "1")
+
 	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
 	req.Header.Set("Authorization", "Bearer "+token)
 
@@ -475,7 +583,7 @@ func TestUpdateUserNotFind(t *testing.T) {
 			status, http.StatusNotFound)
 	}
 
-	expected := fmt.Sprintf("{\"error\":\"user %v don't find\"}", u.ID)
+	expected := fmt.Sprintf("\"detail\":\"user %v don't find\"", u.ID)
 	if !respContains(rr.Body.String(), expected) {
 		t.Errorf("updateUser handler returned unexpected body: got %v, want %v",
 			rr.Body.String(), expected)
@@ -488,6 +596,8 @@ func TestGetUserCorrect(t *testing.T) {
 		t.Fatalf("can't create request %v", err)
 	}
 
+	req = withURLParams(req, "id", "1")
+
 	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
 	req.Header.Set("Authorization", "Bearer "+token)
 
@@ -551,6 +661,8 @@ func TestGetUserIncorrectID(t *testing.T) {
 		t.Fatalf("can't create request %v", err)
 	}
 
+	req = withURLParams(req, "id", "-1")
+
 	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
 	req.Header.Set("Authorization", "Bearer "+token)
 
@@ -599,6 +711,8 @@ func TestGetUserNotFound(t *testing.T) {
 		t.Fatalf("can't create request %v", err)
 	}
 
+	req = withURLParams(req, "id", "1")
+
 	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
 	req.Header.Set("Authorization", "Bearer "+token)
 
@@ -653,6 +767,8 @@ func TestGetUserRobotsCorrect(t *testing.T) {
 		t.Fatalf("can't create request %v", err)
 	}
 
+	req = withURLParams(req, "id", "1")
+
 	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Accept", "application/json")
@@ -715,6 +831,8 @@ func TestGetUserRobotsUserNotFound(t *testing.T) {
 		t.Fatalf("can't create request %v", err)
 	}
 
+	req = withURLParams(req, "id", "1")
+
 	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Accept", "application/json")
@@ -776,6 +894,8 @@ func TestGetUserRobotsCheckTokens(t *testing.T) {
 		t.Fatalf("can't create request %v", err)
 	}
 
+	req = withURLParams(req, "id", "1")
+
 	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Accept", "application/json")
@@ -819,14 +939,143 @@ func TestGetUserRobotsCheckTokens(t *testing.T) {
 
 	handler.ServeHTTP(rr, req)
 
-	if status := rr.Code; status != http.StatusBadRequest {
+	if status := rr.Code; status != http.StatusForbidden {
 		t.Errorf("getUserRobots handler returned wrong status code: got %v, want %v",
-			status, http.StatusBadRequest)
+			status, http.StatusForbidden)
 	}
 
-	expected := `{"error":"tokens don't match"}`
+	expected := `"detail":"tokens don't match"`
 	if !respContains(rr.Body.String(), expected) {
 		t.Errorf("getUserRobots handler returned unexpected body: got %v, want %v",
 			rr.Body.String(), expected)
 	}
 }
+
+func TestGetUsersNotAdmin(t *testing.T) {
+	req, err := http.NewRequest("GET", "/api/v1/users", nil)
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	token := "8b5d7c0b629267f197f0b5d77c6c066c86e9f9fbd51e3d152cfed360bbf5f"
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+
+	mockUserStorage.u = &user.User{
+		ID:   1,
+		Role: user.RoleSupport,
+	}
+
+	mockSessionStorage.s = &session.Session{
+		SessionID: token,
+		UserID:    1,
+	}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.getUsers)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusForbidden {
+		t.Errorf("getUsers handler returned wrong status code: got %v, want %v",
+			status, http.StatusForbidden)
+	}
+
+	expected := `"detail":"only admins can list users"`
+	if !respContains(rr.Body.String(), expected) {
+		t.Errorf("getUsers handler returned unexpected body: got %v, want %v",
+			rr.Body.String(), expected)
+	}
+}
+
+type mockUpdatingUserStorage struct {
+	mockUserStorage
+	updated *user.User
+}
+
+func (m *mockUpdatingUserStorage) Update(u *user.User) error {
+	m.updated = u
+	return nil
+}
+
+func TestSignInRehashesPassword(t *testing.T) {
+	json := []byte(`{"email": "email","password":"123456"}`)
+	req, err := http.NewRequest("POST", "/api/v1/signin", bytes.NewBuffer(json))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUpdatingUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+
+	hash, err := generateHash("123456")
+	if err != nil {
+		t.Fatalf("can't generate hash %v", err)
+	}
+
+	mockUserStorage.u = &user.User{
+		ID:       1,
+		Email:    "email",
+		Password: hash,
+		Verified: true,
+	}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.signIn)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("signIn handler returned wrong status code: got %v, want %v",
+			status, http.StatusOK)
+	}
+
+	if mockUserStorage.updated == nil || !strings.HasPrefix(mockUserStorage.updated.Password, "$argon2id$") {
+		t.Errorf("signIn handler didn't upgrade password hash")
+	}
+
+	if !h.isMatch(mockUserStorage.u.Password, "123456") {
+		t.Errorf("signIn handler stored hash which doesn't match password")
+	}
+}
+
+func TestSignUpCommonPassword(t *testing.T) {
+	json := []byte(`{"email": "user@example.com","password":"password123"}`)
+	req, err := http.NewRequest("POST", "/api/v1/signup", bytes.NewBuffer(json))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+
+	h, _ := New(l, new(mockUserStorage), new(mockSessionStorage), new(mockRobotStorage), hub)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.signUp)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("signUp handler returned wrong status code: got %v, want %v",
+			status, http.StatusBadRequest)
+	}
+
+	expected := "password is too common"
+	if !respContains(rr.Body.String(), expected) {
+		t.Errorf("signUp handler returned unexpected body: got %v, want %v",
+			rr.Body.String(), expected)
+	}
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"cw1/cmd/auth-api/render"
+	"cw1/internal/apperr"
+	"cw1/internal/mail"
+	"cw1/internal/secret"
+	"cw1/internal/user"
+	"cw1/internal/verification"
+	"fmt"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var errInvalidVerification = apperr.New(apperr.KindInvalid, codeInvalidToken, "verification link is invalid or expired")
+
+type resendRequest struct {
+	Email string `json:"email"`
+}
+
+func isValidEmail(email string) bool {
+	addr, err := netmail.ParseAddress(email)
+
+	return err == nil && addr.Address == email
+}
+
+// sendVerification issues a new verification token for the current email of the
+// user and mails a link with it.
+func (h *Handler) sendVerification(u *user.User) error {
+	token, err := secret.Generate()
+	if err != nil {
+		return errors.Wrap(err, "can't generate verification token")
+	}
+
+	now := time.Now().UTC()
+	t := &verification.Token{
+		UserID:    u.ID,
+		Email:     u.Email,
+		Hash:      secret.Hash(token),
+		ExpiresAt: now.Add(verification.TTL),
+		CreatedAt: now,
+	}
+
+	err = h.verifyStorage.Create(t)
+	if err != nil {
+		return errors.Wrapf(err, "can't create verification token for user with id: %v", u.ID)
+	}
+
+	link := fmt.Sprintf("%s/api/v1/verify?token=%s", h.baseURL, url.QueryEscape(token))
+
+	err = h.mailSender.Send(&mail.Message{
+		To:      u.Email,
+		Subject: "Email verification",
+		Body:    fmt.Sprintf("Follow the link to verify your email: %s\nIt is valid for %v.", link, verification.TTL),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "can't send verification mail to user with id: %v", u.ID)
+	}
+
+	return nil
+}
+
+func (h *Handler) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		h.logger.Errorf("verification token is absent")
+		render.Error(w, r, apperr.New(apperr.KindInvalid, codeInvalidToken, "verification token is absent"))
+		return
+	}
+
+	t, err := h.verifyStorage.Consume(secret.Hash(token), time.Now().UTC())
+	if err != nil {
+		h.logger.Errorf("can't consume verification token: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	if t.ID == BottomLineValidID {
+		h.logger.Errorf("verification token is unknown, used or expired")
+		render.Error(w, r, errInvalidVerification)
+		return
+	}
+
+	u, err := h.userStorage.FindByID(t.UserID)
+	if err != nil {
+		h.logger.Errorf("can't find user with id: %v: %v", t.UserID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	// the email was changed after the link had been sent
+	if u.Email != t.Email {
+		h.logger.Errorf("verification token of user with id: %v is for old email", t.UserID)
+		render.Error(w, r, errInvalidVerification)
+		return
+	}
+
+	u.Verified = true
+
+	err = h.userStorage.Update(u)
+	if err != nil {
+		h.logger.Errorf("can't verify email of user with id: %v: %v", t.UserID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// resendVerification always answers 202 for unknown and verified emails so the
+// endpoint can't be used to find out which emails are registered.
+func (h *Handler) resendVerification(w http.ResponseWriter, r *http.Request) {
+	var req resendRequest
+
+	err := decodeJSON(w, r, &req)
+	if err == nil && req.Email == "" {
+		err = errRequired("email")
+	}
+
+	if err != nil {
+		h.logger.Errorf("can't unmarshal input json for resending verification: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	u, err := h.userStorage.FindByEmail(req.Email)
+	if err != nil {
+		h.logger.Errorf("can't find user with email: %v: %v", req.Email, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	if u.ID == BottomLineValidID || u.Verified {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	last, err := h.verifyStorage.LastCreatedAt(u.ID)
+	if err != nil {
+		h.logger.Errorf("can't get last verification of user with id: %v: %v", u.ID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	if wait := time.Until(last.Add(verification.ResendInterval)); wait > 0 {
+		h.logger.Errorf("verification for user with id: %v is requested too often", u.ID)
+		tooManyRequests(w, r, wait,
+			apperr.New(apperr.KindRateLimited, codeVerifyThrottled, "verification mail was sent recently, try later"))
+		return
+	}
+
+	err = h.sendVerification(u)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
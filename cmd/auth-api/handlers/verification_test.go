@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"bytes"
+	"cw1/cmd/socket"
+	"cw1/internal/user"
+	"cw1/internal/verification"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type mockVerificationStorage struct {
+	t    *verification.Token
+	last time.Time
+	verification.Storage
+}
+
+func (m mockVerificationStorage) Create(t *verification.Token) error {
+	return nil
+}
+
+func (m mockVerificationStorage) Consume(hash string, now time.Time) (*verification.Token, error) {
+	return m.t, nil
+}
+
+func (m mockVerificationStorage) LastCreatedAt(userID int64) (time.Time, error) {
+	return m.last, nil
+}
+
+func TestVerifyEmailCorrect(t *testing.T) {
+	req, err := http.NewRequest("GET", "/api/v1/verify?token=token", nil)
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+	mockVerificationStorage := new(mockVerificationStorage)
+
+	mockUserStorage.u = &user.User{
+		ID:    1,
+		Email: "user@example.com",
+	}
+	mockVerificationStorage.t = &verification.Token{
+		ID:     1,
+		UserID: 1,
+		Email:  "user@example.com",
+	}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub,
+		WithVerificationStorage(mockVerificationStorage))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.verifyEmail)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("verifyEmail handler returned wrong status code: got %v, want %v",
+			status, http.StatusOK)
+	}
+
+	if !mockUserStorage.u.Verified {
+		t.Errorf("verifyEmail handler didn't verify email")
+	}
+}
+
+func TestVerifyEmailChangedAfterSending(t *testing.T) {
+	req, err := http.NewRequest("GET", "/api/v1/verify?token=token", nil)
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+	mockVerificationStorage := new(mockVerificationStorage)
+
+	mockUserStorage.u = &user.User{
+		ID:    1,
+		Email: "new@example.com",
+	}
+	mockVerificationStorage.t = &verification.Token{
+		ID:     1,
+		UserID: 1,
+		Email:  "old@example.com",
+	}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub,
+		WithVerificationStorage(mockVerificationStorage))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.verifyEmail)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("verifyEmail handler returned wrong status code: got %v, want %v",
+			status, http.StatusBadRequest)
+	}
+
+	if mockUserStorage.u.Verified {
+		t.Errorf("verifyEmail handler verified email by outdated link")
+	}
+}
+
+func TestResendVerificationThrottled(t *testing.T) {
+	json := []byte(`{"email": "user@example.com"}`)
+	req, err := http.NewRequest("POST", "/api/v1/verify/resend", bytes.NewBuffer(json))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+	mockVerificationStorage := new(mockVerificationStorage)
+	mockMailSender := new(mockMailSender)
+
+	mockUserStorage.u = &user.User{
+		ID:    1,
+		Email: "user@example.com",
+	}
+	mockVerificationStorage.last = time.Now()
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub,
+		WithVerificationStorage(mockVerificationStorage), WithMailSender(mockMailSender))
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.resendVerification)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusTooManyRequests {
+		t.Errorf("resendVerification handler returned wrong status code: got %v, want %v",
+			status, http.StatusTooManyRequests)
+	}
+
+	if rr.Header().Get("Retry-After") == "" {
+		t.Errorf("resendVerification handler didn't set Retry-After header")
+	}
+
+	if len(mockMailSender.sent) != 0 {
+		t.Errorf("resendVerification handler sent mail while throttled")
+	}
+}
+
+func TestSignInNotVerified(t *testing.T) {
+	json := []byte(`{"email": "email","password":"123456"}`)
+	req, err := http.NewRequest("POST", "/api/v1/signin", bytes.NewBuffer(json))
+	if err != nil {
+		t.Fatalf("can't create request %v", err)
+	}
+
+	l := new(mockLogger)
+	hub := socket.NewHub()
+	mockUserStorage := new(mockUserStorage)
+	mockRobotStorage := new(mockRobotStorage)
+	mockSessionStorage := new(mockSessionStorage)
+
+	hash, err := generateHash("123456")
+	if err != nil {
+		t.Fatalf("can't generate hash %v", err)
+	}
+
+	mockUserStorage.u = &user.User{
+		ID:       1,
+		Email:    "email",
+		Password: hash,
+	}
+
+	h, _ := New(l, mockUserStorage, mockSessionStorage, mockRobotStorage, hub)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(h.signIn)
+
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusForbidden {
+		t.Errorf("signIn handler returned wrong status code: got %v, want %v",
+			status, http.StatusForbidden)
+	}
+
+	expected := `"detail":"email is not verified"`
+	if !respContains(rr.Body.String(), expected) {
+		t.Errorf("signIn handler returned unexpected body: got %v, want %v",
+			rr.Body.String(), expected)
+	}
+}
@@ -0,0 +1,450 @@
+package handler
+
+import (
+	"cw1/cmd/auth-api/render"
+	"cw1/internal/apikey"
+	"cw1/internal/apperr"
+	"cw1/internal/robot"
+	"cw1/internal/secret"
+	"cw1/internal/webhook"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	maxWebhookURLLen       = 2048
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 500
+	// planLookback is how long ago finished plans are reported after a restart,
+	// events of plans which were reported before are skipped by their ids.
+	planLookback     = 24 * time.Hour
+	maxFinishedPlans = 1000
+)
+
+var msgWebhookEvents = "must contain at least one of " + strings.Join(webhook.Events, ", ")
+
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active,omitempty"`
+}
+
+// getWebhooks lists hooks of the user without their secrets.
+func (h *Handler) getWebhooks(w http.ResponseWriter, r *http.Request) {
+	p, err := h.authorize(r, apikey.ScopeRobotsRead)
+	if err != nil {
+		h.logger.Errorf("can't authorize user: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	hooks, err := h.hookStorage.FindHooksByUserID(p.userID)
+	if err != nil {
+		h.logger.Errorf("can't get webhooks of user with id: %v from storage: %v", p.userID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	for _, hk := range hooks {
+		hk.Secret = ""
+	}
+
+	err = respondJSON(w, hooks)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+func (h *Handler) getWebhook(w http.ResponseWriter, r *http.Request) {
+	hk, err := h.findOwnWebhook(r, apikey.ScopeRobotsRead)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	hk.Secret = ""
+
+	err = respondJSON(w, hk)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+// createWebhook registers the hook, its secret is returned only here.
+func (h *Handler) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+
+	err := decodeJSON(w, r, &req)
+	if err != nil {
+		h.logger.Errorf("can't unmarshal input json for creating webhook: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	p, err := h.authorize(r, apikey.ScopeRobotsWrite)
+	if err != nil {
+		h.logger.Errorf("can't authorize user: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	events, fields := h.validateWebhook(&req)
+	if len(fields) > 0 {
+		h.logger.Errorf("incorrect webhook from user with id: %v: %v", p.userID, fields)
+		render.Error(w, r, apperr.Validation(fields))
+		return
+	}
+
+	key, err := secret.Generate()
+	if err != nil {
+		h.logger.Errorf("can't generate webhook secret: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	hk := &webhook.Hook{UserID: p.userID, URL: req.URL, Events: events, Secret: key, Active: true}
+	if req.Active != nil {
+		hk.Active = *req.Active
+	}
+
+	err = h.hookStorage.CreateHook(hk)
+	if err != nil {
+		h.logger.Errorf("can't create webhook for user with id: %v in storage: %v", p.userID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/webhooks/%d", hk.ID))
+
+	err = respondJSONStatus(w, http.StatusCreated, hk)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+func (h *Handler) updateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+
+	err := decodeJSON(w, r, &req)
+	if err != nil {
+		h.logger.Errorf("can't unmarshal input json for updating webhook: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	hk, err := h.findOwnWebhook(r, apikey.ScopeRobotsWrite)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	events, fields := h.validateWebhook(&req)
+	if len(fields) > 0 {
+		h.logger.Errorf("incorrect webhook with id: %v: %v", hk.ID, fields)
+		render.Error(w, r, apperr.Validation(fields))
+		return
+	}
+
+	hk.URL, hk.Events = req.URL, events
+	if req.Active != nil {
+		hk.Active = *req.Active
+	}
+
+	err = h.hookStorage.UpdateHook(hk)
+	if err != nil {
+		h.logger.Errorf("can't update webhook with id: %v in storage: %v", hk.ID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	hk.Secret = ""
+
+	err = respondJSON(w, hk)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+// deleteWebhook removes the hook with its delivery log.
+func (h *Handler) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	hk, err := h.findOwnWebhook(r, apikey.ScopeRobotsWrite)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	err = h.hookStorage.DeleteHook(hk.ID)
+	if err != nil {
+		h.logger.Errorf("can't delete webhook with id: %v from storage: %v", hk.ID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// pingWebhook queues the ping event to the hook, so the receiver can be
+// checked without waiting for robot events.
+func (h *Handler) pingWebhook(w http.ResponseWriter, r *http.Request) {
+	hk, err := h.findOwnWebhook(r, apikey.ScopeRobotsWrite)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	if !hk.Active {
+		err = apperr.Newf(apperr.KindConflict, codeWebhookDisabled, "webhook with id %v is disabled", hk.ID)
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	e, err := webhook.NewEvent(webhook.Ping, hk.UserID, map[string]int64{"webhook_id": hk.ID})
+	if err != nil {
+		h.logger.Errorf("can't create ping event: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	d, err := h.webhooks.PublishTo(hk, e)
+	if err != nil {
+		h.logger.Errorf("can't ping webhook with id: %v: %v", hk.ID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = respondJSONStatus(w, http.StatusAccepted, d)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+// getDeliveries returns the delivery log of the hook, the latest deliveries first.
+func (h *Handler) getDeliveries(w http.ResponseWriter, r *http.Request) {
+	limit := defaultDeliveriesLimit
+
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxDeliveriesLimit {
+			render.Error(w, r, errInvalidQuery("limit", v))
+			return
+		}
+	}
+
+	hk, err := h.findOwnWebhook(r, apikey.ScopeRobotsRead)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	deliveries, err := h.hookStorage.FindDeliveries(hk.ID, limit)
+	if err != nil {
+		h.logger.Errorf("can't get deliveries of webhook with id: %v from storage: %v", hk.ID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = respondJSON(w, deliveries)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+// replayDelivery sends the finished delivery again with the same event.
+func (h *Handler) replayDelivery(w http.ResponseWriter, r *http.Request) {
+	deliveryID, err := idParam(r, "deliveryID")
+	if err != nil {
+		h.logger.Errorf("can't get delivery ID from URL params: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+
+	hk, err := h.findOwnWebhook(r, apikey.ScopeRobotsWrite)
+	if err != nil {
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	d, err := h.hookStorage.FindDeliveryByID(deliveryID)
+	if err != nil {
+		h.logger.Errorf("can't find delivery with id: %v in storage: %v", deliveryID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	if d.ID == BottomLineValidID || d.HookID != hk.ID {
+		err = apperr.Newf(apperr.KindNotFound, codeDeliveryNotFound, "delivery with id %v don't exist", deliveryID)
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	// a pending delivery may be sent right now, it's retried anyway
+	if d.Status == webhook.StatusPending {
+		err = apperr.Newf(apperr.KindConflict, codeDeliveryPending, "delivery with id %v is pending", deliveryID)
+		h.logger.Errorf(err.Error())
+		render.Error(w, r, err)
+		return
+	}
+
+	err = h.webhooks.Replay(d)
+	if err != nil {
+		h.logger.Errorf("can't replay delivery with id: %v: %v", deliveryID, err)
+		render.Error(w, r, err)
+		return
+	}
+
+	err = respondJSONStatus(w, http.StatusAccepted, d)
+	if err != nil {
+		h.logger.Errorf("can't respond with json: %v", err)
+		render.Error(w, r, err)
+		return
+	}
+}
+
+func (h *Handler) findOwnWebhook(r *http.Request, scope string) (*webhook.Hook, error) {
+	id, err := idParam(r, "id")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get ID from URL params")
+	}
+
+	p, err := h.authorize(r, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	hk, err := h.hookStorage.FindHookByID(id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't find webhook with id: %v in storage", id)
+	}
+
+	// hooks of other users are hidden as missing ones
+	if hk.ID == BottomLineValidID || hk.UserID != p.userID {
+		return nil, apperr.Newf(apperr.KindNotFound, codeWebhookNotFound, "webhook with id %v don't exist", id)
+	}
+
+	return hk, nil
+}
+
+// validateWebhook checks the request and returns its events without duplicates.
+// The URL must point to a public address, so hooks can't probe the internal network.
+func (h *Handler) validateWebhook(req *webhookRequest) ([]string, map[string]string) {
+	fields := make(map[string]string)
+
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(req.URL) > maxWebhookURLLen {
+		fields["url"] = fmt.Sprintf("must be an absolute http or https URL up to %v characters", maxWebhookURLLen)
+	} else if h.webhooks != nil {
+		if err = h.webhooks.CheckHost(u.Hostname()); err != nil {
+			h.logger.Errorf("incorrect host of webhook %v: %v", u.Hostname(), err)
+			fields["url"] = "must point to a public address"
+		}
+	}
+
+	events := make([]string, 0, len(req.Events))
+	seen := make(map[string]bool, len(req.Events))
+
+	for _, e := range req.Events {
+		if !webhook.IsEvent(e) {
+			fields["events"] = msgWebhookEvents
+			break
+		}
+
+		if !seen[e] {
+			seen[e] = true
+			events = append(events, e)
+		}
+	}
+
+	if len(events) == 0 {
+		fields["events"] = msgWebhookEvents
+	}
+
+	return events, fields
+}
+
+// notify records deliveries of the robot event to hooks of the owner before
+// the response, so the event isn't lost. Failures don't fail the request.
+func (h *Handler) notify(eventType string, rbt *robot.Robot) {
+	if h.webhooks == nil {
+		return
+	}
+
+	e, err := webhook.NewEvent(eventType, rbt.OwnerUserID, rbt)
+	if err != nil {
+		h.logger.Errorf("can't create %v event of robot with id: %v: %v", eventType, rbt.RobotID, err)
+		return
+	}
+
+	if err = h.webhooks.Publish(e); err != nil {
+		h.logger.Errorf("can't publish %v event of robot with id: %v: %v", eventType, rbt.RobotID, err)
+	}
+}
+
+// notifyFinishedPlans publishes events of active robots whose plans finished
+// after since.
+func (h *Handler) notifyFinishedPlans(since time.Time, now time.Time) error {
+	if h.webhooks == nil {
+		return nil
+	}
+
+	active := true
+
+	robots, err := h.robotStorage.List(robot.Filter{
+		Active: &active,
+		PlanTo: &now,
+		Sort:   robot.SortPlanEnd,
+		Desc:   true,
+		Limit:  maxFinishedPlans,
+	})
+	if err != nil {
+		return errors.Wrap(err, "can't get robots with finished plans from storage")
+	}
+
+	for _, rbt := range robots {
+		end := rbt.PlanEnd.V.Time
+		if !end.After(since) {
+			break
+		}
+
+		e := &webhook.Event{
+			ID:        fmt.Sprintf("%v-%v-%v", webhook.PlanFinished, rbt.RobotID, end.Unix()),
+			Type:      webhook.PlanFinished,
+			UserID:    rbt.OwnerUserID,
+			CreatedAt: now,
+			Data:      rbt,
+		}
+
+		if err = h.webhooks.Publish(e); err != nil {
+			return errors.Wrapf(err, "can't publish finished plan of robot with id: %v", rbt.RobotID)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,342 @@
+package handler
+
+import (
+	"cw1/internal/robot"
+	"cw1/internal/webhook"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockWebhookStorage struct {
+	hooks      map[int64]*webhook.Hook
+	deliveries map[int64]*webhook.Delivery
+}
+
+func newMockWebhookStorage(hooks ...*webhook.Hook) *mockWebhookStorage {
+	m := &mockWebhookStorage{hooks: make(map[int64]*webhook.Hook), deliveries: make(map[int64]*webhook.Delivery)}
+	for _, hk := range hooks {
+		m.hooks[hk.ID] = hk
+	}
+
+	return m
+}
+
+func (m *mockWebhookStorage) CreateHook(hk *webhook.Hook) error {
+	hk.ID = int64(len(m.hooks) + 1)
+	m.hooks[hk.ID] = hk
+
+	return nil
+}
+
+func (m *mockWebhookStorage) FindHookByID(id int64) (*webhook.Hook, error) {
+	if hk, ok := m.hooks[id]; ok {
+		return hk, nil
+	}
+
+	return &webhook.Hook{}, nil
+}
+
+func (m *mockWebhookStorage) FindHooksByUserID(userID int64) ([]*webhook.Hook, error) {
+	res := make([]*webhook.Hook, 0)
+
+	for _, hk := range m.hooks {
+		if hk.UserID == userID {
+			res = append(res, hk)
+		}
+	}
+
+	return res, nil
+}
+
+func (m *mockWebhookStorage) FindSubscribed(userID int64, eventType string) ([]*webhook.Hook, error) {
+	res := make([]*webhook.Hook, 0)
+
+	for _, hk := range m.hooks {
+		for _, e := range hk.Events {
+			if hk.UserID == userID && hk.Active && e == eventType {
+				res = append(res, hk)
+			}
+		}
+	}
+
+	return res, nil
+}
+
+func (m *mockWebhookStorage) UpdateHook(hk *webhook.Hook) error {
+	m.hooks[hk.ID] = hk
+	return nil
+}
+
+func (m *mockWebhookStorage) DeleteHook(id int64) error {
+	delete(m.hooks, id)
+	return nil
+}
+
+func (m *mockWebhookStorage) CreateDelivery(d *webhook.Delivery) error {
+	for _, v := range m.deliveries {
+		if v.HookID == d.HookID && v.EventID == d.EventID {
+			return nil
+		}
+	}
+
+	d.ID = int64(len(m.deliveries) + 1)
+	m.deliveries[d.ID] = d
+
+	return nil
+}
+
+func (m *mockWebhookStorage) FindDeliveryByID(id int64) (*webhook.Delivery, error) {
+	if d, ok := m.deliveries[id]; ok {
+		return d, nil
+	}
+
+	return &webhook.Delivery{}, nil
+}
+
+func (m *mockWebhookStorage) FindDeliveries(hookID int64, limit int) ([]*webhook.Delivery, error) {
+	res := make([]*webhook.Delivery, 0)
+
+	for _, d := range m.deliveries {
+		if d.HookID == hookID && len(res) < limit {
+			res = append(res, d)
+		}
+	}
+
+	return res, nil
+}
+
+func (m *mockWebhookStorage) DueDeliveries(now time.Time, limit int) ([]*webhook.Delivery, error) {
+	res := make([]*webhook.Delivery, 0)
+
+	for _, d := range m.deliveries {
+		if d.Status == webhook.StatusPending && !d.NextAttemptAt.V.Time.After(now) && len(res) < limit {
+			res = append(res, d)
+		}
+	}
+
+	return res, nil
+}
+
+func (m *mockWebhookStorage) ClaimDelivery(d *webhook.Delivery, until time.Time) (bool, error) {
+	d.NextAttemptAt = runAt(until)
+	return true, nil
+}
+
+func (m *mockWebhookStorage) UpdateDelivery(d *webhook.Delivery) error {
+	m.deliveries[d.ID] = d
+	return nil
+}
+
+func TestCreateWebhook(t *testing.T) {
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"url":"http://127.0.0.1:9000/hook","events":["deal.executed","deal.executed"]}`, http.StatusCreated},
+		{`{"url":"ftp://example.com/hook","events":["deal.executed"]}`, http.StatusUnprocessableEntity},
+		{`{"url":"/hook","events":["deal.executed"]}`, http.StatusUnprocessableEntity},
+		{`{"url":"https://example.com/hook","events":["robot.created"]}`, http.StatusUnprocessableEntity},
+		{`{"url":"https://example.com/hook","events":[]}`, http.StatusUnprocessableEntity},
+	}
+
+	ws := newMockWebhookStorage()
+	h := newTestHandler(1, &mockRobotStorage{})
+	h.hookStorage = ws
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.createWebhook).ServeHTTP(rr, requestFor(t, "POST", "/api/v1/webhooks", tt.body))
+
+		if status := rr.Code; status != tt.status {
+			t.Errorf("createWebhook handler returned wrong status code for %v: got %v, want %v", tt.body, status, tt.status)
+		}
+	}
+
+	hk := ws.hooks[1]
+	if hk == nil || len(hk.Secret) == 0 || len(hk.Events) != 1 || !hk.Active {
+		t.Errorf("createWebhook handler created wrong webhook: %+v", hk)
+	}
+}
+
+func TestCreateWebhookPrivateAddress(t *testing.T) {
+	ws := newMockWebhookStorage()
+	h := newTestHandler(1, &mockRobotStorage{})
+	h.hookStorage, h.webhooks = ws, webhook.NewDispatcher(ws, new(mockLogger), false)
+
+	for _, u := range []string{"http://127.0.0.1:9000/hook", "http://169.254.169.254/latest", "http://10.0.0.1/hook",
+		"http://[::1]/hook"} {
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.createWebhook).ServeHTTP(rr, requestFor(t, "POST", "/api/v1/webhooks",
+			`{"url":"`+u+`","events":["deal.executed"]}`))
+
+		if status := rr.Code; status != http.StatusUnprocessableEntity {
+			t.Errorf("createWebhook handler returned wrong status code for %v: got %v, want %v",
+				u, status, http.StatusUnprocessableEntity)
+		}
+	}
+}
+
+// TestWebhookDeliveryRefused doesn't follow redirects and doesn't connect to
+// private addresses unless they are allowed.
+func TestWebhookDeliveryRefused(t *testing.T) {
+	var redirected bool
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected = true
+	}))
+	defer target.Close()
+
+	receiver := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer receiver.Close()
+
+	for _, allowPrivate := range []bool{true, false} {
+		ws := newMockWebhookStorage(&webhook.Hook{ID: 1, UserID: 1, URL: receiver.URL, Active: true})
+		ws.deliveries[1] = &webhook.Delivery{ID: 1, HookID: 1, Status: webhook.StatusPending,
+			NextAttemptAt: runAt(time.Now().Add(-time.Minute))}
+
+		if err := webhook.NewDispatcher(ws, new(mockLogger), allowPrivate).DeliverDue(time.Now().UTC()); err != nil {
+			t.Fatalf("DeliverDue returned error: %v", err)
+		}
+
+		d := ws.deliveries[1]
+		if d.Status != webhook.StatusPending || d.LastError == "" || redirected {
+			t.Errorf("delivery wasn't refused (private addresses allowed: %v): %+v", allowPrivate, d)
+		}
+
+		if allowPrivate && d.ResponseStatus != http.StatusTemporaryRedirect {
+			t.Errorf("delivery has wrong response status: got %v, want %v", d.ResponseStatus, http.StatusTemporaryRedirect)
+		}
+	}
+}
+
+func TestGetWebhookOfOtherUser(t *testing.T) {
+	h := newTestHandler(1, &mockRobotStorage{})
+	h.hookStorage = newMockWebhookStorage(&webhook.Hook{ID: 3, UserID: 2, URL: "http://127.0.0.1/hook"})
+
+	req := requestFor(t, "GET", "/api/v1/webhooks/3", "", "id", "3")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.getWebhook).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("getWebhook handler returned wrong status code: got %v, want %v", status, http.StatusNotFound)
+	}
+}
+
+// TestWebhookDelivery sends the activation of the robot to a local receiver,
+// which fails the first attempt, and replays the delivery.
+func TestWebhookDelivery(t *testing.T) {
+	const key = "secret"
+
+	var received []string
+
+	fail := true
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		if !webhook.Verify(key, r.Header.Get(webhook.TimestampHeader), r.Header.Get(webhook.SignatureHeader), body) {
+			t.Errorf("receiver got delivery with wrong signature: %v", string(body))
+		}
+
+		received = append(received, r.Header.Get(webhook.EventHeader))
+
+		if fail {
+			fail = false
+
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	ws := newMockWebhookStorage(&webhook.Hook{ID: 1, UserID: 1, URL: receiver.URL, Secret: key, Active: true,
+		Events: []string{webhook.RobotActivated}})
+	dispatcher := webhook.NewDispatcher(ws, new(mockLogger), true)
+
+	h := newTestHandler(1, &mockRobotStorage{rr: []*robot.Robot{planned(5, 1, -time.Hour, time.Hour)}})
+	h.hookStorage, h.webhooks = ws, dispatcher
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.activate).ServeHTTP(rr, requestFor(t, "PUT", "/api/v1/robot/5/activate", "", "id", "5"))
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("activate handler returned wrong status code: got %v, want %v", status, http.StatusOK)
+	}
+
+	d := ws.deliveries[1]
+	if d == nil || d.EventType != webhook.RobotActivated {
+		t.Fatalf("activate handler didn't publish event: %+v", ws.deliveries)
+	}
+
+	now := time.Now().UTC()
+
+	if err := dispatcher.DeliverDue(now); err != nil {
+		t.Fatalf("DeliverDue returned error: %v", err)
+	}
+
+	if d.Status != webhook.StatusPending || d.Attempts != 1 || d.ResponseStatus != http.StatusInternalServerError {
+		t.Fatalf("failed delivery wasn't scheduled for retry: %+v", d)
+	}
+
+	if err := dispatcher.DeliverDue(now.Add(webhook.Backoff(1))); err != nil {
+		t.Fatalf("DeliverDue returned error: %v", err)
+	}
+
+	if d.Status != webhook.StatusDelivered || d.Attempts != 2 {
+		t.Fatalf("delivery wasn't retried: %+v", d)
+	}
+
+	req := requestFor(t, "POST", "/api/v1/webhooks/1/deliveries/1/replay", "", "id", "1", "deliveryID", "1")
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(h.replayDelivery).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusAccepted {
+		t.Fatalf("replayDelivery handler returned wrong status code: got %v, want %v", status, http.StatusAccepted)
+	}
+
+	if err := dispatcher.DeliverDue(time.Now().UTC()); err != nil {
+		t.Fatalf("DeliverDue returned error: %v", err)
+	}
+
+	if len(received) != 3 || d.Status != webhook.StatusDelivered {
+		t.Errorf("delivery wasn't replayed: %v, %+v", received, d)
+	}
+
+	var e webhook.Event
+	if err := json.Unmarshal(d.Payload, &e); err != nil || e.Type != webhook.RobotActivated ||
+		!strings.Contains(string(d.Payload), `"robot_id":5`) {
+		t.Errorf("delivery has wrong payload: %v", string(d.Payload))
+	}
+}
+
+func TestNotifyFinishedPlans(t *testing.T) {
+	finished := planned(5, 1, -2*time.Hour, -time.Minute)
+	finished.IsActive = true
+
+	ws := newMockWebhookStorage(&webhook.Hook{ID: 1, UserID: 1, URL: "http://127.0.0.1/hook", Active: true,
+		Events: []string{webhook.PlanFinished}})
+
+	h := newTestHandler(1, &mockRobotStorage{rr: []*robot.Robot{finished}})
+	h.hookStorage, h.webhooks = ws, webhook.NewDispatcher(ws, new(mockLogger), false)
+
+	now := time.Now().UTC()
+
+	for i := 0; i < 2; i++ {
+		if err := h.notifyFinishedPlans(now.Add(-time.Hour), now); err != nil {
+			t.Fatalf("notifyFinishedPlans returned error: %v", err)
+		}
+	}
+
+	if len(ws.deliveries) != 1 || ws.deliveries[1].EventType != webhook.PlanFinished {
+		t.Errorf("notifyFinishedPlans published wrong events: %+v", ws.deliveries)
+	}
+}
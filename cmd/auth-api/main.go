@@ -5,8 +5,15 @@ import (
 	handler "cw1/cmd/auth-api/handlers"
 	"cw1/cmd/socket"
 	"cw1/cmd/trade"
+	"cw1/internal/leaderboard"
+	"cw1/internal/limiter"
+	"cw1/internal/mail"
+	"cw1/internal/password"
 	"cw1/internal/postgres"
+	"cw1/internal/quote"
+	"cw1/internal/robot"
 	pb "cw1/internal/streamer"
+	"cw1/internal/webhook"
 	"cw1/pkg/log/logger"
 	"fmt"
 	"io"
@@ -15,6 +22,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -33,12 +42,62 @@ func main() {
 	hub := socket.NewHub()
 	go hub.Run()
 
-	h, err := handler.New(logger, st.u, st.s, st.r, hub)
+	board := leaderboard.NewCache(st.lb, logger)
+
+	stopBoard := make(chan bool)
+	defer close(stopBoard)
+
+	go board.Run(stopBoard, leaderboardRefresh(logger))
+
+	stopPurge := make(chan bool)
+	defer close(stopPurge)
+
+	go purgeRobots(stopPurge, st.r, robotRetention(logger), logger)
+
+	quotes := quote.NewBook()
+
+	hooks := webhook.NewDispatcher(st.wh, logger, webhookAllowPrivate(logger))
+
+	stopHooks := make(chan bool)
+	defer close(stopHooks)
+
+	go hooks.Run(stopHooks, webhookInterval(logger))
+
+	sender, closer := initMailSender(logger)
+	if closer != nil {
+		defer handleCloser(logger, "mail_file", closer)
+	}
+
+	h, err := handler.New(logger, st.u, st.s, st.r, hub,
+		handler.WithAPIKeyStorage(st.k),
+		handler.WithResetStorage(st.rs),
+		handler.WithMailSender(sender),
+		handler.WithVerificationStorage(st.v),
+		handler.WithTOTPStorage(st.t),
+		handler.WithActivationBuyPrice(activationBuyPrice(logger)),
+		handler.WithLimiter(limiter.New(st.l, limiter.DefaultConfig())),
+		handler.WithPasswordHasher(initPasswordHasher(logger)),
+		handler.WithAuditStorage(st.a),
+		handler.WithTickers(tickers()),
+		handler.WithFollowStorage(st.f),
+		handler.WithLeaderboard(board),
+		handler.WithRevisionStorage(st.rv),
+		handler.WithTagStorage(st.tg),
+		handler.WithTemplateStorage(st.tm),
+		handler.WithQuotes(quotes, quoteMaxAge(logger)),
+		handler.WithScheduleStorage(st.sc),
+		handler.WithWebhooks(st.wh, hooks),
+	)
 	if err != nil {
 		logger.Fatalf("Can't create new handler: %s", err)
 	}
 
-	srv := initServer(h, "", "5000")
+	stopScheduler := make(chan bool)
+	defer close(stopScheduler)
+
+	go h.RunScheduler(stopScheduler, schedulerInterval(logger))
+
+	srv := initServer(h, trustedProxies(logger), "", "5000")
 
 	const Duration = 5
 	go gracefulShutdown(srv, Duration*time.Second, logger)
@@ -53,7 +112,7 @@ func main() {
 	tradingClient := pb.NewTradingServiceClient(conn)
 
 	logger.Infof("Server is running at %s", "5000")
-	trader := trade.New(logger, tradingClient, st.r, hub)
+	trader := trade.New(logger, tradingClient, st.r, hub, quotes, hooks)
 
 	quit := make(chan bool)
 	go trader.StartDeals(quit)
@@ -80,9 +139,22 @@ func handleClosers(l logger.Logger, m map[string]io.Closer) {
 }
 
 type storages struct {
-	u *postgres.UserStorage
-	s *postgres.SessionStorage
-	r *postgres.RobotStorage
+	u  *postgres.UserStorage
+	s  *postgres.SessionStorage
+	r  *postgres.RobotStorage
+	k  *postgres.APIKeyStorage
+	rs *postgres.ResetStorage
+	v  *postgres.VerificationStorage
+	t  *postgres.TOTPStorage
+	l  *postgres.LimiterStorage
+	a  *postgres.AuditStorage
+	f  *postgres.FollowStorage
+	lb *postgres.LeaderboardStorage
+	rv *postgres.RevisionStorage
+	tg *postgres.TagStorage
+	tm *postgres.TemplateStorage
+	sc *postgres.ScheduleStorage
+	wh *postgres.WebhookStorage
 }
 
 func initStorages(logger logger.Logger) (*storages, map[string]io.Closer) {
@@ -127,23 +199,319 @@ func initStorages(logger logger.Logger) (*storages, map[string]io.Closer) {
 
 	closers["robot_storage"] = robotStorage
 
-	return &storages{userStorage, sessionStorage, robotStorage}, closers
+	apiKeyStorage, err := postgres.NewAPIKeyStorage(db)
+	if err != nil {
+		logger.Fatalf("can't create api key storage: %s", err)
+	}
+
+	closers["api_key_storage"] = apiKeyStorage
+
+	resetStorage, err := postgres.NewResetStorage(db)
+	if err != nil {
+		logger.Fatalf("can't create reset storage: %s", err)
+	}
+
+	closers["reset_storage"] = resetStorage
+
+	verificationStorage, err := postgres.NewVerificationStorage(db)
+	if err != nil {
+		logger.Fatalf("can't create verification storage: %s", err)
+	}
+
+	closers["verification_storage"] = verificationStorage
+
+	totpStorage, err := postgres.NewTOTPStorage(db)
+	if err != nil {
+		logger.Fatalf("can't create totp storage: %s", err)
+	}
+
+	closers["totp_storage"] = totpStorage
+
+	limiterStorage, err := postgres.NewLimiterStorage(db)
+	if err != nil {
+		logger.Fatalf("can't create limiter storage: %s", err)
+	}
+
+	closers["limiter_storage"] = limiterStorage
+
+	auditStorage, err := postgres.NewAuditStorage(db)
+	if err != nil {
+		logger.Fatalf("can't create audit storage: %s", err)
+	}
+
+	closers["audit_storage"] = auditStorage
+
+	followStorage, err := postgres.NewFollowStorage(db)
+	if err != nil {
+		logger.Fatalf("can't create follow storage: %s", err)
+	}
+
+	closers["follow_storage"] = followStorage
+
+	leaderboardStorage, err := postgres.NewLeaderboardStorage(db)
+	if err != nil {
+		logger.Fatalf("can't create leaderboard storage: %s", err)
+	}
+
+	closers["leaderboard_storage"] = leaderboardStorage
+
+	revisionStorage, err := postgres.NewRevisionStorage(db)
+	if err != nil {
+		logger.Fatalf("can't create revision storage: %s", err)
+	}
+
+	closers["revision_storage"] = revisionStorage
+
+	tagStorage, err := postgres.NewTagStorage(db)
+	if err != nil {
+		logger.Fatalf("can't create tag storage: %s", err)
+	}
+
+	closers["tag_storage"] = tagStorage
+
+	templateStorage, err := postgres.NewTemplateStorage(db)
+	if err != nil {
+		logger.Fatalf("can't create template storage: %s", err)
+	}
+
+	closers["template_storage"] = templateStorage
+
+	scheduleStorage, err := postgres.NewScheduleStorage(db)
+	if err != nil {
+		logger.Fatalf("can't create schedule storage: %s", err)
+	}
+
+	closers["schedule_storage"] = scheduleStorage
+
+	webhookStorage, err := postgres.NewWebhookStorage(db)
+	if err != nil {
+		logger.Fatalf("can't create webhook storage: %s", err)
+	}
+
+	closers["webhook_storage"] = webhookStorage
+
+	return &storages{userStorage, sessionStorage, robotStorage, apiKeyStorage, resetStorage,
+		verificationStorage, totpStorage, limiterStorage, auditStorage, followStorage, leaderboardStorage,
+		revisionStorage, tagStorage, templateStorage, scheduleStorage, webhookStorage}, closers
+}
+
+// initMailSender uses SMTP when SMTP_HOST is set and writes mails to a local
+// file otherwise.
+func initMailSender(logger logger.Logger) (mail.Sender, io.Closer) {
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		return mail.NewSMTPSender(mail.SMTPConfig{
+			Host:     host,
+			Port:     os.Getenv("SMTP_PORT"),
+			User:     os.Getenv("SMTP_USER"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		}), nil
+	}
+
+	f, err := os.OpenFile("mail.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		logger.Fatalf("can't open file for mails: %s", err)
+	}
+
+	return mail.NewFileSender(f), f
+}
+
+// activationBuyPrice reads the buy price of a lot above which activation of
+// the robot needs a TOTP code from TOTP_ACTIVATION_BUY_PRICE, the check is
+// disabled by default.
+func activationBuyPrice(logger logger.Logger) float64 {
+	v := os.Getenv("TOTP_ACTIVATION_BUY_PRICE")
+	if v == "" {
+		return 0
+	}
+
+	price, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		logger.Fatalf("can't parse TOTP_ACTIVATION_BUY_PRICE: %s", err)
+	}
+
+	return price
+}
+
+// quoteMaxAge reads from QUOTE_MAX_AGE how old quotes robots are created from
+// templates with may be, it's five minutes by default.
+func quoteMaxAge(logger logger.Logger) time.Duration {
+	v := os.Getenv("QUOTE_MAX_AGE")
+	if v == "" {
+		const minutes = 5
+		return minutes * time.Minute
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		logger.Fatalf("can't parse QUOTE_MAX_AGE: %v", v)
+	}
+
+	return d
+}
+
+// leaderboardRefresh reads how often the leaderboard is computed from
+// LEADERBOARD_REFRESH, it's a minute by default.
+func leaderboardRefresh(logger logger.Logger) time.Duration {
+	v := os.Getenv("LEADERBOARD_REFRESH")
+	if v == "" {
+		return time.Minute
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		logger.Fatalf("can't parse LEADERBOARD_REFRESH: %v", v)
+	}
+
+	return d
+}
+
+// robotRetention reads how long deleted robots are kept from ROBOT_RETENTION,
+// it's 30 days by default.
+func robotRetention(logger logger.Logger) time.Duration {
+	v := os.Getenv("ROBOT_RETENTION")
+	if v == "" {
+		const days = 30
+		return days * 24 * time.Hour
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		logger.Fatalf("can't parse ROBOT_RETENTION: %v", v)
+	}
+
+	return d
+}
+
+// schedulerInterval reads how often due jobs of robots are run from
+// SCHEDULER_INTERVAL, it's 30 seconds by default.
+func schedulerInterval(logger logger.Logger) time.Duration {
+	v := os.Getenv("SCHEDULER_INTERVAL")
+	if v == "" {
+		const seconds = 30
+		return seconds * time.Second
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		logger.Fatalf("can't parse SCHEDULER_INTERVAL: %v", v)
+	}
+
+	return d
+}
+
+// webhookInterval reads how often due webhook deliveries are sent from
+// WEBHOOK_INTERVAL, it's 5 seconds by default.
+func webhookInterval(logger logger.Logger) time.Duration {
+	v := os.Getenv("WEBHOOK_INTERVAL")
+	if v == "" {
+		const seconds = 5
+		return seconds * time.Second
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		logger.Fatalf("can't parse WEBHOOK_INTERVAL: %v", v)
+	}
+
+	return d
+}
+
+// webhookAllowPrivate reads WEBHOOK_ALLOW_PRIVATE, which lets hooks point to
+// loopback and private addresses, e.g. to a local test receiver.
+func webhookAllowPrivate(logger logger.Logger) bool {
+	v := os.Getenv("WEBHOOK_ALLOW_PRIVATE")
+	if v == "" {
+		return false
+	}
+
+	allow, err := strconv.ParseBool(v)
+	if err != nil {
+		logger.Fatalf("can't parse WEBHOOK_ALLOW_PRIVATE: %s", err)
+	}
+
+	return allow
+}
+
+// purgeRobots hourly removes robots deleted longer than retention ago.
+func purgeRobots(quit <-chan bool, rs *postgres.RobotStorage, retention time.Duration, logger logger.Logger) {
+	tick := time.NewTicker(time.Hour)
+	defer tick.Stop()
+
+	for {
+		n, err := rs.Purge(time.Now().Add(-retention))
+		if err != nil {
+			logger.Errorf("can't purge deleted robots: %v", err)
+		} else if n > 0 {
+			logger.Infof("purged %v deleted robots", n)
+		}
+
+		select {
+		case <-tick.C:
+		case <-quit:
+			return
+		}
+	}
+}
+
+// tickers reads the comma separated instruments robots can trade from TICKERS.
+func tickers() []string {
+	v := os.Getenv("TICKERS")
+	if v == "" {
+		return robot.DefaultTickers
+	}
+
+	var res []string
+
+	for _, t := range strings.Split(v, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			res = append(res, t)
+		}
+	}
+
+	return res
 }
 
-func initServer(h *handler.Handler, host string, port string) *http.Server {
-	r := routes(h)
+// initPasswordHasher hashes new passwords with PASSWORD_HASHER (argon2id or bcrypt),
+// BCRYPT_COST sets the cost of bcrypt.
+func initPasswordHasher(logger logger.Logger) *password.Hasher {
+	c := password.DefaultConfig()
+
+	if alg := os.Getenv("PASSWORD_HASHER"); alg != "" {
+		c.Algorithm = alg
+	}
+
+	if v := os.Getenv("BCRYPT_COST"); v != "" {
+		cost, err := strconv.Atoi(v)
+		if err != nil {
+			logger.Fatalf("can't parse BCRYPT_COST: %s", err)
+		}
+
+		c.BcryptCost = cost
+	}
+
+	hs, err := password.New(c)
+	if err != nil {
+		logger.Fatalf("can't create password hasher: %s", err)
+	}
+
+	return hs
+}
+
+func initServer(h *handler.Handler, proxies []*net.IPNet, host string, port string) *http.Server {
+	r := routes(h, proxies)
 	addr := net.JoinHostPort(host, port)
 	srv := &http.Server{Addr: addr, Handler: r}
 
 	return srv
 }
 
-func routes(h *handler.Handler) *chi.Mux {
+func routes(h *handler.Handler, proxies []*net.IPNet) *chi.Mux {
 	r := chi.NewRouter()
 
 	const Duration = 60
 
-	r.Use(middleware.RealIP)
+	r.Use(realIP(proxies))
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(Duration * time.Second))
 
@@ -152,6 +520,65 @@ func routes(h *handler.Handler) *chi.Mux {
 	return r
 }
 
+// trustedProxies reads networks of reverse proxies from TRUSTED_PROXIES
+// (comma separated CIDRs), no proxy is trusted by default.
+func trustedProxies(logger logger.Logger) []*net.IPNet {
+	var res []*net.IPNet
+
+	for _, v := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			logger.Fatalf("can't parse TRUSTED_PROXIES: %s", err)
+		}
+
+		res = append(res, n)
+	}
+
+	return res
+}
+
+// realIP takes the address of the client from X-Forwarded-For or X-Real-IP
+// only for requests of trusted proxies, other clients could spoof them to pass
+// IP allowlists of API keys and limits of attempts.
+func realIP(proxies []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		proxied := middleware.RealIP(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if fromProxy(r.RemoteAddr, proxies) {
+				proxied.ServeHTTP(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func fromProxy(addr string, proxies []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func gracefulShutdown(srv *http.Server, timeout time.Duration, logger logger.Logger) {
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
@@ -1,36 +1,117 @@
 package render
 
 import (
+	"cw1/internal/apperr"
 	"encoding/json"
 	"net/http"
+	"sort"
+
+	"github.com/go-chi/chi/middleware"
 )
 
 const (
-	ContentTypeHeader = "Content-Type"
-	JSONContentType   = "application/json"
+	ContentTypeHeader     = "Content-Type"
+	JSONContentType       = "application/json"
+	ProblemContentType    = "application/problem+json"
+	RequestIDHeader       = "X-Request-Id"
+	problemTypeAboutBlank = "about:blank"
 )
 
-type ErrorMsg struct {
-	Detail string `json:"error"`
+// Problem is the body of error responses as described in RFC 7807.
+type Problem struct {
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail,omitempty"`
+	Instance      string         `json:"instance,omitempty"`
+	Code          string         `json:"code"`
+	RequestID     string         `json:"request_id,omitempty"`
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+}
+
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
 }
 
-func HTTPError(msg string, status int, w http.ResponseWriter) {
-	Error(ErrorMsg{msg}, status, w)
+var statuses = map[apperr.Kind]int{
+	apperr.KindInternal:             http.StatusInternalServerError,
+	apperr.KindInvalid:              http.StatusBadRequest,
+	apperr.KindUnauthenticated:      http.StatusUnauthorized,
+	apperr.KindForbidden:            http.StatusForbidden,
+	apperr.KindNotFound:             http.StatusNotFound,
+	apperr.KindConflict:             http.StatusConflict,
+	apperr.KindRateLimited:          http.StatusTooManyRequests,
+	apperr.KindTooLarge:             http.StatusRequestEntityTooLarge,
+	apperr.KindPreconditionFailed:   http.StatusPreconditionFailed,
+	apperr.KindPreconditionRequired: http.StatusPreconditionRequired,
 }
 
-func Error(msg ErrorMsg, status int, w http.ResponseWriter) {
-	w.WriteHeader(status)
+// Status maps the kind of the error to the HTTP status.
+func Status(e *apperr.Error) int {
+	if e.Code == apperr.CodeValidation {
+		return http.StatusUnprocessableEntity
+	}
 
-	if msg.Detail != "" {
-		w.Header().Add(ContentTypeHeader, JSONContentType)
+	if s, ok := statuses[e.Kind]; ok {
+		return s
+	}
 
-		out, err := json.Marshal(msg)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+	return http.StatusInternalServerError
+}
+
+// NewProblem describes err for the request, errors which aren't *apperr.Error
+// are described as internal ones without details.
+func NewProblem(r *http.Request, err error) Problem {
+	e := apperr.From(err)
+	status := Status(e)
+
+	p := Problem{
+		Type:      problemTypeAboutBlank,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    e.Detail,
+		Instance:  r.URL.Path,
+		Code:      e.Code,
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+
+	for name, reason := range e.Fields {
+		p.InvalidParams = append(p.InvalidParams, InvalidParam{Name: name, Reason: reason})
+	}
+
+	sort.Slice(p.InvalidParams, func(i, j int) bool {
+		return p.InvalidParams[i].Name < p.InvalidParams[j].Name
+	})
+
+	return p
+}
+
+// Error responds with the problem for err.
+func Error(w http.ResponseWriter, r *http.Request, err error) {
+	p := NewProblem(r, err)
 
-		// no need to handle error here
-		_, _ = w.Write(out)
+	out, err := json.Marshal(p)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
+
+	w.Header().Set(ContentTypeHeader, ProblemContentType)
+	w.WriteHeader(p.Status)
+
+	// no need to handle error here
+	_, _ = w.Write(out)
+}
+
+// RequestID sets the id of the request from middleware.RequestID to the
+// response, so clients can refer to it.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := middleware.GetReqID(r.Context()); id != "" {
+			w.Header().Set(RequestIDHeader, id)
+		}
+
+		next.ServeHTTP(w, r)
+	})
 }
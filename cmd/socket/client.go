@@ -2,6 +2,7 @@ package socket
 
 import (
 	"cw1/cmd/auth-api/render"
+	"cw1/internal/apperr"
 	"cw1/internal/robot"
 	"net/http"
 	"time"
@@ -63,7 +64,7 @@ func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request) {
 
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		render.HTTPError("can't open websocket connection", http.StatusInternalServerError, w)
+		render.Error(w, r, apperr.New(apperr.KindInternal, apperr.CodeInternal, "can't open websocket connection"))
 		return
 	}
 
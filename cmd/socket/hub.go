@@ -43,13 +43,18 @@ func (h *Hub) Run() {
 	}
 }
 
+// Broadcast sends the robot to all clients, tags are private to the owner
+// of the robot and aren't sent.
 func (h *Hub) Broadcast(rbt *robot.Robot) {
+	public := *rbt
+	public.Tags = nil
+
 	done := make(chan bool)
 
 	defer close(done)
 
 	go func() {
-		h.broadcast <- rbt
+		h.broadcast <- &public
 		done <- true
 	}()
 
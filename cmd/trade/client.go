@@ -4,7 +4,10 @@ import (
 	"cw1/cmd/socket"
 	"cw1/internal/robot"
 	pb "cw1/internal/streamer"
+	"cw1/internal/webhook"
 	"cw1/pkg/log/logger"
+
+	"github.com/pkg/errors"
 )
 
 type Client struct {
@@ -12,6 +15,7 @@ type Client struct {
 	tickerName   string
 	robotStorage robot.Storage
 	ws           *socket.Hub
+	hooks        *webhook.Dispatcher
 	send         chan *pb.PriceResponse
 	unregister   chan bool
 	isBuying     bool
@@ -61,12 +65,23 @@ func (c *Client) makeTrade(resp *pb.PriceResponse) {
 	}
 
 	if !c.isSelling && !c.isBuying {
-		c.r.FactYield.V.Float64 += c.sellPrice - c.buyPrice
-		c.r.DealsCount.V.Int64++
+		deal := &robot.Deal{
+			RobotID:   c.r.RobotID,
+			BuyPrice:  c.buyPrice,
+			SellPrice: c.sellPrice,
+			Yield:     c.sellPrice - c.buyPrice,
+		}
 
-		err := c.robotStorage.UpdateBesidesActive(c.r)
+		err := c.saveDeal(deal.Yield)
 		if err != nil {
-			c.logger.Errorf("can't update robot with ids: %v", c.r.RobotID)
+			c.logger.Errorf("can't update robot with ids: %v: %v", c.r.RobotID, err)
+		}
+
+		err = c.robotStorage.AddDeal(deal)
+		if err != nil {
+			c.logger.Errorf("can't save deal of robot with id: %v: %v", c.r.RobotID, err)
+		} else {
+			c.notifyDeal(deal)
 		}
 
 		c.ws.Broadcast(c.r)
@@ -74,6 +89,51 @@ func (c *Client) makeTrade(resp *pb.PriceResponse) {
 	}
 }
 
+func (c *Client) notifyDeal(deal *robot.Deal) {
+	if c.hooks == nil {
+		return
+	}
+
+	e, err := webhook.NewEvent(webhook.DealExecuted, c.r.OwnerUserID, webhook.DealData{Robot: c.r, Deal: deal})
+	if err != nil {
+		c.logger.Errorf("can't create deal event of robot with id: %v: %v", c.r.RobotID, err)
+		return
+	}
+
+	if err = c.hooks.Publish(e); err != nil {
+		c.logger.Errorf("can't publish deal event of robot with id: %v: %v", c.r.RobotID, err)
+	}
+}
+
+// saveDeal adds the result of the deal to the robot. When the robot was changed
+// by its owner meanwhile, the deal is added to the fresh version of the robot.
+func (c *Client) saveDeal(yield float64) error {
+	const maxAttempts = 3
+
+	for attempt := 1; ; attempt++ {
+		c.r.FactYield.V.Float64 += yield
+		c.r.FactYield.V.Valid = true
+		c.r.DealsCount.V.Int64++
+		c.r.DealsCount.V.Valid = true
+
+		err := c.robotStorage.UpdateBesidesActive(c.r)
+		if errors.Cause(err) != robot.ErrConflict || attempt == maxAttempts {
+			return err
+		}
+
+		fresh, err := c.robotStorage.FindByID(c.r.RobotID)
+		if err != nil {
+			return errors.Wrapf(err, "can't reload robot with id: %v", c.r.RobotID)
+		}
+
+		if !isValid(fresh) {
+			return errors.Errorf("robot with id: %v can't trade anymore", c.r.RobotID)
+		}
+
+		c.r = fresh
+	}
+}
+
 func isValid(r *robot.Robot) bool {
 	if r.BuyPrice == nil || r.SellPrice == nil ||
 		r.DealsCount == nil || r.FactYield == nil {
@@ -3,11 +3,16 @@ package trade
 import (
 	"context"
 	"cw1/cmd/socket"
+	"cw1/internal/quote"
 	"cw1/internal/robot"
 	pb "cw1/internal/streamer"
+	"cw1/internal/webhook"
 	"cw1/pkg/log/logger"
 	"io"
 	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
 )
 
 type Ticker struct {
@@ -17,6 +22,8 @@ type Ticker struct {
 	name         string
 	robots       []*robot.Robot
 	service      pb.TradingServiceClient
+	quotes       *quote.Book
+	hooks        *webhook.Dispatcher
 	robotStorage robot.Storage
 	ws           *socket.Hub
 	start        chan bool
@@ -40,7 +47,7 @@ func (t *Ticker) run() {
 			go t.makeDeals()
 
 			for _, r := range t.robots {
-				client := initClient(t.name, r, t.robotStorage, t.ws, t.logger)
+				client := initClient(t.name, r, t.robotStorage, t.ws, t.hooks, t.logger)
 				t.ids[r.RobotID] = client
 				t.mu.Lock()
 				t.clients[client] = true
@@ -84,7 +91,7 @@ func (t *Ticker) work(rbts []*robot.Robot) []*Client {
 		for _, r := range rbts {
 			if _, ok := t.ids[r.RobotID]; !ok {
 				t.logger.Infof("Register client with id: %v", r.RobotID)
-				client := initClient(t.name, r, t.robotStorage, t.ws, t.logger)
+				client := initClient(t.name, r, t.robotStorage, t.ws, t.hooks, t.logger)
 				t.mu.Lock()
 				t.clients[client] = true
 				t.mu.Unlock()
@@ -120,12 +127,14 @@ func (t *Ticker) work(rbts []*robot.Robot) []*Client {
 	return toWork
 }
 
-func initClient(name string, r *robot.Robot, rs robot.Storage, ws *socket.Hub, l logger.Logger) *Client {
+func initClient(name string, r *robot.Robot, rs robot.Storage, ws *socket.Hub, hooks *webhook.Dispatcher,
+	l logger.Logger) *Client {
 	c := &Client{
 		r:            r,
 		tickerName:   name,
 		robotStorage: rs,
 		ws:           ws,
+		hooks:        hooks,
 		send:         make(chan *pb.PriceResponse),
 		unregister:   make(chan bool),
 		isBuying:     true,
@@ -156,6 +165,8 @@ func (t *Ticker) makeDeals() {
 			return
 		}
 
+		t.saveQuote(lot)
+
 		t.mu.Lock()
 		for c := range t.clients {
 			c.send <- lot
@@ -163,3 +174,16 @@ func (t *Ticker) makeDeals() {
 		t.mu.Unlock()
 	}
 }
+
+func (t *Ticker) saveQuote(lot *pb.PriceResponse) {
+	if t.quotes == nil {
+		return
+	}
+
+	ts, err := ptypes.Timestamp(lot.GetTs())
+	if err != nil {
+		ts = time.Now()
+	}
+
+	t.quotes.Set(quote.Quote{Ticker: t.name, BuyPrice: lot.GetBuyPrice(), SellPrice: lot.GetSellPrice(), Time: ts})
+}
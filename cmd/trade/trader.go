@@ -2,8 +2,10 @@ package trade
 
 import (
 	"cw1/cmd/socket"
+	"cw1/internal/quote"
 	"cw1/internal/robot"
 	pb "cw1/internal/streamer"
+	"cw1/internal/webhook"
 	"cw1/pkg/log/logger"
 	"time"
 )
@@ -12,6 +14,8 @@ type Trader struct {
 	tickers        map[string]bool
 	tradingService pb.TradingServiceClient
 	robotStorage   robot.Storage
+	quotes         *quote.Book
+	hooks          *webhook.Dispatcher
 	hub            *Hub
 	ws             *socket.Hub
 	logger         logger.Logger
@@ -22,11 +26,16 @@ type tradeInfo struct {
 	robots []*robot.Robot
 }
 
-func New(l logger.Logger, tc pb.TradingServiceClient, rs robot.Storage, ws *socket.Hub) *Trader {
+// New creates the trader, it keeps the latest prices of tickers in quotes
+// and sends deals to webhooks of robot owners.
+func New(l logger.Logger, tc pb.TradingServiceClient, rs robot.Storage, ws *socket.Hub, quotes *quote.Book,
+	hooks *webhook.Dispatcher) *Trader {
 	return &Trader{
 		tickers:        make(map[string]bool),
 		tradingService: tc,
 		robotStorage:   rs,
+		quotes:         quotes,
+		hooks:          hooks,
 		hub:            NewHub(tc, l, rs),
 		ws:             ws,
 		logger:         l,
@@ -73,7 +82,7 @@ func (t *Trader) work(rbtsByTicker map[string][]*robot.Robot) {
 
 		for name, rbts := range rbtsByTicker {
 			if !t.tickers[name] {
-				ticker := initTicker(name, rbts, t.robotStorage, t.ws, t.logger, t.tradingService)
+				ticker := initTicker(name, rbts, t.robotStorage, t.ws, t.logger, t.tradingService, t.quotes, t.hooks)
 				t.tickers[name] = true
 				t.hub.register <- ticker
 			}
@@ -101,13 +110,16 @@ func (t *Trader) work(rbtsByTicker map[string][]*robot.Robot) {
 	<-done
 }
 
-func initTicker(n string, rr []*robot.Robot, rs robot.Storage, ws *socket.Hub, l logger.Logger, s pb.TradingServiceClient) *Ticker {
+func initTicker(n string, rr []*robot.Robot, rs robot.Storage, ws *socket.Hub, l logger.Logger,
+	s pb.TradingServiceClient, q *quote.Book, hooks *webhook.Dispatcher) *Ticker {
 	t := &Ticker{
 		clients:      make(map[*Client]bool),
 		ids:          make(map[int64]*Client),
 		name:         n,
 		robots:       rr,
 		service:      s,
+		quotes:       q,
+		hooks:        hooks,
 		robotStorage: rs,
 		ws:           ws,
 		start:        make(chan bool),
@@ -0,0 +1,125 @@
+package apikey
+
+import (
+	"cw1/internal/format"
+	"cw1/internal/secret"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	ScopeRobotsRead     = "robots:read"
+	ScopeRobotsWrite    = "robots:write"
+	ScopeRobotsActivate = "robots:activate"
+)
+
+// Prefix marks bearer tokens which must be resolved as API keys instead of sessions.
+const Prefix = "ak_"
+
+type APIKey struct {
+	ID         int64            `json:"id"`
+	UserID     int64            `json:"user_id"`
+	Name       string           `json:"name"`
+	Hint       string           `json:"hint"`
+	Hash       string           `json:"-"`
+	Scopes     []string         `json:"scopes"`
+	AllowedIPs []string         `json:"allowed_ips,omitempty"`
+	ExpiresAt  *format.NullTime `json:"expires_at,omitempty"`
+	LastUsedAt *format.NullTime `json:"last_used_at,omitempty"`
+	CreatedAt  *format.NullTime `json:"created_at,omitempty"`
+}
+
+type Storage interface {
+	Create(k *APIKey) error
+	FindByHash(hash string) (*APIKey, error)
+	FindByUserID(userID int64) ([]*APIKey, error)
+	Delete(id int64) error
+	UpdateLastUsed(id int64, t time.Time) error
+}
+
+func IsKnownScope(scope string) bool {
+	switch scope {
+	case ScopeRobotsRead, ScopeRobotsWrite, ScopeRobotsActivate:
+		return true
+	default:
+		return false
+	}
+}
+
+func IsKey(token string) bool {
+	return strings.HasPrefix(token, Prefix)
+}
+
+// Generate returns a new plain key which is shown to the user only once.
+func Generate() (string, error) {
+	s, err := secret.Generate()
+	if err != nil {
+		return "", err
+	}
+
+	return Prefix + s, nil
+}
+
+func Hash(key string) string {
+	return secret.Hash(key)
+}
+
+// HintFor returns the part of the key which is safe to show in listings.
+func HintFor(key string) string {
+	const Visible = 4
+
+	if len(key) <= len(Prefix)+Visible {
+		return key
+	}
+
+	return key[:len(Prefix)+Visible] + "..."
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (k *APIKey) IsExpired(now time.Time) bool {
+	if k.ExpiresAt == nil || !k.ExpiresAt.V.Valid {
+		return false
+	}
+
+	return now.After(k.ExpiresAt.V.Time)
+}
+
+// AllowsIP reports whether the key can be used from ip. Allowlist entries are plain
+// addresses or CIDR blocks, an empty allowlist allows any address.
+func (k *APIKey) AllowsIP(ip string) bool {
+	if len(k.AllowedIPs) == 0 {
+		return true
+	}
+
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+
+	for _, a := range k.AllowedIPs {
+		if strings.Contains(a, "/") {
+			_, network, err := net.ParseCIDR(a)
+			if err == nil && network.Contains(addr) {
+				return true
+			}
+
+			continue
+		}
+
+		if allowed := net.ParseIP(a); allowed != nil && allowed.Equal(addr) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,85 @@
+// Package apperr describes errors which can be shown to API clients. Every
+// error has a kind, which transports map to their statuses, and a stable code
+// which clients can rely on.
+package apperr
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindInvalid
+	KindUnauthenticated
+	KindForbidden
+	KindNotFound
+	KindConflict
+	KindRateLimited
+	KindTooLarge
+	KindPreconditionFailed
+	KindPreconditionRequired
+)
+
+// Codes shared by several resources.
+const (
+	CodeInternal         = "internal"
+	CodeMalformedRequest = "malformed_request"
+	CodeValidation       = "validation_failed"
+	CodeUnauthenticated  = "unauthenticated"
+	CodeForbidden        = "forbidden"
+	CodeRateLimited      = "rate_limited"
+	CodeTooLarge         = "request_too_large"
+	CodePrecondition     = "precondition_failed"
+	CodeNoPrecondition   = "precondition_required"
+)
+
+type Error struct {
+	Kind   Kind
+	Code   string
+	Detail string
+	// Fields holds messages for incorrect fields of the request.
+	Fields map[string]string
+}
+
+func (e *Error) Error() string {
+	if e.Detail == "" {
+		return e.Code
+	}
+
+	return e.Code + ": " + e.Detail
+}
+
+func New(kind Kind, code string, detail string) *Error {
+	return &Error{Kind: kind, Code: code, Detail: detail}
+}
+
+func Newf(kind Kind, code string, format string, args ...interface{}) *Error {
+	return New(kind, code, fmt.Sprintf(format, args...))
+}
+
+func Validation(fields map[string]string) *Error {
+	return &Error{Kind: KindInvalid, Code: CodeValidation, Detail: "request has incorrect fields", Fields: fields}
+}
+
+// From returns the first *Error in the chain of err, errors of other types
+// are internal and their text isn't shown to clients.
+func From(err error) *Error {
+	var e *Error
+
+	if err != nil && errors.As(err, &e) {
+		return e
+	}
+
+	return New(KindInternal, CodeInternal, "")
+}
+
+// HasCode reports whether err is an *Error with the code.
+func HasCode(err error, code string) bool {
+	var e *Error
+
+	return errors.As(err, &e) && e.Code == code
+}
@@ -0,0 +1,186 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	SignIn          = "user.signin"
+	SignInFailed    = "user.signin_failed"
+	UpdateUser      = "user.update"
+	ExportUser      = "user.export"
+	DeleteUser      = "user.delete"
+	CreateRobot     = "robot.create"
+	UpdateRobot     = "robot.update"
+	DeleteRobot     = "robot.delete"
+	FavouriteRobot  = "robot.favourite" //nolint: misspell
+	ActivateRobot   = "robot.activate"
+	DeactivateRobot = "robot.deactivate"
+	FollowRobot     = "robot.follow"
+	UnfollowRobot   = "robot.unfollow"
+	ForkRobot       = "robot.fork"
+	RevertRobot     = "robot.revert"
+	RestoreRobot    = "robot.restore"
+	ScheduleRobot   = "robot.schedule"
+	UnscheduleRobot = "robot.unschedule"
+)
+
+const (
+	TargetUser  = "user"
+	TargetRobot = "robot"
+)
+
+// Redacted replaces values which must not be written to the log.
+const Redacted = "[redacted]"
+
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Entry is a record of the append-only log. Every entry is chained to the
+// previous one by PrevHash, so a changed or removed entry breaks the chain.
+type Entry struct {
+	ID         int64             `json:"id"`
+	ActorID    int64             `json:"actor_id"`
+	Action     string            `json:"action"`
+	TargetType string            `json:"target_type"`
+	TargetID   int64             `json:"target_id"`
+	IP         string            `json:"ip"`
+	UserAgent  string            `json:"user_agent"`
+	Diff       map[string]Change `json:"diff,omitempty"`
+	PrevHash   string            `json:"prev_hash"`
+	Hash       string            `json:"hash"`
+	CreatedAt  time.Time         `json:"created_at"`
+}
+
+type Filter struct {
+	// UserID limits entries to the ones where the user is the actor or the target,
+	// zero means all entries.
+	UserID int64
+	// Limit is the maximum number of entries, zero means no limit.
+	Limit int
+}
+
+type Storage interface {
+	// Append links the entry to the last one and stores it.
+	Append(e *Entry) error
+	// Find returns the newest entries first.
+	Find(f Filter) ([]*Entry, error)
+}
+
+// ComputeHash returns the hash of the entry content together with PrevHash.
+func (e *Entry) ComputeHash() (string, error) {
+	content := struct {
+		PrevHash   string            `json:"prev_hash"`
+		ActorID    int64             `json:"actor_id"`
+		Action     string            `json:"action"`
+		TargetType string            `json:"target_type"`
+		TargetID   int64             `json:"target_id"`
+		IP         string            `json:"ip"`
+		UserAgent  string            `json:"user_agent"`
+		Diff       map[string]Change `json:"diff"`
+		CreatedAt  string            `json:"created_at"`
+	}{
+		PrevHash:   e.PrevHash,
+		ActorID:    e.ActorID,
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		IP:         e.IP,
+		UserAgent:  e.UserAgent,
+		Diff:       e.Diff,
+		CreatedAt:  e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+
+	b, err := json.Marshal(content)
+	if err != nil {
+		return "", errors.Wrap(err, "can't marshal audit entry")
+	}
+
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Verify checks hashes of the entries and links between them, entries must
+// go in the order they were appended without gaps.
+func Verify(entries []*Entry) error {
+	for i, e := range entries {
+		hash, err := e.ComputeHash()
+		if err != nil {
+			return err
+		}
+
+		if hash != e.Hash {
+			return errors.Errorf("audit entry with id: %v was changed", e.ID)
+		}
+
+		if i > 0 && e.PrevHash != entries[i-1].Hash {
+			return errors.Errorf("audit entry with id: %v isn't linked to entry with id: %v",
+				e.ID, entries[i-1].ID)
+		}
+	}
+
+	return nil
+}
+
+// Diff returns fields of JSON representations of before and after which differ,
+// nil before or after means the object was created or deleted.
+func Diff(before interface{}, after interface{}) (map[string]Change, error) {
+	b, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := make(map[string]Change)
+
+	for k, v := range b {
+		if !reflect.DeepEqual(v, a[k]) {
+			diff[k] = Change{Before: v, After: a[k]}
+		}
+	}
+
+	for k, v := range a {
+		if _, ok := b[k]; !ok && v != nil {
+			diff[k] = Change{After: v}
+		}
+	}
+
+	return diff, nil
+}
+
+func fields(v interface{}) (map[string]interface{}, error) {
+	res := make(map[string]interface{})
+
+	if v == nil {
+		return res, nil
+	}
+
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return res, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't marshal object for diff")
+	}
+
+	err = json.Unmarshal(b, &res)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't unmarshal object for diff")
+	}
+
+	return res, nil
+}
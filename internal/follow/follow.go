@@ -0,0 +1,83 @@
+package follow
+
+import (
+	"bytes"
+	"cw1/internal/format"
+	"cw1/internal/robot"
+	"encoding/json"
+)
+
+// Modes of following, in ModeAuto changes of the parent are applied to the copy
+// at once, in ModeApprove they wait for the owner of the copy.
+const (
+	ModeAuto    = "auto"
+	ModeApprove = "approve"
+)
+
+func IsMode(m string) bool {
+	return m == ModeAuto || m == ModeApprove
+}
+
+// Follow links the copy of a robot to its parent. SyncActivation makes the copy
+// activate and deactivate together with the parent.
+type Follow struct {
+	RobotID        int64            `json:"robot_id"`
+	ParentRobotID  int64            `json:"parent_robot_id"`
+	UserID         int64            `json:"user_id"`
+	Mode           string           `json:"mode"`
+	SyncActivation bool             `json:"sync_activation"`
+	Pending        *Params          `json:"pending,omitempty"`
+	CreatedAt      *format.NullTime `json:"created_at,omitempty"`
+}
+
+// Params are the parameters of the parent robot which followers mirror.
+type Params struct {
+	BuyPrice  *format.NullFloat64 `json:"buy_price,omitempty"`
+	SellPrice *format.NullFloat64 `json:"sell_price,omitempty"`
+	PlanStart *format.NullTime    `json:"plan_start,omitempty"`
+	PlanEnd   *format.NullTime    `json:"plan_end,omitempty"`
+	PlanYield *format.NullFloat64 `json:"plan_yield,omitempty"`
+}
+
+func ParamsOf(r *robot.Robot) *Params {
+	return &Params{
+		BuyPrice:  r.BuyPrice,
+		SellPrice: r.SellPrice,
+		PlanStart: r.PlanStart,
+		PlanEnd:   r.PlanEnd,
+		PlanYield: r.PlanYield,
+	}
+}
+
+func (p *Params) Apply(r *robot.Robot) {
+	r.BuyPrice = p.BuyPrice
+	r.SellPrice = p.SellPrice
+	r.PlanStart = p.PlanStart
+	r.PlanEnd = p.PlanEnd
+	r.PlanYield = p.PlanYield
+}
+
+// Equal compares parameters the way clients see them.
+func (p *Params) Equal(o *Params) bool {
+	a, err := json.Marshal(p)
+	if err != nil {
+		return false
+	}
+
+	b, err := json.Marshal(o)
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(a, b)
+}
+
+type Storage interface {
+	// Create starts following or replaces the settings of the existing follow.
+	Create(f *Follow) error
+	// FindByRobotID returns the follow of the copy, RobotID is zero when the copy doesn't follow.
+	FindByRobotID(robotID int64) (*Follow, error)
+	FindByParentID(parentID int64) ([]*Follow, error)
+	Update(f *Follow) error
+	Delete(robotID int64) error
+}
@@ -0,0 +1,75 @@
+package leaderboard
+
+import (
+	"cw1/pkg/log/logger"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Cache keeps entries of every period, so requests don't aggregate deals.
+// Entries are replaced by Refresh, until the first one boards are empty.
+type Cache struct {
+	storage Storage
+	logger  logger.Logger
+
+	mu        sync.RWMutex
+	entries   map[string][]Entry
+	updatedAt time.Time
+}
+
+func NewCache(s Storage, l logger.Logger) *Cache {
+	return &Cache{
+		storage: s,
+		logger:  l,
+		entries: make(map[string][]Entry),
+	}
+}
+
+func (c *Cache) Refresh() error {
+	now := time.Now().UTC()
+	entries := make(map[string][]Entry, len(Periods))
+
+	for _, p := range Periods {
+		e, err := c.storage.Compute(Since(p, now))
+		if err != nil {
+			return errors.Wrapf(err, "can't compute leaderboard for period: %v", p)
+		}
+
+		entries[p] = e
+	}
+
+	c.mu.Lock()
+	c.entries = entries
+	c.updatedAt = now
+	c.mu.Unlock()
+
+	return nil
+}
+
+// Run refreshes the cache at once and then every interval until quit is closed.
+func (c *Cache) Run(quit <-chan bool, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		if err := c.Refresh(); err != nil {
+			c.logger.Errorf("can't refresh leaderboard: %v", err)
+		}
+
+		select {
+		case <-tick.C:
+		case <-quit:
+			return
+		}
+	}
+}
+
+// Board returns the best robots of the period and the time they were computed at.
+func (c *Cache) Board(period string, rank string, limit int) ([]Entry, time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return Ranked(c.entries[period], rank, limit), c.updatedAt
+}
@@ -0,0 +1,119 @@
+package leaderboard
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Periods robots are ranked over, deals made before the start of the period aren't counted.
+const (
+	PeriodDay   = "day"
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+	PeriodAll   = "all"
+)
+
+var Periods = []string{PeriodDay, PeriodWeek, PeriodMonth, PeriodAll}
+
+func IsPeriod(p string) bool {
+	for _, v := range Periods {
+		if v == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Since returns the start of the period ending at now, it's zero for all time.
+func Since(period string, now time.Time) time.Time {
+	switch period {
+	case PeriodDay:
+		return now.AddDate(0, 0, -1)
+	case PeriodWeek:
+		return now.AddDate(0, 0, -7)
+	case PeriodMonth:
+		return now.AddDate(0, -1, 0)
+	default:
+		return time.Time{}
+	}
+}
+
+// Metrics robots are ranked by, the best robot has the greatest value.
+const (
+	RankYield     = "yield"
+	RankPlanRatio = "plan_ratio"
+	RankDeals     = "deals"
+	RankWinRate   = "win_rate"
+)
+
+func IsRank(r string) bool {
+	switch r {
+	case RankYield, RankPlanRatio, RankDeals, RankWinRate:
+		return true
+	default:
+		return false
+	}
+}
+
+// Entry is the performance of a public robot over the period. PlanRatio is the
+// realized yield divided by the plan one, it's nil when the plan isn't set.
+type Entry struct {
+	Rank        int      `json:"rank"`
+	RobotID     int64    `json:"robot_id"`
+	OwnerUserID int64    `json:"owner_user_id"`
+	Ticker      string   `json:"ticker"`
+	Yield       float64  `json:"yield"`
+	PlanRatio   *float64 `json:"plan_ratio,omitempty"`
+	Deals       int64    `json:"deals"`
+	WinRate     float64  `json:"win_rate"`
+}
+
+type Storage interface {
+	// Compute returns entries of public robots which made deals since the time.
+	Compute(since time.Time) ([]Entry, error)
+}
+
+// Ranked returns a copy of entries ordered by the metric with ranks set,
+// robots with equal values are ordered by id.
+func Ranked(entries []Entry, rank string, limit int) []Entry {
+	res := make([]Entry, len(entries))
+	copy(res, entries)
+
+	sort.SliceStable(res, func(i, j int) bool {
+		a, b := value(res[i], rank), value(res[j], rank)
+		if a != b {
+			return a > b
+		}
+
+		return res[i].RobotID < res[j].RobotID
+	})
+
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+
+	for i := range res {
+		res[i].Rank = i + 1
+	}
+
+	return res
+}
+
+func value(e Entry, rank string) float64 {
+	switch rank {
+	case RankPlanRatio:
+		if e.PlanRatio == nil {
+			return math.Inf(-1)
+		}
+
+		return *e.PlanRatio
+	case RankDeals:
+		return float64(e.Deals)
+	case RankWinRate:
+		return e.WinRate
+	default:
+		return e.Yield
+	}
+}
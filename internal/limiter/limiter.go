@@ -0,0 +1,134 @@
+package limiter
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Store keeps counters of the limiter. It is shared by all instances of the
+// service when backed by a database.
+type Store interface {
+	// Hit counts an attempt in the fixed window which starts with the first
+	// attempt and returns the number of attempts and the end of the window.
+	Hit(key string, window time.Duration, now time.Time) (int, time.Time, error)
+	// Fail counts a consecutive failure and returns the number of failures.
+	Fail(key string, now time.Time) (int, error)
+	Lock(key string, until time.Time) error
+	// LockedUntil returns the end of the lock or zero time.
+	LockedUntil(key string) (time.Time, error)
+	// Reset forgets failures and the lock of the key.
+	Reset(key string) error
+}
+
+type Config struct {
+	// Attempts is the number of attempts allowed in Window.
+	Attempts int
+	Window   time.Duration
+	// Failures is the number of consecutive failures after which the key is locked.
+	Failures int
+	// Lockout is the first lock duration, it doubles with every next failure up to MaxLockout.
+	Lockout    time.Duration
+	MaxLockout time.Duration
+}
+
+func DefaultConfig() Config {
+	const (
+		attempts = 10
+		failures = 5
+	)
+
+	return Config{
+		Attempts:   attempts,
+		Window:     time.Minute,
+		Failures:   failures,
+		Lockout:    time.Minute,
+		MaxLockout: time.Hour,
+	}
+}
+
+type Limiter struct {
+	store  Store
+	config Config
+	now    func() time.Time
+}
+
+func New(s Store, c Config) *Limiter {
+	return &Limiter{store: s, config: c, now: time.Now}
+}
+
+// Allow counts an attempt and returns how long to wait when the limit is exceeded.
+func (l *Limiter) Allow(key string) (time.Duration, error) {
+	now := l.now()
+
+	count, end, err := l.store.Hit(key, l.config.Window, now)
+	if err != nil {
+		return 0, errors.Wrapf(err, "can't count attempt for %v", key)
+	}
+
+	if count > l.config.Attempts {
+		return end.Sub(now), nil
+	}
+
+	return 0, nil
+}
+
+// Locked returns how long the key stays locked.
+func (l *Limiter) Locked(key string) (time.Duration, error) {
+	until, err := l.store.LockedUntil(key)
+	if err != nil {
+		return 0, errors.Wrapf(err, "can't get lock of %v", key)
+	}
+
+	if wait := until.Sub(l.now()); wait > 0 {
+		return wait, nil
+	}
+
+	return 0, nil
+}
+
+// Failed counts a failure and locks the key when there are too many of them.
+// It returns the duration of the new lock.
+func (l *Limiter) Failed(key string) (time.Duration, error) {
+	now := l.now()
+
+	failures, err := l.store.Fail(key, now)
+	if err != nil {
+		return 0, errors.Wrapf(err, "can't count failure for %v", key)
+	}
+
+	if failures < l.config.Failures {
+		return 0, nil
+	}
+
+	lockout := l.lockout(failures - l.config.Failures)
+
+	err = l.store.Lock(key, now.Add(lockout))
+	if err != nil {
+		return 0, errors.Wrapf(err, "can't lock %v", key)
+	}
+
+	return lockout, nil
+}
+
+func (l *Limiter) Succeeded(key string) error {
+	if err := l.store.Reset(key); err != nil {
+		return errors.Wrapf(err, "can't reset %v", key)
+	}
+
+	return nil
+}
+
+func (l *Limiter) lockout(extra int) time.Duration {
+	d := l.config.Lockout
+
+	for i := 0; i < extra && d < l.config.MaxLockout; i++ {
+		d *= 2
+	}
+
+	if d > l.config.MaxLockout {
+		return l.config.MaxLockout
+	}
+
+	return d
+}
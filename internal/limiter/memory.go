@@ -0,0 +1,131 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// sweepInterval is how often expired entries are removed, so the store
+	// doesn't keep every key it has seen.
+	sweepInterval = time.Minute
+	// failureRetention is how long consecutive failures of an unlocked key are
+	// remembered after the last one.
+	failureRetention = 24 * time.Hour
+)
+
+type entry struct {
+	windowEnd   time.Time
+	hits        int
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// expired reports whether the window, the lock and the failures of the entry
+// are over, so forgetting it changes nothing.
+func (e *entry) expired(now time.Time) bool {
+	return !now.Before(e.windowEnd) && !now.Before(e.lockedUntil) &&
+		!now.Before(e.lastFailure.Add(failureRetention))
+}
+
+// MemoryStore keeps counters of a single instance of the service.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*entry
+	nextSweep time.Time
+}
+
+var _ Store = &MemoryStore{}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*entry)}
+}
+
+func (s *MemoryStore) get(key string) *entry {
+	e, ok := s.entries[key]
+	if !ok {
+		e = &entry{}
+		s.entries[key] = e
+	}
+
+	return e
+}
+
+// sweep removes expired entries at most once per sweepInterval.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+
+	s.nextSweep = now.Add(sweepInterval)
+
+	for key, e := range s.entries {
+		if e.expired(now) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func (s *MemoryStore) Hit(key string, window time.Duration, now time.Time) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	e := s.get(key)
+
+	if !now.Before(e.windowEnd) {
+		e.windowEnd = now.Add(window)
+		e.hits = 0
+	}
+
+	e.hits++
+
+	return e.hits, e.windowEnd, nil
+}
+
+func (s *MemoryStore) Fail(key string, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	e := s.get(key)
+	e.failures++
+	e.lastFailure = now
+
+	return e.failures, nil
+}
+
+func (s *MemoryStore) Lock(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.get(key).lockedUntil = until
+
+	return nil
+}
+
+func (s *MemoryStore) LockedUntil(key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		return e.lockedUntil, nil
+	}
+
+	return time.Time{}, nil
+}
+
+func (s *MemoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		e.failures = 0
+		e.lockedUntil = time.Time{}
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package mail
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Sender interface {
+	Send(m *Message) error
+}
+
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	From     string
+}
+
+type SMTPSender struct {
+	config SMTPConfig
+}
+
+var _ Sender = &SMTPSender{}
+
+func NewSMTPSender(c SMTPConfig) *SMTPSender {
+	return &SMTPSender{config: c}
+}
+
+func (s *SMTPSender) Send(m *Message) error {
+	addr := net.JoinHostPort(s.config.Host, s.config.Port)
+
+	var auth smtp.Auth
+	if s.config.User != "" {
+		auth = smtp.PlainAuth("", s.config.User, s.config.Password, s.config.Host)
+	}
+
+	err := smtp.SendMail(addr, auth, s.config.From, []string{m.To}, format(s.config.From, m))
+	if err != nil {
+		return errors.Wrapf(err, "can't send mail to %v", m.To)
+	}
+
+	return nil
+}
+
+// FileSender writes messages instead of sending them, it is used for local
+// development and tests.
+type FileSender struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+var _ Sender = &FileSender{}
+
+func NewFileSender(w io.Writer) *FileSender {
+	return &FileSender{w: w}
+}
+
+func (s *FileSender) Send(m *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.w.Write(append(format("noreply@localhost", m), '\n'))
+	if err != nil {
+		return errors.Wrapf(err, "can't write mail to %v", m.To)
+	}
+
+	return nil
+}
+
+func format(from string, m *Message) []byte {
+	headers := []string{
+		fmt.Sprintf("From: %s", from),
+		fmt.Sprintf("To: %s", m.To),
+		fmt.Sprintf("Subject: %s", m.Subject),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=\"utf-8\"",
+	}
+
+	return []byte(strings.Join(headers, "\r\n") + "\r\n\r\n" + m.Body + "\r\n")
+}
@@ -0,0 +1,298 @@
+package password
+
+// common holds the most used passwords from public breaches, they are
+// rejected regardless of their length.
+var common = map[string]struct{}{
+	"0000":          {},
+	"000000":        {},
+	"00000000":      {},
+	"0987654321":    {},
+	"1111":          {},
+	"11111":         {},
+	"111111":        {},
+	"11111111":      {},
+	"1111111111":    {},
+	"112233":        {},
+	"11223344":      {},
+	"121212":        {},
+	"12121212":      {},
+	"123123":        {},
+	"123123123":     {},
+	"123321":        {},
+	"1234":          {},
+	"12341234":      {},
+	"12344321":      {},
+	"12345":         {},
+	"123456":        {},
+	"1234567":       {},
+	"12345678":      {},
+	"123456789":     {},
+	"1234567890":    {},
+	"1234qwer":      {},
+	"123654":        {},
+	"123qwe":        {},
+	"131313":        {},
+	"159753":        {},
+	"1q2w3e4r":      {},
+	"1q2w3e4r5t":    {},
+	"1qaz2wsx":      {},
+	"1qazxsw2":      {},
+	"2000":          {},
+	"222222":        {},
+	"232323":        {},
+	"333333":        {},
+	"555555":        {},
+	"654321":        {},
+	"666666":        {},
+	"66666666":      {},
+	"696969":        {},
+	"777777":        {},
+	"7777777":       {},
+	"8675309":       {},
+	"87654321":      {},
+	"888888":        {},
+	"88888888":      {},
+	"987654":        {},
+	"987654321":     {},
+	"999999":        {},
+	"99999999":      {},
+	"aaaaaa":        {},
+	"aaaaaaaa":      {},
+	"abc123":        {},
+	"abc12345":      {},
+	"abcd1234":      {},
+	"access":        {},
+	"adidas":        {},
+	"admin":         {},
+	"administrator": {},
+	"amanda":        {},
+	"andrea":        {},
+	"andrew":        {},
+	"angel":         {},
+	"anthony":       {},
+	"arsenal":       {},
+	"asdf1234":      {},
+	"asdfasdf":      {},
+	"asdfgh":        {},
+	"asdfghjk":      {},
+	"ashley":        {},
+	"austin":        {},
+	"badboy":        {},
+	"bailey":        {},
+	"banana":        {},
+	"barney":        {},
+	"baseball":      {},
+	"baseball1":     {},
+	"batman":        {},
+	"batman123":     {},
+	"bigdaddy":      {},
+	"bigdog":        {},
+	"booboo":        {},
+	"boomer":        {},
+	"boston":        {},
+	"brandon":       {},
+	"brandy":        {},
+	"bulldog":       {},
+	"buster":        {},
+	"camaro":        {},
+	"casper":        {},
+	"changeme":      {},
+	"charles":       {},
+	"charlie":       {},
+	"cheese":        {},
+	"chelsea":       {},
+	"chester":       {},
+	"chicago":       {},
+	"chicken":       {},
+	"chris":         {},
+	"cocacola":      {},
+	"coffee":        {},
+	"compaq":        {},
+	"computer":      {},
+	"cookie":        {},
+	"corvette":      {},
+	"cowboy":        {},
+	"cowboys":       {},
+	"crystal":       {},
+	"dakota":        {},
+	"dallas":        {},
+	"daniel":        {},
+	"default":       {},
+	"diablo":        {},
+	"diamond":       {},
+	"dragon":        {},
+	"dragon123":     {},
+	"eagles":        {},
+	"edward":        {},
+	"enter":         {},
+	"falcon":        {},
+	"fender":        {},
+	"ferrari":       {},
+	"fishing":       {},
+	"flower":        {},
+	"football":      {},
+	"football1":     {},
+	"forever":       {},
+	"freedom":       {},
+	"gandalf":       {},
+	"gateway":       {},
+	"george":        {},
+	"gfhjkm":        {},
+	"ghbdtn":        {},
+	"ginger":        {},
+	"golden":        {},
+	"golfer":        {},
+	"guitar":        {},
+	"hammer":        {},
+	"hannah":        {},
+	"harley":        {},
+	"heather":       {},
+	"hello":         {},
+	"hockey":        {},
+	"hunter":        {},
+	"hunter2":       {},
+	"iceman":        {},
+	"iloveyou":      {},
+	"iloveyou1":     {},
+	"internet":      {},
+	"jackson":       {},
+	"james":         {},
+	"jasmine":       {},
+	"jasper":        {},
+	"jennifer":      {},
+	"jessica":       {},
+	"johnny":        {},
+	"jordan":        {},
+	"joseph":        {},
+	"joshua":        {},
+	"junior":        {},
+	"justin":        {},
+	"killer":        {},
+	"klaster":       {},
+	"knight":        {},
+	"lakers":        {},
+	"letmein":       {},
+	"letmein1":      {},
+	"login":         {},
+	"london":        {},
+	"love":          {},
+	"maggie":        {},
+	"marina":        {},
+	"marine":        {},
+	"marlboro":      {},
+	"martin":        {},
+	"master":        {},
+	"master123":     {},
+	"matrix":        {},
+	"matthew":       {},
+	"maverick":      {},
+	"melissa":       {},
+	"mercedes":      {},
+	"merlin":        {},
+	"michael":       {},
+	"michelle":      {},
+	"mickey":        {},
+	"midnight":      {},
+	"miller":        {},
+	"minecraft":     {},
+	"money":         {},
+	"monkey":        {},
+	"monkey123":     {},
+	"monster":       {},
+	"morgan":        {},
+	"mother":        {},
+	"mustang":       {},
+	"nascar":        {},
+	"natasha":       {},
+	"ncc1701":       {},
+	"nicole":        {},
+	"nikita":        {},
+	"oliver":        {},
+	"orange":        {},
+	"p@ssw0rd":      {},
+	"p@ssword":      {},
+	"pa55word":      {},
+	"pass":          {},
+	"passpass":      {},
+	"passw0rd":      {},
+	"password":      {},
+	"password1":     {},
+	"password12":    {},
+	"password123":   {},
+	"patrick":       {},
+	"peanut":        {},
+	"pepper":        {},
+	"phoenix":       {},
+	"player":        {},
+	"please":        {},
+	"porsche":       {},
+	"prince":        {},
+	"princess":      {},
+	"princess1":     {},
+	"purple":        {},
+	"q1w2e3r4":      {},
+	"q1w2e3r4t5":    {},
+	"qazwsx":        {},
+	"qwe123":        {},
+	"qwer1234":      {},
+	"qwerty":        {},
+	"qwerty12":      {},
+	"qwerty123":     {},
+	"qwertyui":      {},
+	"qwertyuiop":    {},
+	"rabbit":        {},
+	"rachel":        {},
+	"raiders":       {},
+	"ranger":        {},
+	"rangers":       {},
+	"redsox":        {},
+	"richard":       {},
+	"robert":        {},
+	"samantha":      {},
+	"samsung":       {},
+	"scooby":        {},
+	"scooter":       {},
+	"secret":        {},
+	"shadow":        {},
+	"silver":        {},
+	"slayer":        {},
+	"smokey":        {},
+	"snoopy":        {},
+	"soccer":        {},
+	"sparky":        {},
+	"spider":        {},
+	"starwars":      {},
+	"steelers":      {},
+	"steven":        {},
+	"summer":        {},
+	"sunshine":      {},
+	"sunshine1":     {},
+	"superman":      {},
+	"superman1":     {},
+	"taylor":        {},
+	"tennis":        {},
+	"test":          {},
+	"thomas":        {},
+	"thunder":       {},
+	"tigers":        {},
+	"tigger":        {},
+	"trustno1":      {},
+	"trustno11":     {},
+	"victoria":      {},
+	"welcome":       {},
+	"welcome1":      {},
+	"welcome123":    {},
+	"whatever":      {},
+	"william":       {},
+	"winner":        {},
+	"winter":        {},
+	"wizard":        {},
+	"xxxxxx":        {},
+	"yamaha":        {},
+	"yankees":       {},
+	"yellow":        {},
+	"zaq12wsx":      {},
+	"zxcvbn":        {},
+	"zxcvbnm":       {},
+	"zxcvbnm1":      {},
+}
@@ -0,0 +1,198 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	Bcrypt   = "bcrypt"
+	Argon2id = "argon2id"
+)
+
+var encoding = base64.RawStdEncoding
+
+// Config describes how new hashes are created. Hashes of any supported
+// algorithm can be verified, they carry their own parameters.
+type Config struct {
+	Algorithm  string
+	BcryptCost int
+	// Argon2Memory is the memory used by argon2id in KiB.
+	Argon2Memory  uint32
+	Argon2Time    uint32
+	Argon2Threads uint8
+	Argon2SaltLen uint32
+	Argon2KeyLen  uint32
+}
+
+func DefaultConfig() Config {
+	const (
+		bcryptCost = 12
+		memory     = 19 * 1024
+		iterations = 2
+		saltLen    = 16
+		keyLen     = 32
+	)
+
+	return Config{
+		Algorithm:     Argon2id,
+		BcryptCost:    bcryptCost,
+		Argon2Memory:  memory,
+		Argon2Time:    iterations,
+		Argon2Threads: 1,
+		Argon2SaltLen: saltLen,
+		Argon2KeyLen:  keyLen,
+	}
+}
+
+type Hasher struct {
+	config Config
+}
+
+func New(c Config) (*Hasher, error) {
+	switch c.Algorithm {
+	case Bcrypt:
+		if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+			return nil, errors.Errorf("incorrect bcrypt cost: %v", c.BcryptCost)
+		}
+	case Argon2id:
+		if c.Argon2Memory == 0 || c.Argon2Time == 0 || c.Argon2Threads == 0 ||
+			c.Argon2SaltLen == 0 || c.Argon2KeyLen == 0 {
+			return nil, errors.New("argon2id parameters must be positive")
+		}
+	default:
+		return nil, errors.Errorf("unknown password hashing algorithm: %v", c.Algorithm)
+	}
+
+	return &Hasher{config: c}, nil
+}
+
+func (h *Hasher) Hash(pwd string) (string, error) {
+	if h.config.Algorithm == Bcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(pwd), h.config.BcryptCost)
+		if err != nil {
+			return "", errors.Wrap(err, "can't generate bcrypt hash")
+		}
+
+		return string(hash), nil
+	}
+
+	salt := make([]byte, h.config.Argon2SaltLen)
+
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", errors.Wrap(err, "can't generate salt")
+	}
+
+	p := argon2Params{
+		memory:  h.config.Argon2Memory,
+		time:    h.config.Argon2Time,
+		threads: h.config.Argon2Threads,
+	}
+
+	key := argon2.IDKey([]byte(pwd), salt, p.time, p.memory, p.threads, h.config.Argon2KeyLen)
+
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", Argon2id, argon2.Version,
+		p.memory, p.time, p.threads, encoding.EncodeToString(salt), encoding.EncodeToString(key)), nil
+}
+
+// Verify reports whether pwd matches the hash made by any supported algorithm.
+func (h *Hasher) Verify(hash string, pwd string) (bool, error) {
+	if isArgon2id(hash) {
+		p, salt, key, err := parseArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+
+		other := argon2.IDKey([]byte(pwd), salt, p.time, p.memory, p.threads, uint32(len(key)))
+
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(pwd))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, errors.Wrap(err, "can't compare bcrypt hash")
+	}
+
+	return true, nil
+}
+
+// NeedsRehash reports whether the hash was made by another algorithm or with
+// other parameters than the configured ones.
+func (h *Hasher) NeedsRehash(hash string) bool {
+	if h.config.Algorithm == Bcrypt {
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != h.config.BcryptCost
+	}
+
+	if !isArgon2id(hash) {
+		return true
+	}
+
+	p, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return p.memory != h.config.Argon2Memory || p.time != h.config.Argon2Time ||
+		p.threads != h.config.Argon2Threads || uint32(len(salt)) != h.config.Argon2SaltLen ||
+		uint32(len(key)) != h.config.Argon2KeyLen
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+func isArgon2id(hash string) bool {
+	return strings.HasPrefix(hash, "$"+Argon2id+"$")
+}
+
+// parseArgon2id parses hashes in the PHC string format:
+// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>.
+func parseArgon2id(hash string) (argon2Params, []byte, []byte, error) {
+	const Parts = 6
+
+	var p argon2Params
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != Parts {
+		return p, nil, nil, errors.New("incorrect format of argon2id hash")
+	}
+
+	var version int
+
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return p, nil, nil, errors.Errorf("unsupported argon2 version: %v", parts[2])
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads)
+	if err != nil {
+		return p, nil, nil, errors.Wrap(err, "can't parse argon2id parameters")
+	}
+
+	salt, err := encoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, errors.Wrap(err, "can't decode argon2id salt")
+	}
+
+	key, err := encoding.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, errors.Wrap(err, "can't decode argon2id key")
+	}
+
+	return p, salt, key, nil
+}
@@ -0,0 +1,48 @@
+package password
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+type Policy struct {
+	MinLength int
+	// MaxLength bounds the work of hashing, zero means no limit.
+	MaxLength int
+}
+
+func DefaultPolicy() Policy {
+	const (
+		minLength = 8
+		maxLength = 72 // bcrypt ignores the rest of the password
+	)
+
+	return Policy{MinLength: minLength, MaxLength: maxLength}
+}
+
+// Validate returns an error which is safe to show to the user.
+func (p Policy) Validate(pwd string) error {
+	n := utf8.RuneCountInString(pwd)
+
+	if n < p.MinLength {
+		return errors.Errorf("password must be at least %d characters long", p.MinLength)
+	}
+
+	if p.MaxLength > 0 && len(pwd) > p.MaxLength {
+		return errors.Errorf("password must be at most %d bytes long", p.MaxLength)
+	}
+
+	if IsCommon(pwd) {
+		return errors.New("password is too common")
+	}
+
+	return nil
+}
+
+// IsCommon reports whether the password is in the bundled list of common passwords.
+func IsCommon(pwd string) bool {
+	_, ok := common[strings.ToLower(pwd)]
+	return ok
+}
@@ -0,0 +1,58 @@
+package policy
+
+import (
+	"cw1/internal/user"
+)
+
+type Action int
+
+const (
+	ReadRobot Action = iota
+	UpdateRobot
+	DeleteRobot
+	ActivateRobot
+	DeactivateRobot
+	ReadUser
+	ListUsers
+	ReadAudit
+	// ManageTemplate changes robot templates, owners of global templates are
+	// checked as zero, so only admins manage them.
+	ManageTemplate
+)
+
+// Subject is the user on whose behalf an action is performed. ReadOnly is set
+// when an admin impersonates another user.
+type Subject struct {
+	UserID   int64
+	Role     user.Role
+	ReadOnly bool
+}
+
+func (a Action) isRead() bool {
+	switch a {
+	case ReadRobot, ReadUser, ListUsers, ReadAudit:
+		return true
+	default:
+		return false
+	}
+}
+
+// Can reports whether the subject may perform the action on a resource owned by ownerID.
+func Can(s Subject, a Action, ownerID int64) bool {
+	if s.ReadOnly && !a.isRead() {
+		return false
+	}
+
+	if a != ListUsers && s.UserID == ownerID {
+		return true
+	}
+
+	switch s.Role {
+	case user.RoleAdmin:
+		return a.isRead() || a == DeactivateRobot || a == ManageTemplate
+	case user.RoleSupport:
+		return a == ReadRobot || a == ReadUser
+	default:
+		return false
+	}
+}
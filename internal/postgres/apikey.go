@@ -0,0 +1,126 @@
+package postgres
+
+import (
+	"cw1/internal/apikey"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+var _ apikey.Storage = &APIKeyStorage{}
+
+type APIKeyStorage struct {
+	statementStorage
+
+	createStmt         *sql.Stmt
+	findByHashStmt     *sql.Stmt
+	findByUserIDStmt   *sql.Stmt
+	deleteStmt         *sql.Stmt
+	updateLastUsedStmt *sql.Stmt
+}
+
+func NewAPIKeyStorage(db *DB) (*APIKeyStorage, error) {
+	s := &APIKeyStorage{statementStorage: newStatementsStorage(db)}
+
+	stmts := []stmt{
+		{Query: createAPIKeyQuery, Dst: &s.createStmt},
+		{Query: findAPIKeyByHashQuery, Dst: &s.findByHashStmt},
+		{Query: findAPIKeysByUserIDQuery, Dst: &s.findByUserIDStmt},
+		{Query: deleteAPIKeyQuery, Dst: &s.deleteStmt},
+		{Query: updateAPIKeyLastUsedQuery, Dst: &s.updateLastUsedStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+const apiKeyFields = "user_id, name, hint, hash, scopes, allowed_ips, expires_at, last_used_at, created_at"
+
+func scanAPIKey(scanner sqlScanner, k *apikey.APIKey) error {
+	return scanner.Scan(&k.ID, &k.UserID, &k.Name, &k.Hint, &k.Hash, pq.Array(&k.Scopes), pq.Array(&k.AllowedIPs),
+		&k.ExpiresAt, &k.LastUsedAt, &k.CreatedAt)
+}
+
+const createAPIKeyQuery = "INSERT INTO api_keys(user_id, name, hint, hash, scopes, allowed_ips, expires_at) " +
+	"VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, " + apiKeyFields
+
+func (s *APIKeyStorage) Create(k *apikey.APIKey) error {
+	row := s.createStmt.QueryRow(k.UserID, k.Name, k.Hint, k.Hash, pq.Array(k.Scopes), pq.Array(k.AllowedIPs), k.ExpiresAt)
+	if err := scanAPIKey(row, k); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
+
+const findAPIKeyByHashQuery = "SELECT id, " + apiKeyFields + " FROM api_keys WHERE hash=$1"
+
+func (s *APIKeyStorage) FindByHash(hash string) (*apikey.APIKey, error) {
+	var k apikey.APIKey
+
+	row := s.findByHashStmt.QueryRow(hash)
+	if err := scanAPIKey(row, &k); err != nil {
+		if err == sql.ErrNoRows {
+			return &k, nil
+		}
+
+		return &k, errors.Wrap(err, "can't scan api key")
+	}
+
+	return &k, nil
+}
+
+const findAPIKeysByUserIDQuery = "SELECT id, " + apiKeyFields + " FROM api_keys WHERE user_id=$1 ORDER BY id"
+
+func (s *APIKeyStorage) FindByUserID(userID int64) ([]*apikey.APIKey, error) {
+	rows, err := s.findByUserIDStmt.Query(userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't exec query to get api keys")
+	}
+
+	defer rows.Close()
+
+	keys := make([]*apikey.APIKey, 0)
+
+	for rows.Next() {
+		var k apikey.APIKey
+
+		err = scanAPIKey(rows, &k)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't scan row with api key")
+		}
+
+		keys = append(keys, &k)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows contain error")
+	}
+
+	return keys, nil
+}
+
+const deleteAPIKeyQuery = "DELETE FROM api_keys WHERE id=$1"
+
+func (s *APIKeyStorage) Delete(id int64) error {
+	if _, err := s.deleteStmt.Exec(id); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
+
+const updateAPIKeyLastUsedQuery = "UPDATE api_keys SET last_used_at=$2 WHERE id=$1"
+
+func (s *APIKeyStorage) UpdateLastUsed(id int64, t time.Time) error {
+	if _, err := s.updateLastUsedStmt.Exec(id, t); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package postgres
+
+import (
+	"cw1/internal/audit"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var _ audit.Storage = &AuditStorage{}
+
+type AuditStorage struct {
+	statementStorage
+
+	lockStmt     *sql.Stmt
+	lastHashStmt *sql.Stmt
+	appendStmt   *sql.Stmt
+	findStmt     *sql.Stmt
+	findAllStmt  *sql.Stmt
+}
+
+func NewAuditStorage(db *DB) (*AuditStorage, error) {
+	s := &AuditStorage{statementStorage: newStatementsStorage(db)}
+
+	stmts := []stmt{
+		{Query: lockAuditQuery, Dst: &s.lockStmt},
+		{Query: lastAuditHashQuery, Dst: &s.lastHashStmt},
+		{Query: appendAuditQuery, Dst: &s.appendStmt},
+		{Query: findAuditQuery, Dst: &s.findStmt},
+		{Query: findAllAuditQuery, Dst: &s.findAllStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+// appends are serialized by the lock, otherwise two entries could be linked
+// to the same previous one
+const lockAuditQuery = "LOCK TABLE audit_log IN EXCLUSIVE MODE"
+const lastAuditHashQuery = "SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1"
+const appendAuditQuery = "INSERT INTO audit_log(actor_id, action, target_type, target_id, ip, user_agent, " +
+	"diff, prev_hash, hash, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id"
+
+func (s *AuditStorage) Append(e *audit.Entry) (err error) {
+	tx, err := s.db.Session.Begin()
+	if err != nil {
+		return errors.Wrap(err, "can't begin transaction")
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.Stmt(s.lockStmt).Exec(); err != nil {
+		return errors.Wrap(err, "can't lock audit log")
+	}
+
+	err = tx.Stmt(s.lastHashStmt).QueryRow().Scan(&e.PrevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return errors.Wrap(err, "can't get hash of last audit entry")
+	}
+
+	// postgres keeps microseconds, the hash must match the stored time
+	e.CreatedAt = e.CreatedAt.UTC().Truncate(time.Microsecond)
+
+	e.Hash, err = e.ComputeHash()
+	if err != nil {
+		return err
+	}
+
+	diff, err := json.Marshal(e.Diff)
+	if err != nil {
+		return errors.Wrap(err, "can't marshal diff")
+	}
+
+	row := tx.Stmt(s.appendStmt).QueryRow(e.ActorID, e.Action, e.TargetType, e.TargetID, e.IP,
+		e.UserAgent, string(diff), e.PrevHash, e.Hash, e.CreatedAt)
+	if err = row.Scan(&e.ID); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "can't commit transaction")
+	}
+
+	return nil
+}
+
+const auditFields = "id, actor_id, action, target_type, target_id, ip, user_agent, diff, prev_hash, hash, created_at"
+const findAuditQuery = "SELECT " + auditFields + " FROM audit_log WHERE actor_id=$1 OR " +
+	"(target_type='user' AND target_id=$1) ORDER BY id DESC LIMIT $2"
+const findAllAuditQuery = "SELECT " + auditFields + " FROM audit_log ORDER BY id DESC LIMIT $1"
+
+func (s *AuditStorage) Find(f audit.Filter) ([]*audit.Entry, error) {
+	var (
+		rows  *sql.Rows
+		err   error
+		limit sql.NullInt64 // LIMIT NULL returns all rows
+	)
+
+	if f.Limit > 0 {
+		limit = sql.NullInt64{Int64: int64(f.Limit), Valid: true}
+	}
+
+	if f.UserID == 0 {
+		rows, err = s.findAllStmt.Query(limit)
+	} else {
+		rows, err = s.findStmt.Query(f.UserID, limit)
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "can't exec query")
+	}
+	defer rows.Close()
+
+	entries := make([]*audit.Entry, 0)
+
+	for rows.Next() {
+		var (
+			e    audit.Entry
+			diff string
+		)
+
+		err = rows.Scan(&e.ID, &e.ActorID, &e.Action, &e.TargetType, &e.TargetID, &e.IP, &e.UserAgent,
+			&diff, &e.PrevHash, &e.Hash, &e.CreatedAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't scan audit entry")
+		}
+
+		if err = json.Unmarshal([]byte(diff), &e.Diff); err != nil {
+			return nil, errors.Wrap(err, "can't unmarshal diff")
+		}
+
+		entries = append(entries, &e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows error")
+	}
+
+	return entries, nil
+}
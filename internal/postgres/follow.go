@@ -0,0 +1,161 @@
+package postgres
+
+import (
+	"cw1/internal/follow"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+var _ follow.Storage = &FollowStorage{}
+
+type FollowStorage struct {
+	statementStorage
+
+	createStmt         *sql.Stmt
+	findByRobotIDStmt  *sql.Stmt
+	findByParentIDStmt *sql.Stmt
+	updateStmt         *sql.Stmt
+	deleteStmt         *sql.Stmt
+}
+
+func NewFollowStorage(db *DB) (*FollowStorage, error) {
+	s := &FollowStorage{statementStorage: newStatementsStorage(db)}
+
+	stmts := []stmt{
+		{Query: createFollowQuery, Dst: &s.createStmt},
+		{Query: findFollowByRobotIDQuery, Dst: &s.findByRobotIDStmt},
+		{Query: findFollowsByParentIDQuery, Dst: &s.findByParentIDStmt},
+		{Query: updateFollowQuery, Dst: &s.updateStmt},
+		{Query: deleteFollowQuery, Dst: &s.deleteStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+const followFields = "robot_id, parent_robot_id, user_id, mode, sync_activation, pending, created_at"
+
+func scanFollow(scanner sqlScanner, f *follow.Follow) error {
+	var pending sql.NullString
+
+	err := scanner.Scan(&f.RobotID, &f.ParentRobotID, &f.UserID, &f.Mode, &f.SyncActivation, &pending, &f.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if !pending.Valid {
+		return nil
+	}
+
+	f.Pending = new(follow.Params)
+
+	return errors.Wrap(json.Unmarshal([]byte(pending.String), f.Pending), "can't unmarshal pending params")
+}
+
+func pendingValue(p *follow.Params) (interface{}, error) {
+	if p == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't marshal pending params")
+	}
+
+	return string(b), nil
+}
+
+const createFollowQuery = "INSERT INTO robot_follows(robot_id, parent_robot_id, user_id, mode, sync_activation, pending) " +
+	"VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (robot_id) DO UPDATE SET " +
+	"mode=EXCLUDED.mode, sync_activation=EXCLUDED.sync_activation, pending=EXCLUDED.pending RETURNING " + followFields
+
+func (s *FollowStorage) Create(f *follow.Follow) error {
+	pending, err := pendingValue(f.Pending)
+	if err != nil {
+		return err
+	}
+
+	row := s.createStmt.QueryRow(f.RobotID, f.ParentRobotID, f.UserID, f.Mode, f.SyncActivation, pending)
+	if err := scanFollow(row, f); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
+
+const findFollowByRobotIDQuery = "SELECT " + followFields + " FROM robot_follows WHERE robot_id=$1"
+
+func (s *FollowStorage) FindByRobotID(robotID int64) (*follow.Follow, error) {
+	var f follow.Follow
+
+	row := s.findByRobotIDStmt.QueryRow(robotID)
+	if err := scanFollow(row, &f); err != nil {
+		if err == sql.ErrNoRows {
+			return &follow.Follow{}, nil
+		}
+
+		return &f, errors.Wrap(err, "can't scan follow")
+	}
+
+	return &f, nil
+}
+
+const findFollowsByParentIDQuery = "SELECT " + followFields + " FROM robot_follows WHERE parent_robot_id=$1 ORDER BY robot_id"
+
+func (s *FollowStorage) FindByParentID(parentID int64) ([]*follow.Follow, error) {
+	rows, err := s.findByParentIDStmt.Query(parentID)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't exec query to get follows")
+	}
+
+	defer rows.Close()
+
+	follows := make([]*follow.Follow, 0)
+
+	for rows.Next() {
+		var f follow.Follow
+
+		err = scanFollow(rows, &f)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't scan row with follow")
+		}
+
+		follows = append(follows, &f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows contain error")
+	}
+
+	return follows, nil
+}
+
+const updateFollowQuery = "UPDATE robot_follows SET mode=$2, sync_activation=$3, pending=$4 WHERE robot_id=$1"
+
+func (s *FollowStorage) Update(f *follow.Follow) error {
+	pending, err := pendingValue(f.Pending)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.updateStmt.Exec(f.RobotID, f.Mode, f.SyncActivation, pending); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
+
+const deleteFollowQuery = "DELETE FROM robot_follows WHERE robot_id=$1"
+
+func (s *FollowStorage) Delete(robotID int64) error {
+	if _, err := s.deleteStmt.Exec(robotID); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"cw1/internal/leaderboard"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var _ leaderboard.Storage = &LeaderboardStorage{}
+
+type LeaderboardStorage struct {
+	statementStorage
+
+	computeStmt *sql.Stmt
+}
+
+func NewLeaderboardStorage(db *DB) (*LeaderboardStorage, error) {
+	s := &LeaderboardStorage{statementStorage: newStatementsStorage(db)}
+
+	stmts := []stmt{
+		{Query: computeLeaderboardQuery, Dst: &s.computeStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+const computeLeaderboardQuery = "SELECT r.robot_id, r.owner_user_id, COALESCE(r.ticker, ''), " +
+	"SUM(d.yield), SUM(d.yield) / NULLIF(r.plan_yield::float8, 0), COUNT(*), " +
+	"COUNT(*) FILTER (WHERE d.yield > 0)::float8 / COUNT(*) " +
+	"FROM robots r JOIN robot_deals d ON d.robot_id = r.robot_id " +
+	"WHERE d.created_at >= $1 AND r.visibility = 'public' AND r.deleted_at IS NULL " +
+	"GROUP BY r.robot_id"
+
+func (s *LeaderboardStorage) Compute(since time.Time) ([]leaderboard.Entry, error) {
+	rows, err := s.computeStmt.Query(since)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't exec query to compute leaderboard")
+	}
+
+	defer rows.Close()
+
+	entries := make([]leaderboard.Entry, 0)
+
+	for rows.Next() {
+		var (
+			e         leaderboard.Entry
+			planRatio sql.NullFloat64
+		)
+
+		err = rows.Scan(&e.RobotID, &e.OwnerUserID, &e.Ticker, &e.Yield, &planRatio, &e.Deals, &e.WinRate)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't scan row with leaderboard entry")
+		}
+
+		if planRatio.Valid {
+			e.PlanRatio = &planRatio.Float64
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows contain error")
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"cw1/internal/limiter"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+var _ limiter.Store = &LimiterStorage{}
+
+type LimiterStorage struct {
+	statementStorage
+
+	hitStmt         *sql.Stmt
+	failStmt        *sql.Stmt
+	lockStmt        *sql.Stmt
+	lockedUntilStmt *sql.Stmt
+	resetStmt       *sql.Stmt
+}
+
+func NewLimiterStorage(db *DB) (*LimiterStorage, error) {
+	s := &LimiterStorage{statementStorage: newStatementsStorage(db)}
+
+	stmts := []stmt{
+		{Query: hitLimitQuery, Dst: &s.hitStmt},
+		{Query: failLimitQuery, Dst: &s.failStmt},
+		{Query: lockLimitQuery, Dst: &s.lockStmt},
+		{Query: lockedUntilQuery, Dst: &s.lockedUntilStmt},
+		{Query: resetLimitQuery, Dst: &s.resetStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+const hitLimitQuery = "INSERT INTO login_limits(key, window_end, hits) VALUES ($1, $2::timestamptz + $3 * interval '1 second', 1) " +
+	"ON CONFLICT (key) DO UPDATE SET " +
+	"hits = CASE WHEN login_limits.window_end <= $2 THEN 1 ELSE login_limits.hits + 1 END, " +
+	"window_end = CASE WHEN login_limits.window_end <= $2 THEN EXCLUDED.window_end ELSE login_limits.window_end END " +
+	"RETURNING hits, window_end"
+
+func (s *LimiterStorage) Hit(key string, window time.Duration, now time.Time) (int, time.Time, error) {
+	var (
+		hits int
+		end  time.Time
+	)
+
+	if err := s.hitStmt.QueryRow(key, now, window.Seconds()).Scan(&hits, &end); err != nil {
+		return 0, time.Time{}, errors.Wrap(err, "can't exec query")
+	}
+
+	return hits, end, nil
+}
+
+const failLimitQuery = "INSERT INTO login_limits(key, window_end, failures) VALUES ($1, $2, 1) " +
+	"ON CONFLICT (key) DO UPDATE SET failures = login_limits.failures + 1 RETURNING failures"
+
+func (s *LimiterStorage) Fail(key string, now time.Time) (int, error) {
+	var failures int
+
+	if err := s.failStmt.QueryRow(key, now).Scan(&failures); err != nil {
+		return 0, errors.Wrap(err, "can't exec query")
+	}
+
+	return failures, nil
+}
+
+const lockLimitQuery = "UPDATE login_limits SET locked_until=$2 WHERE key=$1"
+
+func (s *LimiterStorage) Lock(key string, until time.Time) error {
+	if _, err := s.lockStmt.Exec(key, until); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
+
+const lockedUntilQuery = "SELECT locked_until FROM login_limits WHERE key=$1"
+
+func (s *LimiterStorage) LockedUntil(key string) (time.Time, error) {
+	var until pq.NullTime
+
+	if err := s.lockedUntilStmt.QueryRow(key).Scan(&until); err != nil {
+		if err == sql.ErrNoRows {
+			return time.Time{}, nil
+		}
+
+		return time.Time{}, errors.Wrap(err, "can't exec query")
+	}
+
+	return until.Time, nil
+}
+
+const resetLimitQuery = "UPDATE login_limits SET failures=0, locked_until=NULL WHERE key=$1"
+
+func (s *LimiterStorage) Reset(key string) error {
+	if _, err := s.resetStmt.Exec(key); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"cw1/internal/reset"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var _ reset.Storage = &ResetStorage{}
+
+type ResetStorage struct {
+	statementStorage
+
+	createStmt  *sql.Stmt
+	consumeStmt *sql.Stmt
+}
+
+func NewResetStorage(db *DB) (*ResetStorage, error) {
+	s := &ResetStorage{statementStorage: newStatementsStorage(db)}
+
+	stmts := []stmt{
+		{Query: createResetQuery, Dst: &s.createStmt},
+		{Query: consumeResetQuery, Dst: &s.consumeStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+const createResetQuery = "INSERT INTO password_resets(user_id, hash, expires_at, created_at) " +
+	"VALUES ($1, $2, $3, $4) RETURNING id"
+
+func (s *ResetStorage) Create(t *reset.Token) error {
+	if err := s.createStmt.QueryRow(t.UserID, t.Hash, t.ExpiresAt, t.CreatedAt).Scan(&t.ID); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
+
+const consumeResetQuery = "UPDATE password_resets SET used_at=$2 " +
+	"WHERE hash=$1 AND used_at IS NULL AND expires_at > $2 RETURNING user_id"
+
+func (s *ResetStorage) Consume(hash string, now time.Time) (int64, error) {
+	var userID int64
+
+	if err := s.consumeStmt.QueryRow(hash, now).Scan(&userID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+
+		return 0, errors.Wrap(err, "can't exec query")
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,102 @@
+package postgres
+
+import (
+	"cw1/internal/revision"
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+var _ revision.Storage = &RevisionStorage{}
+
+type RevisionStorage struct {
+	statementStorage
+
+	createStmt        *sql.Stmt
+	findByRobotIDStmt *sql.Stmt
+	findStmt          *sql.Stmt
+}
+
+func NewRevisionStorage(db *DB) (*RevisionStorage, error) {
+	s := &RevisionStorage{statementStorage: newStatementsStorage(db)}
+
+	stmts := []stmt{
+		{Query: createRevisionQuery, Dst: &s.createStmt},
+		{Query: findRevisionsByRobotIDQuery, Dst: &s.findByRobotIDStmt},
+		{Query: findRevisionQuery, Dst: &s.findStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+const revisionFields = "robot_id, rev, ticker, buy_price, sell_price, plan_start, plan_end, plan_yield, author_id, created_at"
+
+func scanRevision(scanner sqlScanner, r *revision.Revision) error {
+	return scanner.Scan(&r.RobotID, &r.Rev, &r.Ticker, &r.BuyPrice, &r.SellPrice, &r.PlanStart, &r.PlanEnd, &r.PlanYield,
+		&r.AuthorID, &r.CreatedAt)
+}
+
+// the primary key makes concurrent revisions of the robot fail instead of sharing the number
+const createRevisionQuery = "INSERT INTO robot_revisions(" + revisionFields + ") " +
+	"SELECT $1, COALESCE(MAX(rev), 0) + 1, $2, $3, $4, $5, $6, $7, $8, now() FROM robot_revisions WHERE robot_id=$1 " +
+	"RETURNING " + revisionFields
+
+func (s *RevisionStorage) Create(r *revision.Revision) error {
+	row := s.createStmt.QueryRow(r.RobotID, r.Ticker, r.BuyPrice, r.SellPrice, r.PlanStart, r.PlanEnd, r.PlanYield, r.AuthorID)
+	if err := scanRevision(row, r); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
+
+const findRevisionsByRobotIDQuery = "SELECT " + revisionFields + " FROM robot_revisions WHERE robot_id=$1 ORDER BY rev DESC"
+
+func (s *RevisionStorage) FindByRobotID(robotID int64) ([]*revision.Revision, error) {
+	rows, err := s.findByRobotIDStmt.Query(robotID)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't exec query to get revisions")
+	}
+
+	defer rows.Close()
+
+	revs := make([]*revision.Revision, 0)
+
+	for rows.Next() {
+		var r revision.Revision
+
+		err = scanRevision(rows, &r)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't scan row with revision")
+		}
+
+		revs = append(revs, &r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows contain error")
+	}
+
+	return revs, nil
+}
+
+const findRevisionQuery = "SELECT " + revisionFields + " FROM robot_revisions WHERE robot_id=$1 AND rev=$2"
+
+func (s *RevisionStorage) Find(robotID int64, rev int64) (*revision.Revision, error) {
+	var r revision.Revision
+
+	row := s.findStmt.QueryRow(robotID, rev)
+	if err := scanRevision(row, &r); err != nil {
+		if err == sql.ErrNoRows {
+			return &revision.Revision{}, nil
+		}
+
+		return &r, errors.Wrap(err, "can't scan revision")
+	}
+
+	return &r, nil
+}
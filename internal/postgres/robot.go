@@ -3,7 +3,11 @@ package postgres
 import (
 	"cw1/internal/robot"
 	"database/sql"
+	"fmt"
+	"strings"
+	"time"
 
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 )
 
@@ -12,15 +16,21 @@ var _ robot.Storage = &RobotStorage{}
 type RobotStorage struct {
 	statementStorage
 
-	createStmt                 *sql.Stmt
-	findByIDStmt               *sql.Stmt
-	findByOwnerIDStmt          *sql.Stmt
-	findByTickerStmt           *sql.Stmt
-	findByOwnerIDAndTickerStmt *sql.Stmt
-	findAllRobotsStmt          *sql.Stmt
-	updateStmt                 *sql.Stmt
-	updateBesidesActiveStmt    *sql.Stmt
-	getActiveRobotsStmt        *sql.Stmt
+	createStmt              *sql.Stmt
+	findByIDStmt            *sql.Stmt
+	findByOwnerIDStmt       *sql.Stmt
+	findByTickerStmt        *sql.Stmt
+	updateStmt              *sql.Stmt
+	updateBesidesActiveStmt *sql.Stmt
+	getActiveRobotsStmt     *sql.Stmt
+	addDealStmt             *sql.Stmt
+	findDealsStmt           *sql.Stmt
+	lockPurgedStmt          *sql.Stmt
+	keepHistoryStmt         *sql.Stmt
+	purgeDealsStmt          *sql.Stmt
+	purgeFollowsStmt        *sql.Stmt
+	unlinkCopiesStmt        *sql.Stmt
+	purgeStmt               *sql.Stmt
 }
 
 func NewRobotStorage(db *DB) (*RobotStorage, error) {
@@ -31,11 +41,17 @@ func NewRobotStorage(db *DB) (*RobotStorage, error) {
 		{Query: findRobotByIDQuery, Dst: &s.findByIDStmt},
 		{Query: findRobotByOwnerIDQuery, Dst: &s.findByOwnerIDStmt},
 		{Query: findRobotByTickerQuery, Dst: &s.findByTickerStmt},
-		{Query: findRobotByOwnerIDAndTickerQuery, Dst: &s.findByOwnerIDAndTickerStmt},
-		{Query: findAllRobotsQuery, Dst: &s.findAllRobotsStmt},
 		{Query: updateRobotQuery, Dst: &s.updateStmt},
 		{Query: updateRobotBesidesActiveQuery, Dst: &s.updateBesidesActiveStmt},
 		{Query: getActiveRobotsQuery, Dst: &s.getActiveRobotsStmt},
+		{Query: addDealQuery, Dst: &s.addDealStmt},
+		{Query: findDealsByOwnerIDQuery, Dst: &s.findDealsStmt},
+		{Query: lockPurgedRobotsQuery, Dst: &s.lockPurgedStmt},
+		{Query: keepRobotHistoryQuery, Dst: &s.keepHistoryStmt},
+		{Query: purgeRobotDealsQuery, Dst: &s.purgeDealsStmt},
+		{Query: purgeRobotFollowsQuery, Dst: &s.purgeFollowsStmt},
+		{Query: unlinkRobotCopiesQuery, Dst: &s.unlinkCopiesStmt},
+		{Query: purgeRobotsQuery, Dst: &s.purgeStmt},
 	}
 
 	if err := s.initStatements(stmts); err != nil {
@@ -47,14 +63,19 @@ func NewRobotStorage(db *DB) (*RobotStorage, error) {
 
 func scanRobot(scanner sqlScanner, r *robot.Robot) error {
 	return scanner.Scan(&r.RobotID, &r.OwnerUserID, &r.ParentRobotID, &r.IsFavourite, &r.IsActive, &r.Ticker, &r.BuyPrice, &r.SellPrice,
-		&r.PlanStart, &r.PlanEnd, &r.PlanYield, &r.FactYield, &r.DealsCount, &r.ActivatedAt, &r.DeactivatedAt, &r.CreatedAt, &r.DeletedAt)
+		&r.PlanStart, &r.PlanEnd, &r.PlanYield, &r.FactYield, &r.DealsCount, &r.ActivatedAt, &r.DeactivatedAt, &r.CreatedAt, &r.DeletedAt,
+		&r.Visibility, &r.Version)
 }
 
-const robotCreateFields = "owner_user_id, is_favourite, is_active" //nolint: misspell
-const createRobotQuery = "INSERT INTO robots(" + robotCreateFields + ") VALUES ($1, $2, $3) RETURNING robot_id"
+const robotCreateFields = "owner_user_id, parent_robot_id, is_favourite, is_active, ticker, buy_price, sell_price, " + //nolint: misspell
+	"plan_start, plan_end, plan_yield, visibility, created_at"
+const createRobotQuery = "INSERT INTO robots(" + robotCreateFields + ") " +
+	"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, COALESCE(NULLIF($11, ''), 'private'), now()) RETURNING robot_id, " + robotFields
 
 func (s *RobotStorage) Create(r *robot.Robot) error {
-	if err := s.createStmt.QueryRow(r.OwnerUserID, r.IsFavourite, r.IsActive).Scan(&r.RobotID); err != nil {
+	row := s.createStmt.QueryRow(r.OwnerUserID, r.ParentRobotID, r.IsFavourite, r.IsActive, r.Ticker, r.BuyPrice, r.SellPrice,
+		r.PlanStart, r.PlanEnd, r.PlanYield, r.Visibility)
+	if err := scanRobot(row, r); err != nil {
 		return errors.Wrap(err, "can't exec query")
 	}
 
@@ -62,7 +83,7 @@ func (s *RobotStorage) Create(r *robot.Robot) error {
 }
 
 const robotFields = "owner_user_id, parent_robot_id, is_favourite, is_active, ticker, buy_price, sell_price, plan_start, plan_end, " + //nolint: misspell
-	"plan_yield, fact_yield, deals_count, activated_at, deactivated_at, created_at, deleted_at"
+	"plan_yield, fact_yield, deals_count, activated_at, deactivated_at, created_at, deleted_at, visibility, version"
 const findRobotByIDQuery = "SELECT robot_id, " + robotFields + " FROM robots WHERE robot_id=$1"
 
 func (s *RobotStorage) FindByID(id int64) (*robot.Robot, error) {
@@ -92,60 +113,202 @@ func (s *RobotStorage) FindByTicker(ticker string) ([]*robot.Robot, error) {
 	return find(s.findByTickerStmt, ticker)
 }
 
-const findRobotByOwnerIDAndTickerQuery = "SELECT robot_id, " + robotFields + " FROM robots WHERE owner_user_id=$1 AND ticker=$2"
+// sortColumn is the expression robots are ordered by, nulls are replaced by
+// the value of null to keep the order total for cursors.
+type sortColumn struct {
+	expr string
+	typ  string
+	null string
+}
 
-func (s *RobotStorage) findByOwnerIDAndTicker(id int64, ticker string) ([]*robot.Robot, error) {
-	return find(s.findByOwnerIDAndTickerStmt, id, ticker)
+var robotSortColumns = map[string]sortColumn{
+	robot.SortID:         {expr: "robot_id", typ: "bigint"},
+	robot.SortFactYield:  {expr: "COALESCE(fact_yield::float8, '-infinity')", typ: "float8", null: "-infinity"},
+	robot.SortDealsCount: {expr: "COALESCE(deals_count, 0)::bigint", typ: "bigint", null: "0"},
+	robot.SortCreatedAt:  {expr: "COALESCE(created_at, '-infinity')::timestamptz", typ: "timestamptz", null: "-infinity"},
+	robot.SortPlanEnd:    {expr: "COALESCE(plan_end, '-infinity')::timestamptz", typ: "timestamptz", null: "-infinity"},
 }
 
-const findAllRobotsQuery = "SELECT robot_id, " + robotFields + " FROM robots"
+const listRobotsQuery = "SELECT robot_id, " + robotFields + " FROM robots"
+
+func (s *RobotStorage) List(f robot.Filter) ([]*robot.Robot, error) {
+	query, args, err := listQuery(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't build query to list robots")
+	}
+
+	rows, err := s.db.Session.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't exec query to list robots")
+	}
 
-func (s *RobotStorage) findAllRobots() ([]*robot.Robot, error) {
-	return find(s.findAllRobotsStmt)
+	return scanRobots(rows)
 }
 
-func (s *RobotStorage) GetAll(id int64, ticker string) ([]*robot.Robot, error) {
+// listQuery translates the filter into the query, values are passed only as args.
+func listQuery(f robot.Filter) (string, []interface{}, error) {
+	if f.Sort == "" {
+		f.Sort = robot.SortID
+	}
+
+	col, ok := robotSortColumns[f.Sort]
+	if !ok {
+		return "", nil, errors.Errorf("unknown sort field: %v", f.Sort)
+	}
+
+	var (
+		conds []string
+		args  []interface{}
+	)
+
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if f.OwnerID != 0 {
+		conds = append(conds, "owner_user_id="+arg(f.OwnerID))
+	}
+
+	if f.Ticker != "" {
+		conds = append(conds, "ticker="+arg(f.Ticker))
+	}
+
+	if len(f.Tags) > 0 {
+		conds = append(conds, "robot_id IN (SELECT rt.robot_id FROM robot_tags rt JOIN tags t ON t.id = rt.tag_id "+
+			"WHERE t.user_id="+arg(f.TagsOf)+" AND t.name = ANY("+arg(pq.Array(f.Tags))+") GROUP BY rt.robot_id "+
+			"HAVING COUNT(*)="+arg(len(f.Tags))+")")
+	}
+
+	if f.Active != nil {
+		conds = append(conds, "is_active="+arg(*f.Active))
+	}
+
+	if f.Favourite != nil {
+		conds = append(conds, "is_favourite="+arg(*f.Favourite)) //nolint: misspell
+	}
+
+	if f.MinYield != nil {
+		conds = append(conds, "fact_yield>="+arg(*f.MinYield))
+	}
+
+	if f.MaxYield != nil {
+		conds = append(conds, "fact_yield<="+arg(*f.MaxYield))
+	}
+
+	if f.PlanFrom != nil {
+		conds = append(conds, "plan_start>="+arg(*f.PlanFrom))
+	}
+
+	if f.PlanTo != nil {
+		conds = append(conds, "plan_end<="+arg(*f.PlanTo))
+	}
+
 	switch {
-	case id != 0 && ticker != "":
-		return s.findByOwnerIDAndTicker(id, ticker)
-	case id != 0:
-		return s.FindByOwnerID(id)
-	case ticker != "":
-		return s.FindByTicker(ticker)
-	default:
-		return s.findAllRobots()
+	case f.Deleted:
+		conds = append(conds, "deleted_at IS NOT NULL")
+	case !f.IncludeDeleted:
+		conds = append(conds, "deleted_at IS NULL")
+	}
+
+	if f.Visibility != "" {
+		conds = append(conds, "visibility="+arg(f.Visibility))
+	}
+
+	if f.VisibleTo != 0 {
+		conds = append(conds, "(visibility="+arg(robot.VisibilityPublic)+" OR owner_user_id="+arg(f.VisibleTo)+")")
 	}
+
+	if f.After != nil {
+		if f.After.Sort != f.Sort {
+			return "", nil, errors.Errorf("cursor is for sort by %v, not %v", f.After.Sort, f.Sort)
+		}
+
+		value := f.After.Value
+		if value == "" {
+			value = col.null
+		}
+
+		op := ">"
+		if f.Desc {
+			op = "<"
+		}
+
+		if f.Sort == robot.SortID {
+			conds = append(conds, "robot_id"+op+arg(f.After.ID))
+		} else {
+			conds = append(conds, fmt.Sprintf("(%s, robot_id)%s(%s::%s, %s)",
+				col.expr, op, arg(value), col.typ, arg(f.After.ID)))
+		}
+	}
+
+	query := listRobotsQuery
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	dir := " ASC"
+	if f.Desc {
+		dir = " DESC"
+	}
+
+	if f.Sort == robot.SortID {
+		query += " ORDER BY robot_id" + dir
+	} else {
+		query += " ORDER BY " + col.expr + dir + ", robot_id" + dir
+	}
+
+	if f.Limit > 0 {
+		query += " LIMIT " + arg(f.Limit)
+	}
+
+	return query, args, nil
 }
 
 const updateRobotQuery = "UPDATE robots SET " +
 	"owner_user_id=$2, parent_robot_id=$3, is_favourite=$4, is_active=$5, ticker=$6, buy_price=$7, " + //nolint: misspell
 	"sell_price=$8, plan_start=$9, plan_end=$10, plan_yield=$11, fact_yield=$12, deals_count=$13, activated_at=$14, deactivated_at=$15, " +
-	"created_at=$16, deleted_at=$17 " +
-	"WHERE robot_id=$1 RETURNING robot_id, " + robotFields
+	"created_at=$16, deleted_at=$17, visibility=$18, version=version+1 " +
+	"WHERE robot_id=$1 AND version=$19 RETURNING robot_id, " + robotFields
 
 func (s *RobotStorage) Update(r *robot.Robot) error {
 	row := s.updateStmt.QueryRow(r.RobotID, r.OwnerUserID, r.ParentRobotID, r.IsFavourite, r.IsActive, r.Ticker, r.BuyPrice, r.SellPrice,
-		r.PlanStart, r.PlanEnd, r.PlanYield, r.FactYield, r.DealsCount, r.ActivatedAt, r.DeactivatedAt, r.CreatedAt, r.DeletedAt)
-	if err := scanRobot(row, r); err != nil {
-		return errors.Wrap(err, "can't exec query")
-	}
+		r.PlanStart, r.PlanEnd, r.PlanYield, r.FactYield, r.DealsCount, r.ActivatedAt, r.DeactivatedAt, r.CreatedAt, r.DeletedAt,
+		r.Visibility, r.Version)
 
-	return nil
+	return scanUpdatedRobot(row, r)
 }
 
 const updateRobotBesidesActiveQuery = "UPDATE robots SET " +
 	"owner_user_id=$2, parent_robot_id=$3, is_favourite=$4, ticker=$5, buy_price=$6, " + //nolint: misspell
 	"sell_price=$7, plan_start=$8, plan_end=$9, plan_yield=$10, fact_yield=$11, deals_count=$12, activated_at=$13, deactivated_at=$14, " +
-	"created_at=$15, deleted_at=$16 " +
-	"WHERE robot_id=$1 RETURNING robot_id, " + robotFields
+	"created_at=$15, deleted_at=$16, visibility=$17, version=version+1 " +
+	"WHERE robot_id=$1 AND version=$18 RETURNING robot_id, " + robotFields
 
 func (s *RobotStorage) UpdateBesidesActive(r *robot.Robot) error {
 	row := s.updateBesidesActiveStmt.QueryRow(r.RobotID, r.OwnerUserID, r.ParentRobotID, r.IsFavourite, r.Ticker, r.BuyPrice, r.SellPrice,
-		r.PlanStart, r.PlanEnd, r.PlanYield, r.FactYield, r.DealsCount, r.ActivatedAt, r.DeactivatedAt, r.CreatedAt, r.DeletedAt)
-	if err := scanRobot(row, r); err != nil {
+		r.PlanStart, r.PlanEnd, r.PlanYield, r.FactYield, r.DealsCount, r.ActivatedAt, r.DeactivatedAt, r.CreatedAt, r.DeletedAt,
+		r.Visibility, r.Version)
+
+	return scanUpdatedRobot(row, r)
+}
+
+// scanUpdatedRobot scans the result of a compare-and-swap update, no rows
+// means the robot has another version.
+func scanUpdatedRobot(row *sql.Row, r *robot.Robot) error {
+	var updated robot.Robot
+
+	err := scanRobot(row, &updated)
+	if err == sql.ErrNoRows {
+		return errors.Wrapf(robot.ErrConflict, "robot with id: %v and version: %v", r.RobotID, r.Version)
+	}
+
+	if err != nil {
 		return errors.Wrap(err, "can't exec query")
 	}
 
+	*r = updated
+
 	return nil
 }
 
@@ -156,12 +319,112 @@ func (s *RobotStorage) GetActiveRobots() ([]*robot.Robot, error) {
 	return find(s.getActiveRobotsStmt)
 }
 
+const addDealQuery = "INSERT INTO robot_deals(robot_id, buy_price, sell_price, yield, created_at) " +
+	"VALUES ($1, $2, $3, $4, now()) RETURNING id, created_at"
+
+func (s *RobotStorage) AddDeal(d *robot.Deal) error {
+	row := s.addDealStmt.QueryRow(d.RobotID, d.BuyPrice, d.SellPrice, d.Yield)
+	if err := row.Scan(&d.ID, &d.CreatedAt); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
+
+const findDealsByOwnerIDQuery = "SELECT d.id, d.robot_id, d.buy_price, d.sell_price, d.yield, d.created_at " +
+	"FROM robot_deals d JOIN robots r ON r.robot_id = d.robot_id WHERE r.owner_user_id=$1 ORDER BY d.id"
+
+func (s *RobotStorage) FindDealsByOwnerID(id int64) ([]*robot.Deal, error) {
+	rows, err := s.findDealsStmt.Query(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't exec query to get deals")
+	}
+
+	defer rows.Close()
+
+	deals := make([]*robot.Deal, 0)
+
+	for rows.Next() {
+		var d robot.Deal
+
+		err = rows.Scan(&d.ID, &d.RobotID, &d.BuyPrice, &d.SellPrice, &d.Yield, &d.CreatedAt)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't scan row with deal")
+		}
+
+		deals = append(deals, &d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows contain error")
+	}
+
+	return deals, nil
+}
+
+const purgedRobots = "SELECT robot_id FROM robots WHERE deleted_at < $1"
+
+// robots are locked first, so they can't be restored while they are purged
+const lockPurgedRobotsQuery = purgedRobots + " FOR UPDATE"
+const keepRobotHistoryQuery = "INSERT INTO robot_history(robot_id, owner_user_id, ticker, fact_yield, deals_count, " +
+	"wins, created_at, deleted_at) " +
+	"SELECT r.robot_id, r.owner_user_id, r.ticker, r.fact_yield, r.deals_count, " +
+	"(SELECT COUNT(*) FROM robot_deals d WHERE d.robot_id = r.robot_id AND d.yield > 0), r.created_at, r.deleted_at " +
+	"FROM robots r WHERE r.deleted_at < $1 ON CONFLICT (robot_id) DO NOTHING"
+const purgeRobotDealsQuery = "DELETE FROM robot_deals WHERE robot_id IN (" + purgedRobots + ")"
+const purgeRobotFollowsQuery = "DELETE FROM robot_follows WHERE robot_id IN (" + purgedRobots + ") " +
+	"OR parent_robot_id IN (" + purgedRobots + ")"
+const unlinkRobotCopiesQuery = "UPDATE robots SET parent_robot_id=NULL, version=version+1 " +
+	"WHERE parent_robot_id IN (" + purgedRobots + ")"
+const purgeRobotsQuery = "DELETE FROM robots WHERE deleted_at < $1"
+
+// Purge removes robots deleted before the time, their totals are kept in the history.
+func (s *RobotStorage) Purge(deletedBefore time.Time) (n int64, err error) {
+	tx, err := s.db.Session.Begin()
+	if err != nil {
+		return 0, errors.Wrap(err, "can't begin transaction")
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	for _, stmt := range []*sql.Stmt{s.lockPurgedStmt, s.keepHistoryStmt, s.purgeDealsStmt, s.purgeFollowsStmt,
+		s.unlinkCopiesStmt} {
+		if _, err = tx.Stmt(stmt).Exec(deletedBefore); err != nil {
+			return 0, errors.Wrap(err, "can't exec query")
+		}
+	}
+
+	res, err := tx.Stmt(s.purgeStmt).Exec(deletedBefore)
+	if err != nil {
+		return 0, errors.Wrap(err, "can't exec query to purge robots")
+	}
+
+	n, err = res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "can't get number of purged robots")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "can't commit transaction")
+	}
+
+	return n, nil
+}
+
 func find(stmt *sql.Stmt, args ...interface{}) ([]*robot.Robot, error) {
 	rows, err := stmt.Query(args...)
 	if err != nil {
 		return nil, errors.Wrap(err, "can't exec query to get robots")
 	}
 
+	return scanRobots(rows)
+}
+
+func scanRobots(rows *sql.Rows) ([]*robot.Robot, error) {
 	defer rows.Close()
 
 	robots := make([]*robot.Robot, 0)
@@ -169,7 +432,7 @@ func find(stmt *sql.Stmt, args ...interface{}) ([]*robot.Robot, error) {
 	for rows.Next() {
 		var r robot.Robot
 
-		err = scanRobot(rows, &r)
+		err := scanRobot(rows, &r)
 		if err != nil {
 			return nil, errors.Wrap(err, "can't scan row with robot")
 		}
@@ -177,7 +440,7 @@ func find(stmt *sql.Stmt, args ...interface{}) ([]*robot.Robot, error) {
 		robots = append(robots, &r)
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, errors.Wrap(err, "rows contain error")
 	}
 
@@ -0,0 +1,142 @@
+package postgres
+
+import (
+	"cw1/internal/robottemplate"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var _ robottemplate.Storage = &TemplateStorage{}
+
+type TemplateStorage struct {
+	statementStorage
+
+	createStmt        *sql.Stmt
+	findByIDStmt      *sql.Stmt
+	findAvailableStmt *sql.Stmt
+	updateStmt        *sql.Stmt
+	deleteStmt        *sql.Stmt
+}
+
+func NewTemplateStorage(db *DB) (*TemplateStorage, error) {
+	s := &TemplateStorage{statementStorage: newStatementsStorage(db)}
+
+	stmts := []stmt{
+		{Query: createTemplateQuery, Dst: &s.createStmt},
+		{Query: findTemplateByIDQuery, Dst: &s.findByIDStmt},
+		{Query: findAvailableTemplatesQuery, Dst: &s.findAvailableStmt},
+		{Query: updateTemplateQuery, Dst: &s.updateStmt},
+		{Query: deleteTemplateQuery, Dst: &s.deleteStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+const templateFields = "id, owner_user_id, global, name, buy_percent, sell_percent, plan_seconds, plan_yield, created_at"
+
+func scanTemplate(scanner sqlScanner, t *robottemplate.Template) error {
+	var seconds int64
+
+	err := scanner.Scan(&t.ID, &t.OwnerUserID, &t.Global, &t.Name, &t.BuyPercent, &t.SellPercent, &seconds,
+		&t.PlanYield, &t.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	t.PlanDuration = robottemplate.Duration(time.Duration(seconds) * time.Second)
+
+	return nil
+}
+
+func planSeconds(t *robottemplate.Template) int64 {
+	return int64(time.Duration(t.PlanDuration) / time.Second)
+}
+
+const createTemplateQuery = "INSERT INTO robot_templates(owner_user_id, global, name, buy_percent, sell_percent, " +
+	"plan_seconds, plan_yield) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING " + templateFields
+
+func (s *TemplateStorage) Create(t *robottemplate.Template) error {
+	row := s.createStmt.QueryRow(t.OwnerUserID, t.Global, t.Name, t.BuyPercent, t.SellPercent, planSeconds(t),
+		t.PlanYield)
+	if err := scanTemplate(row, t); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
+
+const findTemplateByIDQuery = "SELECT " + templateFields + " FROM robot_templates WHERE id=$1"
+
+func (s *TemplateStorage) FindByID(id int64) (*robottemplate.Template, error) {
+	var t robottemplate.Template
+
+	row := s.findByIDStmt.QueryRow(id)
+	if err := scanTemplate(row, &t); err != nil {
+		if err == sql.ErrNoRows {
+			return &robottemplate.Template{}, nil
+		}
+
+		return &t, errors.Wrap(err, "can't scan template")
+	}
+
+	return &t, nil
+}
+
+const findAvailableTemplatesQuery = "SELECT " + templateFields + " FROM robot_templates " +
+	"WHERE owner_user_id=$1 OR global ORDER BY id"
+
+func (s *TemplateStorage) FindAvailable(userID int64) ([]*robottemplate.Template, error) {
+	rows, err := s.findAvailableStmt.Query(userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't exec query to get templates")
+	}
+
+	defer rows.Close()
+
+	templates := make([]*robottemplate.Template, 0)
+
+	for rows.Next() {
+		var t robottemplate.Template
+
+		err = scanTemplate(rows, &t)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't scan row with template")
+		}
+
+		templates = append(templates, &t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows contain error")
+	}
+
+	return templates, nil
+}
+
+const updateTemplateQuery = "UPDATE robot_templates SET global=$2, name=$3, buy_percent=$4, sell_percent=$5, " +
+	"plan_seconds=$6, plan_yield=$7 WHERE id=$1"
+
+func (s *TemplateStorage) Update(t *robottemplate.Template) error {
+	_, err := s.updateStmt.Exec(t.ID, t.Global, t.Name, t.BuyPercent, t.SellPercent, planSeconds(t), t.PlanYield)
+	if err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
+
+const deleteTemplateQuery = "DELETE FROM robot_templates WHERE id=$1"
+
+func (s *TemplateStorage) Delete(id int64) error {
+	if _, err := s.deleteStmt.Exec(id); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
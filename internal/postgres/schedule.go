@@ -0,0 +1,162 @@
+package postgres
+
+import (
+	"cw1/internal/schedule"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var _ schedule.Storage = &ScheduleStorage{}
+
+type ScheduleStorage struct {
+	statementStorage
+
+	createStmt        *sql.Stmt
+	findByIDStmt      *sql.Stmt
+	findByRobotIDStmt *sql.Stmt
+	deleteStmt        *sql.Stmt
+	dueStmt           *sql.Stmt
+	claimStmt         *sql.Stmt
+	setResultStmt     *sql.Stmt
+}
+
+func NewScheduleStorage(db *DB) (*ScheduleStorage, error) {
+	s := &ScheduleStorage{statementStorage: newStatementsStorage(db)}
+
+	stmts := []stmt{
+		{Query: createJobQuery, Dst: &s.createStmt},
+		{Query: findJobByIDQuery, Dst: &s.findByIDStmt},
+		{Query: findJobsByRobotIDQuery, Dst: &s.findByRobotIDStmt},
+		{Query: deleteJobQuery, Dst: &s.deleteStmt},
+		{Query: dueJobsQuery, Dst: &s.dueStmt},
+		{Query: claimJobQuery, Dst: &s.claimStmt},
+		{Query: setJobResultQuery, Dst: &s.setResultStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+const jobFields = "id, robot_id, user_id, action, cron, next_run_at, last_run_at, last_error, created_at"
+
+func scanJob(scanner sqlScanner, j *schedule.Job) error {
+	return scanner.Scan(&j.ID, &j.RobotID, &j.UserID, &j.Action, &j.Cron, &j.NextRunAt, &j.LastRunAt, &j.LastError,
+		&j.CreatedAt)
+}
+
+func scanJobs(rows *sql.Rows) ([]*schedule.Job, error) {
+	defer rows.Close()
+
+	jobs := make([]*schedule.Job, 0)
+
+	for rows.Next() {
+		var j schedule.Job
+
+		if err := scanJob(rows, &j); err != nil {
+			return nil, errors.Wrap(err, "can't scan row with job")
+		}
+
+		jobs = append(jobs, &j)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows contain error")
+	}
+
+	return jobs, nil
+}
+
+const createJobQuery = "INSERT INTO robot_jobs(robot_id, user_id, action, cron, next_run_at) " +
+	"VALUES ($1, $2, $3, $4, $5) RETURNING " + jobFields
+
+func (s *ScheduleStorage) Create(j *schedule.Job) error {
+	row := s.createStmt.QueryRow(j.RobotID, j.UserID, j.Action, j.Cron, j.NextRunAt)
+	if err := scanJob(row, j); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
+
+const findJobByIDQuery = "SELECT " + jobFields + " FROM robot_jobs WHERE id=$1"
+
+func (s *ScheduleStorage) FindByID(id int64) (*schedule.Job, error) {
+	var j schedule.Job
+
+	row := s.findByIDStmt.QueryRow(id)
+	if err := scanJob(row, &j); err != nil {
+		if err == sql.ErrNoRows {
+			return &schedule.Job{}, nil
+		}
+
+		return &j, errors.Wrap(err, "can't scan job")
+	}
+
+	return &j, nil
+}
+
+const findJobsByRobotIDQuery = "SELECT " + jobFields + " FROM robot_jobs WHERE robot_id=$1 " +
+	"ORDER BY next_run_at NULLS LAST, id"
+
+func (s *ScheduleStorage) FindByRobotID(robotID int64) ([]*schedule.Job, error) {
+	rows, err := s.findByRobotIDStmt.Query(robotID)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't exec query to get jobs")
+	}
+
+	return scanJobs(rows)
+}
+
+const deleteJobQuery = "DELETE FROM robot_jobs WHERE id=$1"
+
+func (s *ScheduleStorage) Delete(id int64) error {
+	if _, err := s.deleteStmt.Exec(id); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
+
+const dueJobsQuery = "SELECT " + jobFields + " FROM robot_jobs WHERE next_run_at <= $1 " +
+	"ORDER BY next_run_at, id LIMIT $2"
+
+func (s *ScheduleStorage) Due(now time.Time, limit int) ([]*schedule.Job, error) {
+	rows, err := s.dueStmt.Query(now, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't exec query to get due jobs")
+	}
+
+	return scanJobs(rows)
+}
+
+// the job is claimed only if no other scheduler has moved its next run
+const claimJobQuery = "UPDATE robot_jobs SET next_run_at=$3, last_run_at=now() WHERE id=$1 AND next_run_at=$2"
+
+func (s *ScheduleStorage) Claim(j *schedule.Job, next *time.Time) (bool, error) {
+	res, err := s.claimStmt.Exec(j.ID, j.NextRunAt, next)
+	if err != nil {
+		return false, errors.Wrap(err, "can't exec query")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "can't get affected rows")
+	}
+
+	return n == 1, nil
+}
+
+const setJobResultQuery = "UPDATE robot_jobs SET last_error=$2 WHERE id=$1"
+
+func (s *ScheduleStorage) SetResult(id int64, lastError string) error {
+	if _, err := s.setResultStmt.Exec(id, lastError); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
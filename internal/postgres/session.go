@@ -15,6 +15,8 @@ type SessionStorage struct {
 	createStmt  *sql.Stmt
 	findByID    *sql.Stmt
 	findByToken *sql.Stmt
+	deleteByID  *sql.Stmt
+	findAll     *sql.Stmt
 }
 
 func NewSessionStorage(db *DB) (*SessionStorage, error) {
@@ -24,6 +26,8 @@ func NewSessionStorage(db *DB) (*SessionStorage, error) {
 		{Query: createSessionQuery, Dst: &s.createStmt},
 		{Query: findSessionByIDQuery, Dst: &s.findByID},
 		{Query: findSessionByTokenQuery, Dst: &s.findByToken},
+		{Query: deleteSessionsByUserIDQuery, Dst: &s.deleteByID},
+		{Query: findAllSessionsQuery, Dst: &s.findAll},
 	}
 
 	if err := s.initStatements(stmts); err != nil {
@@ -82,3 +86,43 @@ func (st *SessionStorage) FindByToken(token string) (*session.Session, error) {
 
 	return &s, nil
 }
+
+const deleteSessionsByUserIDQuery = "DELETE FROM sessions WHERE user_id=$1"
+
+func (st *SessionStorage) DeleteByUserID(userID int64) error {
+	if _, err := st.deleteByID.Exec(userID); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
+
+const findAllSessionsQuery = "SELECT " + sessionFields + " FROM sessions WHERE user_id=$1 ORDER BY created_at"
+
+func (st *SessionStorage) FindAllByUserID(userID int64) ([]*session.Session, error) {
+	rows, err := st.findAll.Query(userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't exec query to get sessions")
+	}
+
+	defer rows.Close()
+
+	sessions := make([]*session.Session, 0)
+
+	for rows.Next() {
+		var s session.Session
+
+		err = scanSession(rows, &s)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't scan row with session")
+		}
+
+		sessions = append(sessions, &s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows contain error")
+	}
+
+	return sessions, nil
+}
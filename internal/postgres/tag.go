@@ -0,0 +1,213 @@
+package postgres
+
+import (
+	"cw1/internal/tag"
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+var _ tag.Storage = &TagStorage{}
+
+const uniqueViolation = "23505"
+
+type TagStorage struct {
+	statementStorage
+
+	createStmt         *sql.Stmt
+	findByIDStmt       *sql.Stmt
+	findByUserIDStmt   *sql.Stmt
+	updateStmt         *sql.Stmt
+	deleteStmt         *sql.Stmt
+	ensureStmt         *sql.Stmt
+	clearRobotStmt     *sql.Stmt
+	addRobotStmt       *sql.Stmt
+	findByRobotIDsStmt *sql.Stmt
+}
+
+func NewTagStorage(db *DB) (*TagStorage, error) {
+	s := &TagStorage{statementStorage: newStatementsStorage(db)}
+
+	stmts := []stmt{
+		{Query: createTagQuery, Dst: &s.createStmt},
+		{Query: findTagByIDQuery, Dst: &s.findByIDStmt},
+		{Query: findTagsByUserIDQuery, Dst: &s.findByUserIDStmt},
+		{Query: updateTagQuery, Dst: &s.updateStmt},
+		{Query: deleteTagQuery, Dst: &s.deleteStmt},
+		{Query: ensureTagsQuery, Dst: &s.ensureStmt},
+		{Query: clearRobotTagsQuery, Dst: &s.clearRobotStmt},
+		{Query: addRobotTagsQuery, Dst: &s.addRobotStmt},
+		{Query: findTagsByRobotIDsQuery, Dst: &s.findByRobotIDsStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+const tagFields = "id, user_id, name, created_at"
+
+func scanTag(scanner sqlScanner, t *tag.Tag) error {
+	return scanner.Scan(&t.ID, &t.UserID, &t.Name, &t.CreatedAt)
+}
+
+// tagError replaces violation of the unique name with tag.ErrExists.
+func tagError(err error) error {
+	if e, ok := err.(*pq.Error); ok && e.Code == uniqueViolation {
+		return tag.ErrExists
+	}
+
+	return errors.Wrap(err, "can't exec query")
+}
+
+const createTagQuery = "INSERT INTO tags(user_id, name) VALUES ($1, $2) RETURNING " + tagFields
+
+func (s *TagStorage) Create(t *tag.Tag) error {
+	row := s.createStmt.QueryRow(t.UserID, t.Name)
+	if err := scanTag(row, t); err != nil {
+		return tagError(err)
+	}
+
+	return nil
+}
+
+const findTagByIDQuery = "SELECT " + tagFields + " FROM tags WHERE id=$1"
+
+func (s *TagStorage) FindByID(id int64) (*tag.Tag, error) {
+	var t tag.Tag
+
+	row := s.findByIDStmt.QueryRow(id)
+	if err := scanTag(row, &t); err != nil {
+		if err == sql.ErrNoRows {
+			return &tag.Tag{}, nil
+		}
+
+		return &t, errors.Wrap(err, "can't scan tag")
+	}
+
+	return &t, nil
+}
+
+const findTagsByUserIDQuery = "SELECT " + tagFields + " FROM tags WHERE user_id=$1 ORDER BY name"
+
+func (s *TagStorage) FindByUserID(userID int64) ([]*tag.Tag, error) {
+	rows, err := s.findByUserIDStmt.Query(userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't exec query to get tags")
+	}
+
+	defer rows.Close()
+
+	tags := make([]*tag.Tag, 0)
+
+	for rows.Next() {
+		var t tag.Tag
+
+		err = scanTag(rows, &t)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't scan row with tag")
+		}
+
+		tags = append(tags, &t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows contain error")
+	}
+
+	return tags, nil
+}
+
+const updateTagQuery = "UPDATE tags SET name=$2 WHERE id=$1"
+
+func (s *TagStorage) Update(t *tag.Tag) error {
+	if _, err := s.updateStmt.Exec(t.ID, t.Name); err != nil {
+		return tagError(err)
+	}
+
+	return nil
+}
+
+const deleteTagQuery = "DELETE FROM tags WHERE id=$1"
+
+func (s *TagStorage) Delete(id int64) error {
+	if _, err := s.deleteStmt.Exec(id); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
+
+const ensureTagsQuery = "INSERT INTO tags(user_id, name) SELECT $1, unnest($2::text[]) " +
+	"ON CONFLICT (user_id, name) DO NOTHING"
+const clearRobotTagsQuery = "DELETE FROM robot_tags WHERE robot_id=$1"
+const addRobotTagsQuery = "INSERT INTO robot_tags(robot_id, tag_id) SELECT $1, id FROM tags " +
+	"WHERE user_id=$2 AND name = ANY($3)"
+
+func (s *TagStorage) SetRobotTags(robotID int64, userID int64, names []string) (err error) {
+	tx, err := s.db.Session.Begin()
+	if err != nil {
+		return errors.Wrap(err, "can't begin transaction")
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.Stmt(s.ensureStmt).Exec(userID, pq.Array(names)); err != nil {
+		return errors.Wrap(err, "can't exec query to create tags")
+	}
+
+	if _, err = tx.Stmt(s.clearRobotStmt).Exec(robotID); err != nil {
+		return errors.Wrap(err, "can't exec query to clear tags of robot")
+	}
+
+	if _, err = tx.Stmt(s.addRobotStmt).Exec(robotID, userID, pq.Array(names)); err != nil {
+		return errors.Wrap(err, "can't exec query to add tags to robot")
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "can't commit transaction")
+	}
+
+	return nil
+}
+
+const findTagsByRobotIDsQuery = "SELECT rt.robot_id, t.name FROM robot_tags rt JOIN tags t ON t.id = rt.tag_id " +
+	"WHERE rt.robot_id = ANY($1) ORDER BY t.name"
+
+func (s *TagStorage) FindByRobotIDs(robotIDs []int64) (map[int64][]string, error) {
+	rows, err := s.findByRobotIDsStmt.Query(pq.Array(robotIDs))
+	if err != nil {
+		return nil, errors.Wrap(err, "can't exec query to get tags of robots")
+	}
+
+	defer rows.Close()
+
+	tags := make(map[int64][]string)
+
+	for rows.Next() {
+		var (
+			id   int64
+			name string
+		)
+
+		err = rows.Scan(&id, &name)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't scan row with tag")
+		}
+
+		tags[id] = append(tags[id], name)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows contain error")
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,140 @@
+package postgres
+
+import (
+	"cw1/internal/totp"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+var _ totp.Storage = &TOTPStorage{}
+
+type TOTPStorage struct {
+	statementStorage
+
+	findStmt             *sql.Stmt
+	saveStmt             *sql.Stmt
+	deleteStmt           *sql.Stmt
+	useStepStmt          *sql.Stmt
+	useRecoveryCodeStmt  *sql.Stmt
+	createChallengeStmt  *sql.Stmt
+	consumeChallengeStmt *sql.Stmt
+}
+
+func NewTOTPStorage(db *DB) (*TOTPStorage, error) {
+	s := &TOTPStorage{statementStorage: newStatementsStorage(db)}
+
+	stmts := []stmt{
+		{Query: findTOTPQuery, Dst: &s.findStmt},
+		{Query: saveTOTPQuery, Dst: &s.saveStmt},
+		{Query: deleteTOTPQuery, Dst: &s.deleteStmt},
+		{Query: useTOTPStepQuery, Dst: &s.useStepStmt},
+		{Query: useRecoveryCodeQuery, Dst: &s.useRecoveryCodeStmt},
+		{Query: createChallengeQuery, Dst: &s.createChallengeStmt},
+		{Query: consumeChallengeQuery, Dst: &s.consumeChallengeStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+const totpFields = "user_id, secret, enabled, last_used_step, recovery_codes, created_at"
+const findTOTPQuery = "SELECT " + totpFields + " FROM two_factor WHERE user_id=$1"
+
+func (s *TOTPStorage) Find(userID int64) (*totp.Enrollment, error) {
+	var e totp.Enrollment
+
+	row := s.findStmt.QueryRow(userID)
+	if err := row.Scan(&e.UserID, &e.Secret, &e.Enabled, &e.LastUsedStep, pq.Array(&e.RecoveryCodes), &e.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return &e, nil
+		}
+
+		return &e, errors.Wrap(err, "can't scan two-factor enrollment")
+	}
+
+	return &e, nil
+}
+
+const saveTOTPQuery = "INSERT INTO two_factor(user_id, secret, enabled, last_used_step, recovery_codes) " +
+	"VALUES ($1, $2, $3, $4, $5) ON CONFLICT (user_id) DO UPDATE SET " +
+	"secret=EXCLUDED.secret, enabled=EXCLUDED.enabled, last_used_step=EXCLUDED.last_used_step, " +
+	"recovery_codes=EXCLUDED.recovery_codes RETURNING created_at"
+
+func (s *TOTPStorage) Save(e *totp.Enrollment) error {
+	row := s.saveStmt.QueryRow(e.UserID, e.Secret, e.Enabled, e.LastUsedStep, pq.Array(e.RecoveryCodes))
+	if err := row.Scan(&e.CreatedAt); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
+
+const deleteTOTPQuery = "DELETE FROM two_factor WHERE user_id=$1"
+
+func (s *TOTPStorage) Delete(userID int64) error {
+	if _, err := s.deleteStmt.Exec(userID); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
+
+const useTOTPStepQuery = "UPDATE two_factor SET last_used_step=$2 WHERE user_id=$1 AND last_used_step < $2"
+
+func (s *TOTPStorage) UseStep(userID int64, step int64) (bool, error) {
+	return execAffected(s.useStepStmt, userID, step)
+}
+
+const useRecoveryCodeQuery = "UPDATE two_factor SET recovery_codes=array_remove(recovery_codes, $2) " +
+	"WHERE user_id=$1 AND $2 = ANY(recovery_codes)"
+
+func (s *TOTPStorage) UseRecoveryCode(userID int64, hash string) (bool, error) {
+	return execAffected(s.useRecoveryCodeStmt, userID, hash)
+}
+
+const createChallengeQuery = "INSERT INTO two_factor_challenges(hash, user_id, expires_at) VALUES ($1, $2, $3)"
+
+func (s *TOTPStorage) CreateChallenge(hash string, userID int64, expiresAt time.Time) error {
+	if _, err := s.createChallengeStmt.Exec(hash, userID, expiresAt); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
+
+const consumeChallengeQuery = "UPDATE two_factor_challenges SET used_at=$2 " +
+	"WHERE hash=$1 AND used_at IS NULL AND expires_at > $2 RETURNING user_id"
+
+func (s *TOTPStorage) ConsumeChallenge(hash string, now time.Time) (int64, error) {
+	var userID int64
+
+	if err := s.consumeChallengeStmt.QueryRow(hash, now).Scan(&userID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+
+		return 0, errors.Wrap(err, "can't exec query")
+	}
+
+	return userID, nil
+}
+
+func execAffected(stmt *sql.Stmt, args ...interface{}) (bool, error) {
+	res, err := stmt.Exec(args...)
+	if err != nil {
+		return false, errors.Wrap(err, "can't exec query")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "can't get number of affected rows")
+	}
+
+	return n > 0, nil
+}
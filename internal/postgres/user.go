@@ -16,6 +16,8 @@ type UserStorage struct {
 	findByEmailStmt *sql.Stmt
 	findByIDStmt    *sql.Stmt
 	updateStmt      *sql.Stmt
+	getAllStmt      *sql.Stmt
+	eraseStmts      []*sql.Stmt
 }
 
 func NewUserStorage(db *DB) (*UserStorage, error) {
@@ -26,6 +28,12 @@ func NewUserStorage(db *DB) (*UserStorage, error) {
 		{Query: findUserByEmailQuery, Dst: &s.findByEmailStmt},
 		{Query: findUserByIDQuery, Dst: &s.findByIDStmt},
 		{Query: updateUserQuery, Dst: &s.updateStmt},
+		{Query: getAllUsersQuery, Dst: &s.getAllStmt},
+	}
+
+	s.eraseStmts = make([]*sql.Stmt, len(eraseUserQueries))
+	for i, q := range eraseUserQueries {
+		stmts = append(stmts, stmt{Query: q, Dst: &s.eraseStmts[i]})
 	}
 
 	if err := s.initStatements(stmts); err != nil {
@@ -36,21 +44,21 @@ func NewUserStorage(db *DB) (*UserStorage, error) {
 }
 
 func scanUser(scanner sqlScanner, u *user.User) error {
-	return scanner.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Birthday, &u.Email, &u.Password, &u.UpdatedAt, &u.CreatedAt)
+	return scanner.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Birthday, &u.Email, &u.Password, &u.UpdatedAt, &u.CreatedAt, &u.Role, &u.Verified)
 }
 
-const userCreateFields = "first_name, last_name, birthday, email, password"
-const createUserQuery = "INSERT INTO users(" + userCreateFields + ") VALUES ($1, $2, $3, $4, $5) RETURNING id"
+const userCreateFields = "first_name, last_name, birthday, email, password, email_verified"
+const createUserQuery = "INSERT INTO users(" + userCreateFields + ") VALUES ($1, $2, $3, $4, $5, $6) RETURNING id"
 
 func (s *UserStorage) Create(u *user.User) error {
-	if err := s.createStmt.QueryRow(u.FirstName, u.LastName, u.Birthday, u.Email, u.Password).Scan(&u.ID); err != nil {
+	if err := s.createStmt.QueryRow(u.FirstName, u.LastName, u.Birthday, u.Email, u.Password, u.Verified).Scan(&u.ID); err != nil {
 		return errors.Wrap(err, "can't exec query")
 	}
 
 	return nil
 }
 
-const userFields = "first_name, last_name, birthday, email, password, updated_at, created_at"
+const userFields = "first_name, last_name, birthday, email, password, updated_at, created_at, role, email_verified"
 const findUserByEmailQuery = "SELECT id, " + userFields + " FROM users WHERE email=$1"
 
 func (s *UserStorage) FindByEmail(email string) (*user.User, error) {
@@ -85,14 +93,104 @@ func (s *UserStorage) FindByID(id int64) (*user.User, error) {
 	return &u, nil
 }
 
-const updateUserQuery = "UPDATE users SET first_name=$1, last_name=$2, birthday=$3, email=$4, password=$5, updated_at=$6 " +
-	"WHERE id=$7 RETURNING id, " + userFields
+const updateUserQuery = "UPDATE users SET first_name=$1, last_name=$2, birthday=$3, email=$4, password=$5, updated_at=$6, " +
+	"email_verified=$7 WHERE id=$8 RETURNING id, " + userFields
 
 func (s *UserStorage) Update(u *user.User) error {
-	row := s.updateStmt.QueryRow(u.FirstName, u.LastName, u.Birthday, u.Email, u.Password, u.UpdatedAt, u.ID)
+	row := s.updateStmt.QueryRow(u.FirstName, u.LastName, u.Birthday, u.Email, u.Password, u.UpdatedAt, u.Verified, u.ID)
 	if err := scanUser(row, u); err != nil {
 		return errors.Wrap(err, "can't exec query")
 	}
 
 	return nil
 }
+
+const getAllUsersQuery = "SELECT id, " + userFields + " FROM users ORDER BY id"
+
+func (s *UserStorage) GetAll() ([]*user.User, error) {
+	rows, err := s.getAllStmt.Query()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't exec query to get users")
+	}
+
+	defer rows.Close()
+
+	users := make([]*user.User, 0)
+
+	for rows.Next() {
+		var u user.User
+
+		err = scanUser(rows, &u)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't scan row with user")
+		}
+
+		users = append(users, &u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows contain error")
+	}
+
+	return users, nil
+}
+
+// the user is locked first, so it can't change the data while it's erased
+const lockUserQuery = "SELECT id FROM users WHERE id=$1 FOR UPDATE"
+
+// the version is bumped, so the trade engine doesn't overwrite retired robots
+const retireUserRobotsQuery = "UPDATE robots SET is_active=false, " +
+	"deactivated_at=CASE WHEN is_active THEN now() ELSE deactivated_at END, " +
+	"deleted_at=COALESCE(deleted_at, now()), version=version+1 " +
+	"WHERE owner_user_id=$1 AND (is_active OR deleted_at IS NULL)"
+
+// global templates are shared with other users and stay
+const deleteUserTemplatesQuery = "DELETE FROM robot_templates WHERE owner_user_id=$1 AND NOT global"
+
+// the email stays unique and can't receive mails, the empty password never matches
+const anonymizeUserQuery = "UPDATE users SET first_name='', last_name='', birthday=NULL, " +
+	"email='deleted-' || id || '@deleted.invalid', password='', email_verified=false, " +
+	"updated_at=now(), deleted_at=now() WHERE id=$1"
+
+// eraseUserQueries run in order, deliveries go with webhooks and robot tags
+// with tags by cascades.
+var eraseUserQueries = []string{
+	lockUserQuery,
+	retireUserRobotsQuery,
+	"DELETE FROM robot_jobs WHERE user_id=$1",
+	"DELETE FROM api_keys WHERE user_id=$1",
+	"DELETE FROM two_factor_challenges WHERE user_id=$1",
+	"DELETE FROM two_factor WHERE user_id=$1",
+	"DELETE FROM password_resets WHERE user_id=$1",
+	"DELETE FROM email_verifications WHERE user_id=$1",
+	"DELETE FROM webhooks WHERE user_id=$1",
+	"DELETE FROM tags WHERE user_id=$1",
+	deleteUserTemplatesQuery,
+	"DELETE FROM sessions WHERE user_id=$1",
+	anonymizeUserQuery,
+}
+
+func (s *UserStorage) Erase(id int64) (err error) {
+	tx, err := s.db.Session.Begin()
+	if err != nil {
+		return errors.Wrap(err, "can't begin transaction")
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	for _, stmt := range s.eraseStmts {
+		if _, err = tx.Stmt(stmt).Exec(id); err != nil {
+			return errors.Wrap(err, "can't exec query")
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "can't commit transaction")
+	}
+
+	return nil
+}
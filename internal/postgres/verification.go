@@ -0,0 +1,82 @@
+package postgres
+
+import (
+	"cw1/internal/verification"
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var _ verification.Storage = &VerificationStorage{}
+
+type VerificationStorage struct {
+	statementStorage
+
+	createStmt        *sql.Stmt
+	consumeStmt       *sql.Stmt
+	lastCreatedAtStmt *sql.Stmt
+}
+
+func NewVerificationStorage(db *DB) (*VerificationStorage, error) {
+	s := &VerificationStorage{statementStorage: newStatementsStorage(db)}
+
+	stmts := []stmt{
+		{Query: createVerificationQuery, Dst: &s.createStmt},
+		{Query: consumeVerificationQuery, Dst: &s.consumeStmt},
+		{Query: lastVerificationCreatedAtQuery, Dst: &s.lastCreatedAtStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+const verificationFields = "user_id, email, hash, expires_at, created_at"
+
+const createVerificationQuery = "INSERT INTO email_verifications(" + verificationFields + ") " +
+	"VALUES ($1, $2, $3, $4, $5) RETURNING id"
+
+func (s *VerificationStorage) Create(t *verification.Token) error {
+	if err := s.createStmt.QueryRow(t.UserID, t.Email, t.Hash, t.ExpiresAt, t.CreatedAt).Scan(&t.ID); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
+
+const consumeVerificationQuery = "UPDATE email_verifications SET used_at=$2 " +
+	"WHERE hash=$1 AND used_at IS NULL AND expires_at > $2 RETURNING id, " + verificationFields
+
+func (s *VerificationStorage) Consume(hash string, now time.Time) (*verification.Token, error) {
+	var t verification.Token
+
+	row := s.consumeStmt.QueryRow(hash, now)
+	if err := row.Scan(&t.ID, &t.UserID, &t.Email, &t.Hash, &t.ExpiresAt, &t.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return &t, nil
+		}
+
+		return &t, errors.Wrap(err, "can't exec query")
+	}
+
+	return &t, nil
+}
+
+const lastVerificationCreatedAtQuery = "SELECT COALESCE(MAX(created_at), 'epoch') FROM email_verifications WHERE user_id=$1"
+
+func (s *VerificationStorage) LastCreatedAt(userID int64) (time.Time, error) {
+	var t time.Time
+
+	if err := s.lastCreatedAtStmt.QueryRow(userID).Scan(&t); err != nil {
+		return time.Time{}, errors.Wrap(err, "can't exec query")
+	}
+
+	if t.Unix() == 0 {
+		return time.Time{}, nil
+	}
+
+	return t, nil
+}
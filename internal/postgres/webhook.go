@@ -0,0 +1,278 @@
+package postgres
+
+import (
+	"cw1/internal/webhook"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+var _ webhook.Storage = &WebhookStorage{}
+
+type WebhookStorage struct {
+	statementStorage
+
+	createHookStmt        *sql.Stmt
+	findHookByIDStmt      *sql.Stmt
+	findHooksByUserIDStmt *sql.Stmt
+	findSubscribedStmt    *sql.Stmt
+	updateHookStmt        *sql.Stmt
+	deleteHookStmt        *sql.Stmt
+	createDeliveryStmt    *sql.Stmt
+	findDeliveryByIDStmt  *sql.Stmt
+	findDeliveriesStmt    *sql.Stmt
+	dueDeliveriesStmt     *sql.Stmt
+	claimDeliveryStmt     *sql.Stmt
+	updateDeliveryStmt    *sql.Stmt
+}
+
+func NewWebhookStorage(db *DB) (*WebhookStorage, error) {
+	s := &WebhookStorage{statementStorage: newStatementsStorage(db)}
+
+	stmts := []stmt{
+		{Query: createHookQuery, Dst: &s.createHookStmt},
+		{Query: findHookByIDQuery, Dst: &s.findHookByIDStmt},
+		{Query: findHooksByUserIDQuery, Dst: &s.findHooksByUserIDStmt},
+		{Query: findSubscribedHooksQuery, Dst: &s.findSubscribedStmt},
+		{Query: updateHookQuery, Dst: &s.updateHookStmt},
+		{Query: deleteHookQuery, Dst: &s.deleteHookStmt},
+		{Query: createDeliveryQuery, Dst: &s.createDeliveryStmt},
+		{Query: findDeliveryByIDQuery, Dst: &s.findDeliveryByIDStmt},
+		{Query: findDeliveriesQuery, Dst: &s.findDeliveriesStmt},
+		{Query: dueDeliveriesQuery, Dst: &s.dueDeliveriesStmt},
+		{Query: claimDeliveryQuery, Dst: &s.claimDeliveryStmt},
+		{Query: updateDeliveryQuery, Dst: &s.updateDeliveryStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+const hookFields = "id, user_id, url, events, secret, active, created_at"
+
+func scanHook(scanner sqlScanner, h *webhook.Hook) error {
+	return scanner.Scan(&h.ID, &h.UserID, &h.URL, pq.Array(&h.Events), &h.Secret, &h.Active, &h.CreatedAt)
+}
+
+func scanHooks(rows *sql.Rows) ([]*webhook.Hook, error) {
+	defer rows.Close()
+
+	hooks := make([]*webhook.Hook, 0)
+
+	for rows.Next() {
+		var h webhook.Hook
+
+		if err := scanHook(rows, &h); err != nil {
+			return nil, errors.Wrap(err, "can't scan row with hook")
+		}
+
+		hooks = append(hooks, &h)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows contain error")
+	}
+
+	return hooks, nil
+}
+
+const createHookQuery = "INSERT INTO webhooks(user_id, url, events, secret, active) VALUES ($1, $2, $3, $4, $5) " +
+	"RETURNING " + hookFields
+
+func (s *WebhookStorage) CreateHook(h *webhook.Hook) error {
+	row := s.createHookStmt.QueryRow(h.UserID, h.URL, pq.Array(h.Events), h.Secret, h.Active)
+	if err := scanHook(row, h); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
+
+const findHookByIDQuery = "SELECT " + hookFields + " FROM webhooks WHERE id=$1"
+
+func (s *WebhookStorage) FindHookByID(id int64) (*webhook.Hook, error) {
+	var h webhook.Hook
+
+	row := s.findHookByIDStmt.QueryRow(id)
+	if err := scanHook(row, &h); err != nil {
+		if err == sql.ErrNoRows {
+			return &webhook.Hook{}, nil
+		}
+
+		return &h, errors.Wrap(err, "can't scan hook")
+	}
+
+	return &h, nil
+}
+
+const findHooksByUserIDQuery = "SELECT " + hookFields + " FROM webhooks WHERE user_id=$1 ORDER BY id"
+
+func (s *WebhookStorage) FindHooksByUserID(userID int64) ([]*webhook.Hook, error) {
+	rows, err := s.findHooksByUserIDStmt.Query(userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't exec query to get hooks")
+	}
+
+	return scanHooks(rows)
+}
+
+const findSubscribedHooksQuery = "SELECT " + hookFields + " FROM webhooks " +
+	"WHERE user_id=$1 AND active AND $2=ANY(events) ORDER BY id"
+
+func (s *WebhookStorage) FindSubscribed(userID int64, eventType string) ([]*webhook.Hook, error) {
+	rows, err := s.findSubscribedStmt.Query(userID, eventType)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't exec query to get subscribed hooks")
+	}
+
+	return scanHooks(rows)
+}
+
+const updateHookQuery = "UPDATE webhooks SET url=$2, events=$3, active=$4 WHERE id=$1"
+
+func (s *WebhookStorage) UpdateHook(h *webhook.Hook) error {
+	if _, err := s.updateHookStmt.Exec(h.ID, h.URL, pq.Array(h.Events), h.Active); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
+
+const deleteHookQuery = "DELETE FROM webhooks WHERE id=$1"
+
+func (s *WebhookStorage) DeleteHook(id int64) error {
+	if _, err := s.deleteHookStmt.Exec(id); err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
+
+const deliveryFields = "id, webhook_id, event_id, event_type, payload, status, attempts, response_status, " +
+	"last_error, next_attempt_at, delivered_at, created_at"
+
+func scanDelivery(scanner sqlScanner, d *webhook.Delivery) error {
+	var payload []byte
+
+	err := scanner.Scan(&d.ID, &d.HookID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts,
+		&d.ResponseStatus, &d.LastError, &d.NextAttemptAt, &d.DeliveredAt, &d.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	d.Payload = payload
+
+	return nil
+}
+
+func scanDeliveries(rows *sql.Rows) ([]*webhook.Delivery, error) {
+	defer rows.Close()
+
+	deliveries := make([]*webhook.Delivery, 0)
+
+	for rows.Next() {
+		var d webhook.Delivery
+
+		if err := scanDelivery(rows, &d); err != nil {
+			return nil, errors.Wrap(err, "can't scan row with delivery")
+		}
+
+		deliveries = append(deliveries, &d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows contain error")
+	}
+
+	return deliveries, nil
+}
+
+// the event is delivered to the hook once, replays reuse the delivery
+const createDeliveryQuery = "INSERT INTO webhook_deliveries(webhook_id, event_id, event_type, payload, status, " +
+	"next_attempt_at) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (webhook_id, event_id) DO NOTHING " +
+	"RETURNING " + deliveryFields
+
+func (s *WebhookStorage) CreateDelivery(d *webhook.Delivery) error {
+	row := s.createDeliveryStmt.QueryRow(d.HookID, d.EventID, d.EventType, []byte(d.Payload), d.Status,
+		d.NextAttemptAt)
+	if err := scanDelivery(row, d); err != nil && err != sql.ErrNoRows {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
+
+const findDeliveryByIDQuery = "SELECT " + deliveryFields + " FROM webhook_deliveries WHERE id=$1"
+
+func (s *WebhookStorage) FindDeliveryByID(id int64) (*webhook.Delivery, error) {
+	var d webhook.Delivery
+
+	row := s.findDeliveryByIDStmt.QueryRow(id)
+	if err := scanDelivery(row, &d); err != nil {
+		if err == sql.ErrNoRows {
+			return &webhook.Delivery{}, nil
+		}
+
+		return &d, errors.Wrap(err, "can't scan delivery")
+	}
+
+	return &d, nil
+}
+
+const findDeliveriesQuery = "SELECT " + deliveryFields + " FROM webhook_deliveries WHERE webhook_id=$1 " +
+	"ORDER BY id DESC LIMIT $2"
+
+func (s *WebhookStorage) FindDeliveries(hookID int64, limit int) ([]*webhook.Delivery, error) {
+	rows, err := s.findDeliveriesStmt.Query(hookID, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't exec query to get deliveries")
+	}
+
+	return scanDeliveries(rows)
+}
+
+const dueDeliveriesQuery = "SELECT " + deliveryFields + " FROM webhook_deliveries " +
+	"WHERE status='" + webhook.StatusPending + "' AND next_attempt_at <= $1 ORDER BY next_attempt_at, id LIMIT $2"
+
+func (s *WebhookStorage) DueDeliveries(now time.Time, limit int) ([]*webhook.Delivery, error) {
+	rows, err := s.dueDeliveriesStmt.Query(now, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't exec query to get due deliveries")
+	}
+
+	return scanDeliveries(rows)
+}
+
+const claimDeliveryQuery = "UPDATE webhook_deliveries SET next_attempt_at=$3 WHERE id=$1 AND next_attempt_at=$2"
+
+func (s *WebhookStorage) ClaimDelivery(d *webhook.Delivery, until time.Time) (bool, error) {
+	res, err := s.claimDeliveryStmt.Exec(d.ID, d.NextAttemptAt, until)
+	if err != nil {
+		return false, errors.Wrap(err, "can't exec query")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "can't get affected rows")
+	}
+
+	return n == 1, nil
+}
+
+const updateDeliveryQuery = "UPDATE webhook_deliveries SET status=$2, attempts=$3, response_status=$4, " +
+	"last_error=$5, next_attempt_at=$6, delivered_at=$7 WHERE id=$1"
+
+func (s *WebhookStorage) UpdateDelivery(d *webhook.Delivery) error {
+	_, err := s.updateDeliveryStmt.Exec(d.ID, d.Status, d.Attempts, d.ResponseStatus, d.LastError, d.NextAttemptAt,
+		d.DeliveredAt)
+	if err != nil {
+		return errors.Wrap(err, "can't exec query")
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package quote
+
+import (
+	"sync"
+	"time"
+)
+
+// Quote is a price of a ticker received from the trading service.
+type Quote struct {
+	Ticker    string    `json:"ticker"`
+	BuyPrice  float64   `json:"buy_price"`
+	SellPrice float64   `json:"sell_price"`
+	Time      time.Time `json:"time"`
+}
+
+// Book keeps the latest quote of every ticker. Tickers are streamed only while
+// they have active robots, so quotes of other tickers may be old or missing.
+type Book struct {
+	mu     sync.RWMutex
+	quotes map[string]Quote
+}
+
+func NewBook() *Book {
+	return &Book{quotes: make(map[string]Quote)}
+}
+
+// Set keeps the quote unless a later one is already known.
+func (b *Book) Set(q Quote) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if old, ok := b.quotes[q.Ticker]; ok && old.Time.After(q.Time) {
+		return
+	}
+
+	b.quotes[q.Ticker] = q
+}
+
+func (b *Book) Last(ticker string) (Quote, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	q, ok := b.quotes[ticker]
+
+	return q, ok
+}
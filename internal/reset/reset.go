@@ -0,0 +1,32 @@
+package reset
+
+import (
+	"cw1/internal/secret"
+	"time"
+)
+
+// TTL is how long a reset token can be used after it was issued.
+const TTL = time.Hour
+
+type Token struct {
+	ID        int64
+	UserID    int64
+	Hash      string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+type Storage interface {
+	Create(t *Token) error
+	// Consume marks the token as used and returns its user's ID, or zero if the
+	// token doesn't exist, was already used or is expired.
+	Consume(hash string, now time.Time) (int64, error)
+}
+
+func Generate() (string, error) {
+	return secret.Generate()
+}
+
+func Hash(token string) string {
+	return secret.Hash(token)
+}
@@ -0,0 +1,73 @@
+package revision
+
+import (
+	"bytes"
+	"cw1/internal/format"
+	"cw1/internal/robot"
+	"encoding/json"
+	"time"
+)
+
+// Params are the trading parameters of a robot, a revision is made when any of them changes.
+type Params struct {
+	Ticker    *format.NullString  `json:"ticker,omitempty"`
+	BuyPrice  *format.NullFloat64 `json:"buy_price,omitempty"`
+	SellPrice *format.NullFloat64 `json:"sell_price,omitempty"`
+	PlanStart *format.NullTime    `json:"plan_start,omitempty"`
+	PlanEnd   *format.NullTime    `json:"plan_end,omitempty"`
+	PlanYield *format.NullFloat64 `json:"plan_yield,omitempty"`
+}
+
+func ParamsOf(r *robot.Robot) Params {
+	return Params{
+		Ticker:    r.Ticker,
+		BuyPrice:  r.BuyPrice,
+		SellPrice: r.SellPrice,
+		PlanStart: r.PlanStart,
+		PlanEnd:   r.PlanEnd,
+		PlanYield: r.PlanYield,
+	}
+}
+
+func (p Params) Apply(r *robot.Robot) {
+	r.Ticker = p.Ticker
+	r.BuyPrice = p.BuyPrice
+	r.SellPrice = p.SellPrice
+	r.PlanStart = p.PlanStart
+	r.PlanEnd = p.PlanEnd
+	r.PlanYield = p.PlanYield
+}
+
+// Equal compares parameters the way clients see them.
+func (p Params) Equal(o Params) bool {
+	a, err := json.Marshal(p)
+	if err != nil {
+		return false
+	}
+
+	b, err := json.Marshal(o)
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(a, b)
+}
+
+// Revision is an immutable state of parameters of the robot. Revisions of a
+// robot are numbered from one in the order they were made.
+type Revision struct {
+	RobotID int64 `json:"robot_id"`
+	Rev     int64 `json:"rev"`
+	Params
+	AuthorID  int64     `json:"author_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Storage interface {
+	// Create sets the number of the next revision of the robot.
+	Create(r *Revision) error
+	// FindByRobotID returns the newest revisions first.
+	FindByRobotID(robotID int64) ([]*Revision, error)
+	// Find returns the revision, Rev is zero when it doesn't exist.
+	Find(robotID int64, rev int64) (*Revision, error)
+}
@@ -0,0 +1,133 @@
+package robot
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Fields robot lists can be sorted by, robots with equal values are ordered by id.
+const (
+	SortID         = "robot_id"
+	SortFactYield  = "fact_yield"
+	SortDealsCount = "deals_count"
+	SortCreatedAt  = "created_at"
+	SortPlanEnd    = "plan_end"
+)
+
+func IsSortField(s string) bool {
+	switch s {
+	case SortID, SortFactYield, SortDealsCount, SortCreatedAt, SortPlanEnd:
+		return true
+	default:
+		return false
+	}
+}
+
+// Filter selects robots for lists, zero values of fields don't restrict the list.
+// Robots after the cursor are returned, Limit zero means no limit. VisibleTo
+// limits robots of other users to public ones, Deleted lists only deleted robots.
+// Robots must have all the Tags of the user TagsOf, tags are private to their owner.
+type Filter struct {
+	OwnerID        int64
+	Ticker         string
+	Tags           []string
+	TagsOf         int64
+	Active         *bool
+	Favourite      *bool
+	MinYield       *float64
+	MaxYield       *float64
+	PlanFrom       *time.Time
+	PlanTo         *time.Time
+	IncludeDeleted bool
+	Deleted        bool
+	Visibility     string
+	VisibleTo      int64
+	Sort           string
+	Desc           bool
+	After          *Cursor
+	Limit          int
+}
+
+// Cursor points at the last robot of a page. Value is the sort field of the
+// robot, it's empty when the field is null.
+type Cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v,omitempty"`
+	ID    int64  `json:"id"`
+}
+
+// CursorAfter returns the cursor for the page after r in the list sorted by f.
+func CursorAfter(r *Robot, f Filter) *Cursor {
+	c := &Cursor{Sort: f.Sort, Desc: f.Desc, ID: r.RobotID}
+
+	switch f.Sort {
+	case SortFactYield:
+		if r.FactYield != nil && r.FactYield.V.Valid {
+			c.Value = strconv.FormatFloat(r.FactYield.V.Float64, 'g', -1, 64)
+		}
+	case SortDealsCount:
+		if r.DealsCount != nil && r.DealsCount.V.Valid {
+			c.Value = strconv.FormatInt(r.DealsCount.V.Int64, 10)
+		}
+	case SortCreatedAt:
+		if r.CreatedAt != nil && r.CreatedAt.V.Valid {
+			c.Value = r.CreatedAt.V.Time.Format(time.RFC3339Nano)
+		}
+	case SortPlanEnd:
+		if r.PlanEnd != nil && r.PlanEnd.V.Valid {
+			c.Value = r.PlanEnd.V.Time.Format(time.RFC3339Nano)
+		}
+	}
+
+	return c
+}
+
+func (c *Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't decode cursor")
+	}
+
+	var c Cursor
+
+	err = json.Unmarshal(b, &c)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't unmarshal cursor")
+	}
+
+	if !IsSortField(c.Sort) {
+		return nil, errors.Errorf("cursor has unknown sort field: %v", c.Sort)
+	}
+
+	if c.Value == "" {
+		return &c, nil
+	}
+
+	switch c.Sort {
+	case SortFactYield:
+		_, err = strconv.ParseFloat(c.Value, 64)
+	case SortDealsCount:
+		_, err = strconv.ParseInt(c.Value, 10, 64)
+	case SortCreatedAt, SortPlanEnd:
+		_, err = time.Parse(time.RFC3339Nano, c.Value)
+	default:
+		err = errors.Errorf("cursor of %v can't have a value", c.Sort)
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "cursor has incorrect value")
+	}
+
+	return &c, nil
+}
@@ -2,6 +2,9 @@ package robot
 
 import (
 	"cw1/internal/format"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 type Robot struct {
@@ -22,6 +25,46 @@ type Robot struct {
 	DeactivatedAt *format.NullTime    `json:"deactivated_at,omitempty"`
 	CreatedAt     *format.NullTime    `json:"created_at,omitempty"`
 	DeletedAt     *format.NullTime    `json:"deleted_at,omitempty"`
+	Visibility    string              `json:"visibility,omitempty"`
+	// Version is incremented by every update of the robot.
+	Version int64 `json:"version,omitempty"`
+	// Tags are names of tags of the owner, they aren't kept by Storage.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// Visibility of robots to users other than the owner. Unlisted robots can be
+// read by everyone who knows their id, public ones are listed in the catalogue too.
+const (
+	VisibilityPrivate  = "private"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPublic   = "public"
+)
+
+func IsVisibility(v string) bool {
+	switch v {
+	case VisibilityPrivate, VisibilityUnlisted, VisibilityPublic:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsShared reports whether users other than the owner can read the robot.
+func (r *Robot) IsShared() bool {
+	return r.Visibility == VisibilityUnlisted || r.Visibility == VisibilityPublic
+}
+
+// ErrConflict is returned by updates when the version of the robot isn't the stored one.
+var ErrConflict = errors.New("robot was modified concurrently")
+
+// Deal is a completed pair of buying and selling a lot by the robot.
+type Deal struct {
+	ID        int64     `json:"id"`
+	RobotID   int64     `json:"robot_id"`
+	BuyPrice  float64   `json:"buy_price"`
+	SellPrice float64   `json:"sell_price"`
+	Yield     float64   `json:"yield"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type Storage interface {
@@ -29,8 +72,13 @@ type Storage interface {
 	FindByID(id int64) (*Robot, error)
 	FindByOwnerID(id int64) ([]*Robot, error)
 	FindByTicker(ticker string) ([]*Robot, error)
-	GetAll(id int64, ticker string) ([]*Robot, error)
+	List(f Filter) ([]*Robot, error)
+	// Update and UpdateBesidesActive save the robot if its version is the stored
+	// one and return ErrConflict otherwise, r gets the new version.
 	Update(r *Robot) error
 	UpdateBesidesActive(r *Robot) error
 	GetActiveRobots() ([]*Robot, error)
+	// AddDeal keeps the history of deals, totals of the robot are saved by updates.
+	AddDeal(d *Deal) error
+	FindDealsByOwnerID(id int64) ([]*Deal, error)
 }
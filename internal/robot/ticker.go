@@ -0,0 +1,17 @@
+package robot
+
+// DefaultTickers are the instruments robots can trade when the list isn't configured.
+var DefaultTickers = []string{
+	"AAPL", "AMZN", "FB", "GOOGL", "INTC", "MSFT", "NFLX", "NVDA", "TSLA",
+	"SPFB.RTS", "SPFB.Si", "SBER", "GAZP", "YNDX",
+}
+
+// TickerSet makes a set of tickers for lookups.
+func TickerSet(tickers []string) map[string]bool {
+	set := make(map[string]bool, len(tickers))
+	for _, t := range tickers {
+		set[t] = true
+	}
+
+	return set
+}
@@ -0,0 +1,89 @@
+package robottemplate
+
+import (
+	"cw1/internal/format"
+	"cw1/internal/quote"
+	"cw1/internal/robot"
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Template describes similar robots. The strategy of a robot is its buy and
+// sell prices, templates keep them as percents relative to the market price:
+// the buy price of a robot is the market buy price changed by BuyPercent.
+// Global templates are shared by admins with all users.
+type Template struct {
+	ID           int64            `json:"id"`
+	OwnerUserID  int64            `json:"owner_user_id"`
+	Global       bool             `json:"global"`
+	Name         string           `json:"name"`
+	BuyPercent   float64          `json:"buy_percent"`
+	SellPercent  float64          `json:"sell_percent"`
+	PlanDuration Duration         `json:"plan_duration"`
+	PlanYield    float64          `json:"plan_yield"`
+	CreatedAt    *format.NullTime `json:"created_at,omitempty"`
+}
+
+// Duration is shown in JSON as a string like "36h".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errors.Wrap(err, "duration must be a string")
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return errors.Wrapf(err, "incorrect duration: %v", s)
+	}
+
+	*d = Duration(v)
+
+	return nil
+}
+
+// Robot makes a robot for the ticker from the template, its plan starts now.
+// Prices are rounded to cents.
+func (t *Template) Robot(ticker string, q quote.Quote, now time.Time) *robot.Robot {
+	r := &robot.Robot{
+		Ticker:     &format.NullString{},
+		BuyPrice:   &format.NullFloat64{},
+		SellPrice:  &format.NullFloat64{},
+		PlanStart:  &format.NullTime{},
+		PlanEnd:    &format.NullTime{},
+		PlanYield:  &format.NullFloat64{},
+		Visibility: robot.VisibilityPrivate,
+	}
+
+	r.Ticker.V.String, r.Ticker.V.Valid = ticker, true
+	r.BuyPrice.V.Float64, r.BuyPrice.V.Valid = relative(q.BuyPrice, t.BuyPercent), true
+	r.SellPrice.V.Float64, r.SellPrice.V.Valid = relative(q.SellPrice, t.SellPercent), true
+	r.PlanStart.V.Time, r.PlanStart.V.Valid = now, true
+	r.PlanEnd.V.Time, r.PlanEnd.V.Valid = now.Add(time.Duration(t.PlanDuration)), true
+	r.PlanYield.V.Float64, r.PlanYield.V.Valid = t.PlanYield, true
+
+	return r
+}
+
+func relative(price float64, percent float64) float64 {
+	const cents = 100
+
+	return math.Round(price*(1+percent/100)*cents) / cents
+}
+
+type Storage interface {
+	Create(t *Template) error
+	FindByID(id int64) (*Template, error)
+	// FindAvailable returns templates of the user and global ones.
+	FindAvailable(userID int64) ([]*Template, error)
+	Update(t *Template) error
+	Delete(id int64) error
+}
@@ -0,0 +1,147 @@
+package schedule
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Cron is a standard five field expression: minute, hour, day of month, month
+// and day of week. Fields accept *, lists, ranges and steps like */15 or 1-5.
+// Days match when either day field matches, unless one of them is *.
+// Times are in UTC.
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+type cronField struct {
+	min, max int
+}
+
+var cronFields = []cronField{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+// maxCronYears limits the search of the next time for expressions like 30 of February.
+const maxCronYears = 5
+
+func ParseCron(s string) (*Cron, error) {
+	parts := strings.Fields(s)
+	if len(parts) != len(cronFields) {
+		return nil, errors.Errorf("cron must have %v fields: %q", len(cronFields), s)
+	}
+
+	bits := make([]uint64, len(parts))
+
+	for i, p := range parts {
+		b, err := parseCronField(p, cronFields[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "incorrect field %v of cron", i+1)
+		}
+
+		bits[i] = b
+	}
+
+	const sunday = 7
+	if bits[4]&(1<<sunday) != 0 {
+		bits[4] |= 1
+	}
+
+	return &Cron{
+		minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],
+		domAny: parts[2] == "*", dowAny: parts[4] == "*",
+	}, nil
+}
+
+func parseCronField(s string, f cronField) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(s, ",") {
+		rng, step := part, 1
+
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+
+			rng = part[:i]
+
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, errors.Errorf("incorrect step: %q", part)
+			}
+		}
+
+		lo, hi := f.min, f.max
+
+		switch i := strings.Index(rng, "-"); {
+		case rng == "*":
+		case i >= 0:
+			var err1, err2 error
+
+			lo, err1 = strconv.Atoi(rng[:i])
+			hi, err2 = strconv.Atoi(rng[i+1:])
+
+			if err1 != nil || err2 != nil {
+				return 0, errors.Errorf("incorrect range: %q", part)
+			}
+		default:
+			v, err := strconv.Atoi(rng)
+			if err != nil {
+				return 0, errors.Errorf("incorrect value: %q", part)
+			}
+
+			lo = v
+			if step == 1 {
+				hi = v
+			}
+		}
+
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, errors.Errorf("%q is out of range %v-%v", part, f.min, f.max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+// Next returns the first time after t matching the expression, it's zero when
+// there is no such time in the next years.
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxCronYears, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case !has(c.month, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case !has(c.hour, t.Hour()):
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case !has(c.minute, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom, dow := has(c.dom, t.Day()), has(c.dow, int(t.Weekday()))
+
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+
+	return dom || dow
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
@@ -0,0 +1,44 @@
+package schedule
+
+import (
+	"cw1/internal/format"
+	"time"
+)
+
+const (
+	ActionActivate   = "activate"
+	ActionDeactivate = "deactivate"
+)
+
+func IsAction(a string) bool {
+	return a == ActionActivate || a == ActionDeactivate
+}
+
+// Job activates or deactivates the robot on behalf of the user once or by the
+// cron expression. NextRunAt is null when a one-off job has run. LastError is
+// empty when the last run succeeded.
+type Job struct {
+	ID        int64            `json:"id"`
+	RobotID   int64            `json:"robot_id"`
+	UserID    int64            `json:"user_id"`
+	Action    string           `json:"action"`
+	Cron      string           `json:"cron,omitempty"`
+	NextRunAt *format.NullTime `json:"next_run_at,omitempty"`
+	LastRunAt *format.NullTime `json:"last_run_at,omitempty"`
+	LastError string           `json:"last_error,omitempty"`
+	CreatedAt *format.NullTime `json:"created_at,omitempty"`
+}
+
+// Storage keeps jobs, several schedulers may share it.
+type Storage interface {
+	Create(j *Job) error
+	FindByID(id int64) (*Job, error)
+	FindByRobotID(robotID int64) ([]*Job, error)
+	Delete(id int64) error
+	// Due returns jobs which should have run by the time, earliest first.
+	Due(now time.Time, limit int) ([]*Job, error)
+	// Claim moves the job to its next run, it reports false when another
+	// scheduler has claimed the job before. Next is nil for one-off jobs.
+	Claim(j *Job, next *time.Time) (bool, error)
+	SetResult(id int64, lastError string) error
+}
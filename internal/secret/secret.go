@@ -0,0 +1,31 @@
+package secret
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+)
+
+// Size is the number of random bytes in generated tokens.
+const Size = 32
+
+// Generate returns a random hex encoded token.
+func Generate() (string, error) {
+	b := make([]byte, Size)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", errors.Wrap(err, "can't read random bytes")
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// Hash returns the form in which tokens are kept in storages.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
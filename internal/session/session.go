@@ -17,6 +17,8 @@ type Storage interface {
 	Create(session *Session) error
 	FindByID(id int64) (*Session, error)
 	FindByToken(token string) (*Session, error)
+	FindAllByUserID(userID int64) ([]*Session, error)
+	DeleteByUserID(userID int64) error
 }
 
 func New(token string, userID int64) (*Session, error) {
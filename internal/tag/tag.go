@@ -0,0 +1,44 @@
+package tag
+
+import (
+	"cw1/internal/format"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const MaxNameLen = 32
+
+// ErrExists is returned when the user already has a tag with the name.
+var ErrExists = errors.New("tag already exists")
+
+// Tag groups robots of a user, names of tags are unique for the user.
+type Tag struct {
+	ID        int64            `json:"id"`
+	UserID    int64            `json:"user_id"`
+	Name      string           `json:"name"`
+	CreatedAt *format.NullTime `json:"created_at,omitempty"`
+}
+
+// Name trims the name of a tag and reports whether it's correct.
+func Name(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	n := utf8.RuneCountInString(s)
+
+	return s, n > 0 && n <= MaxNameLen && !strings.Contains(s, ",")
+}
+
+// Storage keeps tags, a tag is removed from all robots when deleted.
+type Storage interface {
+	Create(t *Tag) error
+	FindByID(id int64) (*Tag, error)
+	FindByUserID(userID int64) ([]*Tag, error)
+	Update(t *Tag) error
+	Delete(id int64) error
+	// SetRobotTags replaces tags of the robot, tags of the user which don't
+	// exist are created.
+	SetRobotTags(robotID int64, userID int64, names []string) error
+	// FindByRobotIDs returns names of tags of every robot sorted by name.
+	FindByRobotIDs(robotIDs []int64) (map[int64][]string, error)
+}
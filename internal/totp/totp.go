@@ -0,0 +1,147 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" //nolint: gosec // RFC 6238 uses HMAC-SHA1 by default
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Period is the time step of codes in seconds.
+	Period = 30
+	// Digits is the length of codes.
+	Digits = 6
+	// Skew is the number of steps before and after the current one which are accepted.
+	Skew = 1
+
+	secretSize        = 20
+	recoveryCodeSize  = 5
+	RecoveryCodeCount = 10
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type Enrollment struct {
+	UserID        int64
+	Secret        string
+	Enabled       bool
+	LastUsedStep  int64
+	RecoveryCodes []string
+	CreatedAt     time.Time
+}
+
+type Storage interface {
+	// Find returns enrollment of the user, it has zero UserID if the user has none.
+	Find(userID int64) (*Enrollment, error)
+	Save(e *Enrollment) error
+	Delete(userID int64) error
+	// UseStep stores the step of the accepted code, it returns false if a code of
+	// the same or a later step was already used.
+	UseStep(userID int64, step int64) (bool, error)
+	// UseRecoveryCode removes the code with the hash and reports whether it existed.
+	UseRecoveryCode(userID int64, hash string) (bool, error)
+	CreateChallenge(hash string, userID int64, expiresAt time.Time) error
+	// ConsumeChallenge returns the user of an unused and not expired challenge or zero.
+	ConsumeChallenge(hash string, now time.Time) (int64, error)
+}
+
+func GenerateSecret() (string, error) {
+	b := make([]byte, secretSize)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", errors.Wrap(err, "can't read random bytes for secret")
+	}
+
+	return encoding.EncodeToString(b), nil
+}
+
+// ProvisioningURI returns the otpauth URI which authenticator apps read from a QR code.
+func ProvisioningURI(issuer string, account string, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(Digits))
+	v.Set("period", fmt.Sprint(Period))
+
+	label := url.PathEscape(issuer + ":" + account)
+
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+func Step(t time.Time) int64 {
+	return t.Unix() / Period
+}
+
+func Code(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", errors.Wrap(err, "can't decode secret")
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	_, _ = mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < Digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", Digits, bin%mod), nil
+}
+
+// Validate checks the code against the steps around t and returns the matched step.
+func Validate(secret string, code string, t time.Time) (int64, bool) {
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	current := Step(t)
+
+	for step := current - Skew; step <= current+Skew; step++ {
+		expected, err := Code(secret, step)
+		if err != nil {
+			return 0, false
+		}
+
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// GenerateRecoveryCodes returns one-time codes which are shown to the user once.
+func GenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, 0, RecoveryCodeCount)
+
+	for i := 0; i < RecoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeSize)
+
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't read random bytes for recovery code")
+		}
+
+		codes = append(codes, strings.ToLower(encoding.EncodeToString(b)))
+	}
+
+	return codes, nil
+}
@@ -6,6 +6,14 @@ import (
 	"fmt"
 )
 
+type Role string
+
+const (
+	RoleUser    Role = "user"
+	RoleSupport Role = "support"
+	RoleAdmin   Role = "admin"
+)
+
 type User struct {
 	ID        int64           `json:"id,omitempty"`
 	FirstName string          `json:"first_name,omitempty"`
@@ -13,6 +21,8 @@ type User struct {
 	Birthday  *format.Day     `json:"birthday,omitempty"`
 	Email     string          `json:"email"`
 	Password  string          `json:"password,omitempty"`
+	Role      Role            `json:"-"`
+	Verified  bool            `json:"-"`
 	UpdatedAt format.NullTime `json:"updated_at,omitempty"`
 	CreatedAt format.NullTime `json:"created_at,omitempty"`
 }
@@ -22,12 +32,17 @@ type Storage interface {
 	FindByEmail(email string) (*User, error)
 	FindByID(id int64) (*User, error)
 	Update(u *User) error
+	GetAll() ([]*User, error)
+	// Erase anonymizes the user, retires its robots and removes its credentials,
+	// webhooks, tags, private templates and jobs in one transaction. The record
+	// itself is kept because robots and their financial results refer to it.
+	Erase(id int64) error
 }
 
 func (u *User) MarshalJSON() ([]byte, error) {
 	var birthday *string
 
-	if u.Birthday.V.Valid {
+	if u.Birthday != nil && u.Birthday.V.Valid {
 		t := u.Birthday.V.Time
 		b := fmt.Sprintf("%d-%02d-%02d", t.Year(), t.Month(), t.Day())
 		birthday = &b
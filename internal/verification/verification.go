@@ -0,0 +1,30 @@
+package verification
+
+import (
+	"time"
+)
+
+const (
+	// TTL is how long a verification link stays valid.
+	TTL = 24 * time.Hour
+	// ResendInterval is the minimal time between two verification mails to one user.
+	ResendInterval = time.Minute
+)
+
+type Token struct {
+	ID        int64
+	UserID    int64
+	Email     string
+	Hash      string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+type Storage interface {
+	Create(t *Token) error
+	// Consume marks the token as used and returns it, the returned token has zero
+	// ID if it doesn't exist, was already used or is expired.
+	Consume(hash string, now time.Time) (*Token, error)
+	// LastCreatedAt returns the time of the latest token of the user or zero time.
+	LastCreatedAt(userID int64) (time.Time, error)
+}
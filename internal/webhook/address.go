@@ -0,0 +1,93 @@
+package webhook
+
+import (
+	"net"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// ErrPrivateAddress is returned for hosts of loopback, link-local and private
+// networks, hooks can't reach the internal network of the service.
+var ErrPrivateAddress = errors.New("address of the hook isn't public")
+
+var privateNets = mustParseNets(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+)
+
+func mustParseNets(cidrs ...string) []*net.IPNet {
+	res := make([]*net.IPNet, 0, len(cidrs))
+
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+
+		res = append(res, n)
+	}
+
+	return res
+}
+
+// IsPublic reports whether the address is outside of loopback, link-local,
+// multicast and private networks.
+func IsPublic(ip net.IP) bool {
+	if ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CheckHost resolves the host of a hook, it returns ErrPrivateAddress when any
+// of its addresses isn't public and they aren't allowed.
+func (d *Dispatcher) CheckHost(host string) error {
+	if d.allowPrivate {
+		return nil
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return errors.Wrapf(err, "can't resolve host %v", host)
+	}
+
+	for _, ip := range ips {
+		if !IsPublic(ip) {
+			return ErrPrivateAddress
+		}
+	}
+
+	return nil
+}
+
+// checkDial is the Control of the dialer, it checks the address after the name
+// is resolved, so the host can't point to the internal network later.
+func checkDial(_ string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.Wrapf(err, "can't parse address %v", address)
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !IsPublic(ip) {
+		return ErrPrivateAddress
+	}
+
+	return nil
+}
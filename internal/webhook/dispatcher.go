@@ -0,0 +1,243 @@
+package webhook
+
+import (
+	"bytes"
+	"cw1/internal/format"
+	"cw1/internal/secret"
+	"cw1/pkg/log/logger"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// MaxAttempts is the number of attempts after which a delivery fails.
+	MaxAttempts = 8
+	// FirstRetry is the delay of the first retry, every next one is twice longer.
+	FirstRetry = 30 * time.Second
+
+	requestTimeout = 10 * time.Second
+	maxDue         = 100
+)
+
+// Dispatcher records deliveries of events and sends them.
+type Dispatcher struct {
+	storage      Storage
+	client       *http.Client
+	logger       logger.Logger
+	allowPrivate bool
+}
+
+// NewDispatcher sends deliveries only to public addresses unless allowPrivate
+// is set, e.g. for a local test receiver. Redirects aren't followed, the
+// response with the redirect fails the attempt.
+func NewDispatcher(s Storage, l logger.Logger, allowPrivate bool) *Dispatcher {
+	dialer := &net.Dialer{Timeout: requestTimeout}
+	if !allowPrivate {
+		dialer.Control = checkDial
+	}
+
+	return &Dispatcher{
+		storage: s,
+		client: &http.Client{
+			Timeout:   requestTimeout,
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		logger:       l,
+		allowPrivate: allowPrivate,
+	}
+}
+
+// NewEvent returns the event of the user with a random ID.
+func NewEvent(eventType string, userID int64, data interface{}) (*Event, error) {
+	id, err := secret.Generate()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't generate event id")
+	}
+
+	return &Event{ID: id, Type: eventType, UserID: userID, CreatedAt: time.Now().UTC(), Data: data}, nil
+}
+
+// Publish records deliveries of the event to every hook of its user
+// subscribed to it, they are sent by Run.
+func (d *Dispatcher) Publish(e *Event) error {
+	hooks, err := d.storage.FindSubscribed(e.UserID, e.Type)
+	if err != nil {
+		return errors.Wrapf(err, "can't find hooks of user with id: %v", e.UserID)
+	}
+
+	for _, h := range hooks {
+		if _, err = d.PublishTo(h, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PublishTo records the delivery of the event to the hook.
+func (d *Dispatcher) PublishTo(h *Hook, e *Event) (*Delivery, error) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't marshal event %v", e.Type)
+	}
+
+	dl := &Delivery{
+		HookID:        h.ID,
+		EventID:       e.ID,
+		EventType:     e.Type,
+		Payload:       payload,
+		Status:        StatusPending,
+		NextAttemptAt: nullTime(time.Now().UTC()),
+	}
+
+	err = d.storage.CreateDelivery(dl)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't create delivery of event %v to hook with id: %v", e.ID, h.ID)
+	}
+
+	return dl, nil
+}
+
+// Replay sends the delivery again with a fresh number of attempts.
+func (d *Dispatcher) Replay(dl *Delivery) error {
+	dl.Status = StatusPending
+	dl.Attempts = 0
+	dl.LastError = ""
+	dl.NextAttemptAt = nullTime(time.Now().UTC())
+
+	err := d.storage.UpdateDelivery(dl)
+	if err != nil {
+		return errors.Wrapf(err, "can't update delivery with id: %v", dl.ID)
+	}
+
+	return nil
+}
+
+// Run sends due deliveries every interval until quit is closed.
+func (d *Dispatcher) Run(quit <-chan bool, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		if err := d.DeliverDue(time.Now().UTC()); err != nil {
+			d.logger.Errorf("can't deliver webhooks: %v", err)
+		}
+
+		select {
+		case <-tick.C:
+		case <-quit:
+			return
+		}
+	}
+}
+
+// DeliverDue makes an attempt of every delivery due by the time.
+func (d *Dispatcher) DeliverDue(now time.Time) error {
+	deliveries, err := d.storage.DueDeliveries(now, maxDue)
+	if err != nil {
+		return errors.Wrap(err, "can't get due deliveries from storage")
+	}
+
+	for _, dl := range deliveries {
+		// the claim outlives the request, so the delivery isn't sent twice
+		claimed, err := d.storage.ClaimDelivery(dl, now.Add(2*requestTimeout))
+		if err != nil {
+			d.logger.Errorf("can't claim delivery with id: %v: %v", dl.ID, err)
+			continue
+		}
+
+		if !claimed {
+			continue
+		}
+
+		if err = d.attempt(dl, now); err != nil {
+			d.logger.Errorf("can't save attempt of delivery with id: %v: %v", dl.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *Dispatcher) attempt(dl *Delivery, now time.Time) error {
+	h, err := d.storage.FindHookByID(dl.HookID)
+	if err != nil {
+		return errors.Wrapf(err, "can't find hook with id: %v", dl.HookID)
+	}
+
+	dl.Attempts++
+
+	if h.Active {
+		dl.ResponseStatus, err = d.send(h, dl, now)
+	} else {
+		err = errors.New("hook is disabled")
+	}
+
+	switch {
+	case err == nil:
+		dl.Status = StatusDelivered
+		dl.LastError = ""
+		dl.NextAttemptAt = nil
+		dl.DeliveredAt = nullTime(now)
+	case dl.Attempts >= MaxAttempts || !h.Active:
+		dl.Status = StatusFailed
+		dl.LastError = err.Error()
+		dl.NextAttemptAt = nil
+	default:
+		dl.LastError = err.Error()
+		dl.NextAttemptAt = nullTime(now.Add(Backoff(dl.Attempts)))
+	}
+
+	return d.storage.UpdateDelivery(dl)
+}
+
+// Backoff is the delay after the failed attempt.
+func Backoff(attempt int) time.Duration {
+	return FirstRetry << uint(attempt-1)
+}
+
+// send posts the payload to the hook, responses other than 2xx are errors.
+func (d *Dispatcher) send(h *Hook, dl *Delivery, now time.Time) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(dl.Payload))
+	if err != nil {
+		return 0, errors.Wrap(err, "can't create request")
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, dl.EventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(dl.ID, 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(SignatureHeader, Sign(h.Secret, now, dl.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "can't send request")
+	}
+
+	defer resp.Body.Close()
+
+	// the body is drained so the connection is reused
+	const maxBody = 1 << 16
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxBody))
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return resp.StatusCode, errors.Errorf("receiver responded with status %v", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// nullTime keeps seconds as the storage does, deliveries are claimed by the exact time.
+func nullTime(t time.Time) *format.NullTime {
+	return &format.NullTime{V: sql.NullTime{Time: t.Truncate(time.Second), Valid: true}}
+}
@@ -0,0 +1,141 @@
+// Package webhook delivers events of robots to URLs registered by their
+// owners. Every request is signed with the secret of the hook: the
+// SignatureHeader holds the hex HMAC-SHA256 of the TimestampHeader value, a dot
+// and the body. Failed deliveries are retried with a growing delay.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"cw1/internal/format"
+	"cw1/internal/robot"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+const (
+	DealExecuted     = "deal.executed"
+	RobotActivated   = "robot.activated"
+	RobotDeactivated = "robot.deactivated"
+	RobotDeleted     = "robot.deleted"
+	PlanFinished     = "robot.plan_finished"
+	// Ping is sent only on request of the owner to check the hook.
+	Ping = "ping"
+)
+
+// Events are the types hooks can subscribe to.
+var Events = []string{DealExecuted, RobotActivated, RobotDeactivated, RobotDeleted, PlanFinished}
+
+func IsEvent(e string) bool {
+	for _, v := range Events {
+		if v == e {
+			return true
+		}
+	}
+
+	return false
+}
+
+const (
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Hook sends events of the types to the URL. Secret is shown only when the
+// hook is created.
+type Hook struct {
+	ID        int64            `json:"id"`
+	UserID    int64            `json:"user_id"`
+	URL       string           `json:"url"`
+	Events    []string         `json:"events"`
+	Secret    string           `json:"secret,omitempty"`
+	Active    bool             `json:"active"`
+	CreatedAt *format.NullTime `json:"created_at,omitempty"`
+}
+
+// Event is the body of a delivery. ID is the same in all deliveries and
+// retries of the event, so receivers can skip duplicates.
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	UserID    int64       `json:"-"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// DealData is the data of DealExecuted events.
+type DealData struct {
+	Robot *robot.Robot `json:"robot"`
+	Deal  *robot.Deal  `json:"deal"`
+}
+
+// Delivery is a record of the log of the hook. NextAttemptAt is null when
+// the delivery succeeded or ran out of attempts.
+type Delivery struct {
+	ID             int64            `json:"id"`
+	HookID         int64            `json:"hook_id"`
+	EventID        string           `json:"event_id"`
+	EventType      string           `json:"event_type"`
+	Payload        json.RawMessage  `json:"payload"`
+	Status         string           `json:"status"`
+	Attempts       int              `json:"attempts"`
+	ResponseStatus int              `json:"response_status,omitempty"`
+	LastError      string           `json:"last_error,omitempty"`
+	NextAttemptAt  *format.NullTime `json:"next_attempt_at,omitempty"`
+	DeliveredAt    *format.NullTime `json:"delivered_at,omitempty"`
+	CreatedAt      *format.NullTime `json:"created_at,omitempty"`
+}
+
+type Storage interface {
+	CreateHook(h *Hook) error
+	FindHookByID(id int64) (*Hook, error)
+	FindHooksByUserID(userID int64) ([]*Hook, error)
+	// FindSubscribed returns active hooks of the user subscribed to the event type.
+	FindSubscribed(userID int64, eventType string) ([]*Hook, error)
+	UpdateHook(h *Hook) error
+	DeleteHook(id int64) error
+
+	// CreateDelivery doesn't create a second delivery of the event to the hook,
+	// the ID of d stays zero then.
+	CreateDelivery(d *Delivery) error
+	FindDeliveryByID(id int64) (*Delivery, error)
+	FindDeliveries(hookID int64, limit int) ([]*Delivery, error)
+	// DueDeliveries returns pending deliveries which should be attempted by the time.
+	DueDeliveries(now time.Time, limit int) ([]*Delivery, error)
+	// ClaimDelivery postpones the next attempt until the time, it reports false
+	// when another dispatcher has claimed the delivery before.
+	ClaimDelivery(d *Delivery, until time.Time) (bool, error)
+	UpdateDelivery(d *Delivery) error
+}
+
+// Sign returns the signature of the body sent at the time.
+func Sign(secret string, ts time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and the timestamp headers of a received delivery.
+func Verify(secret string, timestamp string, signature string, body []byte) bool {
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	want := Sign(secret, time.Unix(sec, 0), body)
+
+	return hmac.Equal([]byte(want), []byte(signature))
+}
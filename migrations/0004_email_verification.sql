@@ -0,0 +1,30 @@
+-- accounts created before verification was introduced keep working, they're
+-- marked verified only when the column is added, so the migration can be rerun
+DO
+$$
+    BEGIN
+        IF NOT EXISTS(SELECT 1
+                      FROM information_schema.columns
+                      WHERE table_schema = current_schema()
+                        AND table_name = 'users'
+                        AND column_name = 'email_verified') THEN
+            ALTER TABLE users
+                ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT false;
+
+            UPDATE users SET email_verified = true;
+        END IF;
+    END
+$$;
+
+CREATE TABLE IF NOT EXISTS email_verifications
+(
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT      NOT NULL REFERENCES users (id),
+    email      TEXT        NOT NULL,
+    hash       TEXT        NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS email_verifications_user_id_idx ON email_verifications (user_id);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS two_factor
+(
+    user_id        BIGINT PRIMARY KEY REFERENCES users (id),
+    secret         TEXT        NOT NULL,
+    enabled        BOOLEAN     NOT NULL DEFAULT false,
+    last_used_step BIGINT      NOT NULL DEFAULT 0,
+    recovery_codes TEXT[]      NOT NULL DEFAULT '{}',
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS two_factor_challenges
+(
+    hash       TEXT PRIMARY KEY,
+    user_id    BIGINT      NOT NULL REFERENCES users (id),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at    TIMESTAMPTZ
+);
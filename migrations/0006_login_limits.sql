@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS login_limits
+(
+    key          TEXT PRIMARY KEY,
+    window_end   TIMESTAMPTZ NOT NULL,
+    hits         INT         NOT NULL DEFAULT 0,
+    failures     INT         NOT NULL DEFAULT 0,
+    locked_until TIMESTAMPTZ
+);
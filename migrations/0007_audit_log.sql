@@ -0,0 +1,30 @@
+-- entries are never updated or deleted, the hash chain lets reviewers detect it
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id          BIGSERIAL PRIMARY KEY,
+    actor_id    BIGINT      NOT NULL,
+    action      TEXT        NOT NULL,
+    target_type TEXT        NOT NULL,
+    target_id   BIGINT      NOT NULL,
+    ip          TEXT        NOT NULL,
+    user_agent  TEXT        NOT NULL,
+    diff        JSON        NOT NULL,
+    prev_hash   TEXT        NOT NULL,
+    hash        TEXT        NOT NULL UNIQUE,
+    created_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_actor_id_idx ON audit_log (actor_id);
+CREATE INDEX IF NOT EXISTS audit_log_target_idx ON audit_log (target_type, target_id);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS TRIGGER AS
+$$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE PROCEDURE audit_log_append_only();
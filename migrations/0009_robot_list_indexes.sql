@@ -0,0 +1,4 @@
+CREATE INDEX IF NOT EXISTS robots_owner_user_id_idx ON robots (owner_user_id, robot_id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS robots_ticker_idx ON robots (ticker) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS robots_fact_yield_idx ON robots ((COALESCE(fact_yield::float8, '-infinity')), robot_id);
+CREATE INDEX IF NOT EXISTS robots_deals_count_idx ON robots ((COALESCE(deals_count, 0)::bigint), robot_id);
@@ -0,0 +1,13 @@
+-- pending keeps the parameters of the parent waiting for approval in the approve mode
+CREATE TABLE IF NOT EXISTS robot_follows
+(
+    robot_id        BIGINT PRIMARY KEY REFERENCES robots (robot_id),
+    parent_robot_id BIGINT      NOT NULL REFERENCES robots (robot_id),
+    user_id         BIGINT      NOT NULL REFERENCES users (id),
+    mode            TEXT        NOT NULL,
+    sync_activation BOOLEAN     NOT NULL DEFAULT false,
+    pending         JSON,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS robot_follows_parent_robot_id_idx ON robot_follows (parent_robot_id);
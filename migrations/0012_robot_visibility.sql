@@ -0,0 +1,5 @@
+-- robots are private until their owners share them
+ALTER TABLE robots
+    ADD COLUMN IF NOT EXISTS visibility TEXT NOT NULL DEFAULT 'private';
+
+CREATE INDEX IF NOT EXISTS robots_public_idx ON robots (robot_id) WHERE visibility = 'public';
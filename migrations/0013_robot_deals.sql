@@ -0,0 +1,12 @@
+-- history of deals starts with this migration, earlier deals are only counted in robots totals
+CREATE TABLE IF NOT EXISTS robot_deals
+(
+    id         BIGSERIAL PRIMARY KEY,
+    robot_id   BIGINT           NOT NULL REFERENCES robots (robot_id),
+    buy_price  DOUBLE PRECISION NOT NULL,
+    sell_price DOUBLE PRECISION NOT NULL,
+    yield      DOUBLE PRECISION NOT NULL,
+    created_at TIMESTAMPTZ      NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS robot_deals_created_at_idx ON robot_deals (created_at, robot_id);
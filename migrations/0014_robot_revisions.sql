@@ -0,0 +1,35 @@
+-- revisions are never updated or deleted
+CREATE TABLE IF NOT EXISTS robot_revisions
+(
+    robot_id   BIGINT      NOT NULL REFERENCES robots (robot_id),
+    rev        BIGINT      NOT NULL,
+    ticker     TEXT,
+    buy_price  DOUBLE PRECISION,
+    sell_price DOUBLE PRECISION,
+    plan_start TIMESTAMPTZ,
+    plan_end   TIMESTAMPTZ,
+    plan_yield DOUBLE PRECISION,
+    author_id  BIGINT      NOT NULL REFERENCES users (id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (robot_id, rev)
+);
+
+-- the current parameters of existing robots are their first revision
+INSERT INTO robot_revisions (robot_id, rev, ticker, buy_price, sell_price, plan_start, plan_end, plan_yield,
+                             author_id, created_at)
+SELECT robot_id, 1, ticker, buy_price, sell_price, plan_start, plan_end, plan_yield, owner_user_id,
+       COALESCE(created_at, now())
+FROM robots
+ON CONFLICT DO NOTHING;
+
+CREATE OR REPLACE FUNCTION robot_revisions_append_only() RETURNS TRIGGER AS
+$$
+BEGIN
+    RAISE EXCEPTION 'robot_revisions is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS robot_revisions_append_only ON robot_revisions;
+CREATE TRIGGER robot_revisions_append_only
+    BEFORE UPDATE OR DELETE ON robot_revisions
+    FOR EACH ROW EXECUTE PROCEDURE robot_revisions_append_only();
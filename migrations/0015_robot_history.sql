@@ -0,0 +1,20 @@
+-- totals of robots purged after the retention period
+CREATE TABLE IF NOT EXISTS robot_history
+(
+    robot_id      BIGINT PRIMARY KEY,
+    owner_user_id BIGINT      NOT NULL REFERENCES users (id),
+    ticker        TEXT,
+    fact_yield    DOUBLE PRECISION,
+    deals_count   BIGINT,
+    wins          BIGINT      NOT NULL,
+    created_at    TIMESTAMPTZ,
+    deleted_at    TIMESTAMPTZ NOT NULL,
+    purged_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS robot_history_owner_user_id_idx ON robot_history (owner_user_id);
+CREATE INDEX IF NOT EXISTS robots_deleted_at_idx ON robots (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- revisions outlive purged robots
+ALTER TABLE robot_revisions
+    DROP CONSTRAINT IF EXISTS robot_revisions_robot_id_fkey;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS tags
+(
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT      NOT NULL REFERENCES users (id),
+    name       TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS robot_tags
+(
+    robot_id BIGINT NOT NULL REFERENCES robots (robot_id) ON DELETE CASCADE,
+    tag_id   BIGINT NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (robot_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS robot_tags_tag_id_idx ON robot_tags (tag_id);
@@ -0,0 +1,15 @@
+-- owner_user_id is the author of the template, global templates are shared with all users
+CREATE TABLE IF NOT EXISTS robot_templates
+(
+    id            BIGSERIAL PRIMARY KEY,
+    owner_user_id BIGINT           NOT NULL REFERENCES users (id),
+    global        BOOLEAN          NOT NULL DEFAULT false,
+    name          TEXT             NOT NULL,
+    buy_percent   DOUBLE PRECISION NOT NULL,
+    sell_percent  DOUBLE PRECISION NOT NULL,
+    plan_seconds  BIGINT           NOT NULL,
+    plan_yield    DOUBLE PRECISION NOT NULL,
+    created_at    TIMESTAMPTZ      NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS robot_templates_owner_user_id_idx ON robot_templates (owner_user_id);
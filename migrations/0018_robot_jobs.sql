@@ -0,0 +1,17 @@
+-- jobs activate or deactivate robots once at next_run_at or by the cron expression,
+-- next_run_at is null when a one-off job has run
+CREATE TABLE IF NOT EXISTS robot_jobs
+(
+    id          BIGSERIAL PRIMARY KEY,
+    robot_id    BIGINT      NOT NULL REFERENCES robots (robot_id) ON DELETE CASCADE,
+    user_id     BIGINT      NOT NULL REFERENCES users (id),
+    action      TEXT        NOT NULL CHECK (action IN ('activate', 'deactivate')),
+    cron        TEXT        NOT NULL DEFAULT '',
+    next_run_at TIMESTAMPTZ,
+    last_run_at TIMESTAMPTZ,
+    last_error  TEXT        NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS robot_jobs_robot_id_idx ON robot_jobs (robot_id);
+CREATE INDEX IF NOT EXISTS robot_jobs_next_run_at_idx ON robot_jobs (next_run_at) WHERE next_run_at IS NOT NULL;